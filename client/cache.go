@@ -0,0 +1,80 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cachedResponse is a response body saved on disk with the ETag it was returned with.
+type cachedResponse struct {
+	Url  string `json:"url"`
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// cacheDir returns the directory fioctl keeps its cached data in.
+func cacheDir(elem ...string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(append([]string{dir, "fioctl"}, elem...)...)
+}
+
+func responseCacheFile(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return cacheDir("responses", hex.EncodeToString(sum[:])+".json")
+}
+
+// getCached is Get for large resources which rarely change. The response is saved on disk, and
+// only downloaded again when the server reports it changed, using its ETag. The cached body is
+// only as trustworthy as a downloaded one, so callers must verify it the same way.
+func (a *Api) getCached(url string) (*[]byte, error) {
+	cacheFile := responseCacheFile(url)
+	var cached cachedResponse
+	headers := make(map[string]string)
+	if buf, err := os.ReadFile(cacheFile); err == nil {
+		if err = json.Unmarshal(buf, &cached); err == nil && cached.Url == url && len(cached.ETag) > 0 {
+			headers["If-None-Match"] = cached.ETag
+		}
+	}
+
+	res, err := a.RawGet(url, &headers)
+	log := logrus.WithFields(logrus.Fields{"url": url, "method": "GET"})
+	if err != nil {
+		log.Debugf("Network Error: %s", err)
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		log.Debugf("Using the cached response from %s", cacheFile)
+		return &cached.Body, nil
+	}
+	body, err := readResponse(res, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if etag := res.Header.Get("ETag"); len(etag) > 0 {
+		buf, err := json.Marshal(cachedResponse{Url: url, ETag: etag, Body: *body})
+		if err == nil {
+			if err = os.MkdirAll(filepath.Dir(cacheFile), 0700); err == nil {
+				err = os.WriteFile(cacheFile, buf, 0600)
+			}
+		}
+		if err != nil {
+			log.Debugf("Unable to cache the response: %s", err)
+		}
+	} else if err := os.Remove(cacheFile); err != nil && !os.IsNotExist(err) {
+		log.Debugf("Unable to remove a stale cached response: %s", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,20 @@
+// Package client implements the Foundries.io REST API used by fioctl.
+//
+// It can be imported by other Go programs. The supported API surface is:
+//
+//   - NewClient creates an Api for a server, e.g. https://api.foundries.io,
+//     authenticated by the Config.Token or the Config.ClientCredentials.
+//     Unlike NewApiClient, it never exits the program and does not read any global configuration.
+//   - Api.WithContext returns a copy of the client which makes all requests with the given context.
+//   - The exported Api methods, e.g. DeviceList, TargetsList, FactoryCreateWave.
+//     They return errors rather than exiting; use AsHttpError to inspect HTTP status codes.
+//   - The TUF signing helpers: ParseTufKeyType, GenTufKeyId, LoadOfflineCreds, SaveOfflineCreds,
+//     SaveOfflineCredsCopy, OfflineCredsTimes, FindTufSigner, SignTufMeta, and SignTufRoot. FindTufSigner asks
+//     the TufSignerOptions.Passphrase for the passphrases of keys encrypted with EncryptTufKey. Keys held outside
+//     of the offline TUF keys, e.g. by Api.NewVaultTransitSigner, Api.NewAwsKmsSigner, Api.NewGcpKmsSigner,
+//     or Api.NewAzureKeyVaultSigner, are passed in the TufSignerOptions.ExternalSigners. Api.GcpAccessToken and Api.AzureAccessToken get the tokens used by
+//     the Google Cloud KMS and Azure Key Vault signers. These requests use the context and the CA certificates of the Api.
+//   - The TUF verification helpers: VerifyTufRoot, VerifyTufTargets, VerifyTufMetadata, and TufPinStore.
+//
+// Other exported symbols are used by the fioctl commands and may change without notice.
+package client
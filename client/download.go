@@ -0,0 +1,272 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DownloadItem is a single file downloaded by the Downloader.
+type DownloadItem struct {
+	Url string
+	// Path is a file to save the content to. The partially downloaded content is kept in
+	// the Path + ".part" file, so that an interrupted download is resumed where it stopped.
+	Path string
+	// Writer is used instead of the Path to stream the content, e.g. to STDOUT.
+	// Such downloads can not be resumed, and are only retried if nothing was written yet.
+	Writer io.Writer
+	// Sha256 is an optional hex encoded digest the content is verified against.
+	// It is set to the actual digest of the content after a successful download.
+	Sha256 string
+	// Err is set when the item failed to download.
+	Err error
+
+	size     int64
+	received int64
+	written  bool
+}
+
+// Downloader downloads files in parallel, retrying and resuming failed downloads,
+// and verifying their SHA256 digests. An overall progress is printed to the Progress writer.
+type Downloader struct {
+	Concurrency int
+	Retries     int
+	Progress    io.Writer
+
+	api     *Api
+	lock    sync.Mutex
+	items   []*DownloadItem
+	done    int
+	lastMsg time.Time
+}
+
+func (a *Api) NewDownloader() *Downloader {
+	return &Downloader{Concurrency: 4, Retries: 3, Progress: os.Stderr, api: a}
+}
+
+// Download downloads all items, and returns the first error if any of them failed.
+// Errors of each item are available in its Err field.
+func (d *Downloader) Download(items ...*DownloadItem) error {
+	d.items = items
+	d.done = 0
+	sem := make(chan bool, d.Concurrency)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		sem <- true
+		go func(item *DownloadItem) {
+			defer wg.Done()
+			item.Err = d.downloadWithRetries(item)
+			d.lock.Lock()
+			d.done += 1
+			d.lock.Unlock()
+			d.printProgress(true)
+			<-sem
+		}(item)
+	}
+	wg.Wait()
+	if d.Progress != nil {
+		fmt.Fprintln(d.Progress)
+	}
+
+	for _, item := range items {
+		if item.Err != nil {
+			return item.Err
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) downloadWithRetries(item *DownloadItem) error {
+	var err error
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if attempt > 0 {
+			logrus.Debugf("Retrying download of %s after an error: %s", item.Url, err)
+			select {
+			case <-d.api.ctx.Done():
+				return d.api.ctx.Err()
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		var retry bool
+		if retry, err = d.download(item); err == nil || !retry {
+			return err
+		}
+		if item.Writer != nil && item.written {
+			// The content was already partially streamed, it can not be taken back
+			return err
+		}
+	}
+	return err
+}
+
+// download makes a single attempt to download an item, and returns whether it is worth to retry on error.
+func (d *Downloader) download(item *DownloadItem) (bool, error) {
+	digest := sha256.New()
+	headers := make(map[string]string)
+	var offset int64
+	var part string
+	if item.Writer == nil {
+		part = item.Path + ".part"
+		if st, err := os.Stat(part); err == nil && st.Size() > 0 {
+			offset = st.Size()
+			headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		}
+	}
+
+	res, err := d.api.RawGet(item.Url, &headers)
+	if err != nil {
+		return !errors.Is(err, context.Canceled), err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		logrus.Debugf("Resuming download of %s from %d bytes", item.Url, offset)
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file is not valid for this content anymore, start over
+		if err := os.Remove(part); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("Unable to resume download of %s", item.Url)
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		// The server might ignore the range request and send the whole content
+		offset = 0
+	default:
+		msg := fmt.Sprintf("HTTP error during GET '%s': %s", item.Url, res.Status)
+		return res.StatusCode >= 500, &HttpError{msg, res}
+	}
+
+	var out io.Writer
+	if item.Writer != nil {
+		out = item.Writer
+	} else {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if offset > 0 {
+			flags = os.O_CREATE | os.O_RDWR
+		}
+		f, err := os.OpenFile(part, flags, 0644)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		if offset > 0 {
+			// Hash the previously downloaded content and continue writing after it
+			if _, err := io.CopyN(digest, f, offset); err != nil {
+				return false, err
+			}
+		}
+		out = f
+	}
+
+	d.setSize(item, offset, res.ContentLength)
+	written, err := io.Copy(io.MultiWriter(out, digest, &downloadProgress{d, item}), res.Body)
+	if err != nil {
+		return true, err
+	}
+	if res.ContentLength >= 0 && written != res.ContentLength {
+		return true, fmt.Errorf("Read %d bytes of %s, expected %d bytes", written, item.Url, res.ContentLength)
+	}
+
+	if err := verifyDigest(item, res, digest); err != nil {
+		if item.Writer == nil {
+			if rerr := os.Remove(part); rerr != nil {
+				return false, rerr
+			}
+		}
+		return true, err
+	}
+	if item.Writer == nil {
+		if c, ok := out.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return false, err
+			}
+		}
+		return false, os.Rename(part, item.Path)
+	}
+	return false, nil
+}
+
+// verifyDigest checks the content against an expected SHA256 digest, or a "Digest: sha-256=..." header if sent by the server.
+func verifyDigest(item *DownloadItem, res *http.Response, digest hash.Hash) error {
+	actual := digest.Sum(nil)
+	expected := item.Sha256
+	if len(expected) == 0 {
+		for _, val := range strings.Split(res.Header.Get("Digest"), ",") {
+			val = strings.TrimSpace(val)
+			if strings.HasPrefix(strings.ToLower(val), "sha-256=") {
+				if raw, err := base64.StdEncoding.DecodeString(val[len("sha-256="):]); err == nil {
+					expected = hex.EncodeToString(raw)
+				}
+			}
+		}
+	}
+	actualHex := hex.EncodeToString(actual)
+	if len(expected) > 0 && !strings.EqualFold(expected, actualHex) {
+		return fmt.Errorf("Checksum mismatch for %s: expected sha256 %s, got %s", item.Url, expected, actualHex)
+	}
+	item.Sha256 = actualHex
+	return nil
+}
+
+func (d *Downloader) setSize(item *DownloadItem, offset, length int64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	item.received = offset
+	if length >= 0 {
+		item.size = offset + length
+	}
+}
+
+type downloadProgress struct {
+	d    *Downloader
+	item *DownloadItem
+}
+
+func (p *downloadProgress) Write(buf []byte) (int, error) {
+	p.d.lock.Lock()
+	p.item.received += int64(len(buf))
+	p.item.written = true
+	p.d.lock.Unlock()
+	p.d.printProgress(false)
+	return len(buf), nil
+}
+
+func (d *Downloader) printProgress(force bool) {
+	if d.Progress == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := time.Now()
+	if !force && now.Sub(d.lastMsg) < time.Second {
+		return
+	}
+	d.lastMsg = now
+
+	var total, current int64
+	for _, item := range d.items {
+		total += item.size
+		current += item.received
+	}
+	width := int64(20)
+	filled := width
+	if total > 0 && current < total {
+		filled = current * width / total
+	}
+	fmt.Fprintf(d.Progress, "[%s%s] %d of %d bytes, %d of %d files\r",
+		strings.Repeat("=", int(filled)), strings.Repeat(" ", int(width-filled)),
+		current, total, d.done, len(d.items))
+}
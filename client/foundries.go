@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -25,6 +26,11 @@ type Config struct {
 	Token             string
 	ClientCredentials OAuthConfig
 	ExtraHeaders      map[string]string
+	DebugHttp         bool
+	// Record API mutations into this file instead of sending them
+	PlanOut string
+	// Verify TUF metadata against the roots pinned in this directory
+	TufPinDir string
 }
 
 type Api struct {
@@ -32,6 +38,10 @@ type Api struct {
 	config    Config
 	client    http.Client
 	clientVer string
+	ctx       context.Context
+	trust     *tufTrust
+	// Used for requests to external key stores, like AWS KMS or Vault
+	keyStoreClient http.Client
 }
 
 type ConfigFile struct {
@@ -221,12 +231,27 @@ type FactoryTeamDetails struct {
 }
 
 type JobservBuild struct {
-	ID int `json:"build_id"`
+	ID          int    `json:"build_id"`
+	Url         string `json:"url,omitempty"`
+	Status      string `json:"status,omitempty"`
+	TriggerName string `json:"trigger_name,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Created     string `json:"created,omitempty"`
+	Completed   string `json:"completed,omitempty"`
+}
+
+type JobservBuildList struct {
+	Builds []JobservBuild `json:"builds"`
+	Total  int            `json:"total"`
+	Next   *string        `json:"next"`
 }
 
 type JobservRun struct {
 	Name      string   `json:"name"`
 	Url       string   `json:"url"`
+	Status    string   `json:"status,omitempty"`
+	Created   string   `json:"created,omitempty"`
+	Completed string   `json:"completed,omitempty"`
 	Artifacts []string `json:"artifacts"`
 }
 
@@ -490,7 +515,49 @@ func (d Device) Online(inactiveHoursThreshold int) bool {
 	return true
 }
 
+// NewApiClient creates an API client, exiting the program if the CA certificate file can not be read.
+// Programs using this package as a library should use NewClient instead.
 func NewApiClient(serverUrl string, config Config, caCertPath string, version string) *Api {
+	api, err := NewClient(serverUrl, config, caCertPath, version)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return api
+}
+
+// NewClient creates an API client for the given server, e.g. https://api.foundries.io.
+// The caCertPath is an optional path to additional CA certificates to trust.
+// The version is sent to the server in the User-Agent header.
+func NewClient(serverUrl string, config Config, caCertPath string, version string) (*Api, error) {
+	base, err := newBaseTransport(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	api := Api{
+		serverUrl: strings.TrimRight(serverUrl, "/"),
+		config:    config,
+		clientVer: version,
+		ctx:       context.Background(),
+		trust:     &tufTrust{roots: make(map[string]*AtsTufRoot)},
+	}
+	var transport http.RoundTripper = base
+	if config.DebugHttp {
+		transport = &tracingTransport{transport}
+	}
+	transport = newRateLimitTransport(transport)
+	if len(config.PlanOut) > 0 {
+		transport = newPlanTransport(transport, api.serverUrl, config.PlanOut, config)
+	}
+	api.client.Transport = transport
+
+	api.keyStoreClient = http.Client{Transport: base, Timeout: keyStoreTimeout}
+	return &api, nil
+}
+
+// newBaseTransport returns an HTTP transport trusting the system CA certificates,
+// and the optional additional CA certificates from the caCertPath.
+func newBaseTransport(caCertPath string) (*http.Transport, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
 	if len(caCertPath) > 0 {
 		rootCAs, _ := x509.SystemCertPool()
 		if rootCAs == nil {
@@ -499,24 +566,25 @@ func NewApiClient(serverUrl string, config Config, caCertPath string, version st
 
 		certs, err := os.ReadFile(caCertPath)
 		if err != nil {
-			logrus.Fatalf("Failed to append %q to RootCAs: %v", caCertPath, err)
+			return nil, fmt.Errorf("Failed to append %q to RootCAs: %w", caCertPath, err)
 		}
 
 		if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
 			logrus.Warning("No certs appended, using system certs only")
 		}
 
-		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{
+		base.TLSClientConfig = &tls.Config{
 			RootCAs: rootCAs,
 		}
-
-	}
-	api := Api{
-		serverUrl: strings.TrimRight(serverUrl, "/"),
-		config:    config,
-		client:    *http.DefaultClient,
-		clientVer: version,
 	}
+	return base, nil
+}
+
+// WithContext returns a copy of the client which makes all requests with the given context.
+// This allows to cancel requests, or to set a deadline for them.
+func (a *Api) WithContext(ctx context.Context) *Api {
+	api := *a
+	api.ctx = ctx
 	return &api
 }
 
@@ -663,7 +731,7 @@ func (a *Api) GetOauthConfig() OAuthConfig {
 }
 
 func (a *Api) RawGet(url string, headers *map[string]string) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -691,7 +759,7 @@ func (a *Api) Get(url string) (*[]byte, error) {
 }
 
 func (a *Api) Patch(url string, data []byte) (*[]byte, error) {
-	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodPatch, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
@@ -709,7 +777,7 @@ func (a *Api) Patch(url string, data []byte) (*[]byte, error) {
 }
 
 func (a *Api) RawPost(url string, data []byte, headers *map[string]string) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodPost, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
@@ -735,7 +803,7 @@ func (a *Api) Post(url string, data []byte) (*[]byte, error) {
 }
 
 func (a *Api) Put(url string, data []byte) (*[]byte, error) {
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodPut, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
@@ -753,7 +821,7 @@ func (a *Api) Put(url string, data []byte) (*[]byte, error) {
 }
 
 func (a *Api) Delete(url string, data []byte) (*[]byte, error) {
-	req, err := http.NewRequest(http.MethodDelete, url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodDelete, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
@@ -784,9 +852,9 @@ func (a *Api) DeviceGet(factory, device string) (*Device, error) {
 	return &d, nil
 }
 
-func (a *Api) DeviceList(
+func (a *Api) deviceListUrl(
 	mine bool, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget string, page, limit int,
-) (*DeviceList, error) {
+) string {
 	mineInt := 0
 	if mine {
 		mineInt = 1
@@ -795,6 +863,13 @@ func (a *Api) DeviceList(
 	url += fmt.Sprintf(
 		"mine=%d&match_tag=%s&name_ilike=%s&factory=%s&uuid=%s&group=%s&target_name=%s&page=%d&limit=%d",
 		mineInt, matchTag, nameIlike, byFactory, uuid, byGroup, byTarget, page, limit)
+	return url
+}
+
+func (a *Api) DeviceList(
+	mine bool, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget string, page, limit int,
+) (*DeviceList, error) {
+	url := a.deviceListUrl(mine, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget, page, limit)
 	logrus.Debugf("DeviceList with url: %s", url)
 	return a.DeviceListCont(url)
 }
@@ -1167,6 +1242,15 @@ func (a *Api) GetWireGuardIps(factory string) ([]WireGuardIp, error) {
 }
 
 func (a *Api) TufMetadataGet(factory string, metadata string, tag string, prod bool) (*[]byte, error) {
+	body, err := a.TufMetadataGetRaw(factory, metadata, tag, prod)
+	if err == nil && metadata == "targets.json" {
+		err = a.verifyTufTargets(factory, prod, *body)
+	}
+	return body, err
+}
+
+// TufMetadataGetRaw returns the TUF metadata served to the devices following the tag, without verifying it.
+func (a *Api) TufMetadataGetRaw(factory string, metadata string, tag string, prod bool) (*[]byte, error) {
 	url := a.serverUrl + "/ota/repo/" + factory + "/api/v1/user_repo/" + metadata + "?tag=" + tag
 	if prod {
 		url += "&production=1"
@@ -1204,7 +1288,11 @@ func (a *Api) TufTargetMetadataRefresh(factory string, target string, tag string
 
 func (a *Api) TargetsListRaw(factory string) (*[]byte, error) {
 	url := a.serverUrl + "/ota/repo/" + factory + "/api/v1/user_repo/targets.json"
-	return a.Get(url)
+	body, err := a.Get(url)
+	if err == nil {
+		err = a.verifyTufTargets(factory, false, *body)
+	}
+	return body, err
 }
 
 func (a *Api) TargetGet(factory string, targetName string) (*tuf.FileMeta, error) {
@@ -1275,7 +1363,7 @@ func (t *Target) DeriveTarget(newVer int) *Target {
 
 func (a *Api) TargetsPut(factory string, data []byte) (string, string, error) {
 	url := a.serverUrl + "/ota/factories/" + factory + "/targets/"
-	resp, err := a.Put(url, data)
+	resp, err := a.PutChunked(url, data)
 	if err != nil {
 		return "", "", err
 	}
@@ -1456,6 +1544,75 @@ func (a *Api) JobservLatestBuild(factory string, successful bool) (*JobservBuild
 	return &latestBuild.Data.Build, nil
 }
 
+func (a *Api) JobservBuild(factory string, build int) (*JobservBuild, error) {
+	url := a.serverUrl + "/projects/" + factory + "/lmp/builds/" + strconv.Itoa(build) + "/"
+	logrus.Debugf("JobservBuild with url: %s", url)
+	b, err := a.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	jsonified := struct {
+		Data struct {
+			Build JobservBuild `json:"build"`
+		} `json:"data"`
+	}{}
+	if err = json.Unmarshal(*b, &jsonified); err != nil {
+		return nil, err
+	}
+	return &jsonified.Data.Build, nil
+}
+
+func (a *Api) JobservBuilds(factory string, limit, page int) (*JobservBuildList, error) {
+	url := a.serverUrl + "/projects/" + factory + "/lmp/builds/?limit=" + strconv.Itoa(limit) + "&page=" + strconv.Itoa(page)
+	logrus.Debugf("JobservBuilds with url: %s", url)
+	body, err := a.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	type Jsonified struct {
+		Data JobservBuildList `json:"data"`
+	}
+
+	var jsonified Jsonified
+	err = json.Unmarshal(*body, &jsonified)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonified.Data, nil
+}
+
+// JobservBuildTrigger queues a new CI build using the factory's trigger of a given name.
+// The params are passed to the build as environment variables, e.g. revisions to build from.
+func (a *Api) JobservBuildTrigger(factory, trigger string, params map[string]string) (*JobservBuild, error) {
+	url := a.serverUrl + "/projects/" + factory + "/lmp/builds/"
+	logrus.Debugf("JobservBuildTrigger with url: %s", url)
+	data, err := json.Marshal(map[string]interface{}{
+		"trigger-name": trigger,
+		"params":       params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	body, err := a.Post(url, data)
+	if err != nil {
+		return nil, err
+	}
+
+	type Jsonified struct {
+		Data struct {
+			Build JobservBuild `json:"build"`
+		} `json:"data"`
+	}
+
+	var jsonified Jsonified
+	err = json.Unmarshal(*body, &jsonified)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonified.Data.Build, nil
+}
+
 func (a *Api) JobservRuns(factory string, build int) ([]JobservRun, error) {
 	url := a.serverUrl + "/projects/" + factory + "/lmp/builds/" + strconv.Itoa(build) + "/runs/"
 	logrus.Debugf("JobservRuns with url: %s", url)
@@ -1499,8 +1656,12 @@ func (a *Api) JobservRun(runUrl string) (*JobservRun, error) {
 	return &jsonified.Data.Run, nil
 }
 
+func (a *Api) JobservRunArtifactUrl(factory string, build int, run string, artifact string) string {
+	return a.serverUrl + "/projects/" + factory + "/lmp/builds/" + strconv.Itoa(build) + "/runs/" + run + "/" + artifact
+}
+
 func (a *Api) JobservRunArtifact(factory string, build int, run string, artifact string) (*http.Response, error) {
-	url := a.serverUrl + "/projects/" + factory + "/lmp/builds/" + strconv.Itoa(build) + "/runs/" + run + "/" + artifact
+	url := a.JobservRunArtifactUrl(factory, build, run, artifact)
 	logrus.Debugf("JobservRunArtifact with url: %s", url)
 	return a.RawGet(url, nil)
 }
@@ -1511,43 +1672,13 @@ func (a *Api) JobservTailRun(factory string, build int, run string, artifact str
 }
 
 func (a *Api) JobservTail(url string) {
-	offset := 0
-	status := ""
-	for {
-		headers := map[string]string{"X-OFFSET": strconv.Itoa(offset)}
-		resp, err := a.RawGet(url, &headers)
-		if err != nil {
-			fmt.Printf("TODO LOG ERROR OR SOMETHING: %s\n", err)
-		}
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Printf("Unable to read body resp: %s", err)
-		}
-		if resp.StatusCode != 200 {
-			fmt.Printf("Unable to get '%s': HTTP_%d\n=%s", url, resp.StatusCode, body)
-			return
-		}
-
-		newstatus := resp.Header.Get("X-RUN-STATUS")
-		if newstatus == "QUEUED" {
-			if status == "" {
-				os.Stdout.Write(body)
-			} else {
-				os.Stdout.WriteString(".")
-			}
-		} else if len(newstatus) == 0 {
-			body = body[offset:]
-			os.Stdout.Write(body)
-			return
-		} else {
-			if newstatus != status {
-				color.New(color.FgGreen).Printf("\n--- Status change: %s -> %s\n", status, newstatus)
-			}
-			os.Stdout.Write(body)
-			offset += len(body)
-		}
-		status = newstatus
-		time.Sleep(5 * time.Second)
+	r := a.NewJobservLogReader(url)
+	defer r.Close()
+	r.OnStatus = func(from, to string) {
+		color.New(color.FgGreen).Printf("\n--- Status change: %s -> %s\n", from, to)
+	}
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		fmt.Printf("Unable to follow '%s': %s\n", url, err)
 	}
 }
 
@@ -1653,7 +1784,7 @@ func (a *Api) FactoryCreateWave(factory string, wave *WaveCreate) error {
 		return err
 	}
 
-	_, err = a.Post(url, data)
+	_, err = a.PostChunked(url, data)
 	return err
 }
 
@@ -1735,7 +1866,8 @@ func (a *Api) ProdTargetsList(factory string, failNotExist bool, tags ...string)
 	url := a.serverUrl + "/ota/factories/" + factory + "/prod-targets/?tag=" + strings.Join(tags, ",")
 	logrus.Debugf("Fetching factory production targets %s", url)
 
-	body, err := a.Get(url)
+	// Production targets of all tags can be large, and are fetched several times during key operations
+	body, err := a.getCached(url)
 	if err != nil {
 		if !failNotExist {
 			if herr := AsHttpError(err); herr != nil && herr.Response.StatusCode == 404 {
@@ -1745,9 +1877,22 @@ func (a *Api) ProdTargetsList(factory string, failNotExist bool, tags ...string)
 		return nil, err
 	}
 
+	raw := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(*body, &raw); err != nil {
+		return nil, err
+	}
 	resp := make(map[string]AtsTufTargets)
-	err = json.Unmarshal(*body, &resp)
-	return resp, err
+	for tag, meta := range raw {
+		if err := a.verifyTufTargets(factory, true, meta); err != nil {
+			return nil, fmt.Errorf("Production targets for tag %s: %w", tag, err)
+		}
+		targets := AtsTufTargets{}
+		if err := json.Unmarshal(meta, &targets); err != nil {
+			return nil, err
+		}
+		resp[tag] = targets
+	}
+	return resp, nil
 }
 
 func (a *Api) ProdTargetsGet(factory string, tag string, failNotExist bool) (*AtsTufTargets, error) {
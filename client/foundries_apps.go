@@ -0,0 +1,45 @@
+package client
+
+import (
+	"encoding/json"
+
+	tuf "github.com/theupdateframework/notary/tuf/data"
+)
+
+const AppSignatureType = "ComposeAppSignature"
+
+// AppSignatureMeta is the signed statement of an app signature: that the app bundle with the
+// given URI, and so the manifest digest, was approved by holders of the offline targets keys.
+type AppSignatureMeta struct {
+	Type     string `json:"_type"`
+	App      string `json:"app"`
+	Uri      string `json:"uri"`
+	Version  string `json:"version"`
+	SignedAt string `json:"signed-at"`
+}
+
+// AppSignature is an offline-key signature attached to a compose app bundle manifest.
+type AppSignature struct {
+	Signatures []tuf.Signature  `json:"signatures"`
+	Signed     AppSignatureMeta `json:"signed"`
+}
+
+func (a *Api) appSignatureUrl(factory string, app ComposeApp) string {
+	return a.serverUrl + "/ota/factories/" + factory + "/compose-apps/" + app.Name() + "/signatures/" + app.Hash() + "/"
+}
+
+// AppSignaturePut attaches a signature to the manifest of an app, replacing a previous one.
+func (a *Api) AppSignaturePut(factory string, app ComposeApp, sig AppSignature) error {
+	data, err := json.Marshal(sig)
+	if err != nil {
+		return err
+	}
+	_, err = a.Put(a.appSignatureUrl(factory, app), data)
+	return err
+}
+
+// AppSignatureGetRaw returns the signature attached to the manifest of an app as is,
+// so that it can be verified over the exact signed content.
+func (a *Api) AppSignatureGetRaw(factory string, app ComposeApp) (*[]byte, error) {
+	return a.Get(a.appSignatureUrl(factory, app))
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TufDelegation is a delegated targets role: its keys may sign the targets matching its path patterns.
+type TufDelegation struct {
+	Name        string   `json:"name"`
+	KeyIDs      []string `json:"keyids"`
+	Paths       []string `json:"paths"`
+	Threshold   int      `json:"threshold"`
+	Terminating bool     `json:"terminating"`
+}
+
+// TufDelegations are the delegations of the factory's targets metadata, in the format of TUF targets.json.
+type TufDelegations struct {
+	Keys  map[string]AtsKey `json:"keys"`
+	Roles []TufDelegation   `json:"roles"`
+}
+
+func (a *Api) TufDelegationsGet(factory string) (*TufDelegations, error) {
+	url := a.serverUrl + "/ota/repo/" + factory + "/api/v1/user_repo/trusted-delegations"
+	logrus.Debugf("TufDelegationsGet with url: %s", url)
+	body, err := a.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	var delegations TufDelegations
+	err = json.Unmarshal(*body, &delegations)
+	return &delegations, err
+}
+
+// TufDelegationsPut replaces the delegations of the factory's targets metadata, which is then re-signed by the server.
+func (a *Api) TufDelegationsPut(factory string, delegations TufDelegations) error {
+	url := a.serverUrl + "/ota/repo/" + factory + "/api/v1/user_repo/trusted-delegations"
+	logrus.Debugf("TufDelegationsPut with url: %s", url)
+	data, err := json.Marshal(delegations)
+	if err != nil {
+		return err
+	}
+	_, err = a.Put(url, data)
+	return err
+}
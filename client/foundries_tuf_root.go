@@ -183,11 +183,13 @@ func (a *Api) TufRootUpdatesPut(
 		ProdRoot          *AtsTufRoot                `json:"prod-root"`
 		TargetsSignatures map[string][]tuf.Signature `json:"targets-signatures,omitempty"`
 	}{txid, ciRoot, prodRoot, targetsSigs})
-	_, err = a.Put(url, data)
+	_, err = a.PutChunked(url, data)
 	return
 }
 
-func (a *Api) tufRootGet(factory string, prod bool, version int) (*AtsTufRoot, error) {
+// TufRootGetRaw returns the root metadata exactly as stored on the server.
+// The latest version is returned when the version is not positive.
+func (a *Api) TufRootGetRaw(factory string, prod bool, version int) (*[]byte, error) {
 	url := a.serverUrl + "/ota/repo/" + factory + "/api/v1/user_repo/"
 	if version > 0 {
 		url += fmt.Sprintf("%d.", version)
@@ -197,7 +199,21 @@ func (a *Api) tufRootGet(factory string, prod bool, version int) (*AtsTufRoot, e
 		url += "?production=1"
 	}
 	logrus.Debugf("Fetch root %s", url)
-	body, err := a.Get(url)
+	return a.Get(url)
+}
+
+func (a *Api) tufRootGet(factory string, prod bool, version int) (*AtsTufRoot, error) {
+	if version <= 0 && a.tufPinningEnabled() {
+		// The latest root must be verified against the pinned root, so that it can be trusted during signing
+		_, raw, err := a.TufVerifiedRoot(factory, prod)
+		if err != nil {
+			return nil, err
+		}
+		root := AtsTufRoot{}
+		err = json.Unmarshal(raw, &root)
+		return &root, err
+	}
+	body, err := a.TufRootGetRaw(factory, prod, version)
 	if err != nil {
 		return nil, err
 	}
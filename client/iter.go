@@ -0,0 +1,167 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+)
+
+// DeviceIter iterates over the devices of a device list, fetching its pages on demand:
+//
+//	it := api.DeviceIter(false, "", factory, group, "", "", "", 1000)
+//	for it.Next() {
+//		device := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type DeviceIter struct {
+	api  *Api
+	next *string
+	page []Device
+	idx  int
+	err  error
+	// The number of pages to fetch, or 0 for all of them
+	pages   int
+	fetched int
+}
+
+func (a *Api) DeviceIter(
+	mine bool, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget string, limit int,
+) *DeviceIter {
+	url := a.deviceListUrl(mine, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget, 1, limit)
+	return &DeviceIter{api: a, next: &url}
+}
+
+// DevicePageIter iterates over the devices of a single page of a device list.
+func (a *Api) DevicePageIter(
+	mine bool, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget string, page, limit int,
+) *DeviceIter {
+	url := a.deviceListUrl(mine, matchTag, byFactory, byGroup, nameIlike, uuid, byTarget, page, limit)
+	return &DeviceIter{api: a, next: &url, pages: 1}
+}
+
+// Next advances to the next device, fetching the next page when needed.
+// It returns false when there are no more devices, or fetching a page failed.
+func (it *DeviceIter) Next() bool {
+	for it.idx+1 >= len(it.page) {
+		if it.err != nil || it.next == nil || (it.pages > 0 && it.fetched >= it.pages) {
+			return false
+		}
+		dl, err := it.api.DeviceListCont(*it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.next, it.idx = dl.Devices, dl.Next, -1
+		it.fetched += 1
+	}
+	it.idx += 1
+	return true
+}
+
+// Value returns the current device.
+func (it *DeviceIter) Value() Device {
+	return it.page[it.idx]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *DeviceIter) Err() error {
+	return it.err
+}
+
+// NextPage returns the URL of the page after the iterated ones, or nil if there are no more pages.
+func (it *DeviceIter) NextPage() *string {
+	return it.next
+}
+
+// TargetIter iterates over the targets of a factory. The targets list is not paginated by the server,
+// so it is decoded from the response one target at a time rather than loaded into memory at once.
+type TargetIter struct {
+	api  *Api
+	url  string
+	body io.ReadCloser
+	dec  *json.Decoder
+	name string
+	meta tuf.FileMeta
+	err  error
+	done bool
+}
+
+func (a *Api) TargetIter(factory string) *TargetIter {
+	return &TargetIter{api: a, url: a.serverUrl + "/ota/factories/" + factory + "/targets/"}
+}
+
+func (it *TargetIter) open() error {
+	res, err := it.api.RawGet(it.url, nil)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		log := logrus.WithFields(logrus.Fields{"url": it.url, "method": "GET"})
+		if _, err = readResponse(res, log); err == nil {
+			err = fmt.Errorf("Unexpected response fetching targets: %s", res.Status)
+		}
+		return err
+	}
+	it.body = res.Body
+	it.dec = json.NewDecoder(res.Body)
+	if tok, err := it.dec.Token(); err != nil {
+		return err
+	} else if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("Unexpected targets list starting with %v", tok)
+	}
+	return nil
+}
+
+// Next advances to the next target. It returns false when there are no more targets,
+// or reading them failed.
+func (it *TargetIter) Next() bool {
+	if it.done {
+		return false
+	}
+	if it.dec == nil {
+		if it.err = it.open(); it.err != nil {
+			it.Close()
+			return false
+		}
+	}
+	if !it.dec.More() {
+		it.Close()
+		return false
+	}
+	tok, err := it.dec.Token()
+	if err == nil {
+		it.name = tok.(string)
+		it.meta = tuf.FileMeta{}
+		err = it.dec.Decode(&it.meta)
+	}
+	if err != nil {
+		it.err = fmt.Errorf("Unable to decode targets: %w", err)
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// Value returns the name and metadata of the current target.
+func (it *TargetIter) Value() (string, tuf.FileMeta) {
+	return it.name, it.meta
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *TargetIter) Err() error {
+	return it.err
+}
+
+// Close releases the connection of an iteration stopped before reaching the end of targets.
+func (it *TargetIter) Close() {
+	it.done = true
+	if it.body != nil {
+		it.body.Close()
+		it.body = nil
+	}
+}
@@ -29,6 +29,8 @@ type OAuthConfig struct {
 type ClientCredentials struct {
 	Config OAuthConfig
 	URL    string
+
+	client *http.Client
 }
 
 type Org struct {
@@ -71,7 +73,11 @@ func (c *ClientCredentials) updateConfig(r OAuthResponse) {
 
 // Perform a POST request.
 func (c *ClientCredentials) post(uri string, data url.Values) (*[]byte, error) {
-	res, err := http.PostForm(uri, data)
+	httpClient := http.DefaultClient
+	if c.client != nil {
+		httpClient = c.client
+	}
+	res, err := httpClient.PostForm(uri, data)
 	if err != nil {
 		return nil, err
 	}
@@ -173,5 +179,16 @@ func (c *ClientCredentials) Get() error {
 }
 
 func NewClientCredentials(c OAuthConfig) ClientCredentials {
-	return ClientCredentials{c, URI}
+	return ClientCredentials{Config: c, URL: URI}
+}
+
+// SetCaCert makes the OAuth requests trust additional CA certificates from the caCertPath,
+// e.g. of an on-prem deployment.
+func (c *ClientCredentials) SetCaCert(caCertPath string) error {
+	transport, err := newBaseTransport(caCertPath)
+	if err != nil {
+		return err
+	}
+	c.client = &http.Client{Transport: transport}
+	return nil
 }
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const planVersion = 2
+
+// PlannedRequest is an API mutation recorded instead of being sent to the server.
+// Credentials are never recorded: the person applying a plan uses their own.
+type PlannedRequest struct {
+	Method     string            `json:"method"`
+	Url        string            `json:"url"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+	BodyBase64 string            `json:"body-base64,omitempty"`
+}
+
+func (r PlannedRequest) String() string {
+	return r.Method + " " + r.Url
+}
+
+func (r PlannedRequest) body() ([]byte, error) {
+	if len(r.BodyBase64) > 0 {
+		return base64.StdEncoding.DecodeString(r.BodyBase64)
+	}
+	return r.Body, nil
+}
+
+// Plan is a list of API mutations a command would make, which can be reviewed and applied later.
+type Plan struct {
+	Version   int              `json:"version"`
+	CreatedAt string           `json:"created-at"`
+	Server    string           `json:"server"`
+	Requests  []PlannedRequest `json:"requests"`
+}
+
+func LoadPlan(path string) (*Plan, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err = json.Unmarshal(buf, &plan); err != nil {
+		return nil, fmt.Errorf("Unable to parse plan %s: %w", path, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("Unsupported plan version: %d", plan.Version)
+	}
+	return &plan, nil
+}
+
+// planTransport records all requests changing the server state into a plan file instead of sending them.
+// Read-only requests are sent as usual, so that commands can still inspect the current state.
+type planTransport struct {
+	next http.RoundTripper
+	path string
+	plan *Plan
+	// The headers set from the credentials and config of the person recording the plan
+	skipHeaders map[string]bool
+}
+
+var (
+	// Commands may create several API clients, all of them should record into the same plan
+	plansLock sync.Mutex
+	plans     = make(map[string]*Plan)
+)
+
+func newPlanTransport(next http.RoundTripper, serverUrl, path string, config Config) *planTransport {
+	plansLock.Lock()
+	defer plansLock.Unlock()
+	plan, ok := plans[path]
+	if !ok {
+		plan = &Plan{
+			Version:   planVersion,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			Server:    serverUrl,
+			Requests:  []PlannedRequest{},
+		}
+		plans[path] = plan
+	}
+	skip := map[string]bool{"Authorization": true, "Cookie": true, "Osf-Token": true, "User-Agent": true}
+	if name := os.Getenv("TOKEN_HEADER"); len(name) > 0 {
+		skip[http.CanonicalHeaderKey(name)] = true
+	}
+	for k := range config.ExtraHeaders {
+		skip[http.CanonicalHeaderKey(k)] = true
+	}
+	return &planTransport{next: next, path: path, plan: plan, skipHeaders: skip}
+}
+
+func (t *planTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.next.RoundTrip(req)
+	}
+
+	r := PlannedRequest{Method: req.Method, Url: req.URL.String()}
+	for k, v := range req.Header {
+		if !t.skipHeaders[k] && len(v) > 0 {
+			if r.Headers == nil {
+				r.Headers = make(map[string]string)
+			}
+			r.Headers[k] = v[0]
+		}
+	}
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			if json.Valid(data) {
+				r.Body = data
+			} else {
+				r.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+			}
+		}
+	}
+
+	plansLock.Lock()
+	defer plansLock.Unlock()
+	t.plan.Requests = append(t.plan.Requests, r)
+	// The plan is saved after every request, as many commands exit without returning
+	data, err := json.MarshalIndent(t.plan, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(t.path, append(data, '\n'), 0o600); err != nil {
+		return nil, err
+	}
+	logrus.Debugf("Recorded %s into the plan %s", r, t.path)
+	fmt.Fprintln(os.Stderr, "Planned:", r)
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewBufferString("{}")),
+		ContentLength: 2,
+		Request:       req,
+	}, nil
+}
+
+// ApplyPlannedRequest sends a request recorded into a plan to the server.
+func (a *Api) ApplyPlannedRequest(r PlannedRequest) (*[]byte, error) {
+	data, err := r.body()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(a.ctx, r.Method, r.Url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	a.setReqHeaders(req, false)
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	log := httpLogger(req)
+	res, err := a.client.Do(req)
+	if err != nil {
+		log.Debugf("Network Error: %s", err)
+		return nil, err
+	}
+	return readResponse(res, log)
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	rateLimitMaxRetries = 5
+	// Start spreading requests over the rate limit window when less than this share of quota is left
+	rateLimitThrottleRatio = 0.2
+	rateLimitMaxWait       = 5 * time.Minute
+)
+
+// rateLimitTransport keeps track of the API rate limit headers, and throttles requests
+// to avoid hitting the limit. It retries requests rejected with HTTP 429 (Too Many Requests).
+type rateLimitTransport struct {
+	next http.RoundTripper
+
+	lock      sync.Mutex
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func newRateLimitTransport(next http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{next: next, limit: -1, remaining: -1}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		t.throttle()
+		res, err := t.next.RoundTrip(req)
+		if err != nil {
+			return res, err
+		}
+		t.update(res)
+		if res.StatusCode != http.StatusTooManyRequests || attempt >= rateLimitMaxRetries {
+			return res, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			// Can't rewind the body, let the caller handle the error
+			return res, err
+		}
+
+		wait := retryAfter(res, t.resetIn())
+		logrus.Debugf("Rate limit exceeded for %s, retrying in %s", req.URL, wait)
+		res.Body.Close()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// Delay the request if the remaining quota is low, so that a bulk operation
+// slows down instead of failing mid-way.
+func (t *rateLimitTransport) throttle() {
+	t.lock.Lock()
+	limit, remaining, reset := t.limit, t.remaining, t.reset
+	t.lock.Unlock()
+
+	if limit <= 0 || remaining < 0 || float64(remaining) > float64(limit)*rateLimitThrottleRatio {
+		return
+	}
+	window := time.Until(reset)
+	if window <= 0 {
+		return
+	}
+	wait := window
+	if remaining > 0 {
+		wait = window / time.Duration(remaining+1)
+	}
+	if wait > rateLimitMaxWait {
+		wait = rateLimitMaxWait
+	}
+	logrus.Debugf("Rate limit: %d of %d requests remaining, throttling for %s", remaining, limit, wait)
+	time.Sleep(wait)
+}
+
+func (t *rateLimitTransport) update(res *http.Response) {
+	limit, errL := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	remaining, errR := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	if errL != nil || errR != nil {
+		return
+	}
+	reset := parseRateLimitReset(res.Header.Get("X-RateLimit-Reset"))
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.limit, t.remaining, t.reset = limit, remaining, reset
+	logrus.Debugf("Rate limit: %d of %d requests remaining, resets in %s",
+		remaining, limit, time.Until(reset).Round(time.Second))
+}
+
+func (t *rateLimitTransport) resetIn() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return time.Until(t.reset)
+}
+
+// The reset header is either a UNIX timestamp or a number of seconds until the reset
+func parseRateLimitReset(val string) time.Time {
+	secs, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	if secs > 1_000_000_000 {
+		return time.Unix(secs, 0)
+	}
+	return time.Now().Add(time.Duration(secs) * time.Second)
+}
+
+func retryAfter(res *http.Response, resetIn time.Duration) time.Duration {
+	wait := time.Second
+	if val := res.Header.Get("Retry-After"); len(val) > 0 {
+		if secs, err := strconv.Atoi(val); err == nil {
+			wait = time.Duration(secs) * time.Second
+		} else if at, err := http.ParseTime(val); err == nil {
+			wait = time.Until(at)
+		}
+	} else if resetIn > 0 {
+		wait = resetIn
+	}
+	if wait < time.Second {
+		wait = time.Second
+	} else if wait > rateLimitMaxWait {
+		wait = rateLimitMaxWait
+	}
+	return wait
+}
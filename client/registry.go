@@ -0,0 +1,200 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	MediaTypeOciManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// RegistryDescriptor references content in a container registry, like a layer of an image.
+type RegistryDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// RegistryManifest is an OCI manifest of an image or a compose app bundle.
+type RegistryManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Config        RegistryDescriptor   `json:"config"`
+	Layers        []RegistryDescriptor `json:"layers"`
+	Annotations   map[string]string    `json:"annotations,omitempty"`
+}
+
+// RegistryRef is a parsed reference to content in a registry, e.g. hub.foundries.io/factory/app@sha256:...
+type RegistryRef struct {
+	Host      string
+	Repo      string
+	Reference string
+}
+
+func ParseRegistryRef(uri string) (RegistryRef, error) {
+	var ref RegistryRef
+	parts := strings.SplitN(uri, "/", 2)
+	if len(parts) != 2 || !strings.ContainsAny(parts[0], ".:") {
+		return ref, fmt.Errorf("Invalid registry reference %s: a registry host is required", uri)
+	}
+	ref.Host = parts[0]
+	if idx := strings.Index(parts[1], "@"); idx > 0 {
+		ref.Repo, ref.Reference = parts[1][:idx], parts[1][idx+1:]
+	} else if idx := strings.LastIndex(parts[1], ":"); idx > 0 {
+		ref.Repo, ref.Reference = parts[1][:idx], parts[1][idx+1:]
+	} else {
+		ref.Repo, ref.Reference = parts[1], "latest"
+	}
+	return ref, nil
+}
+
+func (r RegistryRef) url(kind, reference string) string {
+	return "https://" + r.Host + "/v2/" + r.Repo + "/" + kind + "/" + reference
+}
+
+// registryToken exchanges the fioctl credentials for a registry token, as described by the
+// WWW-Authenticate challenge of a registry. The hub.foundries.io accepts the fioctl
+// credentials as a password with any user name.
+func (a *Api) registryToken(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("Unsupported registry authentication: %s", challenge)
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return "", fmt.Errorf("Invalid registry authentication realm: %s", challenge)
+	}
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if len(params[k]) > 0 {
+			q.Set(k, params[k])
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "fioctl-"+a.clientVer)
+	password := a.config.Token
+	if len(password) == 0 {
+		password = a.config.ClientCredentials.AccessToken
+	}
+	req.SetBasicAuth("fioctl", password)
+	log := httpLogger(req)
+	res, err := a.client.Do(req)
+	if err != nil {
+		log.Debugf("Network Error: %s", err)
+		return "", err
+	}
+	body, err := readResponse(res, log)
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(*body, &token); err != nil {
+		return "", fmt.Errorf("Unable to parse a registry token: %w", err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
+
+func (a *Api) registryGet(url, accept string) (*[]byte, error) {
+	var token string
+	for {
+		req, err := http.NewRequestWithContext(a.ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "fioctl-"+a.clientVer)
+		if len(accept) > 0 {
+			req.Header.Set("Accept", accept)
+		}
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		log := httpLogger(req)
+		res, err := a.client.Do(req)
+		if err != nil {
+			log.Debugf("Network Error: %s", err)
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized && len(token) == 0 {
+			res.Body.Close()
+			if token, err = a.registryToken(res.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return readResponse(res, log)
+	}
+}
+
+func verifyRegistryDigest(content []byte, digest string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		// Only content referenced by a digest can be verified
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	if actual := hex.EncodeToString(sum[:]); actual != strings.TrimPrefix(digest, "sha256:") {
+		return fmt.Errorf("Content digest mismatch: expected %s, got sha256:%s", digest, actual)
+	}
+	return nil
+}
+
+// RegistryManifestGet downloads a manifest of an image or a compose app bundle, and verifies its digest.
+func (a *Api) RegistryManifestGet(uri string) (*RegistryManifest, error) {
+	ref, err := ParseRegistryRef(uri)
+	if err != nil {
+		return nil, err
+	}
+	body, err := a.registryGet(ref.url("manifests", ref.Reference), MediaTypeOciManifest+","+MediaTypeDockerManifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyRegistryDigest(*body, ref.Reference); err != nil {
+		return nil, err
+	}
+	var manifest RegistryManifest
+	if err := json.Unmarshal(*body, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// RegistryBlobGet downloads a blob, like a layer, from the repository of the uri, and verifies its digest.
+func (a *Api) RegistryBlobGet(uri, digest string) ([]byte, error) {
+	ref, err := ParseRegistryRef(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, errors.New("Unsupported blob digest: " + digest)
+	}
+	body, err := a.registryGet(ref.url("blobs", digest), "")
+	if err != nil {
+		return nil, err
+	}
+	return *body, verifyRegistryDigest(*body, digest)
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// How often the console of a CI run is polled for new output
+	jobservPollInterval = 5 * time.Second
+	// How many times a failed poll is retried, waiting a second longer after every attempt
+	jobservPollRetries = 5
+)
+
+// JobservLogReader reads the console of a CI run as it is written. Jobserv returns the console from
+// the X-OFFSET header, and the run status in the X-RUN-STATUS header, which is empty once the run completed.
+// Failed polls are retried with a backoff. Reading ends with io.EOF when the run completes, and with
+// the context error when the reader is closed or the context of the API client is cancelled.
+type JobservLogReader struct {
+	// OnStatus is called when the status of the run changes, before the output of the new status is read.
+	OnStatus func(from, to string)
+
+	api    *Api
+	url    string
+	ctx    context.Context
+	cancel context.CancelFunc
+	offset int
+	status string
+	polled bool
+	buf    []byte
+	err    error
+}
+
+func (a *Api) NewJobservLogReader(url string) *JobservLogReader {
+	ctx, cancel := context.WithCancel(a.ctx)
+	return &JobservLogReader{api: a.WithContext(ctx), url: url, ctx: ctx, cancel: cancel}
+}
+
+func (r *JobservLogReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.poll()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close stops reading, including a poll in progress.
+func (r *JobservLogReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// wait sleeps for the delay, unless the reader is closed first.
+func (r *JobservLogReader) wait(delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (r *JobservLogReader) poll() error {
+	if r.polled {
+		if err := r.wait(jobservPollInterval); err != nil {
+			return err
+		}
+	}
+	r.polled = true
+
+	var body []byte
+	var status string
+	for attempt := 1; ; attempt++ {
+		var err error
+		if body, status, err = r.fetch(); err == nil {
+			break
+		} else if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		} else if herr := AsHttpError(err); (herr != nil && herr.Response.StatusCode < 500) || attempt > jobservPollRetries {
+			return err
+		}
+		logrus.Debugf("Unable to poll %s: %s, retrying", r.url, err)
+		if err := r.wait(time.Duration(attempt) * time.Second); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case status == "QUEUED":
+		if r.status == "" {
+			r.buf = body
+		} else {
+			r.buf = []byte(".")
+		}
+	case len(status) == 0:
+		// The run completed, and the whole console is returned
+		if r.offset < len(body) {
+			r.buf = body[r.offset:]
+		}
+		return io.EOF
+	default:
+		if status != r.status && r.OnStatus != nil {
+			r.OnStatus(r.status, status)
+		}
+		r.buf = body
+		r.offset += len(body)
+	}
+	r.status = status
+	return nil
+}
+
+func (r *JobservLogReader) fetch() ([]byte, string, error) {
+	headers := map[string]string{"X-OFFSET": strconv.Itoa(r.offset)}
+	res, err := r.api.RawGet(r.url, &headers)
+	if err != nil {
+		return nil, "", err
+	}
+	status := res.Header.Get("X-RUN-STATUS")
+	body, err := readResponse(res, httpLogger(res.Request))
+	if err != nil {
+		return nil, "", err
+	}
+	return *body, status, nil
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const CorrelationIdHeader = "X-Correlation-ID"
+
+// tracingTransport logs every HTTP request made by the API client.
+// Request and response bodies are never logged, only their sizes.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func newCorrelationId() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := req.Header.Get(CorrelationIdHeader)
+	if len(id) == 0 {
+		id = newCorrelationId()
+		// A RoundTripper must not modify the original request
+		req = req.Clone(req.Context())
+		req.Header.Set(CorrelationIdHeader, id)
+	}
+	log := logrus.WithFields(logrus.Fields{
+		"correlation-id": id,
+		"method":         req.Method,
+		"url":            req.URL.String(),
+	})
+	if req.ContentLength > 0 {
+		log = log.WithField("request-body", "<redacted "+byteCount(req.ContentLength)+">")
+	}
+
+	started := time.Now()
+	res, err := t.next.RoundTrip(req)
+	log = log.WithField("latency", time.Since(started).Round(time.Millisecond).String())
+	if err != nil {
+		log.Infof("HTTP request failed: %s", err)
+		return res, err
+	}
+	log = log.WithField("status", res.StatusCode)
+	if res.ContentLength >= 0 {
+		log = log.WithField("response-body", "<redacted "+byteCount(res.ContentLength)+">")
+	}
+	log.Info("HTTP request completed")
+	return res, err
+}
+
+func byteCount(n int64) string {
+	return strconv.FormatInt(n, 10) + " bytes"
+}
@@ -0,0 +1,458 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	canonical "github.com/docker/go/canonical/json"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+)
+
+const (
+	// These are case insensitive
+	TufKeyTypeNameEd25519    = "ED25519"
+	TufKeyTypeNameRSA        = "RSA"
+	TufKeyTypeNameEcdsaP256  = "ECPRIME256V1"
+	tufKeyTypeSigNameEd25519 = "ed25519"
+	tufKeyTypeSigNameRSA     = "rsassa-pss-sha256"
+	// The names of the NIST P-256 key type and its signature method are those of the Foundries.io TUF server
+	tufKeyTypeSigNameEcdsaP256 = "ecPrime256v1"
+	tufKeyTypeAliasEcdsaP256   = "ECDSA-P256"
+	// RSA keys may be given a size, e.g. RSA-3072; they always sign with RSASSA-PSS, never PKCS#1 v1.5
+	tufKeyTypeRSADefaultBits = 4096
+)
+
+// TufKeyType implements generation, serialization and signing options of a TUF key algorithm.
+type TufKeyType interface {
+	Name() string
+	SigName() string
+	SigOpts() crypto.SignerOpts
+	GenerateKey() (crypto.Signer, error)
+	ParseKey(string) (crypto.Signer, error)
+	SaveKeyPair(crypto.Signer) (priv, pub string, err error)
+}
+
+// TufSigner is a private key which signs TUF metadata under the given key ID.
+type TufSigner struct {
+	Id   string
+	Type TufKeyType
+	Key  crypto.Signer
+}
+
+// OfflineCreds are the files of an offline TUF keys archive, e.g. tuf-root-keys.tgz.
+type OfflineCreds map[string][]byte
+
+type tufKeyTypeRSA struct{ bits int }
+type tufKeyTypeEd25519 struct{}
+type tufKeyTypeEcdsaP256 struct{}
+
+func ParseTufKeyType(s string) (TufKeyType, error) {
+	su := strings.ToUpper(s)
+	switch su {
+	case TufKeyTypeNameEd25519:
+		return &tufKeyTypeEd25519{}, nil
+	case TufKeyTypeNameRSA:
+		return &tufKeyTypeRSA{}, nil
+	case TufKeyTypeNameRSA + "-2048":
+		return &tufKeyTypeRSA{bits: 2048}, nil
+	case TufKeyTypeNameRSA + "-3072":
+		return &tufKeyTypeRSA{bits: 3072}, nil
+	case TufKeyTypeNameRSA + "-4096":
+		return &tufKeyTypeRSA{bits: 4096}, nil
+	case TufKeyTypeNameEcdsaP256, tufKeyTypeAliasEcdsaP256:
+		return &tufKeyTypeEcdsaP256{}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type: %s", s)
+	}
+}
+
+func (t *tufKeyTypeRSA) Name() string { return TufKeyTypeNameRSA }
+
+func (t *tufKeyTypeRSA) SigName() string { return tufKeyTypeSigNameRSA }
+
+func (t *tufKeyTypeRSA) SigOpts() crypto.SignerOpts {
+	return &rsa.PSSOptions{SaltLength: 32, Hash: crypto.SHA256}
+}
+
+// KeySize returns the size in bits of the RSA keys generated for this key type.
+func (t *tufKeyTypeRSA) KeySize() int {
+	if t.bits == 0 {
+		return tufKeyTypeRSADefaultBits
+	}
+	return t.bits
+}
+
+func (t *tufKeyTypeRSA) GenerateKey() (crypto.Signer, error) {
+	return rsa.GenerateKey(rand.Reader, t.KeySize())
+}
+
+func (t *tufKeyTypeRSA) ParseKey(priv string) (crypto.Signer, error) {
+	der, _ := pem.Decode([]byte(priv))
+	if der == nil {
+		return nil, errors.New("Unable to parse RSA private key PEM data")
+	}
+	pk, err := x509.ParsePKCS1PrivateKey(der.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse RSA private key PKCS1 DER data: %w", err)
+	}
+	return pk, nil
+}
+
+func (t *tufKeyTypeRSA) SaveKeyPair(key crypto.Signer) (priv, pub string, err error) {
+	privBytes := x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey))
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return
+	}
+	priv = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: privBytes,
+	}))
+	pub = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubBytes,
+	}))
+	return
+}
+
+func (t *tufKeyTypeEd25519) Name() string { return TufKeyTypeNameEd25519 }
+
+func (t *tufKeyTypeEd25519) SigName() string { return tufKeyTypeSigNameEd25519 }
+
+func (t *tufKeyTypeEd25519) SigOpts() crypto.SignerOpts {
+	return crypto.Hash(0)
+}
+
+func (t *tufKeyTypeEd25519) GenerateKey() (crypto.Signer, error) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	return pk, err
+}
+
+func (t *tufKeyTypeEd25519) ParseKey(priv string) (crypto.Signer, error) {
+	pk, err := hex.DecodeString(priv)
+	if err != nil {
+		return nil, errors.New("Unable to parse Ed25519 private key HEX data")
+	}
+	switch len(pk) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(pk), nil
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(pk), nil
+	default:
+		return nil, errors.New("Wrong Ed25519 private key size")
+	}
+}
+
+func (t *tufKeyTypeEd25519) SaveKeyPair(key crypto.Signer) (priv, pub string, err error) {
+	priv = hex.EncodeToString(key.(ed25519.PrivateKey).Seed())
+	pub = hex.EncodeToString([]byte(key.Public().(ed25519.PublicKey)))
+	return
+}
+
+func (t *tufKeyTypeEcdsaP256) Name() string { return TufKeyTypeNameEcdsaP256 }
+
+func (t *tufKeyTypeEcdsaP256) SigName() string { return tufKeyTypeSigNameEcdsaP256 }
+
+func (t *tufKeyTypeEcdsaP256) SigOpts() crypto.SignerOpts {
+	// Golang ECDSA keys return ASN.1 DER signatures of the SHA-256 digest
+	return crypto.SHA256
+}
+
+func (t *tufKeyTypeEcdsaP256) GenerateKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func (t *tufKeyTypeEcdsaP256) ParseKey(priv string) (crypto.Signer, error) {
+	der, _ := pem.Decode([]byte(priv))
+	if der == nil {
+		return nil, errors.New("Unable to parse ECDSA private key PEM data")
+	}
+	pk, err := x509.ParseECPrivateKey(der.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse ECDSA private key DER data: %w", err)
+	}
+	if pk.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("Unsupported ECDSA curve: %s", pk.Curve.Params().Name)
+	}
+	return pk, nil
+}
+
+func (t *tufKeyTypeEcdsaP256) SaveKeyPair(key crypto.Signer) (priv, pub string, err error) {
+	privBytes, err := x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+	if err != nil {
+		return
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return
+	}
+	priv = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: privBytes,
+	}))
+	pub = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubBytes,
+	}))
+	return
+}
+
+// GenTufKeyId returns the ID of a TUF key as used by the Foundries.io TUF server.
+func GenTufKeyId(key crypto.Signer) (string, error) {
+	// # This has to match the exact logic used by ota-tuf (required by garage-sign):
+	// https://github.com/foundriesio/ota-tuf/blob/fio-changes/libtuf/src/main/scala/com/advancedtelematic/libtuf/crypt/TufCrypto.scala#L66-L71
+	// It sets a keyid to a signature of the key's canonical DER encoding (same logic for all keys).
+	// Note: this differs from the TUF spec, need to change once we deprecate the garage-sign.
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(pubBytes)), nil
+}
+
+// SignTufMeta signs canonical JSON bytes of TUF metadata with each of the signers.
+func SignTufMeta(metaBytes []byte, signers ...TufSigner) ([]tuf.Signature, error) {
+	signatures := make([]tuf.Signature, len(signers))
+
+	for idx, signer := range signers {
+		digest := metaBytes[:]
+		opts := signer.Type.SigOpts()
+		if opts.HashFunc() != crypto.Hash(0) {
+			// Golang expects the caller to hash the digest if needed by the signing method
+
+			h := opts.HashFunc().New()
+			h.Write(digest)
+			digest = h.Sum(nil)
+		}
+		sigBytes, err := signer.Key.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			return nil, err
+		}
+		signatures[idx] = tuf.Signature{
+			KeyID:     signer.Id,
+			Method:    tuf.SigAlgorithm(signer.Type.SigName()),
+			Signature: sigBytes,
+		}
+	}
+	return signatures, nil
+}
+
+// SignTufRoot replaces signatures of the TUF root with signatures of the given signers.
+func SignTufRoot(root *AtsTufRoot, signers ...TufSigner) error {
+	bytes, err := canonical.MarshalCanonical(root.Signed)
+	if err != nil {
+		return err
+	}
+	signatures, err := SignTufMeta(bytes, signers...)
+	if err != nil {
+		return err
+	}
+	root.Signatures = signatures
+	return nil
+}
+
+// LoadOfflineCreds reads an offline TUF keys archive.
+func LoadOfflineCreds(credsFile string) (OfflineCreds, error) {
+	files := make(OfflineCreds)
+	err := readOfflineCreds(credsFile, func(hdr *tar.Header, content []byte) {
+		files[hdr.Name] = content
+	})
+	return files, err
+}
+
+// OfflineCredsTimes returns when each file was added to an offline TUF keys archive.
+// The time is zero for files saved by older versions of fioctl, which did not keep it.
+func OfflineCredsTimes(credsFile string) (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+	err := readOfflineCreds(credsFile, func(hdr *tar.Header, content []byte) {
+		if hdr.ModTime.Unix() > 0 {
+			times[hdr.Name] = hdr.ModTime
+		} else {
+			times[hdr.Name] = time.Time{}
+		}
+	})
+	return times, err
+}
+
+func readOfflineCreds(credsFile string, onFile func(hdr *tar.Header, content []byte)) error {
+	f, err := os.Open(credsFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzf, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gzf)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		} else if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		var b bytes.Buffer
+		if _, err = io.Copy(&b, tr); err != nil {
+			return err
+		}
+		onFile(hdr, b.Bytes())
+	}
+	return nil
+}
+
+// SaveOfflineCreds writes an offline TUF keys archive.
+// The files already in the archive keep the time they were added at.
+func SaveOfflineCreds(path string, creds OfflineCreds) error {
+	return SaveOfflineCredsCopy(path, path, creds)
+}
+
+// SaveOfflineCredsCopy writes a new version of the original offline TUF keys archive to another path,
+// e.g. a temporary copy. The files already in the original archive keep the time they were added at.
+func SaveOfflineCredsCopy(path, original string, creds OfflineCreds) error {
+	// The times are best effort, an original archive which can not be read is simply overwritten
+	times, _ := OfflineCredsTimes(original)
+	now := time.Now().UTC().Round(time.Second)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, val := range creds {
+		modTime, ok := times[name]
+		if !ok {
+			modTime = now
+		}
+		header := &tar.Header{
+			Name:    name,
+			Size:    int64(len(val)),
+			ModTime: modTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tarWriter.Write(val); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// TufSignerOptions tells FindTufSigner how to find the TUF keys which are not plain offline TUF keys.
+type TufSignerOptions struct {
+	// ExternalSigners are TUF keys held outside of the offline TUF keys, e.g. in HashiCorp Vault.
+	// One of them is returned when its public key matches, before looking at the offline TUF keys.
+	ExternalSigners []TufSigner
+	// Passphrase returns the passphrase of an encrypted private key in the offline TUF keys.
+	// It is called for each encrypted key needed, so it is up to the caller to cache them.
+	// When it is nil, encrypted keys can not be used.
+	Passphrase func(keyid string) ([]byte, error)
+}
+
+// ErrTufKeyNotFound is returned by FindTufSigner when the offline TUF keys do not have a key.
+var ErrTufKeyNotFound = errors.New("Can not find private key")
+
+// FindTufSigner finds the private key for a given public key in the offline TUF keys.
+func FindTufSigner(keyid, pubkey string, creds OfflineCreds, opts TufSignerOptions) (*TufSigner, error) {
+	pubkey = strings.TrimSpace(pubkey)
+	if signer := findExternalTufSigner(keyid, pubkey, opts.ExternalSigners); signer != nil {
+		return signer, nil
+	}
+	for k, v := range creds {
+		if strings.HasSuffix(k, ".pub") {
+			tk := AtsKey{}
+			if err := json.Unmarshal(v, &tk); err != nil {
+				return nil, fmt.Errorf("Unable to parse JSON for %s: %w", k, err)
+			}
+			if strings.TrimSpace(tk.KeyValue.Public) == pubkey {
+				pkname := strings.Replace(k, ".pub", ".sec", 1)
+				pkbytes := creds[pkname]
+				tk = AtsKey{}
+				if err := json.Unmarshal(pkbytes, &tk); err != nil {
+					return nil, fmt.Errorf("Unable to parse JSON for %s: %w", pkname, err)
+				}
+				keyType, err := ParseTufKeyType(tk.KeyType)
+				if err != nil {
+					return nil, fmt.Errorf("Unsupported key type for %s: %s", pkname, tk.KeyType)
+				}
+				var pk crypto.Signer
+				if IsEncryptedTufKey(tk.KeyValue.Private) {
+					if opts.Passphrase == nil {
+						return nil, fmt.Errorf("The private key %s is encrypted, but no passphrase is available", pkname)
+					}
+					passphrase, err := opts.Passphrase(keyid)
+					if err != nil {
+						return nil, fmt.Errorf("Unable to get the passphrase for %s: %w", pkname, err)
+					}
+					if pk, err = DecryptTufKey(tk.KeyValue.Private, passphrase); err != nil {
+						return nil, fmt.Errorf("%s: %w", pkname, err)
+					}
+				} else if pk, err = keyType.ParseKey(tk.KeyValue.Private); err != nil {
+					return nil, fmt.Errorf("Unable to parse key value for %s: %w", pkname, err)
+				}
+				return &TufSigner{
+					Id:   keyid,
+					Type: keyType,
+					Key:  pk,
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w for: %s", ErrTufKeyNotFound, keyid)
+}
+
+// TufPublicKeyValue returns the public key value of a signer, as stored in the keyval.public field of a TUF key.
+func TufPublicKeyValue(signer TufSigner) (string, error) {
+	switch pub := signer.Key.Public().(type) {
+	case ed25519.PublicKey:
+		return hex.EncodeToString(pub), nil
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+	}
+	return "", fmt.Errorf("Unsupported public key type: %T", signer.Key.Public())
+}
+
+func findExternalTufSigner(keyid, pubkey string, signers []TufSigner) *TufSigner {
+	for _, signer := range signers {
+		if pub, err := TufPublicKeyValue(signer); err == nil && strings.TrimSpace(pub) == pubkey {
+			return &TufSigner{Id: keyid, Type: signer.Type, Key: signer.Key}
+		}
+	}
+	return nil
+}
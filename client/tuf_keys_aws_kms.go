@@ -0,0 +1,239 @@
+package client
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AwsKmsConfig holds the credentials and the region of the AWS Key Management Service.
+// The Endpoint is optional, e.g. to use a VPC endpoint; by default it is derived from the region.
+type AwsKmsConfig struct {
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Endpoint        string
+}
+
+// awsKmsSigner signs with an asymmetric AWS KMS key; the private key never leaves KMS.
+type awsKmsSigner struct {
+	api   *Api
+	cfg   AwsKmsConfig
+	keyId string
+	pub   crypto.PublicKey
+}
+
+// NewAwsKmsSigner returns a signer for an asymmetric AWS KMS key given by its ARN, ID, or alias.
+// RSA and ECC_NIST_P256 keys are supported. The region is taken from the key ARN, unless set in the config.
+// The key ID is derived from the public key exported by KMS, the same way as for the offline TUF keys.
+func (a *Api) NewAwsKmsSigner(cfg AwsKmsConfig, keyId string) (*TufSigner, error) {
+	if parts := strings.Split(keyId, ":"); len(parts) >= 6 && parts[0] == "arn" && parts[2] == "kms" {
+		if len(cfg.Region) == 0 {
+			cfg.Region = parts[3]
+		}
+	}
+	if len(cfg.Region) == 0 {
+		return nil, fmt.Errorf("The AWS region of KMS key %s is not set", keyId)
+	}
+	if len(cfg.AccessKeyId) == 0 || len(cfg.SecretAccessKey) == 0 {
+		return nil, errors.New("The AWS credentials are not set")
+	}
+	if len(cfg.Endpoint) == 0 {
+		cfg.Endpoint = "https://kms." + cfg.Region + ".amazonaws.com"
+	}
+	s := &awsKmsSigner{api: a, cfg: cfg, keyId: keyId}
+
+	var key struct {
+		PublicKey         string   `json:"PublicKey"`
+		KeySpec           string   `json:"KeySpec"`
+		KeyUsage          string   `json:"KeyUsage"`
+		SigningAlgorithms []string `json:"SigningAlgorithms"`
+	}
+	if err := s.request("GetPublicKey", map[string]string{"KeyId": keyId}, &key); err != nil {
+		return nil, err
+	}
+	if key.KeyUsage != "SIGN_VERIFY" {
+		return nil, fmt.Errorf("KMS key %s can not sign, its key usage is %s", keyId, key.KeyUsage)
+	}
+	if !strings.HasPrefix(key.KeySpec, "RSA_") && key.KeySpec != "ECC_NIST_P256" {
+		return nil, fmt.Errorf("Unsupported KMS key spec for %s: %s, only RSA and ECC_NIST_P256 keys are supported",
+			keyId, key.KeySpec)
+	}
+	der, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the public key of KMS key %s: %w", keyId, err)
+	}
+	if s.pub, err = x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, fmt.Errorf("Unable to parse the public key of KMS key %s: %w", keyId, err)
+	}
+	keyType, err := keyStoreKeyType(s.pub)
+	if err != nil {
+		return nil, fmt.Errorf("KMS key %s: %w", keyId, err)
+	}
+
+	id, err := GenTufKeyId(s)
+	if err != nil {
+		return nil, err
+	}
+	return &TufSigner{Id: id, Type: keyType, Key: s}, nil
+}
+
+func (s *awsKmsSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *awsKmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("Unsupported signature hash: %s", opts.HashFunc())
+	}
+	// KMS uses a salt of the hash length for RSA-PSS, which is what TUF clients expect.
+	// ECDSA signatures are ASN.1 DER encoded, as are those of the offline ECDSA keys.
+	alg := "ECDSA_SHA_256"
+	if _, ok := s.pub.(*rsa.PublicKey); ok {
+		if _, ok := opts.(*rsa.PSSOptions); !ok {
+			return nil, errors.New("Only RSA-PSS signatures are supported by KMS RSA keys")
+		}
+		alg = "RSASSA_PSS_SHA_256"
+	}
+	req := map[string]string{
+		"KeyId":            s.keyId,
+		"Message":          base64.StdEncoding.EncodeToString(digest),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": alg,
+	}
+	var res struct {
+		Signature string `json:"Signature"`
+	}
+	if err := s.request("Sign", req, &res); err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(res.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the signature of KMS key %s: %w", s.keyId, err)
+	}
+	if err := verifyKeyStoreSignature(s.pub, digest, sig); err != nil {
+		return nil, fmt.Errorf("KMS key %s returned a signature which does not verify: %w", s.keyId, err)
+	}
+	return sig, nil
+}
+
+func (s *awsKmsSigner) request(action string, body, data interface{}) error {
+	req, buf, err := newKeyStoreRequest(http.MethodPost, strings.TrimRight(s.cfg.Endpoint, "/")+"/", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	awsSignRequest(req, buf, s.cfg, "kms", time.Now())
+
+	resBody, err := s.api.keyStoreRequest("AWS KMS", action, req, func(body []byte) string {
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &awsErr); err != nil || len(awsErr.Type) == 0 {
+			return ""
+		}
+		// The type may be prefixed by a namespace, e.g. com.amazonaws.kms#NotFoundException
+		return awsErr.Type[strings.LastIndex(awsErr.Type, "#")+1:] + ": " + awsErr.Message
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resBody, data)
+}
+
+// awsSignRequest adds the AWS Signature Version 4 authorization headers to a request.
+func awsSignRequest(req *http.Request, payload []byte, cfg AwsKmsConfig, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(cfg.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + cfg.Region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + cfg.SecretAccessKey)
+	for _, part := range []string{date, cfg.Region, service, "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKeyId, scope, signedHeaders, signature))
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsUriEscape(k)+"="+awsUriEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsUriEscape escapes everything but the unreserved characters of RFC 3986, as required by AWS.
+func awsUriEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
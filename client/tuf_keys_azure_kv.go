@@ -0,0 +1,218 @@
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const azureKeyVaultApiVersion = "7.4"
+
+// AzureKeyVaultScope is the OAuth2 scope of the access tokens for Azure Key Vault.
+const AzureKeyVaultScope = "https://vault.azure.net/.default"
+
+// IsAzureKeyVaultKeyUrl tells if a key name is the URL of an Azure Key Vault key:
+// https://<vault>.vault.azure.net/keys/<name>[/<version>]
+func IsAzureKeyVaultKeyUrl(key string) bool {
+	u, err := url.Parse(key)
+	return err == nil && u.Scheme == "https" && len(u.Host) > 0 && strings.HasPrefix(u.Path, "/keys/")
+}
+
+// AzureKeyVaultConfig holds the OAuth2 access token for Azure Key Vault.
+type AzureKeyVaultConfig struct {
+	AccessToken string
+}
+
+// azureKeyVaultSigner signs with a key of Azure Key Vault; the private key never leaves the vault.
+type azureKeyVaultSigner struct {
+	api *Api
+	cfg AzureKeyVaultConfig
+	kid string
+	pub crypto.PublicKey
+}
+
+// NewAzureKeyVaultSigner returns a signer for an Azure Key Vault key given by its URL.
+// RSA and P-256 EC keys are supported. If the URL has no key version, the current version is used.
+// The key ID is derived from the public key exported by Key Vault, the same way as for the offline TUF keys.
+func (a *Api) NewAzureKeyVaultSigner(cfg AzureKeyVaultConfig, keyUrl string) (*TufSigner, error) {
+	if !IsAzureKeyVaultKeyUrl(keyUrl) {
+		return nil, fmt.Errorf("Invalid Azure Key Vault key URL: %s", keyUrl)
+	}
+	if len(cfg.AccessToken) == 0 {
+		return nil, errors.New("The Azure access token is not set")
+	}
+	s := &azureKeyVaultSigner{api: a, cfg: cfg, kid: strings.TrimRight(keyUrl, "/")}
+
+	var bundle struct {
+		Key struct {
+			Kid string   `json:"kid"`
+			Kty string   `json:"kty"`
+			Ops []string `json:"key_ops"`
+			N   string   `json:"n"`
+			E   string   `json:"e"`
+			Crv string   `json:"crv"`
+			X   string   `json:"x"`
+			Y   string   `json:"y"`
+		} `json:"key"`
+	}
+	if err := s.request(http.MethodGet, s.kid, nil, &bundle); err != nil {
+		return nil, err
+	}
+	decode := func(v string) (*big.Int, error) {
+		buf, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(v, "="))
+		return new(big.Int).SetBytes(buf), err
+	}
+	switch bundle.Key.Kty {
+	case "RSA", "RSA-HSM":
+		n, err := decode(bundle.Key.N)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode the public key of Key Vault key %s: %w", keyUrl, err)
+		}
+		e, err := decode(bundle.Key.E)
+		if err != nil || e.BitLen() > 31 {
+			return nil, fmt.Errorf("Unable to decode the public key exponent of Key Vault key %s", keyUrl)
+		}
+		s.pub = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC", "EC-HSM":
+		if bundle.Key.Crv != "P-256" {
+			return nil, fmt.Errorf("Unsupported Key Vault key curve for %s: %s, only P-256 is supported", keyUrl, bundle.Key.Crv)
+		}
+		x, errX := decode(bundle.Key.X)
+		y, errY := decode(bundle.Key.Y)
+		if errX != nil || errY != nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("Unable to decode the public key of Key Vault key %s", keyUrl)
+		}
+		s.pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	default:
+		return nil, fmt.Errorf("Unsupported Key Vault key type for %s: %s, only RSA and EC keys are supported",
+			keyUrl, bundle.Key.Kty)
+	}
+	keyType, err := keyStoreKeyType(s.pub)
+	if err != nil {
+		return nil, fmt.Errorf("Key Vault key %s: %w", keyUrl, err)
+	}
+	// Pin the key version, so that all signatures are made by the same key even if it is rotated meanwhile
+	if len(bundle.Key.Kid) > 0 {
+		s.kid = bundle.Key.Kid
+	}
+
+	id, err := GenTufKeyId(s)
+	if err != nil {
+		return nil, err
+	}
+	return &TufSigner{Id: id, Type: keyType, Key: s}, nil
+}
+
+func (s *azureKeyVaultSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *azureKeyVaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("Unsupported signature hash: %s", opts.HashFunc())
+	}
+	alg := "ES256"
+	if _, ok := s.pub.(*rsa.PublicKey); ok {
+		if _, ok := opts.(*rsa.PSSOptions); !ok {
+			return nil, errors.New("Only RSA-PSS signatures are supported by Key Vault RSA keys")
+		}
+		// PS256 uses a salt of the hash length, which is what TUF clients expect
+		alg = "PS256"
+	}
+	req := map[string]string{"alg": alg, "value": base64.RawURLEncoding.EncodeToString(digest)}
+	var res struct {
+		Value string `json:"value"`
+	}
+	if err := s.request(http.MethodPost, s.kid+"/sign", req, &res); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(res.Value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the signature of Key Vault key %s: %w", s.kid, err)
+	}
+
+	if alg == "ES256" {
+		// ES256 signatures are the raw r and s values, while TUF clients expect ASN.1 DER, as made by the offline ECDSA keys
+		if len(sig) != 64 {
+			return nil, fmt.Errorf("Key Vault key %s returned an ES256 signature of %d bytes", s.kid, len(sig))
+		}
+		rs := struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])}
+		if sig, err = asn1.Marshal(rs); err != nil {
+			return nil, err
+		}
+	}
+	if err := verifyKeyStoreSignature(s.pub, digest, sig); err != nil {
+		return nil, fmt.Errorf("Key Vault key %s returned a signature which does not verify: %w", s.kid, err)
+	}
+	return sig, nil
+}
+
+func (s *azureKeyVaultSigner) request(method, endpoint string, body, data interface{}) error {
+	req, _, err := newKeyStoreRequest(method, endpoint+"?api-version="+azureKeyVaultApiVersion, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.AccessToken)
+	return s.api.azureRequest(req, "Azure Key Vault", data)
+}
+
+// azureRequest sends a request to an Azure API and parses its JSON response.
+func (a *Api) azureRequest(req *http.Request, service string, data interface{}) error {
+	resBody, err := a.keyStoreRequest(service, req.URL.Path, req, func(body []byte) string {
+		var azErr struct {
+			Error json.RawMessage `json:"error"`
+			// The Microsoft identity platform uses another format
+			Description string `json:"error_description"`
+		}
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &azErr); err != nil {
+			return ""
+		} else if len(azErr.Description) > 0 {
+			return azErr.Description
+		} else if err := json.Unmarshal(azErr.Error, &apiErr); err == nil && len(apiErr.Message) > 0 {
+			return apiErr.Code + ": " + apiErr.Message
+		}
+		return ""
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resBody, data)
+}
+
+// AzureAccessToken returns an OAuth2 access token of a service principal for the given scope,
+// e.g. AzureKeyVaultScope. The authority host is e.g. https://login.microsoftonline.com.
+func (a *Api) AzureAccessToken(authorityHost, tenantId, clientId, clientSecret, scope string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientId)
+	form.Set("client_secret", clientSecret)
+	form.Set("scope", scope)
+	endpoint := strings.TrimRight(authorityHost, "/") + "/" + url.PathEscape(tenantId) + "/oauth2/v2.0/token"
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := a.azureRequest(req, "Azure AD", &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
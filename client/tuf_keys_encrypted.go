@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// An encrypted private key is stored in the keyval.private field of a key in the offline TUF keys
+// as a PEM encoded PKCS#8 EncryptedPrivateKeyInfo (RFC 5958), using the PBES2 scheme (RFC 8018).
+// It is compatible with "openssl pkcs8 -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256".
+const encryptedTufKeyPemType = "ENCRYPTED PRIVATE KEY"
+
+// The PBKDF2 iteration count, as recommended by OWASP for PBKDF2-HMAC-SHA256 in 2023
+const encryptedTufKeyIterations = 600000
+
+// The PBKDF2 iteration counts accepted when decrypting a key. RFC 8018 recommends at least 1000 iterations,
+// and a much higher count of a crafted key would make decrypting it hang.
+const (
+	encryptedTufKeyMinIterations = 1000
+	encryptedTufKeyMaxIterations = 10000000
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	Prf        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// IsEncryptedTufKey tells if the private key value of a TUF key is encrypted.
+func IsEncryptedTufKey(priv string) bool {
+	return strings.HasPrefix(strings.TrimSpace(priv), "-----BEGIN "+encryptedTufKeyPemType+"-----")
+}
+
+// EncryptTufKey encrypts a private key with a passphrase.
+// The result replaces the private key value of the key in the offline TUF keys.
+func EncryptTufKey(key crypto.Signer, passphrase []byte) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: encryptedTufKeyIterations,
+		Prf:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return "", err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return "", err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, salt, encryptedTufKeyIterations, 32, sha256.New))
+	if err != nil {
+		return "", err
+	}
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(der, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: encryptedTufKeyPemType, Bytes: info})), nil
+}
+
+// DecryptTufKey decrypts a private key encrypted with EncryptTufKey, or by openssl using PBES2.
+func DecryptTufKey(priv string, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(priv))
+	if block == nil || block.Type != encryptedTufKeyPemType {
+		return nil, errors.New("Unable to parse encrypted private key PEM data")
+	}
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, fmt.Errorf("Unable to parse encrypted private key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("Unsupported private key encryption: %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("Unable to parse PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("Unsupported key derivation function: %s, only PBKDF2 is supported",
+			params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("Unable to parse PBKDF2 parameters: %w", err)
+	}
+	if kdf.Iterations < encryptedTufKeyMinIterations || kdf.Iterations > encryptedTufKeyMaxIterations {
+		return nil, fmt.Errorf("Unsupported PBKDF2 iteration count: %d, it must be between %d and %d",
+			kdf.Iterations, encryptedTufKeyMinIterations, encryptedTufKeyMaxIterations)
+	}
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.Prf.Algorithm) == 0 || kdf.Prf.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.Prf.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("Unsupported PBKDF2 function: %s", kdf.Prf.Algorithm)
+	}
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("Unsupported private key cipher: %s, only AES-CBC is supported", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("Invalid AES-CBC initialization vector")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("Invalid encrypted private key length")
+	}
+
+	cb, err := aes.NewCipher(pbkdf2.Key(passphrase, kdf.Salt, kdf.Iterations, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(cb, iv).CryptBlocks(data, info.EncryptedData)
+	// A wrong passphrase almost always results in an invalid padding or DER data
+	wrongPassphrase := errors.New("Unable to decrypt the private key: wrong passphrase")
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(data[len(data)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, wrongPassphrase
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data[:len(data)-pad])
+	if err != nil {
+		return nil, wrongPassphrase
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported private key type: %T", key)
+	}
+	return signer, nil
+}
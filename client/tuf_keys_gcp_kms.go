@@ -0,0 +1,279 @@
+package client
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GcpKmsKeyUriPrefix is the prefix of the URIs of Google Cloud KMS keys:
+// gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>[/cryptoKeyVersions/<version>]
+const GcpKmsKeyUriPrefix = "gcpkms://"
+
+// GcpKmsConfig holds the OAuth2 access token for Google Cloud KMS.
+// The Endpoint is optional, by default it is https://cloudkms.googleapis.com/.
+type GcpKmsConfig struct {
+	AccessToken string
+	Endpoint    string
+}
+
+// gcpKmsSigner signs with an asymmetric key version of Google Cloud KMS; the private key never leaves KMS.
+type gcpKmsSigner struct {
+	api  *Api
+	cfg  GcpKmsConfig
+	name string
+	pub  crypto.PublicKey
+}
+
+// NewGcpKmsSigner returns a signer for a Google Cloud KMS key given by its gcpkms:// URI.
+// EC_SIGN_ED25519, EC_SIGN_P256_SHA256, and RSA_SIGN_PSS_*_SHA256 keys are supported.
+// If the URI has no key version, the latest enabled version is used.
+// The key ID is derived from the public key exported by KMS, the same way as for the offline TUF keys.
+func (a *Api) NewGcpKmsSigner(cfg GcpKmsConfig, keyUri string) (*TufSigner, error) {
+	name := strings.TrimPrefix(keyUri, GcpKmsKeyUriPrefix)
+	if name == keyUri || !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/cryptoKeys/") {
+		return nil, fmt.Errorf("Invalid Google Cloud KMS key URI: %s", keyUri)
+	}
+	if len(cfg.AccessToken) == 0 {
+		return nil, errors.New("The Google Cloud access token is not set")
+	}
+	if len(cfg.Endpoint) == 0 {
+		cfg.Endpoint = "https://cloudkms.googleapis.com/"
+	}
+	s := &gcpKmsSigner{api: a, cfg: cfg, name: name}
+	if !strings.Contains(name, "/cryptoKeyVersions/") {
+		version, err := s.latestVersion()
+		if err != nil {
+			return nil, err
+		}
+		s.name = version
+	}
+
+	var key struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := s.request(http.MethodGet, s.name+"/publicKey", nil, &key); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(key.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("Unable to parse the public key PEM data of KMS key %s", s.name)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the public key of KMS key %s: %w", s.name, err)
+	}
+	s.pub = pub
+
+	switch {
+	case key.Algorithm == "EC_SIGN_ED25519", key.Algorithm == "EC_SIGN_P256_SHA256":
+	case strings.HasPrefix(key.Algorithm, "RSA_SIGN_PSS_") && strings.HasSuffix(key.Algorithm, "_SHA256"):
+	default:
+		return nil, fmt.Errorf("Unsupported KMS key algorithm for %s: %s, "+
+			"only EC_SIGN_ED25519, EC_SIGN_P256_SHA256, and RSA_SIGN_PSS_*_SHA256 are supported", s.name, key.Algorithm)
+	}
+	keyType, err := keyStoreKeyType(s.pub)
+	if err != nil {
+		return nil, fmt.Errorf("KMS key %s: %w", s.name, err)
+	}
+
+	id, err := GenTufKeyId(s)
+	if err != nil {
+		return nil, err
+	}
+	return &TufSigner{Id: id, Type: keyType, Key: s}, nil
+}
+
+// latestVersion returns the name of the latest enabled version of the key.
+func (s *gcpKmsSigner) latestVersion() (string, error) {
+	var versions struct {
+		CryptoKeyVersions []struct {
+			Name string `json:"name"`
+		} `json:"cryptoKeyVersions"`
+	}
+	query := "/cryptoKeyVersions?filter=" + url.QueryEscape("state=ENABLED") + "&pageSize=1000"
+	if err := s.request(http.MethodGet, s.name+query, nil, &versions); err != nil {
+		return "", err
+	}
+	latest, latestNum := "", -1
+	for _, v := range versions.CryptoKeyVersions {
+		num, err := strconv.Atoi(v.Name[strings.LastIndex(v.Name, "/")+1:])
+		if err == nil && num > latestNum {
+			latest, latestNum = v.Name, num
+		}
+	}
+	if latestNum < 0 {
+		return "", fmt.Errorf("KMS key %s has no enabled versions", s.name)
+	}
+	return latest, nil
+}
+
+func (s *gcpKmsSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *gcpKmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := make(map[string]interface{})
+	if _, ok := s.pub.(ed25519.PublicKey); ok {
+		// Ed25519 signs the message itself rather than a digest of it
+		req["data"] = base64.StdEncoding.EncodeToString(digest)
+	} else {
+		if opts.HashFunc() != crypto.SHA256 {
+			return nil, fmt.Errorf("Unsupported signature hash: %s", opts.HashFunc())
+		}
+		// KMS uses a salt of the hash length for RSA-PSS, which is what TUF clients expect.
+		// ECDSA signatures are ASN.1 DER encoded, as are those of the offline ECDSA keys.
+		req["digest"] = map[string]string{"sha256": base64.StdEncoding.EncodeToString(digest)}
+	}
+	var res struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.request(http.MethodPost, s.name+":asymmetricSign", req, &res); err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(res.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the signature of KMS key %s: %w", s.name, err)
+	}
+
+	if err := verifyKeyStoreSignature(s.pub, digest, sig); err != nil {
+		return nil, fmt.Errorf("KMS key %s returned a signature which does not verify: %w", s.name, err)
+	}
+	return sig, nil
+}
+
+func (s *gcpKmsSigner) request(method, path string, body, data interface{}) error {
+	req, _, err := newKeyStoreRequest(method, strings.TrimRight(s.cfg.Endpoint, "/")+"/v1/"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.AccessToken)
+	return s.api.gcpRequest(req, "Google Cloud KMS", data)
+}
+
+// gcpRequest sends a request to a Google API and parses its JSON response.
+func (a *Api) gcpRequest(req *http.Request, service string, data interface{}) error {
+	resBody, err := a.keyStoreRequest(service, req.URL.Path, req, func(body []byte) string {
+		var gcpErr struct {
+			Error json.RawMessage `json:"error"`
+			// The OAuth2 token endpoint uses another format
+			Description string `json:"error_description"`
+		}
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &gcpErr); err != nil {
+			return ""
+		} else if len(gcpErr.Description) > 0 {
+			return gcpErr.Description
+		} else if err := json.Unmarshal(gcpErr.Error, &apiErr); err == nil {
+			return apiErr.Message
+		}
+		return ""
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resBody, data)
+}
+
+// GcpAccessToken returns an OAuth2 access token for the Google Cloud application default credentials,
+// i.e. a service account key or the credentials saved by "gcloud auth application-default login".
+func (a *Api) GcpAccessToken(credentials []byte) (string, error) {
+	var creds struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyId string `json:"private_key_id"`
+		TokenUri     string `json:"token_uri"`
+		ClientId     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(credentials, &creds); err != nil {
+		return "", fmt.Errorf("Unable to parse the Google Cloud credentials: %w", err)
+	}
+	if len(creds.TokenUri) == 0 {
+		creds.TokenUri = "https://oauth2.googleapis.com/token"
+	}
+
+	form := url.Values{}
+	switch creds.Type {
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientId)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	case "service_account":
+		assertion, err := gcpJwtAssertion(creds.ClientEmail, creds.PrivateKeyId, creds.PrivateKey, creds.TokenUri)
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	default:
+		return "", fmt.Errorf("Unsupported type of Google Cloud credentials: %s", creds.Type)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, creds.TokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := a.gcpRequest(req, "Google OAuth2", &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// gcpJwtAssertion returns a JWT signed by a service account key to be exchanged for an access token.
+func gcpJwtAssertion(email, keyId, keyPem, audience string) (string, error) {
+	block, _ := pem.Decode([]byte(keyPem))
+	if block == nil {
+		return "", errors.New("Unable to parse the private key PEM data of the Google Cloud service account")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse the private key of the Google Cloud service account: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("The private key of the Google Cloud service account is not an RSA key")
+	}
+
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyId})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   email,
+		"scope": "https://www.googleapis.com/auth/cloudkms",
+		"aud":   audience,
+		"iat":   now,
+		"exp":   now + 3600,
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
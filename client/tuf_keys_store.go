@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// keyStoreTimeout limits each request to an external key store, e.g. AWS KMS or Vault.
+const keyStoreTimeout = 30 * time.Second
+
+// newKeyStoreRequest returns a request to an external key store with the JSON encoded body, unless it is nil.
+// The encoded body is returned too, as some key stores sign it.
+func newKeyStoreRequest(method, endpoint string, body interface{}) (*http.Request, []byte, error) {
+	var buf []byte
+	var reader io.Reader
+	if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return nil, nil, err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, buf, nil
+}
+
+// keyStoreRequest sends a request to an external key store, and returns the body of its 200 response.
+// The request is sent with the context and the CA certificates of the API client,
+// so that cancelling the context also cancels signing.
+// The errMsg returns the message of an error response; the HTTP status is used when it returns nothing.
+func (a *Api) keyStoreRequest(service, what string, req *http.Request, errMsg func(body []byte) string) ([]byte, error) {
+	res, err := a.keyStoreClient.Do(req.WithContext(a.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to reach %s: %w", service, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		msg := errMsg(body)
+		if len(msg) == 0 {
+			msg = res.Status
+		}
+		return nil, fmt.Errorf("%s request %s failed: HTTP_%d %s", service, what, res.StatusCode, msg)
+	}
+	return body, nil
+}
+
+// keyStoreKeyType returns the TUF key type of the public key of an external key store.
+func keyStoreKeyType(pub crypto.PublicKey) (TufKeyType, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return &tufKeyTypeEd25519{}, nil
+	case *rsa.PublicKey:
+		return &tufKeyTypeRSA{}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("Unsupported ECDSA curve: %s, only P-256 is supported", pub.Curve.Params().Name)
+		}
+		return &tufKeyTypeEcdsaP256{}, nil
+	}
+	return nil, fmt.Errorf("Unsupported public key type: %T", pub)
+}
+
+// verifyKeyStoreSignature checks a signature made by an external key store,
+// so that a misconfigured key is caught before the signature is uploaded.
+// RSA keys make RSA-PSS signatures, and ECDSA keys make ASN.1 DER signatures, of a SHA-256 digest.
+func verifyKeyStoreSignature(pub crypto.PublicKey, digest, sig []byte) error {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, sig) {
+			return errors.New("invalid Ed25519 signature")
+		}
+	case *rsa.PublicKey:
+		return rsa.VerifyPSS(pub, crypto.SHA256, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.New("invalid ECDSA signature")
+		}
+	default:
+		return fmt.Errorf("Unsupported public key type: %T", pub)
+	}
+	return nil
+}
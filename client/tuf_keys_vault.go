@@ -0,0 +1,170 @@
+package client
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// VaultTransitConfig locates the transit secrets engine of a HashiCorp Vault server.
+type VaultTransitConfig struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Mount     string
+}
+
+// vaultTransitSigner signs with a key of the Vault transit engine; the private key never leaves Vault.
+type vaultTransitSigner struct {
+	api     *Api
+	cfg     VaultTransitConfig
+	name    string
+	version int
+	pub     crypto.PublicKey
+}
+
+// NewVaultTransitSigner returns a signer for the latest version of a key of the Vault transit engine.
+// The ed25519, ecdsa-p256, and rsa-* keys are supported.
+// The key ID is derived from the public key exported by Vault, the same way as for the offline TUF keys.
+func (a *Api) NewVaultTransitSigner(cfg VaultTransitConfig, name string) (*TufSigner, error) {
+	if len(cfg.Addr) == 0 {
+		return nil, errors.New("The Vault server address is not set")
+	}
+	if len(cfg.Mount) == 0 {
+		cfg.Mount = "transit"
+	}
+	s := &vaultTransitSigner{api: a, cfg: cfg, name: name}
+
+	var key struct {
+		Type          string `json:"type"`
+		LatestVersion int    `json:"latest_version"`
+		Keys          map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	}
+	if err := s.request(http.MethodGet, "keys/"+url.PathEscape(name), nil, &key); err != nil {
+		return nil, err
+	}
+	s.version = key.LatestVersion
+	pub := key.Keys[strconv.Itoa(key.LatestVersion)].PublicKey
+	if len(pub) == 0 {
+		return nil, fmt.Errorf("Vault key %s has no public key, only asymmetric keys can sign", name)
+	}
+
+	switch {
+	case key.Type == "ed25519":
+		raw, err := base64.StdEncoding.DecodeString(pub)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Unable to parse the Ed25519 public key of Vault key %s", name)
+		}
+		s.pub = ed25519.PublicKey(raw)
+	case key.Type == "ecdsa-p256", strings.HasPrefix(key.Type, "rsa-"):
+		block, _ := pem.Decode([]byte(pub))
+		if block == nil {
+			return nil, fmt.Errorf("Unable to parse the public key PEM data of Vault key %s", name)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the public key of Vault key %s: %w", name, err)
+		}
+		s.pub = parsed
+	default:
+		return nil, fmt.Errorf("Unsupported Vault key type for %s: %s, only ed25519, ecdsa-p256, and rsa keys are supported",
+			name, key.Type)
+	}
+	keyType, err := keyStoreKeyType(s.pub)
+	if err != nil {
+		return nil, fmt.Errorf("Vault key %s: %w", name, err)
+	}
+
+	id, err := GenTufKeyId(s)
+	if err != nil {
+		return nil, err
+	}
+	return &TufSigner{Id: id, Type: keyType, Key: s}, nil
+}
+
+func (s *vaultTransitSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *vaultTransitSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(digest),
+		"key_version": s.version,
+	}
+	if _, ok := s.pub.(ed25519.PublicKey); !ok {
+		if opts.HashFunc() != crypto.SHA256 {
+			return nil, fmt.Errorf("Unsupported signature hash: %s", opts.HashFunc())
+		}
+		// The digest is already hashed by the caller. ECDSA signatures are ASN.1 DER encoded by default.
+		req["prehashed"] = true
+		req["hash_algorithm"] = "sha2-256"
+	}
+	if _, ok := s.pub.(*rsa.PublicKey); ok {
+		// A salt of the hash length is what TUF clients expect
+		req["signature_algorithm"] = "pss"
+		req["salt_length"] = "hash"
+	}
+	var res struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.request(http.MethodPost, "sign/"+url.PathEscape(s.name), req, &res); err != nil {
+		return nil, err
+	}
+	// The signature is formatted as vault:v<version>:<base64>
+	parts := strings.SplitN(res.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("Unexpected signature format from Vault key %s", s.name)
+	}
+	sig, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the signature of Vault key %s: %w", s.name, err)
+	}
+
+	if err := verifyKeyStoreSignature(s.pub, digest, sig); err != nil {
+		return nil, fmt.Errorf("Vault key %s returned a signature which does not verify: %w", s.name, err)
+	}
+	return sig, nil
+}
+
+func (s *vaultTransitSigner) request(method, path string, body, data interface{}) error {
+	endpoint := strings.TrimRight(s.cfg.Addr, "/") + "/v1/" + strings.Trim(s.cfg.Mount, "/") + "/" + path
+	req, _, err := newKeyStoreRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.cfg.Token)
+	if len(s.cfg.Namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", s.cfg.Namespace)
+	}
+
+	type envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	resBody, err := s.api.keyStoreRequest("Vault", method+" "+path, req, func(body []byte) string {
+		var res envelope
+		_ = json.Unmarshal(body, &res)
+		return strings.Join(res.Errors, "; ")
+	})
+	if err != nil {
+		return err
+	}
+	var res envelope
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return fmt.Errorf("Unable to parse the Vault response: %w", err)
+	}
+	return json.Unmarshal(res.Data, data)
+}
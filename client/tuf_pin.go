@@ -0,0 +1,167 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TufPinStore keeps the TUF root metadata pinned (trusted) by the user for each factory.
+// Root and targets metadata returned by the API are verified against the pinned root,
+// so that a compromised API can not feed falsified metadata into signing ceremonies.
+type TufPinStore struct {
+	Dir string
+}
+
+func (s TufPinStore) Path(factory string, prod bool) string {
+	name := "ci-root.json"
+	if prod {
+		name = "prod-root.json"
+	}
+	return filepath.Join(s.Dir, factory, name)
+}
+
+// Load returns the pinned root, or nil if no root was pinned yet.
+func (s TufPinStore) Load(factory string, prod bool) (*AtsTufRoot, []byte, error) {
+	raw, err := os.ReadFile(s.Path(factory, prod))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	// Only verify the self signature; the pinned root is trusted as is
+	root, err := VerifyTufRoot(nil, raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid pinned TUF root %s: %w", s.Path(factory, prod), err)
+	}
+	return root, raw, nil
+}
+
+func (s TufPinStore) Save(factory string, prod bool, raw []byte) error {
+	path := s.Path(factory, prod)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0600)
+}
+
+func (s TufPinStore) Remove(factory string, prod bool) error {
+	err := os.Remove(s.Path(factory, prod))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// tufTrust caches roots verified against the pinned roots during the life of a client,
+// so that many targets metadata can be verified without fetching the root each time.
+type tufTrust struct {
+	lock  sync.Mutex
+	roots map[string]*AtsTufRoot
+}
+
+func tufTrustKey(factory string, prod bool) string {
+	return fmt.Sprintf("%s/%v", factory, prod)
+}
+
+func (a *Api) tufPinningEnabled() bool {
+	return len(a.config.TufPinDir) > 0
+}
+
+// TufVerifiedRoot returns the latest root of the factory, verified against the pinned root.
+// If no root is pinned yet, the latest root is pinned (trust on first use).
+func (a *Api) TufVerifiedRoot(factory string, prod bool) (*AtsTufRoot, []byte, error) {
+	a.trust.lock.Lock()
+	defer a.trust.lock.Unlock()
+
+	latestRaw, err := a.TufRootGetRaw(factory, prod, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := tufTrustKey(factory, prod)
+
+	store := TufPinStore{a.config.TufPinDir}
+	pinned, pinnedRaw, err := store.Load(factory, prod)
+	if err != nil {
+		return nil, nil, err
+	}
+	latest, err := VerifyTufRoot(nil, *latestRaw)
+	if err != nil {
+		return nil, nil, err
+	}
+	kind := "CI"
+	if prod {
+		kind = "production"
+	}
+	if pinned == nil {
+		if err := store.Save(factory, prod, *latestRaw); err != nil {
+			return nil, nil, err
+		}
+		logrus.Warnf("Pinned the %s TUF root version %d of factory %s on first use: %s",
+			kind, latest.Signed.Version, factory, store.Path(factory, prod))
+		a.trust.roots[key] = latest
+		return latest, *latestRaw, nil
+	}
+
+	if latest.Signed.Version < pinned.Signed.Version {
+		return nil, nil, fmt.Errorf("The server returned the %s TUF root version %d, older than the pinned version %d",
+			kind, latest.Signed.Version, pinned.Signed.Version)
+	} else if latest.Signed.Version == pinned.Signed.Version {
+		if !bytes.Equal(canonicalOrNil(*latestRaw), canonicalOrNil(pinnedRaw)) {
+			return nil, nil, fmt.Errorf("The server returned the %s TUF root version %d, which differs from the pinned one",
+				kind, latest.Signed.Version)
+		}
+		a.trust.roots[key] = pinned
+		return pinned, *latestRaw, nil
+	}
+
+	trusted := pinned
+	for ver := pinned.Signed.Version + 1; ver <= latest.Signed.Version; ver++ {
+		raw := latestRaw
+		if ver < latest.Signed.Version {
+			if raw, err = a.TufRootGetRaw(factory, prod, ver); err != nil {
+				return nil, nil, err
+			}
+		}
+		if trusted, err = VerifyTufRoot(trusted, *raw); err != nil {
+			return nil, nil, fmt.Errorf("Unable to verify the %s TUF root against the pinned root: %w", kind, err)
+		}
+		if err := store.Save(factory, prod, *raw); err != nil {
+			return nil, nil, err
+		}
+		logrus.Debugf("Pinned the %s TUF root version %d of factory %s", kind, ver, factory)
+	}
+	a.trust.roots[key] = trusted
+	return trusted, *latestRaw, nil
+}
+
+func canonicalOrNil(raw []byte) []byte {
+	msg, _, err := CanonicalTufSigned(raw)
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// verifyTufTargets verifies raw targets metadata against the pinned root, when pinning is enabled.
+func (a *Api) verifyTufTargets(factory string, prod bool, raw []byte) error {
+	if !a.tufPinningEnabled() {
+		return nil
+	}
+	a.trust.lock.Lock()
+	root := a.trust.roots[tufTrustKey(factory, prod)]
+	a.trust.lock.Unlock()
+	if root == nil {
+		var err error
+		if root, _, err = a.TufVerifiedRoot(factory, prod); err != nil {
+			return err
+		}
+	}
+	return VerifyTufTargets(root, raw)
+}
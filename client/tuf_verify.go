@@ -0,0 +1,170 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	canonical "github.com/docker/go/canonical/json"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+)
+
+// CanonicalTufSigned returns the canonical JSON of the "signed" part of TUF metadata, which is what its
+// signatures are made over. Raw metadata is used rather than a parsed struct, so that no field is lost.
+func CanonicalTufSigned(raw []byte) ([]byte, []tuf.Signature, error) {
+	var meta struct {
+		Signatures []tuf.Signature `json:"signatures"`
+		Signed     json.RawMessage `json:"signed"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse TUF metadata: %w", err)
+	}
+	if len(meta.Signed) == 0 {
+		return nil, nil, errors.New("TUF metadata has no signed part")
+	}
+	dec := canonical.NewDecoder(bytes.NewReader(meta.Signed))
+	dec.UseNumber()
+	var signed interface{}
+	if err := dec.Decode(&signed); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse TUF metadata: %w", err)
+	}
+	msg, err := canonical.MarshalCanonical(signed)
+	return msg, meta.Signatures, err
+}
+
+// VerifyTufRole checks that the message is signed by at least a threshold of the role keys.
+func VerifyTufRole(msg []byte, sigs []tuf.Signature, keys map[string]AtsKey, role *tuf.RootRole) error {
+	if role == nil {
+		return errors.New("TUF role is not defined in the root metadata")
+	}
+	valid := make(map[string]bool)
+	for _, sig := range sigs {
+		if valid[sig.KeyID] {
+			continue
+		}
+		found := false
+		for _, kid := range role.KeyIDs {
+			found = found || kid == sig.KeyID
+		}
+		key, ok := keys[sig.KeyID]
+		if !found || !ok {
+			continue
+		}
+		if err := VerifyTufSignature(key, msg, sig.Signature); err == nil {
+			valid[sig.KeyID] = true
+		}
+	}
+	if len(valid) < role.Threshold {
+		return fmt.Errorf("Only %d of %d required signatures are valid", len(valid), role.Threshold)
+	}
+	return nil
+}
+
+// VerifyTufSignature checks a signature of the message made by the given TUF public key.
+func VerifyTufSignature(key AtsKey, msg, sig []byte) error {
+	keyType, err := ParseTufKeyType(key.KeyType)
+	if err != nil {
+		return err
+	}
+	switch keyType.Name() {
+	case TufKeyTypeNameRSA:
+		der, _ := pem.Decode([]byte(key.KeyValue.Public))
+		if der == nil {
+			return errors.New("Unable to parse RSA public key PEM data")
+		}
+		pub, err := x509.ParsePKIXPublicKey(der.Bytes)
+		if err != nil {
+			return err
+		}
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("Public key is not an RSA key")
+		}
+		digest := sha256.Sum256(msg)
+		return rsa.VerifyPSS(rsaPub, keyType.SigOpts().HashFunc(), digest[:], sig,
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	case TufKeyTypeNameEd25519:
+		pub, err := hex.DecodeString(key.KeyValue.Public)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return errors.New("Unable to parse Ed25519 public key HEX data")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(pub), msg, sig) {
+			return errors.New("Invalid Ed25519 signature")
+		}
+		return nil
+	case TufKeyTypeNameEcdsaP256:
+		der, _ := pem.Decode([]byte(key.KeyValue.Public))
+		if der == nil {
+			return errors.New("Unable to parse ECDSA public key PEM data")
+		}
+		pub, err := x509.ParsePKIXPublicKey(der.Bytes)
+		if err != nil {
+			return err
+		}
+		ecPub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("Public key is not an ECDSA key")
+		}
+		digest := sha256.Sum256(msg)
+		if !ecdsa.VerifyASN1(ecPub, digest[:], sig) {
+			return errors.New("Invalid ECDSA signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported key type: %s", key.KeyType)
+}
+
+// VerifyTufRoot verifies the raw root metadata is signed by its own root keys, and, if the trusted root is given,
+// that it is the next version signed by the root keys of the trusted root.
+func VerifyTufRoot(trusted *AtsTufRoot, raw []byte) (*AtsTufRoot, error) {
+	var root AtsTufRoot
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("Unable to parse TUF root: %w", err)
+	}
+	msg, sigs, err := CanonicalTufSigned(raw)
+	if err != nil {
+		return nil, err
+	}
+	if trusted != nil {
+		if root.Signed.Version != trusted.Signed.Version+1 {
+			return nil, fmt.Errorf("Expected TUF root version %d, got %d", trusted.Signed.Version+1, root.Signed.Version)
+		}
+		role := trusted.Signed.Roles[tuf.CanonicalRootRole]
+		if err := VerifyTufRole(msg, sigs, trusted.Signed.Keys, role); err != nil {
+			return nil, fmt.Errorf("TUF root version %d is not signed by the keys of version %d: %w",
+				root.Signed.Version, trusted.Signed.Version, err)
+		}
+	}
+	role := root.Signed.Roles[tuf.CanonicalRootRole]
+	if err := VerifyTufRole(msg, sigs, root.Signed.Keys, role); err != nil {
+		return nil, fmt.Errorf("TUF root version %d is not signed by its own keys: %w", root.Signed.Version, err)
+	}
+	return &root, nil
+}
+
+// VerifyTufTargets verifies the raw targets metadata is signed by the targets keys of the given root.
+func VerifyTufTargets(root *AtsTufRoot, raw []byte) error {
+	return VerifyTufMetadata(root, tuf.CanonicalTargetsRole, raw)
+}
+
+// VerifyTufMetadata verifies the raw metadata of a top-level role is signed by the keys of that role in the given root.
+func VerifyTufMetadata(root *AtsTufRoot, roleName tuf.RoleName, raw []byte) error {
+	msg, sigs, err := CanonicalTufSigned(raw)
+	if err != nil {
+		return err
+	}
+	role := root.Signed.Roles[roleName]
+	if err := VerifyTufRole(msg, sigs, root.Signed.Keys, role); err != nil {
+		return fmt.Errorf("TUF %s metadata is not signed by the %s keys of the root version %d: %w",
+			roleName, roleName, root.Signed.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Payloads over this size are uploaded in chunks, so that a dropped connection does not restart them
+	uploadChunkThreshold = 1024 * 1024
+	uploadChunkSize      = 1024 * 1024
+	uploadRetries        = 5
+)
+
+// uploadSession is a resumable upload staged on the server. Chunks are appended to it at an offset,
+// and the request it is for refers to it instead of carrying the payload.
+type uploadSession struct {
+	Url    string `json:"url"`
+	Offset int    `json:"offset"`
+	// The request which the payload is uploaded for, used to only resume sessions of the same request
+	Target string `json:"target"`
+}
+
+// uploadStateFile keeps the session of a payload between fioctl runs, so that an upload interrupted
+// during e.g. a signing ceremony resumes when the same payload is uploaded again.
+func uploadStateFile(digest string) string {
+	return cacheDir("uploads", digest+".json")
+}
+
+func (a *Api) uploadRequest(method, url string, data []byte, headers map[string]string) (*[]byte, error) {
+	req, err := http.NewRequestWithContext(a.ctx, method, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	a.setReqHeaders(req, true)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	log := httpLogger(req)
+	res, err := a.client.Do(req)
+	if err != nil {
+		log.Debugf("Network Error: %s", err)
+		return nil, err
+	}
+	return readResponse(res, log)
+}
+
+func (a *Api) uploadSessionGet(sessionUrl string) (*uploadSession, error) {
+	body, err := a.Get(sessionUrl)
+	if err != nil {
+		return nil, err
+	}
+	var s uploadSession
+	if err = json.Unmarshal(*body, &s); err != nil {
+		return nil, err
+	}
+	s.Url = sessionUrl
+	return &s, nil
+}
+
+// uploadsSupported checks if the server advertises chunked uploads, by accepting PATCH requests
+// with the payload chunks in the Accept-Patch header of its uploads endpoint (RFC 5789).
+func (a *Api) uploadsSupported() bool {
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodOptions, a.serverUrl+"/uploads/", nil)
+	if err != nil {
+		return false
+	}
+	a.setReqHeaders(req, false)
+	res, err := a.client.Do(req)
+	if err != nil {
+		logrus.Debugf("Unable to check if the server supports chunked uploads: %s", err)
+		return false
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		return false
+	}
+	for _, accept := range strings.Split(res.Header.Get("Accept-Patch"), ",") {
+		if strings.TrimSpace(accept) == "application/octet-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadSessionStart resumes the session of a payload if the server still has it, or starts a new one.
+func (a *Api) uploadSessionStart(target, digest string, length int) (*uploadSession, error) {
+	stateFile := uploadStateFile(digest)
+	if buf, err := os.ReadFile(stateFile); err == nil {
+		var saved uploadSession
+		if err = json.Unmarshal(buf, &saved); err == nil && saved.Target == target {
+			if s, err := a.uploadSessionGet(saved.Url); err == nil {
+				logrus.Debugf("Resuming upload %s at offset %d", s.Url, s.Offset)
+				s.Target = target
+				return s, nil
+			}
+			logrus.Debugf("Unable to resume upload %s, starting a new one", saved.Url)
+		}
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"length": length, "sha256": digest})
+	body, err := a.Post(a.serverUrl+"/uploads/", data)
+	if err != nil {
+		return nil, err
+	}
+	var s uploadSession
+	if err = json.Unmarshal(*body, &s); err != nil {
+		return nil, err
+	} else if len(s.Url) == 0 {
+		return nil, fmt.Errorf("The server did not return an upload URL: %s", string(*body))
+	}
+	s.Target = target
+	if buf, err := json.Marshal(s); err == nil {
+		if err = os.MkdirAll(filepath.Dir(stateFile), 0700); err == nil {
+			err = os.WriteFile(stateFile, buf, 0600)
+		}
+		if err != nil {
+			logrus.Debugf("Unable to save the upload state, it will not be resumed: %s", err)
+		}
+	}
+	return &s, nil
+}
+
+// uploadChunks sends the payload from the session offset, resuming from the offset the server
+// acknowledged when a chunk fails.
+func (a *Api) uploadChunks(s *uploadSession, data []byte) error {
+	failures := 0
+	for s.Offset < len(data) {
+		end := s.Offset + uploadChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		headers := map[string]string{
+			"Content-Type":  "application/octet-stream",
+			"Upload-Offset": strconv.Itoa(s.Offset),
+		}
+		logrus.Debugf("Uploading bytes %d-%d of %d to %s", s.Offset, end, len(data), s.Url)
+		_, err := a.uploadRequest(http.MethodPatch, s.Url, data[s.Offset:end], headers)
+		if err == nil {
+			s.Offset = end
+			failures = 0
+			continue
+		}
+		if herr := AsHttpError(err); herr != nil && herr.Response.StatusCode < 500 &&
+			herr.Response.StatusCode != http.StatusConflict {
+			return err
+		}
+		failures += 1
+		if failures > uploadRetries {
+			return fmt.Errorf("Upload failed at %d of %d bytes: %w", s.Offset, len(data), err)
+		}
+		logrus.Warnf("Upload failed at %d of %d bytes, retrying: %s", s.Offset, len(data), err)
+		time.Sleep(time.Duration(failures) * time.Second)
+		// The chunk may have been partially written, so continue from what the server has
+		if cur, err := a.uploadSessionGet(s.Url); err == nil {
+			s.Offset = cur.Offset
+		}
+	}
+	return nil
+}
+
+// sendChunked sends a request with a large payload as a resumable chunked upload. The request is then
+// made referring to the uploaded payload. Payloads are sent as is to servers not advertising chunked
+// uploads, when recording a plan, so that the plan holds the request itself, and when the chunked upload
+// fails for any reason, as the plain request may still succeed.
+func (a *Api) sendChunked(method, url string, data []byte) (*[]byte, error) {
+	if len(data) < uploadChunkThreshold || len(a.config.PlanOut) > 0 || !a.uploadsSupported() {
+		return a.uploadRequest(method, url, data, nil)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	target := method + " " + url
+
+	s, err := a.uploadSessionStart(target, digest, len(data))
+	if err == nil {
+		err = a.uploadChunks(s, data)
+	}
+	if err != nil {
+		if a.ctx.Err() != nil {
+			return nil, err
+		}
+		logrus.Warnf("Chunked upload failed, sending the payload as is: %s", err)
+		return a.uploadRequest(method, url, data, nil)
+	}
+	body, err := a.uploadRequest(method, url, nil, map[string]string{"X-Upload-Url": s.Url})
+	if err == nil {
+		if err := os.Remove(uploadStateFile(digest)); err != nil && !os.IsNotExist(err) {
+			logrus.Debugf("Unable to remove the upload state: %s", err)
+		}
+	}
+	return body, err
+}
+
+// PutChunked is Put for large payloads, which are uploaded in chunks, and resumed after failures.
+func (a *Api) PutChunked(url string, data []byte) (*[]byte, error) {
+	return a.sendChunked(http.MethodPut, url, data)
+}
+
+// PostChunked is Post for large payloads, which are uploaded in chunks, and resumed after failures.
+func (a *Api) PostChunked(url string, data []byte) (*[]byte, error) {
+	return a.sendChunked(http.MethodPost, url, data)
+}
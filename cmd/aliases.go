@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// aliasParam matches the parameters of an alias: {1}, {2}, ... for the arguments
+// of the alias by position, and {@} for all of them.
+var aliasParam = regexp.MustCompile(`\{(\d+|@)\}`)
+
+// configAliases reads the aliases section of the config file. It is read before the command line
+// is parsed, so the config file flag is looked up in the arguments.
+func configAliases(args []string) map[string]string {
+	path := ""
+	for idx, arg := range args {
+		if strings.HasPrefix(arg, "--config=") {
+			path = strings.TrimPrefix(arg, "--config=")
+		} else if (arg == "--config" || arg == "-c") && idx+1 < len(args) {
+			path = args[idx+1]
+		}
+	}
+	if len(path) == 0 {
+		path, _ = homedir.Expand("~/.config/fioctl.yaml")
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cfg struct {
+		Aliases map[string]string `yaml:"aliases"`
+	}
+	if err := yaml.Unmarshal(buf, &cfg); err != nil {
+		logrus.Debugf("Unable to read aliases from %s: %s", path, err)
+		return nil
+	}
+	return cfg.Aliases
+}
+
+// splitCommandLine splits an alias into arguments the way a shell would for quotes and backslashes.
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("Unterminated quote or escape in: %s", line)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// expandAlias substitutes the parameters of an alias with the given arguments.
+// Arguments not used by any parameter are appended, so that flags can be added to an alias.
+func expandAlias(name, line string, args []string) ([]string, error) {
+	words, err := splitCommandLine(line)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid alias %s: %w", name, err)
+	}
+	used := make([]bool, len(args))
+	var missing error
+	var expanded []string
+	for _, word := range words {
+		if word == "{@}" {
+			expanded = append(expanded, args...)
+			for idx := range used {
+				used[idx] = true
+			}
+			continue
+		}
+		word = aliasParam.ReplaceAllStringFunc(word, func(param string) string {
+			if param == "{@}" {
+				for idx := range used {
+					used[idx] = true
+				}
+				return strings.Join(args, " ")
+			}
+			pos, _ := strconv.Atoi(param[1 : len(param)-1])
+			if pos < 1 || pos > len(args) {
+				missing = fmt.Errorf("The alias %s requires the argument %s: %s", name, param, line)
+				return param
+			}
+			used[pos-1] = true
+			return args[pos-1]
+		})
+		if strings.HasPrefix(word, "~/") {
+			if path, err := homedir.Expand(word); err == nil {
+				word = path
+			}
+		}
+		expanded = append(expanded, word)
+	}
+	if missing != nil {
+		return nil, missing
+	}
+	for idx, arg := range args {
+		if !used[idx] {
+			expanded = append(expanded, arg)
+		}
+	}
+	return expanded, nil
+}
+
+// expandAliases replaces a user defined alias in the command line with the command it stands for.
+// The alias is the first argument which is not a global flag. Built-in commands take precedence.
+func expandAliases(args []string) []string {
+	aliases := configAliases(args)
+	if len(aliases) == 0 {
+		return args
+	}
+	idx := 0
+	for idx < len(args) && strings.HasPrefix(args[idx], "-") {
+		arg := args[idx]
+		idx += 1
+		if strings.Contains(arg, "=") || arg == "--" {
+			continue
+		}
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			flag = rootCmd.PersistentFlags().Lookup(arg[2:])
+		} else if len(arg) == 2 {
+			flag = rootCmd.PersistentFlags().ShorthandLookup(arg[1:])
+		}
+		if flag != nil && flag.Value.Type() != "bool" {
+			idx += 1 // Skip the flag value
+		}
+	}
+	if idx >= len(args) {
+		return args
+	}
+	name := args[idx]
+	line, ok := aliases[name]
+	if !ok {
+		return args
+	}
+	if cmd, _, err := rootCmd.Find([]string{name}); err == nil && cmd != rootCmd {
+		logrus.Debugf("Ignoring the alias %s of the built-in command %s", name, cmd.CommandPath())
+		return args
+	}
+	expanded, err := expandAlias(name, line, args[idx+1:])
+	if err != nil {
+		subcommands.DieNotNil(subcommands.ValidationError("%s", err))
+	}
+	logrus.Debugf("Expanded the alias %s to: %s", name, strings.Join(expanded, " "))
+	return append(args[:idx:idx], expanded...)
+}
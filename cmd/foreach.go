@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var foreachCmd = &cobra.Command{
+	Use:   "foreach-factory --factories <factory>[,<factory>...] -- <command>",
+	Short: "Run a fioctl command for several factories",
+	Long: `Run a fioctl command once for each of several factories, e.g. regional factories
+operated in parallel. The output of each factory is printed in its own section.
+
+The factories can also be listed in the config file:
+
+  factories: [acme-eu, acme-us]
+
+The command exits with 0 if it succeeded for all factories. Otherwise, it exits
+with the exit code of the first factory it failed for.`,
+	Example: `
+  # Show the status of two factories:
+  fioctl foreach-factory --factories acme-eu,acme-us -- status
+
+  # Flags of the command are given after "--":
+  fioctl foreach-factory --factories acme-eu,acme-us --stop-on-error -- devices list --by-tag prod`,
+	Run:  doForeachFactory,
+	Args: cobra.MinimumNArgs(1),
+}
+
+func init() {
+	foreachCmd.Flags().StringSlice("factories", nil, "The factories to run the command for (default: factories in the config file)")
+	foreachCmd.Flags().Bool("stop-on-error", false, "Do not run the command for the remaining factories once it fails")
+}
+
+// foreachArgs returns the arguments of the fioctl command run for a factory,
+// including the global flags given to foreach-factory.
+func foreachArgs(factory string, command []string) []string {
+	var args []string
+	rootCmd.PersistentFlags().Visit(func(f *pflag.Flag) {
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	args = append(args, "--factory", factory)
+	return append(args, command...)
+}
+
+func doForeachFactory(cmd *cobra.Command, args []string) {
+	factories, _ := cmd.Flags().GetStringSlice("factories")
+	stopOnError, _ := cmd.Flags().GetBool("stop-on-error")
+	if len(factories) == 0 {
+		factories = viper.GetStringSlice("factories")
+	}
+	if len(factories) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The --factories flag is required, unless the factories are listed in the config file"))
+	}
+	for _, arg := range args {
+		if arg == "-f" || arg == "--factory" || strings.HasPrefix(arg, "--factory=") {
+			subcommands.DieNotNil(subcommands.ValidationError("The command must not set the factory, it is set by --factories"))
+		}
+	}
+	if args[0] == cmd.Name() {
+		subcommands.DieNotNil(subcommands.ValidationError("The foreach-factory command can not be nested"))
+	}
+
+	exe, err := os.Executable()
+	subcommands.DieNotNil(err)
+
+	exitCode := 0
+	results := make(map[string]string, len(factories))
+	for _, factory := range factories {
+		fmt.Printf("== Factory: %s\n", factory)
+		child := exec.Command(exe, foreachArgs(factory, args)...)
+		child.Stdin = os.Stdin
+		child.Stdout = os.Stdout
+		child.Stderr = os.Stderr
+		logrus.Debugf("Running: %s", child.String())
+
+		err := child.Run()
+		fmt.Println()
+
+		results[factory] = "ok"
+		if err != nil {
+			code := 1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+				results[factory] = fmt.Sprintf("failed (exit code %d)", code)
+			} else {
+				results[factory] = "failed: " + err.Error()
+			}
+			if exitCode == 0 {
+				exitCode = code
+			}
+			if stopOnError {
+				break
+			}
+		}
+	}
+
+	fmt.Println("== Summary")
+	t := tabby.New()
+	t.AddHeader("FACTORY", "RESULT")
+	for _, factory := range factories {
+		result, ok := results[factory]
+		if !ok {
+			result = "skipped"
+		}
+		t.AddLine(factory, result)
+	}
+	t.Print()
+	os.Exit(exitCode)
+}
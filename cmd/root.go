@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -14,17 +15,24 @@ import (
 
 	"github.com/foundriesio/fioctl/client"
 	"github.com/foundriesio/fioctl/subcommands"
+	"github.com/foundriesio/fioctl/subcommands/apps"
+	"github.com/foundriesio/fioctl/subcommands/cache"
+	"github.com/foundriesio/fioctl/subcommands/ci"
 	cfgcmd "github.com/foundriesio/fioctl/subcommands/config"
+	"github.com/foundriesio/fioctl/subcommands/dashboard"
 	"github.com/foundriesio/fioctl/subcommands/devices"
 	"github.com/foundriesio/fioctl/subcommands/docker"
 	"github.com/foundriesio/fioctl/subcommands/el2g"
 	"github.com/foundriesio/fioctl/subcommands/events"
 	"github.com/foundriesio/fioctl/subcommands/factories"
+	"github.com/foundriesio/fioctl/subcommands/factory"
 	"github.com/foundriesio/fioctl/subcommands/git"
 	"github.com/foundriesio/fioctl/subcommands/keys"
 	"github.com/foundriesio/fioctl/subcommands/login"
 	"github.com/foundriesio/fioctl/subcommands/logout"
+	"github.com/foundriesio/fioctl/subcommands/plan"
 	"github.com/foundriesio/fioctl/subcommands/secrets"
+	"github.com/foundriesio/fioctl/subcommands/serve"
 	"github.com/foundriesio/fioctl/subcommands/status"
 	"github.com/foundriesio/fioctl/subcommands/targets"
 	"github.com/foundriesio/fioctl/subcommands/teams"
@@ -34,14 +42,27 @@ import (
 )
 
 var (
-	cfgFile string
-	config  client.Config
-	verbose bool
+	cfgFile   string
+	config    client.Config
+	verbose   bool
+	debugHttp bool
+	planOut   string
+	noTufPin  bool
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "fioctl",
 	Short: "Manage Foundries Factories",
+	Long: `Manage Foundries Factories.
+
+Frequently used command lines can be given names in the aliases section of the config file.
+Parameters {1}, {2}, ... are replaced by the arguments of an alias, and {@} by all of them.
+Other arguments are appended, so that flags can be added when running an alias:
+
+  aliases:
+    release: targets promote {1} --from devel --to prod --sign --keys ~/keys.tgz
+
+  fioctl release 42`,
 }
 
 func Execute() {
@@ -62,9 +83,15 @@ func Execute() {
 		os.Exit(git.RunCredsHelper())
 	}
 
+	rootCmd.SetArgs(expandAliases(os.Args[1:]))
 	if err := rootCmd.Execute(); err != nil {
+		// Commands report their own errors, so these are command line usage errors
+		err = subcommands.WithErrorCode(subcommands.ErrorCodeValidation, err)
+		if subcommands.ErrorFormatJson {
+			subcommands.DieNotNil(err)
+		}
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(subcommands.ExitCodeOf(err))
 	}
 }
 
@@ -73,22 +100,41 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.config/fioctl.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print verbose logging")
+	rootCmd.PersistentFlags().BoolVarP(&debugHttp, "debug-http", "", false,
+		"Log method, URL, status, latency and correlation ID of every API call")
+	rootCmd.PersistentFlags().StringVarP(&planOut, "plan-out", "", "",
+		"Do not change anything, but record API changes into this file to be applied later with \"fioctl apply-plan\"")
+	rootCmd.PersistentFlags().BoolVarP(&noTufPin, "no-tuf-pin", "", false,
+		"Do not verify TUF root and targets metadata against the locally pinned TUF root")
+	rootCmd.PersistentFlags().BoolVarP(&subcommands.TimeDisplay.Utc, "utc", "", false, "Show timestamps in UTC")
+	rootCmd.PersistentFlags().BoolVarP(&subcommands.TimeDisplay.Local, "local", "", false, "Show timestamps in the local time zone")
+	rootCmd.PersistentFlags().StringVarP(&subcommands.TimeDisplay.Format, "time-format", "", "",
+		"Show timestamps in this format: rfc3339, relative (default: as returned by the server)")
 
 	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(foreachCmd)
 
+	rootCmd.AddCommand(apps.NewCommand())
+	rootCmd.AddCommand(cache.NewCommand())
+	rootCmd.AddCommand(ci.NewCommand())
 	rootCmd.AddCommand(cfgcmd.NewCommand())
+	rootCmd.AddCommand(dashboard.NewCommand())
 	rootCmd.AddCommand(devices.NewCommand())
 	rootCmd.AddCommand(docker.NewCommand())
 	rootCmd.AddCommand(git.NewCommand())
 	rootCmd.AddCommand(el2g.NewCommand())
 	rootCmd.AddCommand(events.NewCommand())
 	rootCmd.AddCommand(factories.NewCommand())
+	rootCmd.AddCommand(factory.NewCommand())
+	rootCmd.AddCommand(factory.NewApplyCommand())
 	rootCmd.AddCommand(keys.NewCommand())
 	rootCmd.AddCommand(login.NewCommand())
 	rootCmd.AddCommand(logout.NewCommand())
+	rootCmd.AddCommand(plan.NewCommand())
 	rootCmd.AddCommand(users.NewCommand())
 	rootCmd.AddCommand(teams.NewCommand())
 	rootCmd.AddCommand(secrets.NewCommand())
+	rootCmd.AddCommand(serve.NewCommand())
 	rootCmd.AddCommand(status.NewCommand())
 	rootCmd.AddCommand(targets.NewCommand())
 	rootCmd.AddCommand(version.NewCommand())
@@ -98,6 +144,8 @@ func init() {
 
 	rootCmd.AddCommand(docsRstCmd)
 	rootCmd.AddCommand(docsMdCmd)
+
+	subcommands.RegisterIndexCompletions(rootCmd)
 }
 
 func getConfigDir() string {
@@ -144,7 +192,20 @@ func initConfig() {
 	if err := viper.Unmarshal(&config); err != nil {
 		panic(fmt.Sprintf("Unexpected failure parsing configuration: %s", err))
 	}
+	if debugHttp {
+		config.DebugHttp = true
+	}
+	config.PlanOut = planOut
+	if !noTufPin {
+		configDir := getConfigDir()
+		if cfgFile != "" {
+			configDir = filepath.Dir(cfgFile)
+		}
+		config.TufPinDir = filepath.Join(configDir, "fioctl-tuf")
+	}
 	subcommands.Config = config
+	subcommands.LoadCredentials()
+	subcommands.DieNotNil(subcommands.TimeDisplay.Validate())
 }
 
 var completionCmd = &cobra.Command{
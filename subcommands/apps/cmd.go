@@ -0,0 +1,113 @@
+package apps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var api *client.Api
+
+var cmd = &cobra.Command{
+	Use:   "apps",
+	Short: "Inspect and check the compose apps of factory's targets",
+	Long: `Inspect and check the compose apps of factory's targets.
+
+Apps are referenced as <app>@<version>, where the version is the target version
+the app was built for, e.g. shellhttpd@42.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		api = subcommands.Login(cmd)
+	},
+}
+
+func NewCommand() *cobra.Command {
+	subcommands.RequireFactory(cmd)
+	return cmd
+}
+
+// appRef is an app of a target version, given as <app>@<version>.
+type appRef struct {
+	Name    string
+	Version string
+}
+
+func (r appRef) String() string {
+	return r.Name + "@" + r.Version
+}
+
+func parseAppRef(arg string) (appRef, error) {
+	parts := strings.SplitN(arg, "@", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return appRef{}, subcommands.ValidationError("Invalid app reference %s, expected <app>@<version>", arg)
+	}
+	return appRef{Name: parts[0], Version: parts[1]}, nil
+}
+
+// versionTargets lists the names of targets of a version, sorted, and their custom metadata.
+func versionTargets(factory, version string) ([]string, map[string]client.TufCustom, error) {
+	targets, err := api.TargetsList(factory, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	customs := make(map[string]client.TufCustom)
+	for name, target := range targets {
+		custom, err := api.TargetCustom(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		if custom.Version != version {
+			continue
+		}
+		names = append(names, name)
+		customs[name] = *custom
+	}
+	if len(names) == 0 {
+		return nil, nil, subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("No targets found for version %s", version))
+	}
+	sort.Strings(names)
+	return names, customs, nil
+}
+
+// findAppTarget finds a target of the version which contains the app.
+// All targets of a version contain the same apps, so the first one by name is used.
+func findAppTarget(factory string, ref appRef) (string, client.ComposeApp, error) {
+	names, customs, err := versionTargets(factory, ref.Version)
+	if err != nil {
+		return "", client.ComposeApp{}, err
+	}
+	for _, name := range names {
+		if app, ok := customs[name].ComposeApps[ref.Name]; ok {
+			return name, app, nil
+		}
+	}
+	return "", client.ComposeApp{}, subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+		fmt.Errorf("App %s is not found in targets of version %s", ref.Name, ref.Version))
+}
+
+// appService is a service of a compose app and the image it runs.
+type appService struct {
+	Name  string
+	Image string
+}
+
+// appServices lists the services of a compose app bundle, sorted by name.
+func appServices(bundle *client.ComposeAppBundle) []appService {
+	var services []appService
+	specs, _ := bundle.Content.ComposeSpec["services"].(map[string]interface{})
+	for name, spec := range specs {
+		svc := appService{Name: name}
+		if m, ok := spec.(map[string]interface{}); ok {
+			svc.Image, _ = m["image"].(string)
+		}
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
@@ -0,0 +1,282 @@
+package apps
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+	"github.com/foundriesio/fioctl/subcommands/keys"
+)
+
+var (
+	cosignPath       string
+	cosignKeyless    bool
+	cosignIdentity   string
+	cosignOidcIssuer string
+)
+
+func init() {
+	signImagesCmd := &cobra.Command{
+		Use:   "sign-images <target> (--keys=<offline-targets-creds.tgz> | --keyless)",
+		Short: "Sign the container images of a target's apps with cosign",
+		Long: `Sign the digests of all container images referenced by the apps of a target with cosign,
+after the apps are published. The signatures are stored in the registry next to the images,
+so that any Sigstore aware tool can verify them.
+
+Images are signed either:
+ * with the offline targets keys of the factory, so that no new key has to be managed, or
+ * keyless, with a short-lived certificate for the identity of an OIDC login.
+
+The target is given by its name, or by a version to sign images of all targets of that version.
+cosign must be installed, and logged in to hub.foundries.io, e.g. with "fioctl configure-docker".`,
+		Run:  doSignImages,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Sign images of the target version 42 with the offline targets keys:
+  fioctl apps sign-images 42 --keys ~/path/to/keys/targets.only.key.tgz
+
+  # Sign images keyless in a CI job:
+  fioctl apps sign-images intel-corei7-64-lmp-42 --keyless`,
+	}
+	cmd.AddCommand(signImagesCmd)
+	signImagesCmd.Flags().StringP("keys", "k", "", "Path to <offline-creds.tgz> used to sign the images.")
+	signImagesCmd.Flags().BoolVarP(&cosignKeyless, "keyless", "", false, "Sign keyless with an OIDC identity")
+	signImagesCmd.Flags().StringVarP(&cosignPath, "cosign", "", "cosign", "The path to the cosign executable")
+
+	verifyImagesCmd := &cobra.Command{
+		Use:   "verify-signatures <target>",
+		Short: "Verify cosign signatures of every container image of a target",
+		Long: `Verify that every container image referenced by the apps of a target has a cosign signature,
+made by the offline targets keys of the production TUF root, or keyless by the given identity.`,
+		Run:  doVerifyImages,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Verify signatures made with the offline targets keys:
+  fioctl apps verify-signatures 42
+
+  # Verify keyless signatures made by a CI workflow:
+  fioctl apps verify-signatures 42 --keyless \
+    --certificate-identity https://github.com/org/repo/.github/workflows/release.yml@refs/heads/main \
+    --certificate-oidc-issuer https://token.actions.githubusercontent.com`,
+	}
+	cmd.AddCommand(verifyImagesCmd)
+	verifyImagesCmd.Flags().BoolVarP(&cosignKeyless, "keyless", "", false, "Verify keyless signatures")
+	verifyImagesCmd.Flags().StringVarP(&cosignIdentity, "certificate-identity", "", "",
+		"The identity keyless signatures must be made by")
+	verifyImagesCmd.Flags().StringVarP(&cosignOidcIssuer, "certificate-oidc-issuer", "", "",
+		"The OIDC issuer of the identity keyless signatures must be made by")
+	verifyImagesCmd.Flags().StringVarP(&cosignPath, "cosign", "", "cosign", "The path to the cosign executable")
+}
+
+// targetImages finds the images of all apps of a target, given by its name or version, sorted.
+func targetImages(factory, target string) []string {
+	var customs []client.TufCustom
+	var names []string
+	if _, err := strconv.Atoi(target); err == nil {
+		var byName map[string]client.TufCustom
+		names, byName, err = versionTargets(factory, target)
+		subcommands.DieNotNil(err)
+		for _, name := range names {
+			customs = append(customs, byName[name])
+		}
+	} else {
+		meta, err := api.TargetGet(factory, target)
+		subcommands.DieNotNil(err)
+		custom, err := api.TargetCustom(*meta)
+		subcommands.DieNotNil(err)
+		names = []string{target}
+		customs = []client.TufCustom{*custom}
+	}
+
+	found := make(map[string]bool)
+	var images []string
+	for idx, custom := range customs {
+		for app := range custom.ComposeApps {
+			bundle := composeAppBundle(factory, names[idx], app)
+			for _, svc := range appServices(bundle) {
+				if len(svc.Image) > 0 && !found[svc.Image] {
+					found[svc.Image] = true
+					images = append(images, svc.Image)
+				}
+			}
+		}
+	}
+	if len(images) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("The target %s has no app images", target)))
+	}
+	sort.Strings(images)
+	return images
+}
+
+func runCosign(env []string, args ...string) error {
+	c := exec.Command(cosignPath, args...)
+	c.Env = append(os.Environ(), env...)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	logrus.Debugf("Running: %s %s", cosignPath, strings.Join(args, " "))
+	return c.Run()
+}
+
+// offlineTargetsPublicKeys writes the offline targets public keys as PEM files cosign can verify with.
+func offlineTargetsPublicKeys(factory, dir string) []string {
+	root, role := offlineTargetsRole(factory)
+	var files []string
+	for _, kid := range role.KeyIDs {
+		key := root.Signed.Keys[kid]
+		pub := key.KeyValue.Public
+		if strings.EqualFold(key.KeyType, client.TufKeyTypeNameEd25519) {
+			raw, err := hex.DecodeString(pub)
+			subcommands.DieNotNil(err)
+			der, err := x509.MarshalPKIXPublicKey(ed25519.PublicKey(raw))
+			subcommands.DieNotNil(err)
+			pub = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		}
+		file := filepath.Join(dir, kid+".pub")
+		subcommands.DieNotNil(os.WriteFile(file, []byte(pub), 0600))
+		files = append(files, file)
+	}
+	return files
+}
+
+// importOfflineKeys converts the offline targets keys found in the creds into cosign keys.
+// cosign only signs with its own encrypted key format, so keys are imported with a random password.
+func importOfflineKeys(factory, keysFile, dir string) ([]string, string) {
+	creds, err := keys.GetOfflineCreds(keysFile)
+	subcommands.DieNotNil(err, "Failed to open offline keys file")
+	root, role := offlineTargetsRole(factory)
+
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	subcommands.DieNotNil(err)
+	password := hex.EncodeToString(buf)
+
+	var files []string
+	for _, kid := range role.KeyIDs {
+		signer, err := keys.FindTufSigner(kid, root.Signed.Keys[kid].KeyValue.Public, creds)
+		if err != nil {
+			logrus.Debugf("Skipping offline key %s: %s", kid, err)
+			continue
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(signer.Key)
+		subcommands.DieNotNil(err)
+		pemFile := filepath.Join(dir, kid+".pem")
+		subcommands.DieNotNil(os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+		prefix := filepath.Join(dir, kid)
+		subcommands.DieNotNil(runCosign([]string{"COSIGN_PASSWORD=" + password},
+			"import-key-pair", "--key", pemFile, "--output-key-prefix", prefix), "Failed to import an offline key:")
+		subcommands.DieNotNil(os.Remove(pemFile))
+		files = append(files, prefix+".key")
+	}
+	if len(files) == 0 {
+		subcommands.DieNotNil(fmt.Errorf("None of the offline targets keys is found in %s", keysFile))
+	}
+	return files, password
+}
+
+func doSignImages(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	if cosignKeyless == (len(keysFile) > 0) {
+		subcommands.DieNotNil(subcommands.ValidationError("Either --keys or --keyless must be given"))
+	}
+	_, err := exec.LookPath(cosignPath)
+	subcommands.DieNotNil(err, "cosign is required to sign images:")
+
+	images := targetImages(factory, args[0])
+
+	tmpDir, err := os.MkdirTemp("", "fioctl-cosign-")
+	subcommands.DieNotNil(err)
+	defer os.RemoveAll(tmpDir)
+	var keyFiles []string
+	var env []string
+	if !cosignKeyless {
+		var password string
+		keyFiles, password = importOfflineKeys(factory, keysFile, tmpDir)
+		env = append(env, "COSIGN_PASSWORD="+password)
+	}
+
+	for _, image := range images {
+		if !strings.Contains(image, "@sha256:") {
+			// Tags can be moved to other images, so only digests are signed
+			fmt.Println("WARNING: Skipping an image not pinned by a digest:", image)
+			continue
+		}
+		fmt.Println("Signing", image)
+		if cosignKeyless {
+			err = runCosign(env, "sign", "--yes", image)
+		} else {
+			for _, key := range keyFiles {
+				if err = runCosign(env, "sign", "--yes", "--key", key, image); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			subcommands.DieNotNil(err, "Failed to sign "+image+":")
+		}
+	}
+}
+
+func doVerifyImages(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	if cosignKeyless && (len(cosignIdentity) == 0 || len(cosignOidcIssuer) == 0) {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The --certificate-identity and --certificate-oidc-issuer flags are required to verify keyless signatures"))
+	}
+	_, err := exec.LookPath(cosignPath)
+	subcommands.DieNotNil(err, "cosign is required to verify images:")
+
+	images := targetImages(factory, args[0])
+
+	tmpDir, err := os.MkdirTemp("", "fioctl-cosign-")
+	subcommands.DieNotNil(err)
+	defer os.RemoveAll(tmpDir)
+	var pubFiles []string
+	if !cosignKeyless {
+		pubFiles = offlineTargetsPublicKeys(factory, tmpDir)
+	}
+
+	var failed []string
+	for _, image := range images {
+		verified := false
+		if cosignKeyless {
+			verified = runCosign(nil, "verify", "--certificate-identity", cosignIdentity,
+				"--certificate-oidc-issuer", cosignOidcIssuer, image) == nil
+		} else {
+			for _, pub := range pubFiles {
+				if runCosign(nil, "verify", "--key", pub, image) == nil {
+					verified = true
+					break
+				}
+			}
+		}
+		status := "verified"
+		if !verified {
+			status = "NOT VERIFIED"
+			failed = append(failed, image)
+		}
+		fmt.Printf("%s\t%s\n", status, image)
+	}
+	if len(failed) > 0 {
+		os.RemoveAll(tmpDir)
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("%d of %d images have no valid signature", len(failed), len(images))))
+	}
+}
@@ -0,0 +1,246 @@
+package apps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// Lines of unchanged context shown around changes of a compose file
+const diffContext = 2
+
+var (
+	diffTargets []string
+	diffApp     string
+)
+
+func init() {
+	diffCmd := &cobra.Command{
+		Use:   "diff --target <from version> --target <to version>",
+		Short: "Show what changed in the apps between two target versions",
+		Long: `Show what changed in the compose apps between two target versions: the apps added
+or removed, and for each changed app the services added or removed, the image
+digests that changed, and the changes of its compose file.
+
+This shows exactly what an app-only update ships to devices.`,
+		Run:  doDiff,
+		Args: cobra.NoArgs,
+		Example: `
+  # Show changes of all apps between target versions 120 and 125:
+  fioctl apps diff --target 120 --target 125
+
+  # Only show changes of the shellhttpd app:
+  fioctl apps diff --target 120 --target 125 --app shellhttpd`,
+	}
+	cmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringArrayVarP(&diffTargets, "target", "", nil,
+		"A target version to compare. Must be given twice: the version to compare from, and the version to compare to")
+	diffCmd.Flags().StringVarP(&diffApp, "app", "", "", "Only show changes of this app")
+}
+
+// versionApps finds the apps of a target version.
+func versionApps(factory, version string) (string, map[string]client.ComposeApp) {
+	names, customs, err := versionTargets(factory, version)
+	subcommands.DieNotNil(err)
+	// All targets of a version contain the same apps
+	return names[0], customs[names[0]].ComposeApps
+}
+
+func composeAppBundle(factory, targetName, app string) *client.ComposeAppBundle {
+	bundle, err := api.TargetComposeApp(factory, targetName, app)
+	subcommands.DieNotNil(err)
+	if len(bundle.Error) > 0 {
+		subcommands.DieNotNil(fmt.Errorf("The app %s of %s is not valid: %s", app, targetName, bundle.Error))
+	}
+	return bundle
+}
+
+// diffLines returns a line diff of two texts, with lines prefixed by "-", "+", or " " when unchanged.
+// Only changed lines and a few lines of context around them are returned.
+func diffLines(from, to string) []string {
+	a := strings.Split(strings.TrimRight(from, "\n"), "\n")
+	b := strings.Split(strings.TrimRight(to, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var all []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			all = append(all, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, "-"+a[i])
+			i++
+		default:
+			all = append(all, "+"+b[j])
+			j++
+		}
+	}
+
+	show := make([]bool, len(all))
+	for idx, line := range all {
+		if line[0] == ' ' {
+			continue
+		}
+		for k := idx - diffContext; k <= idx+diffContext; k++ {
+			if k >= 0 && k < len(all) {
+				show[k] = true
+			}
+		}
+	}
+	var lines []string
+	for idx, line := range all {
+		if !show[idx] {
+			continue
+		}
+		if idx > 0 && !show[idx-1] {
+			lines = append(lines, "...")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func composeSpecYaml(bundle *client.ComposeAppBundle) string {
+	if bundle.Content.ComposeSpec == nil {
+		return ""
+	}
+	// If a JSON unmarshal worked - YAML marshal will also work
+	spec, _ := yaml.Marshal(bundle.Content.ComposeSpec)
+	return string(spec)
+}
+
+func diffApps(factory, fromVersion, fromTarget, toVersion, toTarget, name string) {
+	from := composeAppBundle(factory, fromTarget, name)
+	to := composeAppBundle(factory, toTarget, name)
+
+	fromImages := make(map[string]string)
+	for _, svc := range appServices(from) {
+		fromImages[svc.Name] = svc.Image
+	}
+	toImages := make(map[string]string)
+	for _, svc := range appServices(to) {
+		toImages[svc.Name] = svc.Image
+	}
+
+	var added, removed, changed []string
+	for _, svc := range appServices(to) {
+		if image, ok := fromImages[svc.Name]; !ok {
+			added = append(added, svc.Name)
+		} else if image != svc.Image {
+			changed = append(changed, svc.Name)
+		}
+	}
+	for _, svc := range appServices(from) {
+		if _, ok := toImages[svc.Name]; !ok {
+			removed = append(removed, svc.Name)
+		}
+	}
+
+	if len(added) > 0 {
+		fmt.Println("\tServices added:")
+		for _, svc := range added {
+			fmt.Printf("\t\t%s: %s\n", svc, toImages[svc])
+		}
+	}
+	if len(removed) > 0 {
+		fmt.Println("\tServices removed:")
+		for _, svc := range removed {
+			fmt.Printf("\t\t%s: %s\n", svc, fromImages[svc])
+		}
+	}
+	if len(changed) > 0 {
+		fmt.Println("\tImages changed:")
+		for _, svc := range changed {
+			fmt.Printf("\t\t%s:\n\t\t\t- %s\n\t\t\t+ %s\n", svc, fromImages[svc], toImages[svc])
+		}
+	}
+
+	lines := diffLines(composeSpecYaml(from), composeSpecYaml(to))
+	if len(lines) == 0 {
+		fmt.Println("\tCompose file: unchanged")
+		return
+	}
+	fmt.Printf("\tCompose file:\n\t\t--- %s\n\t\t+++ %s\n", fromVersion, toVersion)
+	for _, line := range lines {
+		fmt.Println("\t\t" + line)
+	}
+}
+
+func doDiff(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	if len(diffTargets) != 2 {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The --target flag must be given twice: the version to compare from, and the version to compare to"))
+	}
+	fromVersion, toVersion := diffTargets[0], diffTargets[1]
+	logrus.Debugf("Comparing apps of %s and %s", fromVersion, toVersion)
+
+	fromTarget, fromApps := versionApps(factory, fromVersion)
+	toTarget, toApps := versionApps(factory, toVersion)
+
+	var names []string
+	for name := range fromApps {
+		names = append(names, name)
+	}
+	for name := range toApps {
+		if _, ok := fromApps[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(diffApp) > 0 {
+		if _, ok := fromApps[diffApp]; !ok {
+			if _, ok := toApps[diffApp]; !ok {
+				subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+					fmt.Errorf("App %s is not found in targets of versions %s and %s", diffApp, fromVersion, toVersion)))
+			}
+		}
+		names = []string{diffApp}
+	}
+
+	for idx, name := range names {
+		if idx > 0 {
+			fmt.Println()
+		}
+		fromApp, inFrom := fromApps[name]
+		toApp, inTo := toApps[name]
+		switch {
+		case !inFrom:
+			fmt.Printf("## %s: added\n\t+ %s\n", name, toApp.Uri)
+		case !inTo:
+			fmt.Printf("## %s: removed\n\t- %s\n", name, fromApp.Uri)
+		case fromApp.Hash() == toApp.Hash():
+			fmt.Printf("## %s: unchanged\n\t  %s\n", name, toApp.Uri)
+		default:
+			fmt.Printf("## %s: changed\n\t- %s\n\t+ %s\n", name, fromApp.Uri, toApp.Uri)
+			diffApps(factory, fromVersion, fromTarget, toVersion, toTarget, name)
+		}
+	}
+}
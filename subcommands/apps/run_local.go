@@ -0,0 +1,165 @@
+package apps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	runLocalDir      string
+	runLocalCompose  string
+	runLocalPlatform string
+	runLocalNoStart  bool
+)
+
+func init() {
+	runLocalCmd := &cobra.Command{
+		Use:   "run-local <app>@<version>",
+		Short: "Run an app on this computer the way aktualizr-lite runs it on devices",
+		Long: `Download the bundle of an app, and start it with Docker Compose the same way
+aktualizr-lite starts apps on devices. This helps to reproduce issues of apps that work
+with a local "docker compose up", but fail on devices.
+
+Like on devices:
+ * The app bundle is extracted into a directory named after the app.
+ * The compose project is named after the app.
+ * The images are pulled first, and then the app is started with:
+   docker compose up --remove-orphans --detach
+
+The hub.foundries.io images are pulled by Docker, so "fioctl configure-docker" must be run first.
+Devices usually have a different CPU architecture, which can be emulated with --platform.`,
+		Run:  doRunLocal,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Run the shellhttpd app of the target version 42:
+  fioctl apps run-local shellhttpd@42
+
+  # Run the arm64 images of the app using QEMU emulation:
+  fioctl apps run-local shellhttpd@42 --platform linux/arm64
+
+  # Only download the app bundle to inspect it:
+  fioctl apps run-local shellhttpd@42 --dir /tmp/shellhttpd --no-start`,
+	}
+	cmd.AddCommand(runLocalCmd)
+	runLocalCmd.Flags().StringVarP(&runLocalDir, "dir", "", "",
+		"The directory to extract the app bundle to (default: ./<app>)")
+	runLocalCmd.Flags().StringVarP(&runLocalCompose, "compose", "", "docker compose",
+		`The Docker Compose command, e.g. "docker-compose" to use Compose v1 like older devices`)
+	runLocalCmd.Flags().StringVarP(&runLocalPlatform, "platform", "", "",
+		"Run images of this platform, e.g. linux/arm64. Sets DOCKER_DEFAULT_PLATFORM")
+	runLocalCmd.Flags().BoolVarP(&runLocalNoStart, "no-start", "", false, "Only extract the app bundle, do not start the app")
+}
+
+// extractAppBundle extracts a gzipped tarball of an app bundle into a directory.
+func extractAppBundle(bundle []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(bundle))
+	if err != nil {
+		return fmt.Errorf("Unable to read the app bundle: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Unable to read the app bundle: %w", err)
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("The app bundle contains an unsafe path: %s", hdr.Name)
+		}
+		dst := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			logrus.Debugf("Skipping %s of the app bundle: unsupported file type", hdr.Name)
+		}
+	}
+}
+
+func runCompose(dir string, env []string, args ...string) error {
+	argv := append(strings.Fields(runLocalCompose), args...)
+	fmt.Println("Running:", strings.Join(argv, " "))
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Dir = dir
+	c.Env = env
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+func doRunLocal(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	ref, err := parseAppRef(args[0])
+	subcommands.DieNotNil(err)
+	dir := runLocalDir
+	if len(dir) == 0 {
+		dir = ref.Name
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The directory %s is not empty. Remove it, or use the --dir flag", dir))
+	}
+
+	targetName, app, err := findAppTarget(factory, ref)
+	subcommands.DieNotNil(err)
+	logrus.Debugf("Running %s of target %s", ref, targetName)
+
+	fmt.Println("Downloading", app.Uri)
+	manifest, err := api.RegistryManifestGet(app.Uri)
+	subcommands.DieNotNil(err)
+	if len(manifest.Layers) == 0 {
+		subcommands.DieNotNil(fmt.Errorf("The app bundle %s has no content", app.Uri))
+	}
+	// The first layer of an app bundle manifest is the tarball of the app directory
+	bundle, err := api.RegistryBlobGet(app.Uri, manifest.Layers[0].Digest)
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.MkdirAll(dir, 0755))
+	subcommands.DieNotNil(extractAppBundle(bundle, dir))
+	fmt.Println("Extracted the app bundle to", dir)
+	if runLocalNoStart {
+		return
+	}
+
+	env := os.Environ()
+	if len(runLocalPlatform) > 0 {
+		env = append(env, "DOCKER_DEFAULT_PLATFORM="+runLocalPlatform)
+	}
+	// The compose project name is the app name on devices, whatever the local directory is
+	subcommands.DieNotNil(runCompose(dir, env, "--project-name", ref.Name, "pull"))
+	subcommands.DieNotNil(runCompose(dir, env, "--project-name", ref.Name, "up", "--remove-orphans", "--detach"))
+	fmt.Printf("\nThe app is running. Stop it with:\n  cd %s && %s --project-name %s down\n", dir, runLocalCompose, ref.Name)
+}
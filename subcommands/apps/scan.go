@@ -0,0 +1,181 @@
+package apps
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// Severities reported by scanners, from the least severe
+var severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+var (
+	scanFailOn string
+	scanTrivy  string
+)
+
+// trivyReport is the part of "trivy image --format json" output used to report findings.
+type trivyReport struct {
+	Results []struct {
+		Target          string               `json:"Target"`
+		Vulnerabilities []trivyVulnerability `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+type trivyVulnerability struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgName          string `json:"PkgName"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Severity         string `json:"Severity"`
+	Title            string `json:"Title"`
+}
+
+func init() {
+	scanCmd := &cobra.Command{
+		Use:   "scan <app>@<version>",
+		Short: "Scan the images of an app for known vulnerabilities",
+		Long: `Scan the container images of an app for known vulnerabilities (CVEs), and report
+them per image.
+
+Images are scanned with Trivy directly from the registry, so they do not have to be
+pulled into a local Docker engine. Trivy must be installed. The hub.foundries.io
+images are accessed with the fioctl credentials, which need the "containers:read" scope.
+
+With --fail-on, the command exits with a non-zero code when a vulnerability of that
+severity or above is found, so that it can gate publishing an app.`,
+		Run:  doScan,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Report vulnerabilities of the shellhttpd app in the target version 42:
+  fioctl apps scan shellhttpd@42
+
+  # Fail a CI job when the app has critical vulnerabilities:
+  fioctl apps scan shellhttpd@42 --fail-on critical`,
+	}
+	cmd.AddCommand(scanCmd)
+	scanCmd.Flags().StringVarP(&scanFailOn, "fail-on", "", "",
+		"Exit with an error if a vulnerability of this severity or above is found: low, medium, high, critical")
+	scanCmd.Flags().StringVarP(&scanTrivy, "trivy", "", "trivy", "The path to the trivy executable")
+}
+
+func severityLevel(severity string) int {
+	return slices.Index(severities, strings.ToUpper(severity))
+}
+
+func scanImage(image string) ([]trivyVulnerability, error) {
+	c := exec.Command(scanTrivy, "image", "--quiet", "--format", "json", "--scanners", "vuln",
+		"--image-src", "remote", image)
+	c.Env = os.Environ()
+	if strings.HasPrefix(image, "hub.foundries.io/") {
+		if token := subcommands.Config.ClientCredentials.AccessToken; len(token) > 0 {
+			c.Env = append(c.Env, "TRIVY_USERNAME=<token>", "TRIVY_PASSWORD="+token)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	logrus.Debugf("Running: %s", strings.Join(c.Args, " "))
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("Unable to scan %s: %w\n%s", image, err, strings.TrimSpace(stderr.String()))
+	}
+	var report trivyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return nil, fmt.Errorf("Unable to parse the scan report of %s: %w", image, err)
+	}
+	var vulns []trivyVulnerability
+	for _, result := range report.Results {
+		vulns = append(vulns, result.Vulnerabilities...)
+	}
+	sort.SliceStable(vulns, func(i, j int) bool {
+		li, lj := severityLevel(vulns[i].Severity), severityLevel(vulns[j].Severity)
+		if li != lj {
+			return li > lj
+		}
+		return vulns[i].VulnerabilityID < vulns[j].VulnerabilityID
+	})
+	return vulns, nil
+}
+
+func doScan(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	ref, err := parseAppRef(args[0])
+	subcommands.DieNotNil(err)
+	failLevel := -1
+	if len(scanFailOn) > 0 {
+		if failLevel = severityLevel(scanFailOn); failLevel < 1 {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"Invalid --fail-on severity %s, expected low, medium, high or critical", scanFailOn))
+		}
+	}
+	if _, err := exec.LookPath(scanTrivy); err != nil {
+		subcommands.DieNotNil(fmt.Errorf("Trivy is required to scan images: %w", err))
+	}
+
+	targetName, _, err := findAppTarget(factory, ref)
+	subcommands.DieNotNil(err)
+	logrus.Debugf("Scanning %s of target %s", ref, targetName)
+	bundle, err := api.TargetComposeApp(factory, targetName, ref.Name)
+	subcommands.DieNotNil(err)
+	if len(bundle.Error) > 0 {
+		subcommands.DieNotNil(fmt.Errorf("The app %s is not valid: %s", ref, bundle.Error))
+	}
+
+	failing := 0
+	for idx, svc := range appServices(bundle) {
+		if idx > 0 {
+			fmt.Println()
+		}
+		if len(svc.Image) == 0 {
+			fmt.Printf("## Service %s: no image\n", svc.Name)
+			continue
+		}
+		fmt.Printf("## Service %s: %s\n", svc.Name, svc.Image)
+		vulns, err := scanImage(svc.Image)
+		subcommands.DieNotNil(err)
+
+		counts := make(map[string]int)
+		for _, v := range vulns {
+			counts[strings.ToUpper(v.Severity)]++
+			if failLevel > 0 && severityLevel(v.Severity) >= failLevel {
+				failing++
+			}
+		}
+		var summary []string
+		for i := len(severities) - 1; i >= 0; i-- {
+			summary = append(summary, fmt.Sprintf("%s: %d", severities[i], counts[severities[i]]))
+		}
+		fmt.Printf("\tTotal: %d (%s)\n", len(vulns), strings.Join(summary, ", "))
+		if len(vulns) == 0 {
+			continue
+		}
+		fmt.Println()
+		t := tabby.New()
+		t.AddHeader("SEVERITY", "ID", "PACKAGE", "INSTALLED", "FIXED", "TITLE")
+		for _, v := range vulns {
+			title := v.Title
+			if len(title) > 60 {
+				title = title[:57] + "..."
+			}
+			t.AddLine(v.Severity, v.VulnerabilityID, v.PkgName, v.InstalledVersion, v.FixedVersion, title)
+		}
+		t.Print()
+	}
+
+	if failing > 0 {
+		subcommands.DieNotNil(fmt.Errorf("Found %d vulnerabilities of %s severity or above in %s",
+			failing, strings.ToLower(scanFailOn), ref))
+	}
+}
@@ -0,0 +1,157 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	canonical "github.com/docker/go/canonical/json"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+	"github.com/foundriesio/fioctl/subcommands/keys"
+)
+
+func init() {
+	signCmd := &cobra.Command{
+		Use:   "sign <app>@<version> --keys=<offline-targets-creds.tgz>",
+		Short: "Sign an app with the offline targets keys",
+		Long: `Attach a signature made with the offline targets keys to the manifest of an app.
+
+The signature proves that the app bundle, identified by its manifest digest, was approved
+by the holders of the offline keys. This provides a provenance of apps independent of the
+TUF signing of targets, e.g. for apps shared between factories or mirrored to other registries.
+
+The signature is made by the offline targets keys of the production TUF root.
+Verify it with "fioctl apps verify".`,
+		Run:  doSign,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Sign the shellhttpd app of the target version 42:
+  fioctl apps sign shellhttpd@42 --keys ~/path/to/keys/targets.only.key.tgz`,
+	}
+	cmd.AddCommand(signCmd)
+	signCmd.Flags().StringP("keys", "k", "", "Path to <offline-creds.tgz> used to sign the app.")
+	_ = signCmd.MarkFlagRequired("keys")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify <app>@<version>",
+		Short: "Verify the offline targets keys signature of an app",
+		Long: `Verify that the manifest of an app has a signature made by the offline targets keys
+of the production TUF root, as attached by "fioctl apps sign".`,
+		Run:  doVerify,
+		Args: cobra.ExactArgs(1),
+	}
+	cmd.AddCommand(verifyCmd)
+}
+
+// offlineTargetsRole returns the targets role of the production TUF root without the online targets key.
+func offlineTargetsRole(factory string) (*client.AtsTufRoot, *tuf.RootRole) {
+	root, err := api.TufProdRootGet(factory)
+	subcommands.DieNotNil(err, "Failed to fetch production root role")
+	onlinePub, err := api.TufTargetsOnlineKey(factory)
+	subcommands.DieNotNil(err, "Failed to fetch online targets public key")
+
+	role := &tuf.RootRole{Threshold: 1}
+	if targets := root.Signed.Roles[tuf.CanonicalTargetsRole]; targets != nil {
+		role.Threshold = targets.Threshold
+		for _, kid := range targets.KeyIDs {
+			if root.Signed.Keys[kid].KeyValue.Public != onlinePub.KeyValue.Public {
+				role.KeyIDs = append(role.KeyIDs, kid)
+			}
+		}
+	}
+	if len(role.KeyIDs) == 0 {
+		subcommands.DieNotNil(fmt.Errorf(`Root role is not configured to sign targets offline.
+Please, run "fioctl keys rotate-targets" in order to create offline targets keys.`))
+	}
+	return root, role
+}
+
+func doSign(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	ref, err := parseAppRef(args[0])
+	subcommands.DieNotNil(err)
+	keysFile, _ := cmd.Flags().GetString("keys")
+	creds, err := keys.GetOfflineCreds(keysFile)
+	subcommands.DieNotNil(err, "Failed to open offline keys file")
+
+	_, app, err := findAppTarget(factory, ref)
+	subcommands.DieNotNil(err)
+	logrus.Debugf("Signing %s", app.Uri)
+
+	root, role := offlineTargetsRole(factory)
+	var signers []keys.TufSigner
+	for _, kid := range role.KeyIDs {
+		signer, err := keys.FindTufSigner(kid, root.Signed.Keys[kid].KeyValue.Public, creds)
+		if err != nil {
+			// The threshold might be reached by keys of other holders
+			logrus.Debugf("Skipping offline key %s: %s", kid, err)
+			continue
+		}
+		signers = append(signers, *signer)
+	}
+	if len(signers) == 0 {
+		subcommands.DieNotNil(fmt.Errorf("None of the offline targets keys is found in %s", keysFile))
+	}
+
+	sig := client.AppSignature{
+		Signed: client.AppSignatureMeta{
+			Type:     client.AppSignatureType,
+			App:      ref.Name,
+			Uri:      app.Uri,
+			Version:  ref.Version,
+			SignedAt: time.Now().UTC().Round(time.Second).Format(time.RFC3339),
+		},
+	}
+	meta, err := canonical.MarshalCanonical(sig.Signed)
+	subcommands.DieNotNil(err)
+	sig.Signatures, err = keys.SignTufMeta(meta, signers...)
+	subcommands.DieNotNil(err, "Failed to sign the app")
+	subcommands.DieNotNil(api.AppSignaturePut(factory, app, sig))
+
+	fmt.Printf("Signed %s (%s) with keys:\n", ref, app.Uri)
+	for _, s := range sig.Signatures {
+		fmt.Println("\t", s.KeyID)
+	}
+	if len(signers) < role.Threshold {
+		fmt.Printf("WARNING: %d of %d required signatures are made, the app will not verify\n",
+			len(signers), role.Threshold)
+	}
+}
+
+func doVerify(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	ref, err := parseAppRef(args[0])
+	subcommands.DieNotNil(err)
+
+	_, app, err := findAppTarget(factory, ref)
+	subcommands.DieNotNil(err)
+	raw, err := api.AppSignatureGetRaw(factory, app)
+	if herr := client.AsHttpError(err); herr != nil && herr.Response.StatusCode == 404 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("The app %s is not signed", ref)))
+	}
+	subcommands.DieNotNil(err)
+
+	msg, sigs, err := client.CanonicalTufSigned(*raw)
+	subcommands.DieNotNil(err)
+	var sig client.AppSignature
+	subcommands.DieNotNil(json.Unmarshal(*raw, &sig))
+	if sig.Signed.Type != client.AppSignatureType || sig.Signed.App != ref.Name || sig.Signed.Uri != app.Uri {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("The signature is made for %s %s, not for %s", sig.Signed.App, sig.Signed.Uri, app.Uri)))
+	}
+
+	root, role := offlineTargetsRole(factory)
+	if err := client.VerifyTufRole(msg, sigs, root.Signed.Keys, role); err != nil {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("The signature of %s is not valid: %w", ref, err)))
+	}
+	fmt.Printf("The app %s (%s) is signed by the offline targets keys\n", ref, app.Uri)
+	fmt.Printf("\tSigned at: %s, for version %s\n", sig.Signed.SignedAt, sig.Signed.Version)
+}
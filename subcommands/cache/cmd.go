@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	api *client.Api
+
+	refreshQuiet bool
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local index of factory resources",
+		Long: `Fioctl keeps a local index of the names of factory resources: devices, target versions,
+tags, and device groups. Shell completion uses it, so that it is instant even on slow links.
+
+The index is refreshed in the background by shell completion when it is older than an hour.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			api = subcommands.Login(cmd)
+		},
+	}
+	subcommands.RequireFactory(cmd)
+
+	refreshCmd := &cobra.Command{
+		Use:   "refresh",
+		Short: "Refresh the local index of factory resources",
+		Run:   doRefresh,
+		Args:  cobra.NoArgs,
+	}
+	refreshCmd.Flags().BoolVarP(&refreshQuiet, "quiet", "q", false, "Do not print a summary of the index")
+	cmd.AddCommand(refreshCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show how old the local index is and what it contains",
+		Run:   doShow,
+		Args:  cobra.NoArgs,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove the local index of factory resources",
+		Run:   doClear,
+		Args:  cobra.NoArgs,
+	})
+	return cmd
+}
+
+func printIndex(idx *subcommands.ResourceIndex) {
+	t := subcommands.Tabby(0, "RESOURCE", "COUNT")
+	for _, kind := range []subcommands.IndexKind{
+		subcommands.IndexDevices, subcommands.IndexVersions, subcommands.IndexTags, subcommands.IndexGroups,
+	} {
+		t.AddLine(kind, len(idx.Names(kind)))
+	}
+	t.Print()
+}
+
+func doRefresh(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	logrus.Debugf("Refreshing resource index of %s", factory)
+	idx, err := subcommands.RefreshResourceIndex(api, factory)
+	subcommands.DieNotNil(err)
+	if !refreshQuiet {
+		fmt.Printf("Refreshed the index of %s\n\n", factory)
+		printIndex(idx)
+	}
+}
+
+func doShow(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	idx, err := subcommands.LoadResourceIndex(factory)
+	subcommands.DieNotNil(err)
+	if idx == nil {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There is no index of %s, run: fioctl cache refresh", factory)))
+	}
+	stale := ""
+	if idx.IsStale() {
+		stale = " (stale, run: fioctl cache refresh)"
+	}
+	fmt.Printf("Updated at: %s, %s ago%s\n\n", subcommands.FormatTime(idx.UpdatedAt.Format(time.RFC3339)), idx.Age(), stale)
+	printIndex(idx)
+}
+
+func doClear(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	subcommands.DieNotNil(subcommands.ClearResourceIndex(factory))
+	fmt.Println("Removed the index of", factory)
+}
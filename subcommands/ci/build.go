@@ -0,0 +1,79 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	buildTrigger       string
+	buildManifestRev   string
+	buildContainersRev string
+)
+
+func init() {
+	buildCmd := &cobra.Command{
+		Use:   "build",
+		Short: "Trigger a CI build of the factory",
+		Long: `Trigger a CI build of the factory.
+
+By default a build uses the latest commits of the branch at the time it starts.
+Release builds can be made reproducible by pinning the exact commits of the
+LmP manifest and containers repositories to build from. The pinned commits are
+recorded in the resulting Targets as "lmp-manifest-sha" and "containers-sha".`,
+		Example: `
+  # Build the platform from exact commits:
+  fioctl ci build --trigger platform-main \
+    --manifest-rev 4a3c2f0d1e --containers-rev 9b8e7d6c5a`,
+		Run:  doBuild,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(buildCmd)
+	buildCmd.Flags().StringVarP(&buildTrigger, "trigger", "", "platform-main",
+		"The name of the factory's CI trigger to run, e.g. platform-main, containers-devel")
+	buildCmd.Flags().StringVarP(&buildManifestRev, "manifest-rev", "", "",
+		"The commit of the LmP manifest repository to build from")
+	buildCmd.Flags().StringVarP(&buildContainersRev, "containers-rev", "", "",
+		"The commit of the containers repository to build from")
+}
+
+var gitShaRe = regexp.MustCompile("^[0-9a-f]{7,40}$")
+
+func doBuild(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+
+	params := make(map[string]string)
+	if len(buildManifestRev) > 0 {
+		if !gitShaRe.MatchString(buildManifestRev) {
+			subcommands.DieNotNil(fmt.Errorf("Invalid manifest commit: %s", buildManifestRev))
+		}
+		params["LMP_MANIFEST_SHA"] = buildManifestRev
+	}
+	if len(buildContainersRev) > 0 {
+		if !gitShaRe.MatchString(buildContainersRev) {
+			subcommands.DieNotNil(fmt.Errorf("Invalid containers commit: %s", buildContainersRev))
+		}
+		params["CONTAINERS_SHA"] = buildContainersRev
+	}
+
+	logrus.Debugf("Triggering %s build for %s with %v", buildTrigger, factory, params)
+	build, err := api.JobservBuildTrigger(factory, buildTrigger, params)
+	subcommands.DieNotNil(err)
+
+	fmt.Printf("Build %d queued\n", build.ID)
+	if len(buildManifestRev) > 0 {
+		fmt.Println("  LmP manifest:", buildManifestRev)
+	}
+	if len(buildContainersRev) > 0 {
+		fmt.Println("  Containers:  ", buildContainersRev)
+	}
+	if len(build.Url) > 0 {
+		fmt.Println("Details:", build.Url)
+	}
+}
@@ -0,0 +1,23 @@
+package ci
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var api *client.Api
+
+var cmd = &cobra.Command{
+	Use:   "ci",
+	Short: "Inspect and control the factory's CI builds",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		api = subcommands.Login(cmd)
+	},
+}
+
+func NewCommand() *cobra.Command {
+	subcommands.RequireFactory(cmd)
+	return cmd
+}
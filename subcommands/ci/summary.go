@@ -0,0 +1,156 @@
+package ci
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var summaryOutput subcommands.ListOutput
+
+func init() {
+	summaryCmd := &cobra.Command{
+		Use:   "summary",
+		Short: "Show the health of CI builds per branch and machine",
+		Long: `Show the health of recent CI builds per branch and machine:
+the latest build status, the success ratio and the average build duration.
+
+The branch is taken from the name of the trigger which started a build,
+e.g. "platform-main" is a platform build of the "main" branch.
+The machine is the name of a build run, e.g. "intel-corei7-64".`,
+		Run:  doSummary,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(summaryCmd)
+	summaryCmd.Flags().IntP("builds", "n", 20, "Number of latest builds to include into the summary")
+	summaryOutput.AddFlags(summaryCmd, "branch,machine")
+}
+
+type runStats struct {
+	branch    string
+	machine   string
+	latest    string
+	latestId  int
+	total     int
+	passed    int
+	completed int
+	duration  time.Duration
+}
+
+func isPassed(status string) bool {
+	return status == "PASSED" || status == "PROMOTED"
+}
+
+func isFinished(status string) bool {
+	return isPassed(status) || status == "FAILED"
+}
+
+func branchName(trigger string) string {
+	if idx := strings.Index(trigger, "-"); idx > 0 {
+		return trigger[idx+1:]
+	}
+	return trigger
+}
+
+func runDuration(run client.JobservRun) (time.Duration, bool) {
+	if len(run.Created) == 0 || len(run.Completed) == 0 {
+		return 0, false
+	}
+	created, err := time.Parse(time.RFC3339, run.Created)
+	if err != nil {
+		return 0, false
+	}
+	completed, err := time.Parse(time.RFC3339, run.Completed)
+	if err != nil {
+		return 0, false
+	}
+	return completed.Sub(created), true
+}
+
+func latestBuilds(factory string, count int) []client.JobservBuild {
+	var builds []client.JobservBuild
+	limit := count
+	if limit > 100 {
+		limit = 100
+	}
+	for page := 1; len(builds) < count; page++ {
+		lst, err := api.JobservBuilds(factory, limit, page)
+		subcommands.DieNotNil(err)
+		builds = append(builds, lst.Builds...)
+		if lst.Next == nil || len(lst.Builds) == 0 {
+			break
+		}
+	}
+	if len(builds) > count {
+		builds = builds[:count]
+	}
+	return builds
+}
+
+func doSummary(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	count, _ := cmd.Flags().GetInt("builds")
+	if count < 1 {
+		subcommands.DieNotNil(fmt.Errorf("Invalid number of builds: %d", count))
+	}
+	logrus.Debugf("Summarizing %d latest builds of %s", count, factory)
+
+	stats := make(map[string]*runStats)
+	for _, build := range latestBuilds(factory, count) {
+		runs, err := api.JobservRuns(factory, build.ID)
+		subcommands.DieNotNil(err)
+		branch := branchName(build.TriggerName)
+		for _, run := range runs {
+			key := branch + "/" + run.Name
+			s, ok := stats[key]
+			if !ok {
+				s = &runStats{branch: branch, machine: run.Name}
+				stats[key] = s
+			}
+			if build.ID > s.latestId {
+				s.latestId = build.ID
+				s.latest = run.Status
+			}
+			if !isFinished(run.Status) {
+				continue
+			}
+			s.total += 1
+			if isPassed(run.Status) {
+				s.passed += 1
+			}
+			if d, ok := runDuration(run); ok {
+				s.completed += 1
+				s.duration += d
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	t := summaryOutput.NewTable("BRANCH", "MACHINE", "LATEST BUILD", "LATEST STATUS", "SUCCESS", "AVG DURATION")
+	for _, k := range keys {
+		s := stats[k]
+		ratio := "-"
+		if s.total > 0 {
+			ratio = fmt.Sprintf("%d%% (%d/%d)", s.passed*100/s.total, s.passed, s.total)
+		}
+		avg := "-"
+		if s.completed > 0 {
+			avg = (s.duration / time.Duration(s.completed)).Round(time.Second).String()
+		}
+		t.AddLine(s.branch, s.machine, s.latestId, s.latest, ratio, avg)
+	}
+	t.Print()
+}
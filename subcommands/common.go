@@ -2,15 +2,17 @@ package subcommands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/cheynewallace/tabby"
 	canonical "github.com/docker/go/canonical/json"
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/shurcooL/go/indentwriter"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -27,31 +29,98 @@ var (
 
 func RequireFactory(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringP("factory", "f", "", "Factory to list targets for")
-	cmd.PersistentFlags().StringP("token", "t", "", "API token from https://app.foundries.io/settings/tokens/")
+	cmd.PersistentFlags().StringP("token", "t", "", "API token from https://app.foundries.io/settings/tokens/ (or FIOCTL_TOKEN)")
+	DieNotNil(cmd.RegisterFlagCompletionFunc("factory", completeFactories))
+}
+
+// completeFactories completes the factory flag with the factories the logged in account can access.
+// Nothing is completed if the account is not logged in, rather than logging in from a shell completion.
+func completeFactories(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ctx := CurrentContext()
+	token, err := findApiToken(ctx.ApiUrl, ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	Config.Token = token
+	if len(token) == 0 {
+		creds := NewClientCredentials()
+		if expired, err := creds.IsExpired(); err != nil || expired || len(creds.Config.AccessToken) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+	api := client.NewApiClient(ctx.ApiUrl, Config, ctx.CaCert, version.Commit)
+	factories, err := api.FactoriesList(false)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, f := range factories {
+		if strings.HasPrefix(f.Name, toComplete) {
+			names = append(names, f.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// inferFactory finds the factory to use when the factory flag is not set: the only factory the account
+// can access. Otherwise, the flag is required, and the factories to choose from are listed.
+func inferFactory(api *client.Api) string {
+	msg := "Required flag \"factory\" not set"
+	factories, err := api.FactoriesList(false)
+	if err != nil {
+		logrus.Debugf("Unable to list factories of the account: %s", err)
+		DieNotNil(ValidationError("%s", msg))
+	}
+	if len(factories) == 1 {
+		fmt.Fprintf(os.Stderr, "NOTE: Using the factory %s, the only factory this account can access\n", factories[0].Name)
+		return factories[0].Name
+	}
+	var names []string
+	for _, f := range factories {
+		names = append(names, f.Name)
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		msg += ". Factories of this account: " + strings.Join(names, ", ")
+	}
+	DieNotNil(ValidationError("%s", msg))
+	return ""
 }
 
 func Login(cmd *cobra.Command) *client.Api {
-	ca := os.Getenv("CACERT")
-	DieNotNil(viper.BindPFlags(cmd.Flags()))
-	Config.Token = viper.GetString("token")
-	url := os.Getenv("API_URL")
-	if len(url) == 0 {
-		url = "https://api.foundries.io"
+	api := login(cmd)
+	if cmd.Flags().Lookup("factory") != nil && len(viper.GetString("factory")) == 0 {
+		viper.Set("factory", inferFactory(api))
 	}
+	return api
+}
+
+// OfflineApi returns an API client which is not logged in, for the commands working without logging in
+// which still reach other services, e.g. a cloud KMS, with the CA certificates of the current context.
+func OfflineApi() *client.Api {
+	ctx := CurrentContext()
+	return client.NewApiClient(ctx.ApiUrl, Config, ctx.CaCert, version.Commit)
+}
+
+func login(cmd *cobra.Command) *client.Api {
+	DieNotNil(viper.BindPFlags(cmd.Flags()))
+	ctx := CurrentContext()
+	ca := ctx.CaCert
+	url := ctx.ApiUrl
+	var err error
+	Config.Token, err = findApiToken(url, ctx)
+	DieNotNil(err)
 	if len(Config.Token) > 0 {
-		if cmd.Flags().Lookup("factory") != nil && len(viper.GetString("factory")) == 0 {
-			DieNotNil(fmt.Errorf("Required flag \"factory\" not set"))
-		}
 		return client.NewApiClient(url, Config, ca, version.Commit)
 	}
 
 	if len(Config.ClientCredentials.ClientId) == 0 {
-		DieNotNil(fmt.Errorf("Please run: \"fioctl login\" first"))
-	}
-	if cmd.Flags().Lookup("factory") != nil && len(viper.GetString("factory")) == 0 {
-		DieNotNil(fmt.Errorf("Required flag \"factory\" not set"))
+		DieNotNil(WithErrorCode(ErrorCodeAuth, errors.New("Please run: \"fioctl login\" first")))
 	}
-	creds := client.NewClientCredentials(Config.ClientCredentials)
+	creds := NewClientCredentials()
 
 	expired, err := creds.IsExpired()
 	DieNotNil(err)
@@ -61,11 +130,11 @@ func Login(cmd *cobra.Command) *client.Api {
 	}
 
 	if len(creds.Config.AccessToken) == 0 {
-		DieNotNil(creds.Get())
+		DieNotNil(WithErrorCode(ErrorCodeAuth, creds.Get()))
 	} else if creds.HasRefreshToken() {
-		DieNotNil(creds.Refresh())
+		DieNotNil(WithErrorCode(ErrorCodeAuth, creds.Refresh()))
 	} else {
-		DieNotNil(fmt.Errorf("Missing refresh token"))
+		DieNotNil(WithErrorCode(ErrorCodeAuth, errors.New("Missing refresh token")))
 	}
 	SaveOauthConfig(creds.Config)
 	Config.ClientCredentials = creds.Config
@@ -87,27 +156,34 @@ func SaveOauthConfig(c client.OAuthConfig) {
 	// This gets run automatically when "logging in". So you sometimes
 	// accidentally write CLI flags viper finds to the file, that you
 	// don't intend to be saved. So we do it the hard way:
-	name := viper.ConfigFileUsed()
-	if len(name) == 0 {
-		logrus.Debug("Guessing config file from path")
-		path, err := homedir.Expand("~/.config")
-		DieNotNil(err)
-		name = filepath.Join(path, "fioctl.yaml")
-	}
+	name := configFileName()
 	// Try to read in config
 	cfg := make(map[string]interface{})
 	buf, err := os.ReadFile(name)
 	if err == nil {
 		DieNotNil(yaml.Unmarshal(buf, &cfg), "Unable unmarshal configuration:")
 	}
-	val := viper.Get("clientcredentials")
-	cfg["clientcredentials"] = val
+
+	store := viper.GetString("credential-store")
+	if store != CredStorePlain {
+		store = saveSecureCreds(c)
+	}
+	if len(store) > 0 && store != CredStorePlain {
+		// Credentials are in a secure store; make sure there is no plain text copy left
+		delete(cfg, "clientcredentials")
+		cfg["credential-store"] = store
+	} else {
+		val := viper.Get("clientcredentials")
+		cfg["clientcredentials"] = val
+		cfg["credential-store"] = CredStorePlain
+	}
+	viper.Set("credential-store", cfg["credential-store"])
 	if len(c.DefaultOrg) > 0 {
 		cfg["factory"] = c.DefaultOrg
 	}
 	buf, err = yaml.Marshal(cfg)
 	DieNotNil(err, "Unable to marshall oauth config:")
-	DieNotNil(os.WriteFile(name, buf, os.FileMode(0644)), "Unable to update config: ")
+	DieNotNil(os.WriteFile(name, buf, os.FileMode(0600)), "Unable to update config: ")
 }
 
 // An os.Exit exits immediately, skipping all deferred functions
@@ -122,16 +198,16 @@ func AddLastWill(lastWill LastWill) {
 
 func DieNotNil(err error, message ...string) {
 	if err != nil {
-		parts := []interface{}{"ERROR:"}
+		var parts []interface{}
 		for _, p := range message {
 			parts = append(parts, p)
 		}
 		parts = append(parts, err)
-		fmt.Println(parts...)
+		printError(err, strings.TrimSuffix(fmt.Sprintln(parts...), "\n"))
 		for _, w := range onLastWill {
 			w()
 		}
-		os.Exit(1)
+		os.Exit(ExitCodeOf(err))
 	}
 }
 
@@ -29,10 +29,162 @@ type SetConfigOptions struct {
 	Reason      string
 	FileArgs    []string
 	IsRawFile   bool
+	IsDryRun    bool
+	IsReplace   bool
+	IsConfirmed bool
+	ListFunc    func() (*client.DeviceConfigList, error)
 	SetFunc     func(client.ConfigCreateRequest) error
 	EncryptFunc func(string) string
 }
 
+// Effects of the on-changed handlers shipped with fioconfig
+var knownConfigHandlers = map[string]string{
+	FIO_TOML_ONCHANGED: "restarts aktualizr-lite with the new configuration",
+	"/usr/share/fioconfig/handlers/factory-config-vpn": "reconfigures the WireGuard VPN",
+	"/usr/share/fioconfig/handlers/renew-client-cert":  "renews the device client certificate",
+}
+
+// ConfigFileChange describes what would happen to a config file on devices.
+type ConfigFileChange struct {
+	Name   string
+	Action string
+	// Why the content of the file can not be compared, if so
+	Note      string
+	OnChanged []string
+}
+
+const (
+	ConfigFileAdded     = "add"
+	ConfigFileChanged   = "change"
+	ConfigFileUnchanged = "unchanged"
+	ConfigFileRemoved   = "remove"
+)
+
+// PlanConfigChange compares a new config with the current one. When replacing, the files missing
+// in the new config are removed. Otherwise, the new config is merged with the current one.
+func PlanConfigChange(current *client.DeviceConfigList, cfg client.ConfigCreateRequest, replace bool) []ConfigFileChange {
+	existing := make(map[string]client.ConfigFile)
+	var existingNames []string
+	if current != nil && len(current.Configs) > 0 {
+		for _, f := range current.Configs[0].Files {
+			existing[f.Name] = f
+			existingNames = append(existingNames, f.Name)
+		}
+	}
+
+	var changes []ConfigFileChange
+	seen := make(map[string]bool)
+	for _, f := range cfg.Files {
+		seen[f.Name] = true
+		change := ConfigFileChange{Name: f.Name, OnChanged: f.OnChanged}
+		old, ok := existing[f.Name]
+		switch {
+		case !ok:
+			change.Action = ConfigFileAdded
+		case !old.Unencrypted || !f.Unencrypted:
+			// Encrypted values differ even for the same content
+			change.Action = ConfigFileChanged
+			change.Note = "encrypted, the content can not be compared"
+		case old.Value != f.Value || strings.Join(old.OnChanged, " ") != strings.Join(f.OnChanged, " "):
+			change.Action = ConfigFileChanged
+		default:
+			change.Action = ConfigFileUnchanged
+		}
+		changes = append(changes, change)
+	}
+	if replace {
+		for _, name := range existingNames {
+			if !seen[name] {
+				changes = append(changes, ConfigFileChange{Name: name, Action: ConfigFileRemoved})
+			}
+		}
+	}
+	return changes
+}
+
+// PrintConfigPlan shows which files would change, which on-changed handlers would run on devices,
+// and whether a reboot would be triggered.
+func PrintConfigPlan(changes []ConfigFileChange) {
+	fmt.Println("= Dry run, nothing was uploaded")
+	fmt.Println("Files:")
+	for _, c := range changes {
+		if len(c.Note) > 0 {
+			fmt.Printf("\t%-10s %s (%s)\n", c.Action, c.Name, c.Note)
+		} else {
+			fmt.Printf("\t%-10s %s\n", c.Action, c.Name)
+		}
+	}
+
+	var handlers, reboots []string
+	for _, c := range changes {
+		if (c.Action != ConfigFileAdded && c.Action != ConfigFileChanged) || len(c.OnChanged) == 0 {
+			continue
+		}
+		handler := fmt.Sprintf("%s: %s", c.Name, strings.Join(c.OnChanged, " "))
+		if effect, ok := knownConfigHandlers[c.OnChanged[0]]; ok {
+			handler += " (" + effect + ")"
+		}
+		handlers = append(handlers, handler)
+		for _, arg := range c.OnChanged {
+			if strings.HasSuffix(arg, "reboot") {
+				reboots = append(reboots, c.Name)
+				break
+			}
+		}
+	}
+	fmt.Println("On-changed handlers to run on devices:")
+	if len(handlers) == 0 {
+		fmt.Println("\tnone")
+	}
+	for _, h := range handlers {
+		fmt.Println("\t" + h)
+	}
+	if len(reboots) > 0 {
+		fmt.Println("Reboot: triggered by", strings.Join(reboots, ", "))
+	} else {
+		fmt.Println("Reboot: not triggered")
+	}
+}
+
+// PreviewConfigChange shows the content of the config files a change overwrites or removes.
+func PreviewConfigChange(current *client.DeviceConfigList, cfg client.ConfigCreateRequest, replace bool) *Preview {
+	existing := make(map[string]client.ConfigFile)
+	if current != nil && len(current.Configs) > 0 {
+		for _, f := range current.Configs[0].Files {
+			existing[f.Name] = f
+		}
+	}
+	preview := NewPreview("Config files to change:")
+	for _, change := range PlanConfigChange(current, cfg, replace) {
+		switch change.Action {
+		case ConfigFileAdded:
+			preview.Add(change.Name)
+		case ConfigFileRemoved:
+			preview.Remove(change.Name)
+		case ConfigFileChanged:
+			if len(change.Note) > 0 {
+				preview.Overwrite(change.Name, change.Note)
+				continue
+			}
+			for _, f := range cfg.Files {
+				if f.Name == change.Name {
+					old := existing[f.Name]
+					before := old.Value + onChangedSuffix(old.OnChanged)
+					preview.Change(f.Name, before, f.Value+onChangedSuffix(f.OnChanged))
+				}
+			}
+		}
+	}
+	return preview
+}
+
+func onChangedSuffix(onChanged []string) string {
+	if len(onChanged) == 0 {
+		return ""
+	}
+	return "\n(on-changed: " + strings.Join(onChanged, " ") + ")"
+}
+
 func SetConfig(opts *SetConfigOptions) {
 	cfg := client.ConfigCreateRequest{Reason: opts.Reason}
 	if opts.IsRawFile {
@@ -58,6 +210,25 @@ func SetConfig(opts *SetConfigOptions) {
 		}
 	}
 
+	if opts.IsDryRun {
+		var current *client.DeviceConfigList
+		if opts.ListFunc != nil {
+			var err error
+			current, err = opts.ListFunc()
+			DieNotNil(err, "Failed to fetch existing config:")
+		}
+		PrintConfigPlan(PlanConfigChange(current, cfg, opts.IsReplace))
+		return
+	}
+
+	if opts.ListFunc != nil {
+		current, err := opts.ListFunc()
+		DieNotNil(err, "Failed to fetch existing config:")
+		if !PreviewConfigChange(current, cfg, opts.IsReplace).ConfirmWith(opts.IsConfirmed) {
+			return
+		}
+	}
+
 	if opts.EncryptFunc != nil {
 		for i := range cfg.Files {
 			file := &cfg.Files[i]
@@ -125,12 +296,12 @@ func PrintConfig(cfg *client.DeviceConfig, showAppliedAt, highlightFirstLine boo
 
 	if highlightFirstLine {
 		firstLine := color.New(color.FgYellow)
-		firstLine.Printf(indent+"Created At:    %s\n", cfg.CreatedAt)
+		firstLine.Printf(indent+"Created At:    %s\n", FormatTime(cfg.CreatedAt))
 	} else {
-		printf("Created At:    %s\n", cfg.CreatedAt)
+		printf("Created At:    %s\n", FormatTime(cfg.CreatedAt))
 	}
 	if showAppliedAt {
-		printf("Applied At:    %s\n", cfg.AppliedAt)
+		printf("Applied At:    %s\n", FormatTime(cfg.AppliedAt))
 	}
 	printf("Change Reason: %s\n", cfg.Reason)
 	printf("Files:\n")
@@ -192,7 +363,7 @@ func SetUpdatesConfig(opts *SetUpdatesConfigOptions, reportedTag string, reporte
 	if !opts.IsForced {
 		DieNotNil(err, "Failed to fetch existing config changelog (override with --force):")
 	}
-	sota, err := loadSotaConfig(dcl)
+	sota, err := LoadSotaConfig(dcl)
 	if !opts.IsForced {
 		DieNotNil(err, "Invalid FIO toml file (override with --force):")
 	}
@@ -258,13 +429,15 @@ func SetUpdatesConfig(opts *SetUpdatesConfigOptions, reportedTag string, reporte
 		},
 	}
 	if opts.IsDryRun {
+		PrintConfigPlan(PlanConfigChange(dcl, cfg, false))
+		fmt.Println("\n= New " + FIO_TOML_NAME)
 		fmt.Println(newToml)
 	} else {
 		DieNotNil(opts.SetFunc(cfg, opts.IsForced))
 	}
 }
 
-func loadSotaConfig(dcl *client.DeviceConfigList) (sota *toml.Tree, err error) {
+func LoadSotaConfig(dcl *client.DeviceConfigList) (sota *toml.Tree, err error) {
 	found := false
 	if dcl != nil && len(dcl.Configs) > 0 {
 		for _, cfgFile := range dcl.Configs[0].Files {
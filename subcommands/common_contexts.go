@@ -0,0 +1,67 @@
+package subcommands
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+)
+
+const defaultApiUrl = "https://api.foundries.io"
+
+// FactoryContext holds the settings used to access a factory hosted on a different backend than
+// the Foundries.io SaaS, e.g. an on-prem deployment. They are set per factory in the config file:
+//
+//	contexts:
+//	  <factory>:
+//	    api-url: https://api.example.com
+//	    oauth-url: https://app.example.com/oauth
+//	    cacert: /etc/ssl/certs/example-ca.pem
+//	    token-cmd: pass show example/fioctl-token
+type FactoryContext struct {
+	ApiUrl   string `mapstructure:"api-url"`
+	OAuthUrl string `mapstructure:"oauth-url"`
+	CaCert   string `mapstructure:"cacert"`
+	Token    string `mapstructure:"token"`
+	TokenCmd string `mapstructure:"token-cmd"`
+}
+
+// CurrentContext returns the settings of the factory selected by the --factory flag or the config file.
+// The API_URL and CACERT environment variables take precedence over the context settings.
+func CurrentContext() FactoryContext {
+	var ctx FactoryContext
+	if factory := viper.GetString("factory"); len(factory) > 0 {
+		contexts := make(map[string]FactoryContext)
+		DieNotNil(viper.UnmarshalKey("contexts", &contexts), "Invalid contexts in the config file:")
+		if c, ok := contexts[factory]; ok {
+			logrus.Debugf("Using the context of factory %s: api-url=%s oauth-url=%s cacert=%s",
+				factory, c.ApiUrl, c.OAuthUrl, c.CaCert)
+			ctx = c
+		}
+	}
+	if url := os.Getenv("API_URL"); len(url) > 0 {
+		ctx.ApiUrl = url
+	} else if len(ctx.ApiUrl) == 0 {
+		ctx.ApiUrl = defaultApiUrl
+	}
+	if ca := os.Getenv("CACERT"); len(ca) > 0 {
+		ctx.CaCert = ca
+	}
+	if len(ctx.OAuthUrl) == 0 {
+		ctx.OAuthUrl = client.URI
+	}
+	return ctx
+}
+
+// NewClientCredentials returns OAuth client credentials using the endpoints of the current context.
+func NewClientCredentials() client.ClientCredentials {
+	ctx := CurrentContext()
+	creds := client.NewClientCredentials(Config.ClientCredentials)
+	creds.URL = ctx.OAuthUrl
+	if len(ctx.CaCert) > 0 {
+		DieNotNil(creds.SetCaCert(ctx.CaCert))
+	}
+	return creds
+}
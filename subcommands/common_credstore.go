@@ -0,0 +1,180 @@
+package subcommands
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+
+	"github.com/foundriesio/fioctl/client"
+)
+
+// Where the OAuth client credentials are stored. The value is kept in the
+// "credential-store" key of the fioctl config file.
+const (
+	CredStoreKeychain      = "keychain"
+	CredStoreEncryptedFile = "encrypted-file"
+	CredStorePlain         = "plain"
+
+	credStoreKeychainService = "fioctl"
+	credStoreFileName        = "fioctl-credentials.enc"
+	credStoreKeyName         = "fioctl-credentials.key"
+)
+
+func configFileName() string {
+	name := viper.ConfigFileUsed()
+	if len(name) == 0 {
+		logrus.Debug("Guessing config file from path")
+		path, err := homedir.Expand("~/.config")
+		DieNotNil(err)
+		name = filepath.Join(path, "fioctl.yaml")
+	}
+	return name
+}
+
+// The keychain entry is bound to a config file, so that several configs do not clash
+func credStoreKeychainUser() string {
+	name, err := filepath.Abs(configFileName())
+	if err != nil {
+		name = configFileName()
+	}
+	return name
+}
+
+// LoadCredentials reads the OAuth client credentials from the secure store configured for fioctl.
+// Credentials found in a plain text config file are migrated to the secure store on first run.
+func LoadCredentials() {
+	switch store := viper.GetString("credential-store"); store {
+	case CredStoreKeychain, CredStoreEncryptedFile:
+		creds, err := readSecureCreds(store)
+		DieNotNil(err, "Unable to read credentials from "+store+":")
+		if creds != nil {
+			Config.ClientCredentials = *creds
+		}
+	case "":
+		if len(Config.ClientCredentials.ClientId) > 0 {
+			logrus.Debug("Migrating credentials from a plain text config file")
+			SaveOauthConfig(Config.ClientCredentials)
+		}
+	case CredStorePlain:
+		break
+	default:
+		DieNotNil(fmt.Errorf("Unsupported credential-store: %s", store))
+	}
+}
+
+// Save credentials into the most secure store available.
+// Return an empty store name if no secure store is available.
+func saveSecureCreds(c client.OAuthConfig) string {
+	buf, err := json.Marshal(c)
+	DieNotNil(err, "Unable to marshall oauth config:")
+
+	if err = keyring.Set(credStoreKeychainService, credStoreKeychainUser(), string(buf)); err == nil {
+		return CredStoreKeychain
+	}
+	logrus.Debugf("OS keychain is not available: %s", err)
+
+	if err = writeEncryptedCreds(buf); err == nil {
+		if viper.GetString("credential-store") != CredStoreEncryptedFile {
+			logrus.Warningf("The OS keychain is not available, so the credentials are saved to %s, encrypted "+
+				"with the key in %s. This only protects them when the config file is shared by accident: "+
+				"anyone able to read the key file can decrypt them. Once a keychain is available, "+
+				"e.g. the Secret Service on Linux, run \"fioctl login\" again to move the credentials into it.",
+				credStorePath(credStoreFileName), credStorePath(credStoreKeyName))
+		}
+		return CredStoreEncryptedFile
+	}
+	logrus.Warningf("Unable to save credentials into an encrypted file: %s", err)
+	return ""
+}
+
+func readSecureCreds(store string) (*client.OAuthConfig, error) {
+	var buf []byte
+	if store == CredStoreKeychain {
+		val, err := keyring.Get(credStoreKeychainService, credStoreKeychainUser())
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		buf = []byte(val)
+	} else {
+		var err error
+		if buf, err = readEncryptedCreds(); err != nil || buf == nil {
+			return nil, err
+		}
+	}
+	var c client.OAuthConfig
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func credStorePath(name string) string {
+	return filepath.Join(filepath.Dir(configFileName()), name)
+}
+
+// The encrypted file protects credentials from an accidental exposure, e.g. sharing the config file.
+// The key is kept in a separate file only readable by the user, next to the encrypted file, so it does not
+// protect them from anyone able to read the files of the user, e.g. other programs run by the user.
+func credStoreCipher() (cipher.AEAD, error) {
+	path := credStorePath(credStoreKeyName)
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(path, key, 0o600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func writeEncryptedCreds(buf []byte) error {
+	gcm, err := credStoreCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	return os.WriteFile(credStorePath(credStoreFileName), gcm.Seal(nonce, nonce, buf, nil), 0o600)
+}
+
+func readEncryptedCreds() ([]byte, error) {
+	data, err := os.ReadFile(credStorePath(credStoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	gcm, err := credStoreCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("Encrypted credentials file is corrupted")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
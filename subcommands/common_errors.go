@@ -0,0 +1,119 @@
+package subcommands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/foundriesio/fioctl/client"
+)
+
+// ErrorCode is a stable identifier of an error category, which wrappers can react to
+// instead of parsing error messages.
+type ErrorCode string
+
+const (
+	ErrorCodeGeneric    ErrorCode = "error"
+	ErrorCodeAuth       ErrorCode = "auth"
+	ErrorCodeNotFound   ErrorCode = "not-found"
+	ErrorCodeConflict   ErrorCode = "conflict"
+	ErrorCodeRateLimit  ErrorCode = "rate-limit"
+	ErrorCodeValidation ErrorCode = "validation"
+	ErrorCodeSigning    ErrorCode = "signing"
+	ErrorCodeExpiring   ErrorCode = "expiring"
+	ErrorCodeExpired    ErrorCode = "expired"
+)
+
+// Exit codes of the fioctl process for each error category.
+var errorExitCodes = map[ErrorCode]int{
+	ErrorCodeGeneric:    1,
+	ErrorCodeValidation: 2,
+	ErrorCodeAuth:       3,
+	ErrorCodeNotFound:   4,
+	ErrorCodeConflict:   5,
+	ErrorCodeRateLimit:  6,
+	ErrorCodeSigning:    7,
+	ErrorCodeExpiring:   8,
+	ErrorCodeExpired:    9,
+}
+
+// ErrorFormatJson is set when a command is run with "-o json".
+// Errors are then printed to STDERR as {"error": {"code": ..., "message": ...}}.
+var ErrorFormatJson bool
+
+// CodedError attaches an explicit error code to an error.
+type CodedError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// WithErrorCode attaches an error code to an error, so that it is reported in that category.
+func WithErrorCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CodedError{code, err}
+}
+
+// ValidationError returns an error reported as invalid user input.
+func ValidationError(format string, args ...interface{}) error {
+	return WithErrorCode(ErrorCodeValidation, fmt.Errorf(format, args...))
+}
+
+// ErrorCodeOf finds a category of an error, based on an explicit error code or an HTTP status code.
+func ErrorCodeOf(err error) ErrorCode {
+	var coded *CodedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	if herr := client.AsHttpError(err); herr != nil && herr.Response != nil {
+		switch herr.Response.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrorCodeAuth
+		case http.StatusNotFound:
+			return ErrorCodeNotFound
+		case http.StatusConflict:
+			return ErrorCodeConflict
+		case http.StatusTooManyRequests:
+			return ErrorCodeRateLimit
+		case http.StatusBadRequest, http.StatusUnprocessableEntity:
+			return ErrorCodeValidation
+		}
+	}
+	return ErrorCodeGeneric
+}
+
+// ExitCodeOf returns the exit code of the fioctl process failed with a given error.
+func ExitCodeOf(err error) int {
+	return errorExitCodes[ErrorCodeOf(err)]
+}
+
+func printError(err error, message string) {
+	if !ErrorFormatJson {
+		fmt.Println("ERROR:", message)
+		return
+	}
+	out := map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    ErrorCodeOf(err),
+			"message": message,
+		},
+	}
+	buf, jerr := json.Marshal(out)
+	if jerr != nil {
+		// Should never happen, but we must not lose the original error
+		fmt.Fprintln(os.Stderr, message)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(buf))
+}
@@ -0,0 +1,65 @@
+package subcommands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// AddIfNotExistsFlag adds the --if-not-exists flag to a create-style command,
+// so that declarative scripts can re-run it.
+func AddIfNotExistsFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("if-not-exists", false, "Do nothing if it already exists, instead of failing")
+}
+
+// AddIfExistsFlags adds the --if-exists flag, and its --ignore-missing synonym, to a delete-style
+// command, so that declarative scripts can re-run it.
+func AddIfExistsFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("if-exists", false, "Do nothing if it does not exist, instead of failing")
+	cmd.Flags().Bool("ignore-missing", false, "The same as --if-exists")
+}
+
+func IfNotExists(cmd *cobra.Command) bool {
+	val, _ := cmd.Flags().GetBool("if-not-exists")
+	return val
+}
+
+func IfExists(cmd *cobra.Command) bool {
+	ifExists, _ := cmd.Flags().GetBool("if-exists")
+	ignoreMissing, _ := cmd.Flags().GetBool("ignore-missing")
+	return ifExists || ignoreMissing
+}
+
+// SkipExisting tells if a create-style command should do nothing, because what it creates
+// already exists and the --if-not-exists flag is set.
+func SkipExisting(cmd *cobra.Command, exists bool, what string) bool {
+	if exists && IfNotExists(cmd) {
+		fmt.Println(what, "already exists, skipping")
+		return true
+	}
+	return false
+}
+
+// SkipMissing tells if a delete-style command should do nothing, because what it deletes
+// does not exist and the --if-exists flag is set.
+func SkipMissing(cmd *cobra.Command, exists bool, what string) bool {
+	if !exists && IfExists(cmd) {
+		fmt.Println(what, "does not exist, skipping")
+		return true
+	}
+	return false
+}
+
+// IgnoreMissing drops a not found error of a delete-style command when the --if-exists flag is set.
+// It covers what was deleted by someone else after the command checked that it exists.
+func IgnoreMissing(cmd *cobra.Command, err error) error {
+	if err != nil && IfExists(cmd) && ErrorCodeOf(err) == ErrorCodeNotFound {
+		return nil
+	}
+	return err
+}
+
+// IsNotFound tells if an API request failed because a resource does not exist.
+func IsNotFound(err error) bool {
+	return err != nil && ErrorCodeOf(err) == ErrorCodeNotFound
+}
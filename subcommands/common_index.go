@@ -0,0 +1,312 @@
+package subcommands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+)
+
+// IndexMaxAge is how long a resource index is used before it is considered stale.
+const IndexMaxAge = time.Hour
+
+type IndexKind string
+
+const (
+	IndexDevices  IndexKind = "devices"
+	IndexVersions IndexKind = "target versions"
+	IndexTags     IndexKind = "tags"
+	IndexGroups   IndexKind = "device groups"
+)
+
+// ResourceIndex is a local copy of the names of factory resources. It makes shell completion
+// and name lookups instant, at the cost of being as old as its last refresh.
+type ResourceIndex struct {
+	Factory   string    `json:"factory"`
+	UpdatedAt time.Time `json:"updated-at"`
+	Devices   []string  `json:"devices"`
+	Versions  []string  `json:"target-versions"`
+	Tags      []string  `json:"tags"`
+	Groups    []string  `json:"device-groups"`
+}
+
+func (idx *ResourceIndex) Age() time.Duration {
+	return time.Since(idx.UpdatedAt).Round(time.Second)
+}
+
+func (idx *ResourceIndex) IsStale() bool {
+	return idx.Age() > IndexMaxAge
+}
+
+func (idx *ResourceIndex) Names(kind IndexKind) []string {
+	switch kind {
+	case IndexDevices:
+		return idx.Devices
+	case IndexVersions:
+		return idx.Versions
+	case IndexTags:
+		return idx.Tags
+	case IndexGroups:
+		return idx.Groups
+	}
+	return nil
+}
+
+func resourceIndexFile(factory string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "fioctl", "index", factory+".json")
+}
+
+// LoadResourceIndex returns the local index of a factory, or nil if it was never refreshed.
+func LoadResourceIndex(factory string) (*ResourceIndex, error) {
+	buf, err := os.ReadFile(resourceIndexFile(factory))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var idx ResourceIndex
+	if err := json.Unmarshal(buf, &idx); err != nil {
+		return nil, fmt.Errorf("Invalid resource index %s: %w", resourceIndexFile(factory), err)
+	}
+	return &idx, nil
+}
+
+func ClearResourceIndex(factory string) error {
+	if err := os.Remove(resourceIndexFile(factory)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RefreshResourceIndex fetches the names of factory resources and saves them as the local index.
+func RefreshResourceIndex(api *client.Api, factory string) (*ResourceIndex, error) {
+	idx := ResourceIndex{Factory: factory, UpdatedAt: time.Now().UTC()}
+
+	it := api.DeviceIter(false, "", factory, "", "", "", "", 1000)
+	for it.Next() {
+		idx.Devices = append(idx.Devices, it.Value().Name)
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to list devices: %w", err)
+	}
+	sort.Strings(idx.Devices)
+
+	versions := make(map[string]bool)
+	tags := make(map[string]bool)
+	ti := api.TargetIter(factory)
+	for ti.Next() {
+		_, target := ti.Value()
+		custom, err := api.TargetCustom(target)
+		if err != nil {
+			continue
+		}
+		versions[custom.Version] = true
+		for _, tag := range custom.Tags {
+			tags[tag] = true
+		}
+	}
+	if err := ti.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to list targets: %w", err)
+	}
+	idx.Versions = sortedKeys(versions)
+	sort.SliceStable(idx.Versions, func(i, j int) bool { return len(idx.Versions[i]) < len(idx.Versions[j]) })
+	idx.Tags = sortedKeys(tags)
+
+	groups, err := api.FactoryListDeviceGroup(factory)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list device groups: %w", err)
+	}
+	for _, g := range *groups {
+		idx.Groups = append(idx.Groups, g.Name)
+	}
+	sort.Strings(idx.Groups)
+
+	buf, err := json.Marshal(idx)
+	if err != nil {
+		return nil, err
+	}
+	path := resourceIndexFile(factory)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// Replace the index atomically, so that completions never read a partially written one
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return nil, err
+	}
+	return &idx, os.Rename(tmp, path)
+}
+
+// refreshIndexInBackground starts "fioctl cache refresh" without waiting for it, unless a refresh
+// was started recently. It is used by completions, which must not wait for the network.
+func refreshIndexInBackground(factory string) {
+	marker := resourceIndexFile(factory) + ".refreshing"
+	if st, err := os.Stat(marker); err == nil && time.Since(st.ModTime()) < time.Minute {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0700); err != nil {
+		return
+	}
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(exe, "cache", "refresh", "--quiet", "--factory", factory)
+	if err := cmd.Start(); err != nil {
+		logrus.Debugf("Unable to refresh the resource index: %s", err)
+		return
+	}
+	_ = cmd.Process.Release()
+}
+
+// completeFromIndex completes names of the given kind from the local index of the factory.
+// A stale or missing index is refreshed in the background, and its age is shown as a hint.
+func completeFromIndex(cmd *cobra.Command, kind IndexKind, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	factory := viper.GetString("factory")
+	if len(factory) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	idx, err := LoadResourceIndex(factory)
+	if err != nil || idx == nil {
+		refreshIndexInBackground(factory)
+		return cobra.AppendActiveHelp(nil, "Building the index of "+factory+" in the background"),
+			cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, name := range idx.Names(kind) {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+	if idx.IsStale() {
+		refreshIndexInBackground(factory)
+		names = cobra.AppendActiveHelp(names, fmt.Sprintf(
+			"The index of %s is %s old, refreshing it in the background", factory, idx.Age()))
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func indexArgCompletion(kind IndexKind) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return completeFromIndex(cmd, kind, toComplete)
+	}
+}
+
+func indexFlagCompletion(kind IndexKind) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeFromIndex(cmd, kind, toComplete)
+	}
+}
+
+// RegisterIndexCompletions adds completions from the resource index to the commands of a tree.
+// The first argument is completed by its name in the command usage: <device> for device names
+// and <version> for target versions. The --group and --tag flags complete device groups and tags.
+func RegisterIndexCompletions(root *cobra.Command) {
+	for _, cmd := range root.Commands() {
+		RegisterIndexCompletions(cmd)
+	}
+	if root.ValidArgsFunction == nil && root.Runnable() {
+		fields := strings.Fields(root.Use)
+		if len(fields) > 1 {
+			switch strings.Trim(fields[1], "[]") {
+			case "<device>":
+				root.ValidArgsFunction = indexArgCompletion(IndexDevices)
+			case "<name>":
+				if root.Parent() != nil && root.Parent().Name() == "devices" {
+					root.ValidArgsFunction = indexArgCompletion(IndexDevices)
+				}
+			case "<version>", "<target-version>":
+				root.ValidArgsFunction = indexArgCompletion(IndexVersions)
+			}
+		}
+	}
+	for flag, kind := range map[string]IndexKind{"group": IndexGroups, "tag": IndexTags} {
+		if root.LocalNonPersistentFlags().Lookup(flag) != nil {
+			// Fails for flags with their own completion already, which is kept
+			_ = root.RegisterFlagCompletionFunc(flag, indexFlagCompletion(kind))
+		}
+	}
+}
+
+// IndexSuggestions returns the names in the local index which are similar to a name not found
+// by the server, e.g. because of a typo. Nothing is fetched, so a missing index suggests nothing.
+func IndexSuggestions(factory string, kind IndexKind, name string) []string {
+	idx, err := LoadResourceIndex(factory)
+	if err != nil || idx == nil {
+		return nil
+	}
+	var suggestions []string
+	lower := strings.ToLower(name)
+	for _, candidate := range idx.Names(kind) {
+		c := strings.ToLower(candidate)
+		if c != lower && (strings.Contains(c, lower) || strings.Contains(lower, c) || editDistance(c, lower) <= 2) {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	if len(suggestions) > 5 {
+		suggestions = suggestions[:5]
+	}
+	return suggestions
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
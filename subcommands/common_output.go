@@ -0,0 +1,318 @@
+package subcommands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	OutputFormatTable = "table"
+	OutputFormatCsv   = "csv"
+	OutputFormatJson  = "json"
+	// The default output format of the commands which do not list things
+	OutputFormatText = "text"
+)
+
+// ListOutput holds the options which control how list commands print their results.
+type ListOutput struct {
+	Format   string
+	NoHeader bool
+	Columns  []string
+	SortBy   []string
+	Desc     bool
+
+	sorted bool
+}
+
+// AddFlags adds the output flags to a list command.
+// The sortExample is a value of the --sort-by flag for the help, made of columns of that command.
+func (o *ListOutput) AddFlags(cmd *cobra.Command, sortExample string) {
+	o.Format = OutputFormatTable
+	cmd.Flags().VarP((*outputFormat)(&o.Format), "output", "o",
+		"Output format, supported: table, csv, json. With json, errors are also printed as JSON to STDERR")
+	cmd.Flags().BoolVarP(&o.NoHeader, "no-header", "", false, "Do not print the header line")
+	if cmd.Flags().Lookup("columns") == nil {
+		// Some commands have their own more advanced columns handling
+		cmd.Flags().StringSliceVarP(&o.Columns, "columns", "", nil,
+			"Specify which columns to display and in which order (default: all columns)")
+	}
+	cmd.Flags().StringSliceVarP(&o.SortBy, "sort-by", "", nil,
+		"Sort results by these columns, e.g. --sort-by="+sortExample+". When paginated, each page is sorted separately")
+	cmd.Flags().BoolVarP(&o.Desc, "desc", "", false, "Sort results in descending order")
+}
+
+// AddOutputFlag adds the --output flag to a command which prints text by default, or its result as JSON.
+// With json, errors are also printed as JSON to STDERR, the same as by the list commands.
+// The command checks that the format is one it supports.
+func AddOutputFlag(cmd *cobra.Command, format *string, usage string) {
+	*format = OutputFormatText
+	cmd.Flags().VarP((*outputFormat)(format), "output", "o", usage)
+}
+
+// outputFormat is a value of the --output flag.
+// It switches error messages to JSON as soon as the flag is parsed, so that even early errors are structured.
+type outputFormat string
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+func (f *outputFormat) Set(val string) error {
+	*f = outputFormat(val)
+	ErrorFormatJson = val == OutputFormatJson
+	return nil
+}
+
+func (f *outputFormat) Type() string {
+	return "string"
+}
+
+// Sort sorts items of a list by the --sort-by columns.
+// The value function returns a value of the column for the list item at the given index.
+// Values are compared as numbers or timestamps when possible, and as strings otherwise.
+func (o *ListOutput) Sort(list interface{}, columns []string, value func(idx int, column string) string) {
+	if len(o.SortBy) == 0 {
+		return
+	}
+	for _, key := range o.SortBy {
+		if !slices.Contains(columns, key) {
+			DieNotNil(ValidationError("Invalid sort column: %s\nAvailable columns: %s", key, strings.Join(columns, ",")))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		for _, key := range o.SortBy {
+			if res := compareValues(value(i, key), value(j, key)); res != 0 {
+				return (res < 0) != o.Desc
+			}
+		}
+		return false
+	})
+	o.sorted = true
+}
+
+func compareValues(a, b string) int {
+	if ai, err := strconv.ParseFloat(a, 64); err == nil {
+		if bi, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case ai < bi:
+				return -1
+			case ai > bi:
+				return 1
+			}
+			return 0
+		}
+	}
+	if at, ok := ParseTime(a); ok {
+		if bt, ok := ParseTime(b); ok {
+			switch {
+			case at.Before(bt):
+				return -1
+			case at.After(bt):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func (o *ListOutput) assertFormat() {
+	switch o.Format {
+	case OutputFormatTable, OutputFormatCsv, OutputFormatJson:
+	default:
+		DieNotNil(ValidationError("Unsupported output format: %s", o.Format))
+	}
+}
+
+// Streams tells if the rows of a list are printed as they are added, rather than all at once by Print.
+// This is the case for CSV output which is not sorted, so that piping long lists starts sooner.
+func (o *ListOutput) Streams() bool {
+	return o.Format == OutputFormatCsv && len(o.SortBy) == 0
+}
+
+// ListTable collects rows of a list command, and prints them in the requested format.
+type ListTable struct {
+	out    *ListOutput
+	header []string
+	rows   [][]string
+
+	// Set when the rows are printed as they are added
+	stream   *csv.Writer
+	selected []int
+}
+
+func (o *ListOutput) NewTable(columns ...string) *ListTable {
+	o.assertFormat()
+	t := &ListTable{out: o, header: columns}
+	if o.Streams() {
+		t.selected = t.columnIndexes()
+		t.stream = csv.NewWriter(os.Stdout)
+		if !o.NoHeader {
+			header := selectRow(columns, t.selected)
+			for idx, col := range header {
+				header[idx] = columnName(col)
+			}
+			DieNotNil(t.stream.Write(header))
+		}
+	}
+	return t
+}
+
+func (t *ListTable) AddLine(vals ...interface{}) {
+	row := make([]string, len(vals))
+	for idx, val := range vals {
+		row[idx] = fmt.Sprint(val)
+	}
+	if t.stream != nil {
+		row = selectRow(row, t.selected)
+		for idx := range row {
+			row[idx] = FormatTime(row[idx])
+		}
+		DieNotNil(t.stream.Write(row))
+		t.stream.Flush()
+		return
+	}
+	t.rows = append(t.rows, row)
+}
+
+func columnName(header string) string {
+	return strings.ToLower(strings.ReplaceAll(header, " ", "-"))
+}
+
+// columnIndexes returns the indexes of the columns selected by the user, in the order they were selected,
+// or nil to keep all the columns.
+func (t *ListTable) columnIndexes() []int {
+	if len(t.out.Columns) == 0 {
+		return nil
+	}
+	indexes := make(map[string]int, len(t.header))
+	for idx, col := range t.header {
+		indexes[columnName(col)] = idx
+	}
+	selected := make([]int, len(t.out.Columns))
+	for idx, col := range t.out.Columns {
+		pos, ok := indexes[columnName(col)]
+		if !ok {
+			available := make([]string, len(t.header))
+			for i, h := range t.header {
+				available[i] = columnName(h)
+			}
+			DieNotNil(ValidationError("Invalid column name: %s\nAvailable columns: %s",
+				col, strings.Join(available, ",")))
+		}
+		selected[idx] = pos
+	}
+	return selected
+}
+
+func selectRow(row []string, selected []int) []string {
+	if selected == nil {
+		return row
+	}
+	newRow := make([]string, len(selected))
+	for idx, pos := range selected {
+		if pos < len(row) {
+			newRow[idx] = row[pos]
+		}
+	}
+	return newRow
+}
+
+// Only keep the columns selected by the user, in the order they were selected.
+func (t *ListTable) selectColumns() {
+	selected := t.columnIndexes()
+	if selected == nil {
+		return
+	}
+	t.header = selectRow(t.header, selected)
+	for i, row := range t.rows {
+		t.rows[i] = selectRow(row, selected)
+	}
+}
+
+func (t *ListTable) Print() {
+	if t.stream != nil {
+		t.stream.Flush()
+		DieNotNil(t.stream.Error())
+		return
+	}
+	if !t.out.sorted {
+		names := make([]string, len(t.header))
+		indexes := make(map[string]int, len(t.header))
+		for idx, col := range t.header {
+			names[idx] = columnName(col)
+			indexes[names[idx]] = idx
+		}
+		t.out.Sort(t.rows, names, func(idx int, column string) string {
+			return t.rows[idx][indexes[column]]
+		})
+	}
+	t.selectColumns()
+	for _, row := range t.rows {
+		for idx := range row {
+			row[idx] = FormatTime(row[idx])
+		}
+	}
+	if t.out.Format == OutputFormatJson {
+		items := make([]map[string]string, len(t.rows))
+		for i, row := range t.rows {
+			item := make(map[string]string, len(row))
+			for idx, val := range row {
+				item[columnName(t.header[idx])] = val
+			}
+			items[i] = item
+		}
+		buf, err := json.MarshalIndent(items, "", "  ")
+		DieNotNil(err)
+		fmt.Println(string(buf))
+		return
+	}
+	if t.out.Format == OutputFormatCsv {
+		w := csv.NewWriter(os.Stdout)
+		if !t.out.NoHeader {
+			header := make([]string, len(t.header))
+			for idx, col := range t.header {
+				header[idx] = columnName(col)
+			}
+			DieNotNil(w.Write(header))
+		}
+		DieNotNil(w.WriteAll(t.rows))
+		return
+	}
+
+	tab := tabby.New()
+	if !t.out.NoHeader {
+		header := make([]interface{}, len(t.header))
+		for idx, col := range t.header {
+			header[idx] = strings.ToUpper(col)
+		}
+		tab.AddHeader(header...)
+	}
+	for _, row := range t.rows {
+		line := make([]interface{}, len(row))
+		for idx, val := range row {
+			line[idx] = val
+		}
+		tab.AddLine(line...)
+	}
+	tab.Print()
+}
+
+// ShowPages prints a hint how to show the next page.
+// It is printed to STDERR for machine readable formats, so that it does not break the output.
+func (o *ListOutput) ShowPages(showPage int, next *string) {
+	if o.Format == OutputFormatTable {
+		ShowPages(showPage, next)
+	} else if next != nil {
+		fmt.Fprintf(os.Stderr, "More results are available, use: -p%d\n", showPage+1)
+	}
+}
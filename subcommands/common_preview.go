@@ -0,0 +1,126 @@
+package subcommands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/karrick/godiff"
+	"github.com/spf13/cobra"
+)
+
+type previewLine struct {
+	sign byte
+	text string
+}
+
+// Preview lists exactly what a command is about to remove or change, so that the user can review
+// it before confirming. Destructive commands share it, so that they all look and behave the same.
+type Preview struct {
+	title       string
+	lines       []previewLine
+	destructive bool
+	out         io.Writer
+}
+
+func NewPreview(title string) *Preview {
+	return &Preview{title: title, out: os.Stdout}
+}
+
+// SetOutput prints the preview to another writer, e.g. stderr for commands printing JSON to stdout.
+func (p *Preview) SetOutput(out io.Writer) {
+	p.out = out
+}
+
+// AddConfirmFlag adds the --yes flag used by Preview.Confirm to a command.
+func AddConfirmFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolP("yes", "y", false, "Apply the changes without asking for a confirmation")
+}
+
+// Remove adds an item about to be removed.
+func (p *Preview) Remove(format string, args ...interface{}) {
+	p.lines = append(p.lines, previewLine{'-', fmt.Sprintf(format, args...)})
+	p.destructive = true
+}
+
+// Add adds an item about to be created. Additions alone do not need a confirmation.
+func (p *Preview) Add(format string, args ...interface{}) {
+	p.lines = append(p.lines, previewLine{'+', fmt.Sprintf(format, args...)})
+}
+
+// Change adds a unified diff of a value about to be overwritten. Nothing is added if it is unchanged.
+func (p *Preview) Change(name, before, after string) {
+	if before == after {
+		return
+	}
+	p.lines = append(p.lines, previewLine{'~', name})
+	diff := godiff.Strings(strings.Split(before, "\n"), strings.Split(after, "\n"))
+	for _, line := range diff {
+		p.lines = append(p.lines, previewLine{line[0], "    " + line[1:]})
+	}
+	p.destructive = true
+}
+
+// Overwrite adds an item about to be replaced when its content can not be shown, e.g. because it is
+// encrypted.
+func (p *Preview) Overwrite(name, reason string) {
+	p.lines = append(p.lines, previewLine{'~', fmt.Sprintf("%s (%s)", name, reason)})
+	p.destructive = true
+}
+
+func (p *Preview) IsEmpty() bool {
+	return len(p.lines) == 0
+}
+
+func (p *Preview) Print() {
+	if p.IsEmpty() {
+		fmt.Fprintln(p.out, "Nothing to change")
+		return
+	}
+	fmt.Fprintln(p.out, p.title)
+	for _, line := range p.lines {
+		text := fmt.Sprintf("  %c %s", line.sign, line.text)
+		switch line.sign {
+		case '-':
+			_, _ = color.New(color.FgRed).Fprintln(p.out, text)
+		case '+':
+			_, _ = color.New(color.FgGreen).Fprintln(p.out, text)
+		case '~':
+			_, _ = color.New(color.FgYellow).Fprintln(p.out, text)
+		default:
+			fmt.Fprintln(p.out, text)
+		}
+	}
+}
+
+// Confirm prints the preview and asks the user to confirm it, unless the --yes flag is set.
+// It returns false if there is nothing to change or the user declines. Without a terminal
+// to ask on, the command fails unless the changes are confirmed with the --yes flag.
+func (p *Preview) Confirm(cmd *cobra.Command) bool {
+	yes, _ := cmd.Flags().GetBool("yes")
+	return p.ConfirmWith(yes)
+}
+
+// ConfirmWith is Confirm for code which is not given the command, with the value of its --yes flag.
+func (p *Preview) ConfirmWith(yes bool) bool {
+	p.Print()
+	if p.IsEmpty() {
+		return false
+	}
+	if !p.destructive {
+		return true
+	}
+	if yes {
+		return true
+	}
+	if !isTerminal(os.Stdin) {
+		DieNotNil(ValidationError("Refusing to apply the changes above without a confirmation, use --yes to confirm them"))
+	}
+	if !PromptYesNo("Apply these changes?", false) {
+		fmt.Fprintln(p.out, "Cancelled, nothing was changed")
+		return false
+	}
+	return true
+}
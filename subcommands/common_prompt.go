@@ -0,0 +1,78 @@
+package subcommands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Prompt asks the user a question and returns the answer. An empty answer returns the default value.
+func Prompt(question, defaultValue string) string {
+	if len(defaultValue) > 0 {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := readLine()
+	if err != nil {
+		DieNotNil(fmt.Errorf("Unable to read the answer: %w", err))
+	}
+	answer = strings.TrimSpace(answer)
+	if len(answer) == 0 {
+		return defaultValue
+	}
+	return answer
+}
+
+func readLine() (string, error) {
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// PromptSecret asks the user for a secret, e.g. a passphrase, without showing it on the terminal.
+func PromptSecret(question string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return "", errors.New("Unable to ask for a secret without a terminal")
+	}
+	fmt.Printf("%s: ", question)
+	return readSecret()
+}
+
+// PromptValid keeps asking the question until the validate function accepts the answer.
+func PromptValid(question, defaultValue string, validate func(string) error) string {
+	for {
+		answer := Prompt(question, defaultValue)
+		if err := validate(answer); err != nil {
+			fmt.Println("ERROR:", err)
+			continue
+		}
+		return answer
+	}
+}
+
+// PromptYesNo asks the user a yes/no question.
+func PromptYesNo(question string, defaultValue bool) bool {
+	def := "y/N"
+	if defaultValue {
+		def = "Y/n"
+	}
+	for {
+		answer := strings.ToLower(Prompt(question+" ("+def+")", ""))
+		switch answer {
+		case "":
+			return defaultValue
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Println("Please, answer yes or no.")
+	}
+}
@@ -0,0 +1,108 @@
+package subcommands
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	TimeFormatRfc3339  = "rfc3339"
+	TimeFormatRelative = "relative"
+)
+
+// TimeOptions control how timestamps, like expiry dates, last-seen times and build times, are displayed.
+// By default timestamps are shown exactly as returned by the API.
+type TimeOptions struct {
+	Utc    bool
+	Local  bool
+	Format string
+}
+
+var TimeDisplay TimeOptions
+
+func (o TimeOptions) Validate() error {
+	if o.Utc && o.Local {
+		return errors.New("The --utc and --local flags are mutually exclusive")
+	}
+	switch o.Format {
+	case "", TimeFormatRfc3339, TimeFormatRelative:
+	default:
+		return fmt.Errorf("Unsupported time format: %s. Supported: %s, %s",
+			o.Format, TimeFormatRfc3339, TimeFormatRelative)
+	}
+	return nil
+}
+
+func (o TimeOptions) isDefault() bool {
+	return !o.Utc && !o.Local && o.Format == ""
+}
+
+// Layouts of timestamps returned by the API. Those without a zone are in UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ParseTime parses a timestamp in any of the layouts returned by the API.
+func ParseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// FormatTime converts a timestamp returned by the API according to the global time options.
+// Values which are not timestamps are returned unchanged.
+func FormatTime(value string) string {
+	if TimeDisplay.isDefault() {
+		return value
+	}
+	if t, ok := ParseTime(value); ok {
+		return FormatTimestamp(t)
+	}
+	return value
+}
+
+// FormatTimestamp formats a time according to the global time options.
+func FormatTimestamp(t time.Time) string {
+	if TimeDisplay.isDefault() {
+		return t.String()
+	}
+	if TimeDisplay.Format == TimeFormatRelative {
+		return relativeTime(t, time.Now())
+	}
+	if TimeDisplay.Utc {
+		t = t.UTC()
+	} else if TimeDisplay.Local {
+		t = t.Local()
+	}
+	return t.Format(time.RFC3339)
+}
+
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	d = time.Duration(math.Abs(float64(d)))
+
+	var val string
+	switch {
+	case d < time.Minute:
+		val = fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		val = fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		val = fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		val = fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	if future {
+		return "in " + val
+	}
+	return val + " ago"
+}
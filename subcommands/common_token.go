@@ -0,0 +1,120 @@
+package subcommands
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Find an API token for non-interactive use (e.g. CI pipelines). In order of precedence:
+// 1. The --token flag or the FIOCTL_TOKEN environment variable (or "token" in the config file).
+// 2. The output of the "token-cmd" config option (or FIOCTL_TOKEN_CMD environment variable).
+// 3. The password for the API host in the netrc file ($NETRC or ~/.netrc), unless OAuth client credentials are set.
+func findApiToken(apiUrl string, ctx FactoryContext) (string, error) {
+	if token := viper.GetString("token"); len(token) > 0 {
+		return token, nil
+	}
+	if len(ctx.Token) > 0 {
+		return ctx.Token, nil
+	}
+	if len(ctx.TokenCmd) > 0 {
+		return runTokenCmd(ctx.TokenCmd)
+	}
+	if command := viper.GetString("token-cmd"); len(command) > 0 {
+		return runTokenCmd(command)
+	}
+	if len(Config.ClientCredentials.ClientId) > 0 {
+		// A token from the netrc file must not replace the credentials of "fioctl login"
+		return "", nil
+	}
+	return netrcToken(apiUrl)
+}
+
+func runTokenCmd(command string) (string, error) {
+	logrus.Debugf("Running token helper: %s", command)
+	cmd := shellCommand(command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Token helper command failed: %w\n= %s", err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(string(out))
+	if len(token) == 0 {
+		return "", fmt.Errorf("Token helper command returned an empty token")
+	}
+	return token, nil
+}
+
+func netrcToken(apiUrl string) (string, error) {
+	path := os.Getenv("NETRC")
+	if len(path) == 0 {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, netrcFileName)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Debugf("Unable to read netrc file %s: %s", path, err)
+		}
+		return "", nil
+	}
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return "", err
+	}
+	token := parseNetrc(string(content), u.Hostname())
+	if len(token) > 0 {
+		logrus.Debugf("Using API token for %s from %s", u.Hostname(), path)
+	}
+	return token, nil
+}
+
+// Return the password of the first netrc entry for the host. The default entry is not used:
+// it often holds a password for another service, which must not be sent to the API.
+func parseNetrc(content, host string) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		// Comments are only allowed at the start of the line
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+	fields := strings.Fields(strings.Join(lines, "\n"))
+
+	var machine, password string
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine", "default":
+			if machine == host && len(password) > 0 {
+				return password
+			}
+			machine, password = "", ""
+			if fields[i] == "machine" && i+1 < len(fields) {
+				i++
+				machine = fields[i]
+			}
+		case "password":
+			if i+1 < len(fields) {
+				i++
+				password = fields[i]
+			}
+		case "login", "account", "macdef":
+			i++
+		}
+	}
+	if machine == host && len(password) > 0 {
+		return password
+	}
+	return ""
+}
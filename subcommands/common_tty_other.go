@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package subcommands
+
+import "os"
+
+// isTerminal tells if a file is a terminal the user can answer prompts on.
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// readSecret reads a line from the standard input. Hiding it is not supported on this platform.
+func readSecret() (string, error) {
+	return readLine()
+}
@@ -3,8 +3,18 @@
 
 package subcommands
 
-import "golang.org/x/sys/unix"
+import (
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
 
 func IsWritable(dir string) bool {
 	return unix.Access(dir, unix.W_OK) == nil
 }
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+const netrcFileName = ".netrc"
@@ -4,6 +4,7 @@
 package subcommands
 
 import (
+	"os/exec"
 	"syscall"
 )
 
@@ -14,3 +15,9 @@ func IsWritable(dir string) bool {
 	}
 	return false
 }
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+const netrcFileName = "_netrc"
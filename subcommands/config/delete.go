@@ -17,6 +17,7 @@ func init() {
 	}
 	cmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().StringP("group", "g", "", "Device group to use")
+	subcommands.AddConfirmFlag(deleteCmd)
 }
 
 func doConfigDelete(cmd *cobra.Command, args []string) {
@@ -24,6 +25,12 @@ func doConfigDelete(cmd *cobra.Command, args []string) {
 	group, _ := cmd.Flags().GetString("group")
 	filename := args[0]
 
+	preview := subcommands.NewPreview("Config files to delete:")
+	preview.Remove(filename)
+	if !preview.Confirm(cmd) {
+		return
+	}
+
 	if group == "" {
 		logrus.Debugf("Deleting file %s from config for %s", filename, factory)
 		subcommands.DieNotNil(api.FactoryDeleteConfig(factory, filename))
@@ -3,7 +3,6 @@ package config
 import (
 	"fmt"
 
-	"github.com/cheynewallace/tabby"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -11,6 +10,8 @@ import (
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
+var groupListOutput subcommands.ListOutput
+
 func init() {
 	groupCmd := &cobra.Command{
 		Use:   "device-group",
@@ -18,23 +19,30 @@ func init() {
 	}
 	cmd.AddCommand(groupCmd)
 
-	groupCmd.AddCommand(&cobra.Command{
+	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "Show available device groups",
 		Run:   doListDeviceGroup,
-	})
-	groupCmd.AddCommand(&cobra.Command{
+	}
+	groupListOutput.AddFlags(listCmd, "created-at")
+	groupCmd.AddCommand(listCmd)
+	createCmd := &cobra.Command{
 		Use:   "create <name> [<description>]",
 		Short: "Create a new device groups",
 		Run:   doCreateDeviceGroup,
 		Args:  cobra.RangeArgs(1, 2),
-	})
-	groupCmd.AddCommand(&cobra.Command{
+	}
+	subcommands.AddIfNotExistsFlag(createCmd)
+	groupCmd.AddCommand(createCmd)
+	deleteCmd := &cobra.Command{
 		Use:   "delete <name>",
 		Short: "Delete an existing device group",
 		Run:   doDeleteDeviceGroup,
 		Args:  cobra.ExactArgs(1),
-	})
+	}
+	subcommands.AddConfirmFlag(deleteCmd)
+	subcommands.AddIfExistsFlags(deleteCmd)
+	groupCmd.AddCommand(deleteCmd)
 
 	updateCmd := &cobra.Command{
 		Use:   "update <name>",
@@ -54,18 +62,31 @@ func doListDeviceGroup(cmd *cobra.Command, args []string) {
 	lst, err := api.FactoryListDeviceGroup(factory)
 	subcommands.DieNotNil(err)
 
-	t := tabby.New()
-	t.AddHeader("NAME", "DESCRIPTION", "CREATED AT", "UPDATED AT")
+	t := groupListOutput.NewTable("NAME", "DESCRIPTION", "CREATED AT", "UPDATED AT")
 	for _, grp := range *lst {
 		t.AddLine(grp.Name, grp.Description, grp.ChangeMeta.CreatedAt, grp.ChangeMeta.UpdatedAt)
 	}
 	t.Print()
 }
 
+func deviceGroupExists(factory, name string) bool {
+	lst, err := api.FactoryListDeviceGroup(factory)
+	subcommands.DieNotNil(err)
+	for _, grp := range *lst {
+		if grp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func doCreateDeviceGroup(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	name := args[0]
 	logrus.Debugf("Creating a new device group %s for %s", name, factory)
+	if subcommands.IfNotExists(cmd) && subcommands.SkipExisting(cmd, deviceGroupExists(factory, name), "Device group "+name) {
+		return
+	}
 	var description *string
 	if len(args) > 1 {
 		description = &args[1]
@@ -79,16 +100,25 @@ func doCreateDeviceGroup(cmd *cobra.Command, args []string) {
 	if grp.Description != "" {
 		fmt.Printf("Description: \t%s\n", grp.Description)
 	}
-	fmt.Printf("Created At: \t%s\n\n", grp.ChangeMeta.CreatedAt)
+	fmt.Printf("Created At: \t%s\n\n", subcommands.FormatTime(grp.ChangeMeta.CreatedAt))
 }
 
 func doDeleteDeviceGroup(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	name := args[0]
 	logrus.Debugf("Deleting a device group %s from %s", name, factory)
+	if subcommands.IfExists(cmd) && subcommands.SkipMissing(cmd, deviceGroupExists(factory, name), "Device group "+name) {
+		return
+	}
+
+	preview := subcommands.NewPreview("Device groups to delete:")
+	preview.Remove(name)
+	if !preview.Confirm(cmd) {
+		return
+	}
 
 	err := api.FactoryDeleteDeviceGroup(factory, name)
-	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(subcommands.IgnoreMissing(cmd, err))
 }
 
 func doUpdateDeviceGroup(cmd *cobra.Command, args []string) {
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// configLayer is one of the configs merged into what a device receives, from the most specific one.
+type configLayer struct {
+	Name   string
+	Config *client.DeviceConfig
+}
+
+func init() {
+	explainCmd := &cobra.Command{
+		Use:   "explain <device> [<filename>]",
+		Short: "Explain which layer supplies each config file a device receives",
+		Long: `A device receives config files merged from three layers: the factory config,
+the config of its device group, and its own device config. A file in a more specific
+layer overrides the file with the same name in the less specific layers.
+
+This command shows, as a tree, which layer supplies each config file of a device,
+and which layers have values that are overridden. When explaining a single file,
+the unencrypted values of all layers are shown.`,
+		Run:  doExplain,
+		Args: cobra.RangeArgs(1, 2),
+		Example: `
+  # Explain all config files of a device:
+  fioctl config explain my-device
+
+  # Explain where the aktualizr-lite overrides of a device come from:
+  fioctl config explain my-device z-50-fioctl.toml`,
+	}
+	cmd.AddCommand(explainCmd)
+}
+
+func latestConfig(dcl *client.DeviceConfigList, err error) *client.DeviceConfig {
+	subcommands.DieNotNil(err)
+	if len(dcl.Configs) == 0 {
+		return nil
+	}
+	return &dcl.Configs[0]
+}
+
+func explainValue(f client.ConfigFile) string {
+	if !f.Unencrypted {
+		return "(encrypted)"
+	}
+	lines := strings.Split(strings.TrimSpace(f.Value), "\n")
+	val := lines[0]
+	if len(val) > 60 {
+		val = val[:57] + "..."
+	}
+	if len(lines) > 1 {
+		val += fmt.Sprintf(" (+%d lines)", len(lines)-1)
+	}
+	return fmt.Sprintf("%q", val)
+}
+
+func doExplain(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	name := args[0]
+	logrus.Debugf("Explaining config of %s", name)
+
+	device, err := api.DeviceGet(factory, name)
+	subcommands.DieNotNil(err)
+	group := device.GroupName
+	if device.Group != nil {
+		group = device.Group.Name
+	}
+
+	layers := []configLayer{{Name: "device", Config: latestConfig(api.DeviceListConfig(factory, name))}}
+	if len(group) > 0 {
+		layers = append(layers, configLayer{
+			Name:   "group " + group,
+			Config: latestConfig(api.GroupListConfig(factory, group)),
+		})
+	}
+	layers = append(layers, configLayer{Name: "factory", Config: latestConfig(api.FactoryListConfig(factory))})
+
+	var names []string
+	found := make(map[string]bool)
+	for _, layer := range layers {
+		if layer.Config == nil {
+			continue
+		}
+		for _, f := range layer.Config.Files {
+			if !found[f.Name] && (len(args) == 1 || f.Name == args[1]) {
+				found[f.Name] = true
+				names = append(names, f.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	title := device.Name
+	if len(group) > 0 {
+		title += " (group: " + group + ")"
+	}
+	fmt.Println(title)
+	if len(names) == 0 {
+		if len(args) == 2 {
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+				fmt.Errorf("The device does not receive a config file named %s", args[1])))
+		}
+		fmt.Println("└── no config files")
+		return
+	}
+
+	for idx, fname := range names {
+		branch, indent := "├── ", "│   "
+		if idx == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+		var supplied []configLayer
+		var files []client.ConfigFile
+		for _, layer := range layers {
+			if layer.Config == nil {
+				continue
+			}
+			for _, f := range layer.Config.Files {
+				if f.Name == fname {
+					supplied = append(supplied, layer)
+					files = append(files, f)
+				}
+			}
+		}
+		fmt.Printf("%s%s <- %s\n", branch, fname, supplied[0].Name)
+		for i, layer := range supplied {
+			leaf, leafIndent := "├── ", "│   "
+			if i == len(supplied)-1 {
+				leaf, leafIndent = "└── ", "    "
+			}
+			status := "effective"
+			if i > 0 {
+				status = "overridden by " + supplied[0].Name
+			}
+			fmt.Printf("%s%s%s: %s [%s]", indent, leaf, layer.Name, explainValue(files[i]), status)
+			if len(files[i].OnChanged) > 0 {
+				fmt.Printf(" on-changed: %s", strings.Join(files[i].OnChanged, " "))
+			}
+			fmt.Printf(" (%s, %s)\n", subcommands.FormatTime(layer.Config.CreatedAt), layer.Config.Reason)
+			if len(args) == 2 && files[i].Unencrypted {
+				// Show the whole values when explaining a single file, so that overrides can be compared
+				for _, line := range strings.Split(strings.TrimRight(files[i].Value, "\n"), "\n") {
+					fmt.Printf("%s%s | %s\n", indent, leafIndent, line)
+				}
+			}
+		}
+	}
+}
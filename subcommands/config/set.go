@@ -62,6 +62,9 @@ create a device group wide configuration instead.`,
 	setCmd.Flags().StringP("reason", "m", "", "Add a message to store as the \"reason\" for this change")
 	setCmd.Flags().BoolP("raw", "", false, "Use raw configuration file")
 	setCmd.Flags().BoolP("create", "", false, "Replace the whole config with these values. Default is to merge these values in with the existing config values")
+	setCmd.Flags().BoolP("dry-run", "", false,
+		"Only show which files would change, which on-changed handlers would run, and whether a reboot would be triggered")
+	subcommands.AddConfirmFlag(setCmd)
 }
 
 func doConfigSet(cmd *cobra.Command, args []string) {
@@ -70,10 +73,22 @@ func doConfigSet(cmd *cobra.Command, args []string) {
 	reason, _ := cmd.Flags().GetString("reason")
 	isRaw, _ := cmd.Flags().GetBool("raw")
 	shouldCreate, _ := cmd.Flags().GetBool("create")
-	opts := subcommands.SetConfigOptions{FileArgs: args, Reason: reason, IsRawFile: isRaw}
+	isDryRun, _ := cmd.Flags().GetBool("dry-run")
+	isConfirmed, _ := cmd.Flags().GetBool("yes")
+	opts := subcommands.SetConfigOptions{
+		FileArgs:    args,
+		Reason:      reason,
+		IsRawFile:   isRaw,
+		IsDryRun:    isDryRun,
+		IsReplace:   shouldCreate,
+		IsConfirmed: isConfirmed,
+	}
 
 	if group == "" {
 		logrus.Debugf("Creating new config for %s", factory)
+		opts.ListFunc = func() (*client.DeviceConfigList, error) {
+			return api.FactoryListConfig(factory)
+		}
 		opts.SetFunc = func(cfg client.ConfigCreateRequest) error {
 			if shouldCreate {
 				return api.FactoryCreateConfig(factory, cfg)
@@ -83,6 +98,9 @@ func doConfigSet(cmd *cobra.Command, args []string) {
 		}
 	} else {
 		logrus.Debugf("Creating new config for %s group %s", factory, group)
+		opts.ListFunc = func() (*client.DeviceConfigList, error) {
+			return api.GroupListConfig(factory, group)
+		}
 		opts.SetFunc = func(cfg client.ConfigCreateRequest) error {
 			if shouldCreate {
 				return api.GroupCreateConfig(factory, group, cfg)
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const (
+	wizardNtpFileName   = "ntp-servers"
+	wizardProxyFileName = "http-proxy"
+)
+
+func init() {
+	wizardCmd := &cobra.Command{
+		Use:   "wizard",
+		Short: "Interactively configure common factory settings",
+		Long: `Interactively configure the most common factory settings:
+- WireGuard VPN server used to access devices (factory-wide only).
+- NTP servers used by devices to synchronize time.
+- HTTP proxy used by devices to access the network.
+- How often aktualizr-lite polls for updates.
+
+All answers are validated and then saved as a single configuration change.
+Use the --group parameter to configure a device group instead of the whole factory.
+
+The NTP servers are saved into the "` + wizardNtpFileName + `" file, and the proxy settings
+into the "` + wizardProxyFileName + `" file in an environment file format.`,
+		Run:  doConfigWizard,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(wizardCmd)
+	wizardCmd.Flags().StringP("group", "g", "", "Device group to use")
+	wizardCmd.Flags().StringP("reason", "m", "Configured using fioctl config wizard", "Add a message to store as the \"reason\" for this change")
+	wizardCmd.Flags().BoolP("dryrun", "", false, "Only show what would be changed")
+}
+
+func doConfigWizard(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	group, _ := cmd.Flags().GetString("group")
+	reason, _ := cmd.Flags().GetString("reason")
+	isDryRun, _ := cmd.Flags().GetBool("dryrun")
+
+	var dcl *client.DeviceConfigList
+	var err error
+	if group == "" {
+		dcl, err = api.FactoryListConfig(factory)
+	} else {
+		dcl, err = api.GroupListConfig(factory, group)
+	}
+	subcommands.DieNotNil(err, "Failed to fetch existing config:")
+	current := make(map[string]string)
+	if len(dcl.Configs) > 0 {
+		for _, f := range dcl.Configs[0].Files {
+			current[f.Name] = f.Value
+		}
+	}
+
+	cfg := client.ConfigCreateRequest{Reason: reason}
+	if group == "" {
+		if f := wizardWireguard(factory); f != nil {
+			cfg.Files = append(cfg.Files, *f)
+		}
+	} else {
+		fmt.Println("WireGuard can only be configured factory-wide, skipping it for a device group.")
+	}
+	if f := wizardNtp(current[wizardNtpFileName]); f != nil {
+		cfg.Files = append(cfg.Files, *f)
+	}
+	if f := wizardProxy(current[wizardProxyFileName]); f != nil {
+		cfg.Files = append(cfg.Files, *f)
+	}
+	if f := wizardPolling(dcl); f != nil {
+		cfg.Files = append(cfg.Files, *f)
+	}
+
+	if len(cfg.Files) == 0 {
+		fmt.Println("No changes were requested.")
+		return
+	}
+
+	fmt.Println("\nThe following configuration change will be made:")
+	subcommands.PrintConfig(&client.DeviceConfig{Reason: cfg.Reason, Files: cfg.Files}, false, false, " ")
+	if isDryRun || !subcommands.PromptYesNo("Apply these changes?", false) {
+		return
+	}
+
+	if group == "" {
+		logrus.Debugf("Patching config for %s", factory)
+		err = api.FactoryPatchConfig(factory, cfg, false)
+	} else {
+		logrus.Debugf("Patching config for %s group %s", factory, group)
+		err = api.GroupPatchConfig(factory, group, cfg, false)
+	}
+	subcommands.DieNotNil(err)
+}
+
+func wizardWireguard(factory string) *client.ConfigFile {
+	wsc := LoadWireguardServerConfig(factory, api)
+	fmt.Println("\n= WireGuard VPN")
+	if !subcommands.PromptYesNo("Configure the WireGuard VPN server?", false) {
+		return nil
+	}
+	wsc.Enabled = subcommands.PromptYesNo("Enable VPN access for devices?", true)
+	if wsc.Enabled {
+		wsc.Endpoint = subcommands.PromptValid("Server endpoint (host:port)", wsc.Endpoint, validateHostPort)
+		address := wsc.VpnAddress
+		if len(address) == 0 {
+			address = "10.42.42.1"
+		}
+		wsc.VpnAddress = subcommands.PromptValid("Server VPN address", address, validateIPv4)
+		wsc.PublicKey = subcommands.PromptValid("Server public key", wsc.PublicKey, validateWireguardKey)
+	}
+	return &client.ConfigFile{
+		Name:        "wireguard-server",
+		Value:       wsc.Marshall(),
+		Unencrypted: true,
+		OnChanged:   []string{"/usr/share/fioconfig/handlers/factory-config-vpn"},
+	}
+}
+
+func wizardNtp(current string) *client.ConfigFile {
+	fmt.Println("\n= NTP")
+	if !subcommands.PromptYesNo("Configure NTP servers?", false) {
+		return nil
+	}
+	servers := strings.Join(strings.Fields(strings.TrimPrefix(current, "NTP=")), ",")
+	servers = subcommands.PromptValid("NTP servers (comma separated)", servers, func(val string) error {
+		for _, s := range strings.Split(val, ",") {
+			if err := validateHost(strings.TrimSpace(s)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var list []string
+	for _, s := range strings.Split(servers, ",") {
+		list = append(list, strings.TrimSpace(s))
+	}
+	return &client.ConfigFile{
+		Name:        wizardNtpFileName,
+		Value:       "NTP=" + strings.Join(list, " "),
+		Unencrypted: true,
+	}
+}
+
+func wizardProxy(current string) *client.ConfigFile {
+	fmt.Println("\n= HTTP proxy")
+	if !subcommands.PromptYesNo("Configure an HTTP proxy?", false) {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(current, "\n") {
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	httpProxy := subcommands.PromptValid("HTTP proxy URL", values["HTTP_PROXY"], validateProxyUrl)
+	httpsProxy := subcommands.PromptValid("HTTPS proxy URL", httpProxy, validateProxyUrl)
+	noProxy := subcommands.Prompt("Hosts to access without proxy (comma separated)", values["NO_PROXY"])
+	return &client.ConfigFile{
+		Name:        wizardProxyFileName,
+		Value:       fmt.Sprintf("HTTP_PROXY=%s\nHTTPS_PROXY=%s\nNO_PROXY=%s", httpProxy, httpsProxy, noProxy),
+		Unencrypted: true,
+	}
+}
+
+func wizardPolling(dcl *client.DeviceConfigList) *client.ConfigFile {
+	fmt.Println("\n= Update polling")
+	if !subcommands.PromptYesNo("Configure how often devices check for updates?", false) {
+		return nil
+	}
+	sota, err := subcommands.LoadSotaConfig(dcl)
+	subcommands.DieNotNil(err, "Invalid FIO toml file:")
+	current := ""
+	if val, ok := sota.Get("uptane.polling_sec").(int64); ok {
+		current = strconv.FormatInt(val, 10)
+	}
+	interval := subcommands.PromptValid("Polling interval in seconds", current, func(val string) error {
+		sec, err := strconv.Atoi(val)
+		if err != nil || sec < 10 || sec > 86400 {
+			return errors.New("Polling interval must be a number between 10 and 86400")
+		}
+		return nil
+	})
+	sec, _ := strconv.Atoi(interval)
+	sota.Set("uptane.polling_sec", int64(sec))
+	newToml, err := sota.ToTomlString()
+	subcommands.DieNotNil(err, "Unable to encode toml:")
+	return &client.ConfigFile{
+		Name:        subcommands.FIO_TOML_NAME,
+		Value:       newToml,
+		Unencrypted: true,
+		OnChanged:   []string{subcommands.FIO_TOML_ONCHANGED},
+	}
+}
+
+func validateHost(val string) error {
+	if len(val) == 0 || strings.ContainsAny(val, " /:") {
+		return fmt.Errorf("Invalid host name: %q", val)
+	}
+	return nil
+}
+
+func validateHostPort(val string) error {
+	host, port, err := net.SplitHostPort(val)
+	if err != nil {
+		return err
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("Invalid port: %s", port)
+	}
+	return validateHost(host)
+}
+
+func validateIPv4(val string) error {
+	if ip := net.ParseIP(val); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("Invalid IPv4 address: %s", val)
+	}
+	return nil
+}
+
+func validateWireguardKey(val string) error {
+	if key, err := base64.StdEncoding.DecodeString(val); err != nil || len(key) != 32 {
+		return errors.New("WireGuard public key must be a base64 encoded 32 byte value")
+	}
+	return nil
+}
+
+func validateProxyUrl(val string) error {
+	u, err := url.Parse(val)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("Invalid proxy URL: %s", val)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package dashboard
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	api *client.Api
+
+	refreshInterval   time.Duration
+	inactiveThreshold int
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dashboard",
+		Short: "Show a live terminal dashboard of a factory",
+		Long: `Show a terminal dashboard of a factory, refreshed periodically: a summary of the device fleet,
+active waves, recent CI builds, and pending TUF root updates.
+
+Keys:
+  1-4, Tab, Left/Right  Switch between the panes
+  Up/Down, k/j          Select a row
+  Enter                 Show the details of the selected row
+  Esc, Backspace        Go back from the details
+  r                     Refresh now
+  q, Ctrl-C             Quit`,
+		Run:  doDashboard,
+		Args: cobra.NoArgs,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			api = subcommands.Login(cmd)
+		},
+	}
+	subcommands.RequireFactory(cmd)
+	cmd.Flags().DurationVarP(&refreshInterval, "interval", "", 30*time.Second, "How often to refresh the dashboard")
+	cmd.Flags().IntVarP(&inactiveThreshold, "offline-threshold", "", 4,
+		"Consider device 'OFFLINE' if not seen in the last X hours")
+	return cmd
+}
+
+// key is a key press the dashboard handles.
+type key int
+
+const (
+	keyNone key = iota
+	keyQuit
+	keyRefresh
+	keyUp
+	keyDown
+	keyNextPane
+	keyPrevPane
+	keyEnter
+	keyBack
+	keyPane1
+	keyPane2
+	keyPane3
+	keyPane4
+)
+
+func parseKey(buf []byte) key {
+	switch string(buf) {
+	case "q", "Q", "\x03":
+		return keyQuit
+	case "r", "R":
+		return keyRefresh
+	case "k", "\x1b[A", "\x1bOA":
+		return keyUp
+	case "j", "\x1b[B", "\x1bOB":
+		return keyDown
+	case "\t", "l", "\x1b[C", "\x1bOC":
+		return keyNextPane
+	case "\x1b[Z", "h", "\x1b[D", "\x1bOD":
+		return keyPrevPane
+	case "\r", "\n":
+		return keyEnter
+	case "\x1b", "\x7f", "\b":
+		return keyBack
+	case "1":
+		return keyPane1
+	case "2":
+		return keyPane2
+	case "3":
+		return keyPane3
+	case "4":
+		return keyPane4
+	}
+	return keyNone
+}
+
+func readKeys(keys chan<- key) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			keys <- keyQuit
+			return
+		}
+		if k := parseKey(buf[:n]); k != keyNone {
+			keys <- k
+		}
+	}
+}
+
+func doDashboard(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	logrus.Debugf("Showing dashboard of %s", factory)
+	if refreshInterval < time.Second {
+		subcommands.DieNotNil(subcommands.ValidationError("The refresh interval must be at least 1s"))
+	}
+
+	term, err := openTerminal()
+	subcommands.DieNotNil(err, "Unable to start the dashboard:")
+	// Use the alternate screen, so that the dashboard does not clobber the terminal scrollback
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	restore := func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		term.restore()
+	}
+	subcommands.AddLastWill(restore)
+	defer restore()
+
+	d := newDashboard(factory)
+	keys := make(chan key)
+	go readKeys(keys)
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	snapshots := make(chan *snapshot)
+	details := make(chan []string)
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	refresh := func() {
+		if !d.refreshing {
+			d.refreshing = true
+			go func() { snapshots <- fetchSnapshot(factory) }()
+		}
+	}
+	refresh()
+	for {
+		width, height := term.size()
+		fmt.Print(strings.Join(d.render(width, height), "\r\n"))
+		select {
+		case s := <-snapshots:
+			d.refreshing = false
+			d.snap = s
+			d.clampSelection()
+		case lines := <-details:
+			d.detail = lines
+		case <-ticker.C:
+			refresh()
+		case <-resized:
+		case k := <-keys:
+			switch k {
+			case keyQuit:
+				return
+			case keyRefresh:
+				refresh()
+			case keyUp:
+				d.move(-1)
+			case keyDown:
+				d.move(1)
+			case keyNextPane:
+				d.switchPane(d.pane + 1)
+			case keyPrevPane:
+				d.switchPane(d.pane + len(panes) - 1)
+			case keyPane1, keyPane2, keyPane3, keyPane4:
+				d.switchPane(int(k - keyPane1))
+			case keyEnter:
+				if d.detail == nil && d.snap != nil {
+					if fetch := d.selectedDetail(); fetch != nil {
+						d.detail = []string{"Loading..."}
+						go func() { details <- fetch() }()
+					}
+				}
+			case keyBack:
+				d.detail = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const (
+	paneFleet = iota
+	paneWaves
+	paneBuilds
+	paneTuf
+)
+
+var panes = []string{"Fleet", "Waves", "Builds", "TUF"}
+
+// snapshot is the factory state shown by the dashboard. Each part is fetched separately,
+// so that a failure only affects its own pane.
+type snapshot struct {
+	at time.Time
+
+	status    *client.FactoryStatus
+	statusErr error
+	waves     []client.Wave
+	wavesErr  error
+	builds    []client.JobservBuild
+	buildsErr error
+	tuf       *client.TufRootUpdates
+	tufErr    error
+}
+
+func fetchSnapshot(factory string) *snapshot {
+	s := snapshot{at: time.Now()}
+	s.status, s.statusErr = api.FactoryStatus(factory, inactiveThreshold)
+	if wl, err := api.FactoryListWaves(factory, 20, 1); err != nil {
+		s.wavesErr = err
+	} else {
+		s.waves = wl.Waves
+	}
+	if bl, err := api.JobservBuilds(factory, 20, 1); err != nil {
+		s.buildsErr = err
+	} else {
+		s.builds = bl.Builds
+	}
+	if updates, err := api.TufRootUpdatesGet(factory); err != nil {
+		s.tufErr = err
+	} else {
+		s.tuf = &updates
+	}
+	return &s
+}
+
+// fleetTag is a row of the fleet pane.
+type fleetTag struct {
+	kind string
+	tag  client.TagStatus
+}
+
+func (s *snapshot) fleetTags() []fleetTag {
+	var tags []fleetTag
+	if s.status == nil {
+		return tags
+	}
+	for _, t := range s.status.ProdWaveTags {
+		tags = append(tags, fleetTag{"wave", t})
+	}
+	for _, t := range s.status.ProdTags {
+		tags = append(tags, fleetTag{"production", t})
+	}
+	for _, t := range s.status.Tags {
+		tags = append(tags, fleetTag{"ci", t})
+	}
+	return tags
+}
+
+type dashboard struct {
+	factory    string
+	pane       int
+	selected   []int
+	snap       *snapshot
+	detail     []string
+	refreshing bool
+}
+
+func newDashboard(factory string) *dashboard {
+	return &dashboard{factory: factory, selected: make([]int, len(panes))}
+}
+
+func (d *dashboard) rowCount() int {
+	if d.snap == nil {
+		return 0
+	}
+	switch d.pane {
+	case paneFleet:
+		return len(d.snap.fleetTags())
+	case paneWaves:
+		return len(d.snap.waves)
+	case paneBuilds:
+		return len(d.snap.builds)
+	}
+	return 0
+}
+
+func (d *dashboard) clampSelection() {
+	if rows := d.rowCount(); d.selected[d.pane] >= rows {
+		d.selected[d.pane] = rows - 1
+	}
+	if d.selected[d.pane] < 0 {
+		d.selected[d.pane] = 0
+	}
+}
+
+func (d *dashboard) move(delta int) {
+	if d.detail == nil {
+		d.selected[d.pane] += delta
+		d.clampSelection()
+	}
+}
+
+func (d *dashboard) switchPane(pane int) {
+	d.pane = pane % len(panes)
+	d.detail = nil
+	d.clampSelection()
+}
+
+// selectedDetail returns a function fetching the details of the selected row, if it has any.
+func (d *dashboard) selectedDetail() func() []string {
+	idx := d.selected[d.pane]
+	if idx >= d.rowCount() {
+		return nil
+	}
+	switch d.pane {
+	case paneFleet:
+		ft := d.snap.fleetTags()[idx]
+		return func() []string { return tagDetail(ft) }
+	case paneWaves:
+		wave := d.snap.waves[idx]
+		return func() []string { return waveDetail(d.factory, wave) }
+	case paneBuilds:
+		build := d.snap.builds[idx]
+		return func() []string { return buildDetail(d.factory, build) }
+	}
+	return nil
+}
+
+func table(columns []string, rows [][]string) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	_ = w.Flush()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+func errLines(err error) []string {
+	return []string{"ERROR: " + err.Error()}
+}
+
+func (d *dashboard) paneLines() (header []string, rows []string) {
+	s := d.snap
+	switch d.pane {
+	case paneFleet:
+		if s.statusErr != nil {
+			return errLines(s.statusErr), nil
+		}
+		var cells [][]string
+		for _, ft := range s.fleetTags() {
+			name := ft.tag.Name
+			if len(name) == 0 {
+				name = "(Untagged)"
+			}
+			cells = append(cells, []string{
+				name, ft.kind, strconv.Itoa(ft.tag.LatestTarget), strconv.Itoa(ft.tag.DevicesTotal),
+				strconv.Itoa(ft.tag.DevicesOnLatest), strconv.Itoa(ft.tag.DevicesOnline),
+			})
+		}
+		lines := table([]string{"TAG", "KIND", "LATEST TARGET", "DEVICES", "ON LATEST", "ONLINE"}, cells)
+		return append([]string{fmt.Sprintf("Total number of devices: %d", s.status.TotalDevices), ""}, lines[0]), lines[1:]
+	case paneWaves:
+		if s.wavesErr != nil {
+			return errLines(s.wavesErr), nil
+		}
+		active := 0
+		var cells [][]string
+		for _, w := range s.waves {
+			if w.Status == "active" {
+				active += 1
+			}
+			cells = append(cells, []string{w.Name, w.Version, w.Tag, w.Status, subcommands.FormatTime(w.ChangeMeta.CreatedAt)})
+		}
+		lines := table([]string{"NAME", "VERSION", "TAG", "STATUS", "CREATED AT"}, cells)
+		return []string{fmt.Sprintf("Active waves: %d", active), "", lines[0]}, lines[1:]
+	case paneBuilds:
+		if s.buildsErr != nil {
+			return errLines(s.buildsErr), nil
+		}
+		var cells [][]string
+		for _, b := range s.builds {
+			cells = append(cells, []string{
+				strconv.Itoa(b.ID), b.Status, b.TriggerName, subcommands.FormatTime(b.Created), subcommands.FormatTime(b.Completed),
+			})
+		}
+		lines := table([]string{"BUILD", "STATUS", "TRIGGER", "CREATED", "COMPLETED"}, cells)
+		return []string{"Recent builds:", "", lines[0]}, lines[1:]
+	case paneTuf:
+		if s.tufErr != nil {
+			return errLines(s.tufErr), nil
+		}
+		return tufLines(s.tuf), nil
+	}
+	return nil, nil
+}
+
+func tufLines(u *client.TufRootUpdates) []string {
+	if u.Status == client.TufRootUpdatesStatusNone || len(u.Status) == 0 {
+		return []string{"There are no pending TUF root updates."}
+	}
+	lines := []string{"Pending TUF root updates: " + u.Status}
+	if u.ChangeMeta != nil {
+		lines = append(lines, fmt.Sprintf("Started by %s at %s", u.ChangeMeta.CreatedBy, subcommands.FormatTime(u.ChangeMeta.CreatedAt)))
+	}
+	if len(u.Amendments) > 0 {
+		lines = append(lines, "", "Changes:")
+		for _, a := range u.Amendments {
+			lines = append(lines, "  - "+a.Message)
+		}
+	}
+	for _, e := range u.Issues.Errors {
+		lines = append(lines, "  ERROR: "+e.Message)
+	}
+	for _, w := range u.Issues.Warnings {
+		lines = append(lines, "  WARNING: "+w.Message)
+	}
+	lines = append(lines, "", "See: fioctl keys tuf updates view")
+	return lines
+}
+
+func tagDetail(ft fleetTag) []string {
+	name := ft.tag.Name
+	if len(name) == 0 {
+		name = "(Untagged)"
+	}
+	lines := []string{fmt.Sprintf("Tag %s (%s): orphan target versions are marked with a star (*)", name, ft.kind), ""}
+	var cells [][]string
+	for _, t := range ft.tag.Targets {
+		version := strconv.Itoa(t.Version)
+		if t.IsOrphan {
+			version += "*"
+		}
+		cells = append(cells, []string{version, strconv.Itoa(t.Devices), strconv.Itoa(t.Reinstalling)})
+	}
+	lines = append(lines, table([]string{"TARGET", "DEVICES", "INSTALLING"}, cells)...)
+	cells = nil
+	for _, g := range ft.tag.DeviceGroups {
+		cells = append(cells, []string{
+			g.Name, strconv.Itoa(g.DevicesTotal), strconv.Itoa(g.DevicesOnLatest), strconv.Itoa(g.DevicesOnline),
+			strconv.Itoa(g.Reinstalling),
+		})
+	}
+	lines = append(lines, "")
+	return append(lines, table([]string{"DEVICE GROUP", "DEVICES", "ON LATEST", "ONLINE", "INSTALLING"}, cells)...)
+}
+
+func waveDetail(factory string, wave client.Wave) []string {
+	s, err := api.FactoryWaveStatus(factory, wave.Name, inactiveThreshold)
+	if err != nil {
+		return errLines(err)
+	}
+	lines := []string{
+		fmt.Sprintf("Wave %s: version %d, tag %s, %s", s.Name, s.Version, s.Tag, s.Status),
+		fmt.Sprintf("Created at %s", subcommands.FormatTime(s.CreatedAt)),
+		fmt.Sprintf("Devices: %d total, %d updated, %d scheduled, %d unscheduled",
+			s.TotalDevices, s.UpdatedDevices, s.ScheduledDevices, s.UnscheduledDevices),
+		"",
+	}
+	var cells [][]string
+	for _, g := range s.RolloutGroups {
+		cells = append(cells, []string{
+			g.Name, subcommands.FormatTime(g.RolloutAt), strconv.Itoa(g.DevicesTotal), strconv.Itoa(g.DevicesOnline),
+			strconv.Itoa(g.DevicesOnWave), strconv.Itoa(g.DevicesOnNewer),
+		})
+	}
+	return append(lines, table([]string{"ROLLOUT GROUP", "ROLLOUT AT", "DEVICES", "ONLINE", "ON WAVE", "ON NEWER"}, cells)...)
+}
+
+func buildDetail(factory string, build client.JobservBuild) []string {
+	runs, err := api.JobservRuns(factory, build.ID)
+	if err != nil {
+		return errLines(err)
+	}
+	lines := []string{fmt.Sprintf("Build %d: %s", build.ID, build.Status)}
+	if len(build.Reason) > 0 {
+		lines = append(lines, "Reason: "+build.Reason)
+	}
+	lines = append(lines, "")
+	var cells [][]string
+	for _, r := range runs {
+		cells = append(cells, []string{r.Name, r.Status, subcommands.FormatTime(r.Created), subcommands.FormatTime(r.Completed)})
+	}
+	return append(lines, table([]string{"RUN", "STATUS", "CREATED", "COMPLETED"}, cells)...)
+}
+
+func truncate(line string, width int) string {
+	if r := []rune(line); len(r) > width {
+		return string(r[:width])
+	}
+	return line
+}
+
+// render draws the whole screen, fitting the selected row of a pane into the window height.
+func (d *dashboard) render(width, height int) []string {
+	var tabs []string
+	for idx, name := range panes {
+		tab := fmt.Sprintf(" %d %s ", idx+1, name)
+		if idx == d.pane {
+			tab = "\x1b[7m" + tab + "\x1b[0m"
+		}
+		tabs = append(tabs, tab)
+	}
+	status := "loading..."
+	if d.snap != nil {
+		status = "updated " + d.snap.at.Format("15:04:05")
+	}
+	if d.refreshing {
+		status = "refreshing..."
+	}
+	out := []string{fmt.Sprintf("\x1b[1m%s\x1b[0m  %s  (%s)", d.factory, strings.Join(tabs, " "), status), ""}
+
+	var header, rows []string
+	selected := -1
+	if d.detail != nil {
+		header = d.detail
+	} else if d.snap != nil {
+		header, rows = d.paneLines()
+		selected = d.selected[d.pane]
+	}
+	body := height - len(out) - 2
+	for _, line := range header {
+		if len(out) < body+2 {
+			out = append(out, truncate(line, width))
+		}
+	}
+	if len(rows) > 0 {
+		visible := body + 2 - len(out)
+		first := 0
+		if selected >= visible {
+			first = selected - visible + 1
+		}
+		for idx := first; idx < len(rows) && idx < first+visible; idx++ {
+			line := truncate(rows[idx], width)
+			if idx == selected {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			out = append(out, line)
+		}
+	}
+	for len(out) < height-1 {
+		out = append(out, "")
+	}
+	help := "q: quit  r: refresh  tab/1-4: panes  up/down: select  enter: details"
+	if d.detail != nil {
+		help = "q: quit  r: refresh  esc: back"
+	}
+	out = append(out, "\x1b[2m"+truncate(help, width)+"\x1b[0m")
+	// Move to the top left and clear each line before drawing it
+	for idx := range out {
+		out[idx] = "\x1b[2K" + out[idx]
+	}
+	out[0] = "\x1b[H" + out[0]
+	return out
+}
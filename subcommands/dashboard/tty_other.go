@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package dashboard
+
+import (
+	"errors"
+	"os"
+)
+
+type terminal struct{}
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("The dashboard is not supported on this platform, use \"fioctl status\" instead")
+}
+
+func (t *terminal) restore() {}
+
+func (t *terminal) size() (int, int) {
+	return 80, 24
+}
+
+func notifyResize(ch chan os.Signal) {}
@@ -66,7 +66,7 @@ func doListStates(cmd *cobra.Command, args []string) {
 		if indx >= asListLimit {
 			break
 		}
-		fmt.Printf("Time:\t%s\n", s.DeviceTime)
+		fmt.Printf("Time:\t%s\n", subcommands.FormatTime(s.DeviceTime))
 		fmt.Printf("Hash:\t%s\n", s.Ostree)
 		fmt.Println("Unhealthy Apps:")
 		printAppsState(s.Apps, "healthy", false)
@@ -8,8 +8,9 @@ import (
 )
 
 var (
-	api       *client.Api
-	listLimit int
+	api           *client.Api
+	listLimit     int
+	updatesOutput subcommands.ListOutput
 )
 
 var cmd = &cobra.Command{
@@ -49,6 +50,9 @@ fioctl devices updates <device> <update-id>
 
 # Show the most recent update with bash help:
 fioctl devices updates <device> $(fioctl devices updates <device> -n1 | tail -n1 | cut -f1 -d\ )
+
+# Export a report of updates applied to all devices of a group for an audit:
+fioctl devices updates export --group <group> --since 2024-01-01 -o csv
 `,
 }
 
@@ -56,6 +60,7 @@ func NewCommand() *cobra.Command {
 	subcommands.RequireFactory(cmd)
 
 	updatesCmd.Flags().IntVarP(&listLimit, "limit", "n", 0, "Limit the number of updates displayed.")
+	updatesOutput.AddFlags(updatesCmd, "time")
 
 	cmd.AddCommand(configCmd)
 	cmd.AddCommand(updatesCmd)
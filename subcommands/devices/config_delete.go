@@ -9,17 +9,24 @@ import (
 )
 
 func init() {
-	configCmd.AddCommand(&cobra.Command{
+	deleteCmd := &cobra.Command{
 		Use:   "delete <device> <file>",
 		Short: "Delete file from the current configuration",
 		Run:   doConfigDelete,
 		Args:  cobra.ExactArgs(2),
-	})
+	}
+	configCmd.AddCommand(deleteCmd)
+	subcommands.AddConfirmFlag(deleteCmd)
 }
 
 func doConfigDelete(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	logrus.Debug("Deleting file from device config")
 
+	preview := subcommands.NewPreview("Config files of " + args[0] + " to delete:")
+	preview.Remove(args[1])
+	if !preview.Confirm(cmd) {
+		return
+	}
 	subcommands.DieNotNil(api.DeviceDeleteConfig(factory, args[0], args[1]))
 }
@@ -70,6 +70,9 @@ device's configuration and apply it.`,
 	setConfigCmd.Flags().StringP("reason", "m", "", "Add a message to store as the \"reason\" for this change")
 	setConfigCmd.Flags().BoolP("raw", "", false, "Use raw configuration file")
 	setConfigCmd.Flags().BoolP("create", "", false, "Replace the whole config with these values. Default is to merge these values in with the existing config values")
+	setConfigCmd.Flags().BoolP("dry-run", "", false,
+		"Only show which files would change, which on-changed handlers would run, and whether a reboot would be triggered")
+	subcommands.AddConfirmFlag(setConfigCmd)
 }
 
 func loadEciesPub(pubkey string) *ecies.PublicKey {
@@ -99,6 +102,8 @@ func doConfigSet(cmd *cobra.Command, args []string) {
 	reason, _ := cmd.Flags().GetString("reason")
 	isRaw, _ := cmd.Flags().GetBool("raw")
 	shouldCreate, _ := cmd.Flags().GetBool("create")
+	isDryRun, _ := cmd.Flags().GetBool("dry-run")
+	isConfirmed, _ := cmd.Flags().GetBool("yes")
 
 	logrus.Debugf("Creating new device config for %s", name)
 	// Ensure the device has a public key we can encrypt with
@@ -110,9 +115,15 @@ func doConfigSet(cmd *cobra.Command, args []string) {
 	pubkey := loadEciesPub(device.PublicKey)
 
 	subcommands.SetConfig(&subcommands.SetConfigOptions{
-		FileArgs:  args[1:],
-		Reason:    reason,
-		IsRawFile: isRaw,
+		FileArgs:    args[1:],
+		Reason:      reason,
+		IsRawFile:   isRaw,
+		IsDryRun:    isDryRun,
+		IsReplace:   shouldCreate,
+		IsConfirmed: isConfirmed,
+		ListFunc: func() (*client.DeviceConfigList, error) {
+			return api.DeviceListConfig(factory, device.Name)
+		},
 		SetFunc: func(cfg client.ConfigCreateRequest) error {
 			if shouldCreate {
 				return api.DeviceCreateConfig(factory, device.Name, cfg)
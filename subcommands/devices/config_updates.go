@@ -33,10 +33,13 @@ currently configured and reporting.`,
 	configUpdatesCmd.Flags().StringP("tag", "", "", "Target tag for device to follow")
 	configUpdatesCmd.Flags().StringP("tags", "", "", "Target tag for device to follow")
 	configUpdatesCmd.Flags().StringP("apps", "", "", "comma,separate,list")
+	configUpdatesCmd.Flags().BoolP("dry-run", "", false,
+		"Only show what would be changed, which on-changed handlers would run, and whether a reboot would be triggered")
 	configUpdatesCmd.Flags().BoolP("dryrun", "", false, "Only show what would be changed")
 	configUpdatesCmd.Flags().BoolP("force", "", false, "DANGER: For a config on a device that might result in corruption")
 
 	_ = configUpdatesCmd.Flags().MarkHidden("tags") // assign for go linter
+	_ = configUpdatesCmd.Flags().MarkDeprecated("dryrun", "use --dry-run instead")
 }
 
 func doConfigUpdates(cmd *cobra.Command, args []string) {
@@ -48,7 +51,11 @@ func doConfigUpdates(cmd *cobra.Command, args []string) {
 		// check the old, deprecated "tags" option
 		updateTag, _ = cmd.Flags().GetString("tags")
 	}
-	isDryRun, _ := cmd.Flags().GetBool("dryrun")
+	isDryRun, _ := cmd.Flags().GetBool("dry-run")
+	if !isDryRun {
+		// check the old, deprecated "dryrun" option
+		isDryRun, _ = cmd.Flags().GetBool("dryrun")
+	}
 	isForced, _ := cmd.Flags().GetBool("force")
 
 	logrus.Debugf("Configuring device updates for %s", name)
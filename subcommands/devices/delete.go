@@ -7,21 +7,32 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
 )
 
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	deleteCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "Delete a device(s) registered to a factory.",
 		Run:   doDelete,
 		Args:  cobra.MinimumNArgs(1),
-	})
+	}
+	cmd.AddCommand(deleteCmd)
+	subcommands.AddConfirmFlag(deleteCmd)
 }
 
 func doDelete(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	logrus.Debug("Deleting %r", args)
 
+	preview := subcommands.NewPreview("Devices to delete:")
+	for _, name := range args {
+		preview.Remove(name)
+	}
+	if !preview.Confirm(cmd) {
+		return
+	}
 	for _, name := range args {
 		fmt.Printf("Deleting %s .. ", name)
 		if err := api.DeviceDelete(factory, name); err != nil {
@@ -10,7 +10,7 @@ import (
 )
 
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	deleteCmd := &cobra.Command{
 		Use:   "delete-denied <uuid> [<uuid>...]",
 		Short: "Remove a device UUID from the deny list",
 		Run:   doDeleteDenied,
@@ -18,13 +18,22 @@ func init() {
 		Long: `Remove a device UUID from the deny list so that the UUID can be re-used.
 This is handy for Factories using HSMs and a factory-registration-reference
 server.`,
-	})
+	}
+	cmd.AddCommand(deleteCmd)
+	subcommands.AddConfirmFlag(deleteCmd)
 }
 
 func doDeleteDenied(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	logrus.Debug("Deleting %r", args)
 
+	preview := subcommands.NewPreview("Device UUIDs to remove from the deny list:")
+	for _, uuid := range args {
+		preview.Remove(uuid)
+	}
+	if !preview.Confirm(cmd) {
+		return
+	}
 	for _, uuid := range args {
 		fmt.Printf("Deleting %s .. ", uuid)
 		subcommands.DieNotNil(api.DeviceDeleteDenied(factory, uuid))
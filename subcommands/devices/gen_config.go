@@ -0,0 +1,200 @@
+package devices
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const defaultDeviceGateway = "https://ota-lite.foundries.io:8443"
+
+// The sota.toml written by lmp-device-register, which config files are applied on top of.
+const baseSotaToml = `
+[tls]
+server = "%[1]s"
+ca_source = "file"
+pkey_source = "file"
+cert_source = "file"
+
+[provision]
+server = "%[1]s"
+
+[uptane]
+repo_server = "%[1]s/repo"
+key_source = "file"
+polling_sec = 300
+
+[pacman]
+type = "ostree+compose_apps"
+ostree_server = "%[1]s/treehub"
+packages_file = "/usr/package.manifest"
+tags = ""
+compose_apps_root = "/var/sota/compose-apps"
+callback_program = "/var/sota/aklite-callback.sh"
+
+[storage]
+type = "sqlite"
+path = "/var/sota/"
+sqldb_path = "/var/sota/sql.db"
+
+[import]
+base_path = "/var/sota/import"
+tls_cacert_path = "/var/sota/root.crt"
+tls_clientcert_path = "/var/sota/client.pem"
+tls_pkey_path = "/var/sota/pkey.pem"
+`
+
+var (
+	genConfigGroup string
+	genConfigOut   string
+)
+
+func init() {
+	genConfigCmd := &cobra.Command{
+		Use:   "gen-config [<device>] [--group <group>]",
+		Short: "Generate the aktualizr-lite config a device runs with",
+		Long: `Render the sota.toml settings aktualizr-lite and fioconfig run with on a device:
+the device gateway URLs, the tag and apps to follow, how often to poll for updates,
+and the callback program.
+
+The settings of lmp-device-register are merged with the TOML config files the device
+receives from the factory, its device group, and its own config. When a device has
+reported its aktualizr-lite config, that is used in place of the lmp-device-register settings.
+
+This is useful to create golden images, and to reproduce the environment of a device
+when investigating issues.`,
+		Run:  doGenConfig,
+		Args: cobra.MaximumNArgs(1),
+		Example: `
+  # Generate the config of a device:
+  fioctl devices gen-config my-device --out sota.toml
+
+  # Generate the config for devices of a group, e.g. for a golden image:
+  fioctl devices gen-config --group production --out sota.toml`,
+	}
+	cmd.AddCommand(genConfigCmd)
+	genConfigCmd.Flags().StringVarP(&genConfigGroup, "group", "g", "",
+		"Generate the config for devices in this device group rather than a specific device")
+	genConfigCmd.Flags().StringVarP(&genConfigOut, "out", "", "", "Write the config to this file rather than STDOUT")
+}
+
+// deviceGateway finds the device gateway URL from the factory's TLS certificate.
+func deviceGateway(factory string) string {
+	certs, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	if block, _ := pem.Decode([]byte(certs.TlsCrt)); block != nil {
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil && len(c.DNSNames) > 0 {
+			return "https://" + c.DNSNames[0] + ":8443"
+		}
+	}
+	logrus.Debugf("The factory has no device gateway certificate, using %s", defaultDeviceGateway)
+	return defaultDeviceGateway
+}
+
+// mergeToml sets all values of the overlay into the base, as aktualizr-lite does for config files read later.
+func mergeToml(base, overlay *toml.Tree, prefix []string) {
+	for _, key := range overlay.Keys() {
+		keyPath := append(append([]string{}, prefix...), key)
+		if sub, ok := overlay.GetPath([]string{key}).(*toml.Tree); ok {
+			mergeToml(base, sub, keyPath)
+		} else {
+			base.SetPath(keyPath, overlay.GetPath([]string{key}))
+		}
+	}
+}
+
+// renderSotaConfig renders the aktualizr-lite config of a device, or of devices in a group when the device is nil.
+func renderSotaConfig(factory string, device *client.Device, group string) string {
+	sota, err := toml.Load(fmt.Sprintf(baseSotaToml, deviceGateway(factory)))
+	subcommands.DieNotNil(err)
+
+	var layers []*client.DeviceConfig
+	if device != nil {
+		if len(device.AktualizrToml) > 0 {
+			reported, err := toml.Load(device.AktualizrToml)
+			subcommands.DieNotNil(err, "Unable to decode the aktualizr-lite config reported by the device:")
+			logrus.Debug("Using the aktualizr-lite config reported by the device")
+			sota = reported
+		} else if len(device.Tag) > 0 {
+			sota.Set("pacman.tags", device.Tag)
+		}
+		group = device.GroupName
+		if device.Group != nil {
+			group = device.Group.Name
+		}
+		layers = append(layers, latestConfig(api.DeviceListConfig(factory, device.Name)))
+	}
+	if len(group) > 0 {
+		layers = append(layers, latestConfig(api.GroupListConfig(factory, group)))
+	}
+	layers = append(layers, latestConfig(api.FactoryListConfig(factory)))
+
+	// A file of a more specific layer overrides the file with the same name of less specific ones
+	effective := make(map[string]client.ConfigFile)
+	for i := len(layers) - 1; i >= 0; i-- {
+		if layers[i] == nil {
+			continue
+		}
+		for _, f := range layers[i].Files {
+			effective[f.Name] = f
+		}
+	}
+	var names []string
+	for name, f := range effective {
+		if strings.HasSuffix(name, ".toml") && f.Unencrypted {
+			names = append(names, name)
+		}
+	}
+	// aktualizr-lite reads config files in the order of their names
+	sort.Strings(names)
+	for _, name := range names {
+		overlay, err := toml.Load(effective[name].Value)
+		subcommands.DieNotNil(err, "Unable to decode "+name+":")
+		logrus.Debugf("Applying %s", name)
+		mergeToml(sota, overlay, nil)
+	}
+
+	out, err := sota.ToTomlString()
+	subcommands.DieNotNil(err, "Unable to encode toml:")
+	return out
+}
+
+func doGenConfig(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	if (len(args) == 1) == (len(genConfigGroup) > 0) {
+		subcommands.DieNotNil(subcommands.ValidationError("Either a device or the --group flag must be given"))
+	}
+
+	var device *client.Device
+	if len(args) == 1 {
+		var err error
+		device, err = api.DeviceGet(factory, args[0])
+		subcommands.DieNotNil(err)
+	}
+	out := renderSotaConfig(factory, device, genConfigGroup)
+	if len(genConfigOut) == 0 {
+		fmt.Print(out)
+		return
+	}
+	subcommands.DieNotNil(os.WriteFile(genConfigOut, []byte(out), 0644))
+	fmt.Println("Config written to", genConfigOut)
+}
+
+func latestConfig(dcl *client.DeviceConfigList, err error) *client.DeviceConfig {
+	subcommands.DieNotNil(err)
+	if len(dcl.Configs) == 0 {
+		return nil
+	}
+	return &dcl.Configs[0]
+}
@@ -7,7 +7,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/cheynewallace/tabby"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,10 +22,12 @@ var (
 	deviceByGroup       string
 	deviceInactiveHours int
 	deviceUuid          string
+	deviceListAll       bool
 	showColumns         []string
 	showPage            int
 	paginationLimit     int
 	paginationLimits    []int
+	listOutput          subcommands.ListOutput
 )
 
 type column struct {
@@ -89,7 +90,7 @@ var Columns = map[string]column{
 	"is-wave":       {func(d *client.Device) string { return fmt.Sprintf("%v", d.IsWave) }},
 }
 
-func addPaginationFlags(cmd *cobra.Command) {
+func addPaginationFlags(cmd *cobra.Command, sortExample string) {
 	paginationLimits = []int{10, 20, 30, 40, 50, 100, 200, 500, 1000}
 	limitsStr := ""
 	for i, limit := range paginationLimits {
@@ -101,6 +102,7 @@ func addPaginationFlags(cmd *cobra.Command) {
 
 	cmd.Flags().IntVarP(&showPage, "page", "p", 1, "Page of devices to display when pagination is needed")
 	cmd.Flags().IntVarP(&paginationLimit, "limit", "n", 500, "Number of devices to paginate by. Allowed values: "+limitsStr)
+	listOutput.AddFlags(cmd, sortExample)
 }
 
 func init() {
@@ -127,7 +129,11 @@ func init() {
 	listCmd.Flags().IntVarP(&deviceInactiveHours, "offline-threshold", "", 4, "List the device as 'OFFLINE' if not seen in the last X hours")
 	listCmd.Flags().StringVarP(&deviceUuid, "uuid", "", "", "Find device with the given UUID")
 	listCmd.Flags().StringSliceVarP(&showColumns, "columns", "", defCols, "Specify which columns to display")
-	addPaginationFlags(listCmd)
+	addPaginationFlags(listCmd, "tag,last-seen")
+	listCmd.Flags().BoolVarP(&deviceListAll, "all", "", false,
+		"List the devices of all pages, fetching them a page of --limit devices at a time. "+
+			"With --output=csv, and no --sort-by, devices are printed as they are fetched")
+	listCmd.MarkFlagsMutuallyExclusive("all", "page")
 }
 
 // We allow pattern matching using filepath.Match type * and ?
@@ -157,30 +163,69 @@ func assertPagination() {
 }
 
 func showDeviceList(dl *client.DeviceList, showColumns []string) {
-	t := tabby.New()
-	var cols = make([]interface{}, len(showColumns))
-	for idx, c := range showColumns {
+	t := newDeviceTable(showColumns)
+	sortDevices(dl.Devices)
+	for _, device := range dl.Devices {
+		addDeviceLine(t, device, showColumns)
+	}
+	t.Print()
+	listOutput.ShowPages(showPage, dl.Next)
+}
+
+// showDeviceIter prints the devices as they are fetched, unless they must be sorted first.
+func showDeviceIter(it *client.DeviceIter, showColumns []string) {
+	t := newDeviceTable(showColumns)
+	if len(listOutput.SortBy) > 0 {
+		var devices []client.Device
+		for it.Next() {
+			devices = append(devices, it.Value())
+		}
+		subcommands.DieNotNil(it.Err())
+		sortDevices(devices)
+		for _, device := range devices {
+			addDeviceLine(t, device, showColumns)
+		}
+	} else {
+		for it.Next() {
+			addDeviceLine(t, it.Value(), showColumns)
+		}
+		subcommands.DieNotNil(it.Err())
+	}
+	t.Print()
+	listOutput.ShowPages(showPage, it.NextPage())
+}
+
+func newDeviceTable(showColumns []string) *subcommands.ListTable {
+	for _, c := range showColumns {
 		if _, ok := Columns[c]; !ok {
 			fmt.Println("ERROR: Invalid column name:", c)
 			os.Exit(1)
 		}
-		cols[idx] = strings.ToUpper(c)
 	}
-	t.AddHeader(cols...)
+	return listOutput.NewTable(showColumns...)
+}
+
+func sortDevices(devices []client.Device) {
+	allCols := make([]string, 0, len(Columns))
+	for c := range Columns {
+		allCols = append(allCols, c)
+	}
+	sort.Strings(allCols)
+	listOutput.Sort(devices, allCols, func(idx int, column string) string {
+		return Columns[column].Formatter(&devices[idx])
+	})
+}
 
+func addDeviceLine(t *subcommands.ListTable, device client.Device, showColumns []string) {
+	if len(device.TargetName) == 0 {
+		device.TargetName = "???"
+	}
 	row := make([]interface{}, len(showColumns))
-	for _, device := range dl.Devices {
-		if len(device.TargetName) == 0 {
-			device.TargetName = "???"
-		}
-		for idx, col := range showColumns {
-			col := Columns[col]
-			row[idx] = col.Formatter(&device)
-		}
-		t.AddLine(row...)
+	for idx, col := range showColumns {
+		col := Columns[col]
+		row[idx] = col.Formatter(&device)
 	}
-	t.Print()
-	subcommands.ShowPages(showPage, dl.Next)
+	t.AddLine(row...)
 }
 
 func doList(cmd *cobra.Command, args []string) {
@@ -192,17 +237,14 @@ func doList(cmd *cobra.Command, args []string) {
 	if len(args) == 1 {
 		name_ilike = sqlLikeIfy(args[0])
 	}
-	dl, err := api.DeviceList(
-		deviceMine,
-		deviceByTag,
-		factory,
-		deviceByGroup,
-		name_ilike,
-		deviceUuid,
-		deviceByTarget,
-		showPage,
-		paginationLimit,
-	)
-	subcommands.DieNotNil(err)
-	showDeviceList(dl, showColumns)
+	var it *client.DeviceIter
+	if deviceListAll {
+		it = api.DeviceIter(
+			deviceMine, deviceByTag, factory, deviceByGroup, name_ilike, deviceUuid, deviceByTarget, paginationLimit)
+	} else {
+		it = api.DevicePageIter(
+			deviceMine, deviceByTag, factory, deviceByGroup, name_ilike, deviceUuid, deviceByTarget,
+			showPage, paginationLimit)
+	}
+	showDeviceIter(it, showColumns)
 }
@@ -19,7 +19,7 @@ they are deleted, so that they can't continue to access the system by getting
 re-created.`,
 	}
 	cmd.AddCommand(listCmd)
-	addPaginationFlags(listCmd)
+	addPaginationFlags(listCmd, "name")
 }
 
 func doListDenied(cmd *cobra.Command, args []string) {
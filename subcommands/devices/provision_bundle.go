@@ -0,0 +1,167 @@
+package devices
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// The script run on a device to register it with the bundle content
+const provisionScript = `#!/bin/sh -e
+# Registers this device with the factory using the provisioning bundle in this directory.
+cd "$(dirname "$0")"
+DEVICE_API_TOKEN="$(cat token)" lmp-device-register%s
+install -D -m 0644 config.toml /etc/sota/conf.d/z-40-provision.toml
+`
+
+var (
+	bundleGroup      string
+	bundleCount      int
+	bundleShared     bool
+	bundleNamePrefix string
+	bundleOut        string
+	bundleTokenFile  string
+)
+
+// provisionBundle describes a bundle in its manifest.json file.
+type provisionBundle struct {
+	Factory   string `json:"factory"`
+	Group     string `json:"group,omitempty"`
+	Name      string `json:"name,omitempty"`
+	CreatedAt string `json:"created-at"`
+}
+
+func init() {
+	bundleCmd := &cobra.Command{
+		Use:   "provision-bundle --token-file <file> --out <dir> (--count <n> | --shared)",
+		Short: "Generate bundles to register devices with lmp-device-register",
+		Long: `Generate provisioning bundles, which register devices on the factory floor with
+lmp-device-register without an interactive login.
+
+Each bundle is a directory with:
+  token          an API token allowed to register devices (devices:create scope)
+  root.crt       the factory root CA certificate
+  config.toml    the initial aktualizr-lite config of devices in the group
+  register.sh    a script running lmp-device-register with the bundle content
+  manifest.json  what the bundle was generated for
+
+With --count, a bundle is generated for each device, so that every device gets a
+unique name. With --shared, a single bundle is generated for all devices, which then
+use their default names. All bundles of a run share the API token read from --token-file.
+Create it at https://app.foundries.io/settings/tokens/ with the devices:create scope,
+and a short expiration, as every bundle holds it until it expires or is revoked there.
+
+The bundles contain a secret token, so they must be handled like other credentials.`,
+		Run:  doProvisionBundle,
+		Args: cobra.NoArgs,
+		Example: `
+  # Generate bundles for 100 devices of the "line-1" group:
+  fioctl devices provision-bundle --token-file line-1.token --group line-1 --count 100 --out bundles/
+
+  # Generate a single bundle shared by devices of the group:
+  fioctl devices provision-bundle --token-file line-1.token --group line-1 --shared --out bundles/`,
+	}
+	cmd.AddCommand(bundleCmd)
+	bundleCmd.Flags().StringVarP(&bundleGroup, "group", "g", "", "The device group to register devices into")
+	bundleCmd.Flags().IntVarP(&bundleCount, "count", "", 0, "Generate a bundle for each of this number of devices")
+	bundleCmd.Flags().BoolVarP(&bundleShared, "shared", "", false, "Generate a single bundle shared by all devices")
+	bundleCmd.Flags().StringVarP(&bundleNamePrefix, "name-prefix", "", "",
+		"The prefix of device names in per-device bundles (default: the group name or \"device\")")
+	bundleCmd.Flags().StringVarP(&bundleOut, "out", "", "", "The directory to write the bundles to")
+	bundleCmd.Flags().StringVarP(&bundleTokenFile, "token-file", "", "",
+		"A file with the API token allowed to register devices (devices:create scope)")
+	_ = bundleCmd.MarkFlagFilename("token-file")
+	_ = bundleCmd.MarkFlagRequired("token-file")
+	_ = bundleCmd.MarkFlagRequired("out")
+}
+
+func writeProvisionBundle(dir string, token, rootCrt, config string, bundle provisionBundle) {
+	subcommands.DieNotNil(os.MkdirAll(dir, 0700))
+	var args []string
+	if len(bundle.Name) > 0 {
+		args = append(args, fmt.Sprintf("--name %q", bundle.Name))
+	}
+	if len(bundle.Group) > 0 {
+		args = append(args, fmt.Sprintf("--device-group %q", bundle.Group))
+	}
+	if sota, err := toml.Load(config); err == nil {
+		if tags, _ := sota.GetDefault("pacman.tags", "").(string); len(tags) > 0 {
+			args = append(args, fmt.Sprintf("--tags %q", tags))
+		}
+		if apps, ok := sota.Get("pacman.compose_apps").(string); ok {
+			args = append(args, fmt.Sprintf("--apps %q", apps))
+		}
+	}
+	manifest, err := json.MarshalIndent(bundle, "", "  ")
+	subcommands.DieNotNil(err)
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"token", token, 0600},
+		{"root.crt", rootCrt, 0644},
+		{"config.toml", config, 0644},
+		{"register.sh", fmt.Sprintf(provisionScript, strings.Join(append([]string{""}, args...), " ")), 0755},
+		{"manifest.json", string(manifest) + "\n", 0644},
+	}
+	for _, f := range files {
+		subcommands.DieNotNil(os.WriteFile(filepath.Join(dir, f.name), []byte(f.content), f.mode))
+	}
+}
+
+func doProvisionBundle(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	if bundleShared == (bundleCount > 0) {
+		subcommands.DieNotNil(subcommands.ValidationError("Either --count or --shared must be given"))
+	}
+	buf, err := os.ReadFile(bundleTokenFile)
+	subcommands.DieNotNil(err, "Failed to read the API token:")
+	token := strings.TrimSpace(string(buf))
+	if len(token) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The API token file is empty: %s", bundleTokenFile))
+	}
+	if entries, err := os.ReadDir(bundleOut); err == nil && len(entries) > 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("Refusing to write bundles into a non-empty directory: %s", bundleOut))
+	}
+	prefix := bundleNamePrefix
+	if len(prefix) == 0 {
+		prefix = bundleGroup
+		if len(prefix) == 0 {
+			prefix = "device"
+		}
+	}
+
+	certs, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	if len(certs.RootCrt) == 0 {
+		subcommands.DieNotNil(fmt.Errorf("The factory PKI is not set up. Please see \"fioctl keys ca create\""))
+	}
+	config := renderSotaConfig(factory, nil, bundleGroup)
+
+	bundle := provisionBundle{
+		Factory:   factory,
+		Group:     bundleGroup,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if bundleShared {
+		writeProvisionBundle(filepath.Join(bundleOut, "shared"), token, certs.RootCrt, config, bundle)
+		fmt.Println("Generated a shared bundle in", filepath.Join(bundleOut, "shared"))
+	} else {
+		for i := 1; i <= bundleCount; i++ {
+			bundle.Name = fmt.Sprintf("%s-%0*d", prefix, len(fmt.Sprint(bundleCount)), i)
+			writeProvisionBundle(filepath.Join(bundleOut, bundle.Name), token, certs.RootCrt, config, bundle)
+		}
+		fmt.Printf("Generated %d bundles in %s\n", bundleCount, bundleOut)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/foundriesio/fioctl/client"
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
@@ -33,6 +34,11 @@ func doShow(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	logrus.Debug("Showing device")
 	device, err := api.DeviceGet(factory, args[0])
+	if herr := client.AsHttpError(err); herr != nil && herr.Response.StatusCode == 404 {
+		if similar := subcommands.IndexSuggestions(factory, subcommands.IndexDevices, args[0]); len(similar) > 0 {
+			err = fmt.Errorf("%w\nDid you mean: %s", err, strings.Join(similar, ", "))
+		}
+	}
 	subcommands.DieNotNil(err)
 
 	fmt.Printf("UUID:\t\t%s\n", device.Uuid)
@@ -49,17 +55,17 @@ func doShow(cmd *cobra.Command, args []string) {
 	fmt.Printf("Up to date:\t%v\n", device.UpToDate)
 	fmt.Printf("Target:\t\t%s / sha256(%s)\n", device.TargetName, device.OstreeHash)
 	fmt.Printf("Ostree Hash:\t%s\n", device.OstreeHash)
-	fmt.Printf("Created At:\t%s\n", device.ChangeMeta.CreatedAt)
+	fmt.Printf("Created At:\t%s\n", subcommands.FormatTime(device.ChangeMeta.CreatedAt))
 	if len(device.ChangeMeta.CreatedBy) > 0 {
 		fmt.Printf("Created By:\t%s\n", device.ChangeMeta.CreatedBy)
 	}
 	if len(device.ChangeMeta.UpdatedAt) > 0 {
-		fmt.Printf("Updated At:\t%s\n", device.ChangeMeta.UpdatedAt)
+		fmt.Printf("Updated At:\t%s\n", subcommands.FormatTime(device.ChangeMeta.UpdatedAt))
 	}
 	if len(device.ChangeMeta.UpdatedBy) > 0 {
 		fmt.Printf("Updated By:\t%s\n", device.ChangeMeta.UpdatedBy)
 	}
-	fmt.Printf("Last Seen:\t%s\n", device.LastSeen)
+	fmt.Printf("Last Seen:\t%s\n", subcommands.FormatTime(device.LastSeen))
 	if len(device.Tag) > 0 {
 		fmt.Printf("Tag:\t\t%s\n", device.Tag)
 	}
@@ -0,0 +1,266 @@
+package devices
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	exportGroup   string
+	exportSince   string
+	exportFormat  string
+	exportOutFile string
+	exportSignKey string
+)
+
+// updateRecord is a row of the update history report.
+type updateRecord struct {
+	Device        string `json:"device"`
+	Uuid          string `json:"uuid"`
+	UpdateId      string `json:"update-id"`
+	Target        string `json:"target"`
+	FromVersion   string `json:"from-version"`
+	Version       string `json:"version"`
+	Started       string `json:"started"`
+	Completed     string `json:"completed"`
+	Result        string `json:"result"`
+	FailureDetail string `json:"failure-detail,omitempty"`
+}
+
+// updateReport is the JSON form of the update history report.
+type updateReport struct {
+	Factory     string         `json:"factory"`
+	Group       string         `json:"group,omitempty"`
+	Since       string         `json:"since,omitempty"`
+	GeneratedAt string         `json:"generated-at"`
+	Updates     []updateRecord `json:"updates"`
+}
+
+func init() {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a report of updates applied to devices for audits",
+		Long: `Export a timestamped report of every update applied to devices: the versions,
+results, and timestamps of each update. The report can be signed with a private key,
+so that auditors can verify it was not modified after the export.
+
+The signature is written next to the report with a .sig extension. It is a signature of
+the report's SHA256 digest, which can be verified with:
+
+  openssl dgst -sha256 -verify public.pem -signature report.csv.sig report.csv`,
+		Run:  doExportUpdates,
+		Args: cobra.NoArgs,
+		Example: `
+  # Export updates of devices in the "medical" group since the start of 2024:
+  fioctl devices updates export --group medical --since 2024-01-01 -o csv --out-file report.csv
+
+  # Export a signed report:
+  fioctl devices updates export --since 2024-01-01 -o json --out-file report.json --sign-key audit.key`,
+	}
+	updatesCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportGroup, "group", "g", "", "Only export updates of devices in this device group")
+	exportCmd.Flags().StringVarP(&exportSince, "since", "", "",
+		"Only export updates started since this date, e.g. 2024-01-01 or 2024-01-01T12:00:00Z")
+	exportCmd.Flags().StringVarP(&exportFormat, "output", "o", subcommands.OutputFormatCsv, "Report format: csv or json")
+	exportCmd.Flags().StringVarP(&exportOutFile, "out-file", "", "", "Write the report to this file rather than STDOUT")
+	exportCmd.Flags().StringVarP(&exportSignKey, "sign-key", "", "",
+		"Sign the report with this PEM encoded private key. Requires --out-file")
+}
+
+func parseSince(since string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", since); err == nil {
+		return t, nil
+	}
+	if t, ok := subcommands.ParseTime(since); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid --since date: %s", since)
+}
+
+// summarizeUpdate finds when an update started and completed, and its result, from the update events.
+func summarizeUpdate(rec *updateRecord, events []client.UpdateEvent) {
+	rec.Result = "in-progress"
+	for idx, event := range events {
+		if idx == 0 {
+			rec.Started = event.Time
+		}
+		if event.Detail.Success == nil {
+			continue
+		}
+		if !*event.Detail.Success {
+			rec.Result = "failed"
+			rec.Completed = event.Time
+			rec.FailureDetail = event.Detail.Details
+		} else if event.Type.Id == "EcuInstallationCompleted" && rec.Result != "failed" {
+			rec.Result = "succeeded"
+			rec.Completed = event.Time
+		}
+	}
+}
+
+func exportDeviceUpdates(factory string, device client.Device, since time.Time) []updateRecord {
+	var records []updateRecord
+	ul, err := api.DeviceListUpdates(factory, device.Name)
+	for {
+		subcommands.DieNotNil(err)
+		for _, update := range ul.Updates {
+			if len(records) > 0 && len(records[len(records)-1].FromVersion) == 0 {
+				// Updates are listed from the newest, so this is the version the previous one updated from
+				records[len(records)-1].FromVersion = update.Version
+			}
+			if t, ok := subcommands.ParseTime(update.Time); ok && t.Before(since) {
+				return records
+			}
+			rec := updateRecord{
+				Device:   device.Name,
+				Uuid:     device.Uuid,
+				UpdateId: update.CorrelationId,
+				Target:   update.Target,
+				Version:  update.Version,
+			}
+			events, err := api.DeviceUpdateEvents(factory, device.Name, update.CorrelationId)
+			subcommands.DieNotNil(err)
+			summarizeUpdate(&rec, events)
+			if len(rec.Started) == 0 {
+				rec.Started = update.Time
+			}
+			records = append(records, rec)
+		}
+		if ul.Next == nil {
+			return records
+		}
+		ul, err = api.DeviceListUpdatesCont(*ul.Next)
+	}
+}
+
+func signReport(keyFile string, report []byte) ([]byte, error) {
+	buf, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, rest := pem.Decode(buf)
+	if block != nil && block.Type == "EC PARAMETERS" {
+		block, _ = pem.Decode(rest)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("No PEM encoded private key found in %s", keyFile)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", keyFile, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported private key in %s", keyFile)
+	}
+	if _, ok := signer.(ed25519.PrivateKey); ok {
+		return signer.Sign(rand.Reader, report, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(report)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func doExportUpdates(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	if exportFormat != subcommands.OutputFormatCsv && exportFormat != subcommands.OutputFormatJson {
+		subcommands.DieNotNil(subcommands.ValidationError("Unsupported report format: %s", exportFormat))
+	}
+	if len(exportSignKey) > 0 && len(exportOutFile) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The --out-file flag is required to sign the report"))
+	}
+	var since time.Time
+	if len(exportSince) > 0 {
+		var err error
+		since, err = parseSince(exportSince)
+		if err != nil {
+			subcommands.DieNotNil(subcommands.ValidationError("%s", err))
+		}
+	}
+
+	report := updateReport{
+		Factory:     factory,
+		Group:       exportGroup,
+		Since:       exportSince,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Updates:     []updateRecord{},
+	}
+	it := api.DeviceIter(false, "", factory, exportGroup, "", "", "", 1000)
+	for it.Next() {
+		device := it.Value()
+		logrus.Debugf("Exporting updates of %s", device.Name)
+		report.Updates = append(report.Updates, exportDeviceUpdates(factory, device, since)...)
+	}
+	subcommands.DieNotNil(it.Err())
+
+	var out bytes.Buffer
+	if exportFormat == subcommands.OutputFormatJson {
+		buf, err := json.MarshalIndent(report, "", "  ")
+		subcommands.DieNotNil(err)
+		out.Write(buf)
+		out.WriteString("\n")
+	} else {
+		// The report metadata is written as comment lines, which CSV readers can be told to skip
+		fmt.Fprintf(&out, "# factory: %s\n# generated-at: %s\n", report.Factory, report.GeneratedAt)
+		if len(report.Group) > 0 {
+			fmt.Fprintf(&out, "# group: %s\n", report.Group)
+		}
+		if len(report.Since) > 0 {
+			fmt.Fprintf(&out, "# since: %s\n", report.Since)
+		}
+		w := csv.NewWriter(&out)
+		subcommands.DieNotNil(w.Write([]string{
+			"device", "uuid", "update-id", "target", "from-version", "version",
+			"started", "completed", "result", "failure-detail",
+		}))
+		for _, r := range report.Updates {
+			subcommands.DieNotNil(w.Write([]string{
+				r.Device, r.Uuid, r.UpdateId, r.Target, r.FromVersion, r.Version,
+				r.Started, r.Completed, r.Result, r.FailureDetail,
+			}))
+		}
+		w.Flush()
+		subcommands.DieNotNil(w.Error())
+	}
+
+	if len(exportOutFile) == 0 {
+		fmt.Print(out.String())
+		return
+	}
+	if _, err := os.Stat(exportOutFile); err == nil {
+		subcommands.DieNotNil(errors.New("Refusing to overwrite an existing file: " + exportOutFile))
+	}
+	subcommands.DieNotNil(os.WriteFile(exportOutFile, out.Bytes(), 0644))
+	fmt.Printf("Exported %d updates to %s\n", len(report.Updates), exportOutFile)
+	if len(exportSignKey) > 0 {
+		sig, err := signReport(exportSignKey, out.Bytes())
+		subcommands.DieNotNil(err, "Failed to sign the report:")
+		subcommands.DieNotNil(os.WriteFile(exportOutFile+".sig", sig, 0644))
+		fmt.Println("Signature written to", exportOutFile+".sig")
+	}
+}
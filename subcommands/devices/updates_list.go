@@ -1,7 +1,6 @@
 package devices
 
 import (
-	"github.com/cheynewallace/tabby"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -25,8 +24,7 @@ func init() {
 func doListUpdates(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	logrus.Debug("Showing device updates")
-	t := tabby.New()
-	t.AddHeader("ID", "TIME", "VERSION", "TARGET")
+	t := updatesOutput.NewTable("ID", "TIME", "VERSION", "TARGET")
 	var ul *client.UpdateList
 	for {
 		var err error
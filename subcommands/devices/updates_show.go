@@ -27,7 +27,7 @@ func doShowUpdate(cmd *cobra.Command, args []string) {
 	events, err := api.DeviceUpdateEvents(factory, args[0], args[1])
 	subcommands.DieNotNil(err)
 	for _, event := range events {
-		fmt.Printf("%s : %s(%s)", event.Time, event.Type.Id, event.Detail.TargetName)
+		fmt.Printf("%s : %s(%s)", subcommands.FormatTime(event.Time), event.Type.Id, event.Detail.TargetName)
 		if event.Detail.Success != nil {
 			if *event.Detail.Success {
 				fmt.Println(" -> Succeed")
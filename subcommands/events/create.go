@@ -1,6 +1,7 @@
 package events
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/foundriesio/fioctl/client"
@@ -11,14 +12,16 @@ import (
 )
 
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	pushCmd := &cobra.Command{
 		Use:   "mk-push <label> <url>",
 		Short: "Create an event queue that will ingest events at the URL",
 		Args:  cobra.ExactArgs(2),
 		Run:   doCreatePush,
-	})
+	}
+	cmd.AddCommand(pushCmd)
+	subcommands.AddIfNotExistsFlag(pushCmd)
 
-	cmd.AddCommand(&cobra.Command{
+	pullCmd := &cobra.Command{
 		Use:   "mk-pull <label> <pubsub creds file>",
 		Short: "Create a message queue that can be polled for events",
 		Args:  cobra.ExactArgs(2),
@@ -28,8 +31,31 @@ func init() {
   https://cloud.google.com/pubsub/docs/reference/libraries 
 
 The command creates a credentials file to a scoped service account capable of 
-polling the resulting PubSub subscription.`,
-	})
+polling the resulting PubSub subscription.
+
+With --if-not-exists, the credentials file is only written when the queue is created.`,
+	}
+	cmd.AddCommand(pullCmd)
+	subcommands.AddIfNotExistsFlag(pullCmd)
+}
+
+// queueExists checks if a queue with the label exists. A queue of another type,
+// or pushing to another URL, fails the check as it can not be reused.
+func queueExists(factory string, queue client.EventQueue) bool {
+	queues, err := api.EventQueuesList(factory)
+	subcommands.DieNotNil(err)
+	for _, q := range queues {
+		if q.Label != queue.Label {
+			continue
+		}
+		if q.Type != queue.Type || q.PushUrl != queue.PushUrl {
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict,
+				fmt.Errorf("Event queue %s already exists with a different configuration: type=%s url=%s",
+					q.Label, q.Type, q.PushUrl)))
+		}
+		return true
+	}
+	return false
 }
 
 func doCreatePush(cmd *cobra.Command, args []string) {
@@ -41,6 +67,9 @@ func doCreatePush(cmd *cobra.Command, args []string) {
 		Type:    "push",
 		PushUrl: args[1],
 	}
+	if subcommands.IfNotExists(cmd) && subcommands.SkipExisting(cmd, queueExists(factory, queue), "Event queue "+queue.Label) {
+		return
+	}
 
 	_, err := api.EventQueuesCreate(factory, queue)
 	subcommands.DieNotNil(err)
@@ -54,6 +83,9 @@ func doCreatePull(cmd *cobra.Command, args []string) {
 		Label: args[0],
 		Type:  "pull",
 	}
+	if subcommands.IfNotExists(cmd) && subcommands.SkipExisting(cmd, queueExists(factory, queue), "Event queue "+queue.Label) {
+		return
+	}
 
 	creds, err := api.EventQueuesCreate(factory, queue)
 	subcommands.DieNotNil(err)
@@ -1,20 +1,23 @@
 package events
 
 import (
-	"github.com/cheynewallace/tabby"
 	"github.com/foundriesio/fioctl/subcommands"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var listOutput subcommands.ListOutput
+
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	listCmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List configured event queues",
 		Run:     doList,
-	})
+	}
+	listOutput.AddFlags(listCmd, "type")
+	cmd.AddCommand(listCmd)
 }
 
 func doList(cmd *cobra.Command, args []string) {
@@ -24,8 +27,7 @@ func doList(cmd *cobra.Command, args []string) {
 	queues, err := api.EventQueuesList(factory)
 	subcommands.DieNotNil(err)
 
-	t := tabby.New()
-	t.AddHeader("LABEL", "TYPE", "PUSH URL")
+	t := listOutput.NewTable("LABEL", "TYPE", "PUSH URL")
 	for _, queue := range queues {
 		t.AddLine(queue.Label, queue.Type, queue.PushUrl)
 	}
@@ -8,18 +8,38 @@ import (
 )
 
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	rmCmd := &cobra.Command{
 		Use:   "rm <label>",
 		Short: "Remove an event queue",
 		Args:  cobra.ExactArgs(1),
 		Run:   doRemove,
-	})
+	}
+	cmd.AddCommand(rmCmd)
+	subcommands.AddConfirmFlag(rmCmd)
+	subcommands.AddIfExistsFlags(rmCmd)
 }
 
 func doRemove(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	logrus.Debugf("Removing event queue for: %s", factory)
+	if subcommands.IfExists(cmd) {
+		queues, err := api.EventQueuesList(factory)
+		subcommands.DieNotNil(err)
+		exists := false
+		for _, q := range queues {
+			exists = exists || q.Label == args[0]
+		}
+		if subcommands.SkipMissing(cmd, exists, "Event queue "+args[0]) {
+			return
+		}
+	}
+
+	preview := subcommands.NewPreview("Event queues to remove:")
+	preview.Remove(args[0])
+	if !preview.Confirm(cmd) {
+		return
+	}
 
 	err := api.EventQueuesDelete(factory, args[0])
-	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(subcommands.IgnoreMissing(cmd, err))
 }
@@ -0,0 +1,383 @@
+package factory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const applyLong = `Apply a declarative bundle produced by "fioctl factory export" to the factory.
+
+The bundle can be a single file, or a directory of YAML files each containing a
+part of the bundle, e.g. device-groups.yaml, config.yaml, webhooks.yaml.
+Such a directory can be kept in git, so that all factory changes are reviewed
+in pull requests, and applied by CI.
+
+The following changes are applied:
+- missing device groups are created, and descriptions of existing ones are updated.
+- changed unencrypted configuration files are updated in the factory and device group configuration.
+- missing event queues (webhooks) are created.
+- tags of the targets listed in the bundle are set.
+
+Encrypted configuration files, CI secrets, team scopes, pull event queues, and
+changed event queues are only compared; differences are reported, but must be
+changed using the dedicated commands. Once the other changes are applied, the
+command fails if such manual changes remain, as the factory is not in the
+desired state yet.
+Nothing is deleted unless the --prune flag is set. Then device groups, configuration
+files, and event queues missing in the bundle are deleted. Deletions must be
+confirmed, or approved ahead of time with the --yes flag, e.g. in CI.
+
+Waves are not part of the bundle: each wave is signed with the offline TUF
+targets keys when it is created, so it can not be declared ahead of time.
+
+The change plan is always printed before any change is made.`
+
+func init() {
+	applyCmd := &cobra.Command{
+		Use:   "apply <factory.yaml|directory>",
+		Short: "Apply a declarative bundle to the factory",
+		Long:  applyLong,
+		Example: `
+  # Review changes which would be made to the factory:
+  fioctl factory apply factory.yaml --dry-run
+
+  # Clone the state of one factory into another factory:
+  fioctl factory export -f staging --out staging.yaml
+  fioctl factory apply -f production staging.yaml`,
+		Run:  doApply,
+		Args: cobra.ExactArgs(1),
+	}
+	addApplyFlags(applyCmd)
+	cmd.AddCommand(applyCmd)
+}
+
+// NewApplyCommand returns a top level shortcut for "fioctl factory apply".
+func NewApplyCommand() *cobra.Command {
+	applyCmd := &cobra.Command{
+		Use:   "apply <factory.yaml|directory>",
+		Short: "Converge the factory to the state declared in a file or directory",
+		Long:  applyLong,
+		Example: `
+  # Converge the factory to the state kept in a git repository:
+  fioctl apply ./factory/ --prune`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			api = subcommands.Login(cmd)
+		},
+		Run:  doApply,
+		Args: cobra.ExactArgs(1),
+	}
+	addApplyFlags(applyCmd)
+	subcommands.RequireFactory(applyCmd)
+	return applyCmd
+}
+
+func addApplyFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("dry-run", "", false, "Only show what changes would be made")
+	cmd.Flags().BoolP("prune", "", false, "Delete device groups, config files, and event queues missing in the bundle")
+	subcommands.AddConfirmFlag(cmd)
+}
+
+// A change is a single step required to bring a factory to the desired state.
+// If apply is nil - the change cannot be made automatically and is only reported.
+type change struct {
+	action string
+	kind   string
+	name   string
+	apply  func() error
+}
+
+func (c change) String() string {
+	return fmt.Sprintf("%s %s %s", c.action, c.kind, c.name)
+}
+
+func doApply(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	prune, _ := cmd.Flags().GetBool("prune")
+
+	desired, err := loadBundle(args[0])
+	subcommands.DieNotNil(err)
+	logrus.Debugf("Comparing bundle %s to the factory %s", args[0], factory)
+	current, err := fetchBundle(factory)
+	subcommands.DieNotNil(err)
+	if len(desired.TargetTags) > 0 {
+		names := make([]string, 0, len(desired.TargetTags))
+		for name := range desired.TargetTags {
+			names = append(names, name)
+		}
+		current.TargetTags, err = fetchTargetTags(factory, names)
+		subcommands.DieNotNil(err)
+	}
+
+	changes := planChanges(factory, current, desired, prune)
+	if len(changes) == 0 {
+		fmt.Println("No changes found. Factory is already in the desired state.")
+		return
+	}
+
+	printChanges(changes)
+	if dryRun {
+		return
+	}
+
+	preview := subcommands.NewPreview("The following will be deleted:")
+	for _, c := range changes {
+		if c.action == "delete" && c.apply != nil {
+			preview.Remove("%s %s", c.kind, c.name)
+		}
+	}
+	if !preview.IsEmpty() && !preview.Confirm(cmd) {
+		return
+	}
+
+	var manual []string
+	for _, c := range changes {
+		if c.apply == nil {
+			manual = append(manual, c.String())
+			continue
+		}
+		fmt.Println("=", c)
+		subcommands.DieNotNil(c.apply(), "Failed to "+c.String()+":")
+	}
+	if len(manual) > 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict, fmt.Errorf(
+			"The factory is not in the desired state, %d changes must be made manually:\n  %s",
+			len(manual), strings.Join(manual, "\n  "))))
+	}
+}
+
+func printChanges(changes []change) {
+	fmt.Println("The following changes are required:")
+	for _, c := range changes {
+		line := fmt.Sprintf(" %s", c)
+		switch {
+		case c.apply == nil:
+			color.Yellow(line + " (manual action required)")
+		case c.action == "delete":
+			color.Red(line)
+		case c.action == "create":
+			color.Green(line)
+		default:
+			fmt.Println(line)
+		}
+	}
+	fmt.Println()
+}
+
+func planChanges(factory string, current, desired *Bundle, prune bool) []change {
+	var changes []change
+	changes = append(changes, planDeviceGroups(factory, current, desired, prune)...)
+	changes = append(changes, planConfig(factory, current, desired, prune)...)
+	changes = append(changes, planEventQueues(factory, current, desired, prune)...)
+	changes = append(changes, planTargetTags(factory, current, desired)...)
+
+	for _, s := range desired.Secrets {
+		if !slices.Contains(current.Secrets, s) {
+			changes = append(changes, change{action: "create", kind: "secret", name: s})
+		}
+	}
+	for _, t := range desired.Teams {
+		idx := slices.IndexFunc(current.Teams, func(c BundleTeam) bool { return c.Name == t.Name })
+		if idx < 0 {
+			changes = append(changes, change{action: "create", kind: "team", name: t.Name})
+		} else if cur := current.Teams[idx]; !subcommands.IsSliceSetEqual(cur.Scopes, t.Scopes) ||
+			!subcommands.IsSliceSetEqual(cur.Groups, t.Groups) {
+			changes = append(changes, change{action: "update", kind: "team", name: t.Name})
+		}
+	}
+	return changes
+}
+
+func planDeviceGroups(factory string, current, desired *Bundle, prune bool) []change {
+	var changes []change
+	for _, g := range desired.DeviceGroups {
+		g := g
+		idx := slices.IndexFunc(current.DeviceGroups, func(c BundleDeviceGroup) bool { return c.Name == g.Name })
+		if idx < 0 {
+			changes = append(changes, change{"create", "device-group", g.Name, func() error {
+				var description *string
+				if len(g.Description) > 0 {
+					description = &g.Description
+				}
+				_, err := api.FactoryCreateDeviceGroup(factory, g.Name, description)
+				return err
+			}})
+		} else if current.DeviceGroups[idx].Description != g.Description {
+			changes = append(changes, change{"update", "device-group", g.Name, func() error {
+				return api.FactoryPatchDeviceGroup(factory, g.Name, nil, &g.Description)
+			}})
+		}
+	}
+	if prune {
+		for _, g := range current.DeviceGroups {
+			g := g
+			if slices.IndexFunc(desired.DeviceGroups, func(d BundleDeviceGroup) bool { return d.Name == g.Name }) < 0 {
+				changes = append(changes, change{"delete", "device-group", g.Name, func() error {
+					return api.FactoryDeleteDeviceGroup(factory, g.Name)
+				}})
+			}
+		}
+	}
+	return changes
+}
+
+func planConfig(factory string, current, desired *Bundle, prune bool) []change {
+	changes := planConfigFiles("config file", current.Config, desired.Config, prune,
+		func(files []client.ConfigFile) error {
+			cfg := client.ConfigCreateRequest{Reason: "Apply factory bundle", Files: files}
+			return api.FactoryPatchConfig(factory, cfg, false)
+		},
+		func(name string) error { return api.FactoryDeleteConfig(factory, name) },
+	)
+	for _, gc := range desired.GroupConfig {
+		gc := gc
+		var cur []BundleConfigFile
+		if idx := slices.IndexFunc(current.GroupConfig, func(c BundleGroupConfig) bool { return c.Group == gc.Group }); idx >= 0 {
+			cur = current.GroupConfig[idx].Files
+		}
+		kind := "device group " + gc.Group + " config file"
+		changes = append(changes, planConfigFiles(kind, cur, gc.Files, prune,
+			func(files []client.ConfigFile) error {
+				cfg := client.ConfigCreateRequest{Reason: "Apply factory bundle", Files: files}
+				return api.GroupPatchConfig(factory, gc.Group, cfg, false)
+			},
+			func(name string) error { return api.GroupDeleteConfig(factory, gc.Group, name) },
+		)...)
+	}
+	if prune {
+		for _, gc := range current.GroupConfig {
+			gc := gc
+			if slices.IndexFunc(desired.GroupConfig, func(d BundleGroupConfig) bool { return d.Group == gc.Group }) >= 0 ||
+				slices.IndexFunc(desired.DeviceGroups, func(d BundleDeviceGroup) bool { return d.Name == gc.Group }) < 0 {
+				// The config of a device group missing in the bundle is deleted along with the group
+				continue
+			}
+			kind := "device group " + gc.Group + " config file"
+			changes = append(changes, planConfigFiles(kind, gc.Files, nil, prune, nil,
+				func(name string) error { return api.GroupDeleteConfig(factory, gc.Group, name) },
+			)...)
+		}
+	}
+	return changes
+}
+
+func planConfigFiles(
+	kind string, current, desired []BundleConfigFile, prune bool,
+	patch func(files []client.ConfigFile) error, remove func(name string) error,
+) []change {
+	var changes []change
+	var files []client.ConfigFile
+	last := -1
+	for _, f := range desired {
+		idx := slices.IndexFunc(current, func(c BundleConfigFile) bool { return c.Name == f.Name })
+		action := "create"
+		if idx >= 0 {
+			cur := current[idx]
+			if cur.Unencrypted == f.Unencrypted && cur.Value == f.Value &&
+				slices.Equal(cur.OnChanged, f.OnChanged) {
+				continue
+			}
+			action = "update"
+		}
+		if !f.Unencrypted {
+			if idx < 0 {
+				changes = append(changes, change{action: action, kind: "encrypted " + kind, name: f.Name})
+			}
+			continue
+		}
+		changes = append(changes, change{action: action, kind: kind, name: f.Name})
+		last = len(changes) - 1
+		files = append(files, f.AsConfigFile())
+	}
+	if last >= 0 {
+		// All config file changes are made in a single transaction by the last change
+		changes[last].apply = func() error { return patch(files) }
+	}
+	if prune {
+		for _, f := range current {
+			name := f.Name
+			if slices.IndexFunc(desired, func(d BundleConfigFile) bool { return d.Name == name }) < 0 {
+				changes = append(changes, change{"delete", kind, name, func() error { return remove(name) }})
+			}
+		}
+	}
+	return changes
+}
+
+func planTargetTags(factory string, current, desired *Bundle) []change {
+	var changes []change
+	names := make([]string, 0, len(desired.TargetTags))
+	for name := range desired.TargetTags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	updates := make(client.UpdateTargets)
+	last := -1
+	for _, name := range names {
+		tags := desired.TargetTags[name]
+		cur, ok := current.TargetTags[name]
+		if !ok {
+			// A target can only be created by CI
+			changes = append(changes, change{action: "tag missing", kind: "target", name: name})
+			continue
+		}
+		if subcommands.IsSliceSetEqual(cur, tags) {
+			continue
+		}
+		changes = append(changes, change{action: "update", kind: "tags of target", name: name})
+		last = len(changes) - 1
+		updates[name] = client.UpdateTarget{Custom: client.TufCustom{Tags: tags}}
+	}
+	if last >= 0 {
+		// All targets are re-tagged in a single transaction by the last change
+		changes[last].apply = func() error {
+			_, _, err := api.TargetUpdateTags(factory, updates)
+			return err
+		}
+	}
+	return changes
+}
+
+func planEventQueues(factory string, current, desired *Bundle, prune bool) []change {
+	var changes []change
+	for _, q := range desired.EventQueues {
+		q := q
+		idx := slices.IndexFunc(current.EventQueues, func(c BundleEventQueue) bool { return c.Label == q.Label })
+		if idx >= 0 {
+			if current.EventQueues[idx] != q {
+				changes = append(changes, change{action: "update", kind: "event-queue", name: q.Label})
+			}
+		} else if q.Type == "push" {
+			changes = append(changes, change{"create", "event-queue", q.Label, func() error {
+				queue := client.EventQueue{Label: q.Label, Type: q.Type, PushUrl: q.PushUrl}
+				_, err := api.EventQueuesCreate(factory, queue)
+				return err
+			}})
+		} else {
+			// Pull queues produce credentials, which must be saved by the user
+			changes = append(changes, change{action: "create", kind: "event-queue", name: q.Label})
+		}
+	}
+	if prune {
+		for _, q := range current.EventQueues {
+			q := q
+			if slices.IndexFunc(desired.EventQueues, func(d BundleEventQueue) bool { return d.Label == q.Label }) < 0 {
+				changes = append(changes, change{"delete", "event-queue", q.Label, func() error {
+					return api.EventQueuesDelete(factory, q.Label)
+				}})
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,197 @@
+package factory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+	"github.com/foundriesio/fioctl/subcommands/version"
+)
+
+type backupManifest struct {
+	Factory       string         `json:"factory"`
+	CreatedAt     string         `json:"created-at"`
+	FioctlVersion string         `json:"fioctl-version"`
+	Files         map[string]int `json:"files"`
+}
+
+type backupWriter struct {
+	dir      string
+	manifest backupManifest
+}
+
+func init() {
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Save a full snapshot of the factory into a directory",
+		Long: `Save a full snapshot of the factory into a directory for disaster recovery and
+compliance purposes. The snapshot contains:
+
+  factory.yaml          The declarative factory state, restorable with "fioctl factory apply"
+  tuf/ci/*.root.json    All versions of the CI TUF root metadata
+  tuf/prod/*.root.json  All versions of the production TUF root metadata
+  tuf/targets.json      The CI targets metadata
+  tuf/prod-targets.json The production targets metadata of all tags
+  config/factory.json   The history of factory configuration changes
+  config/groups/*.json  The history of device group configuration changes
+  devices.json          The device inventory
+  waves.json            The wave history
+  triggers.json         The CI trigger settings (secret values are not included)
+  event-queues.json     The event queue (web hook) settings
+  manifest.json         A summary of the snapshot
+
+Values of encrypted configuration files and secrets are never saved.`,
+		Example: `
+  fioctl factory backup --out backup/`,
+		Run:  doBackup,
+		Args: cobra.NoArgs,
+	}
+	backupCmd.Flags().StringP("out", "o", "", "Directory to save the snapshot to")
+	_ = backupCmd.MarkFlagRequired("out")
+	_ = backupCmd.MarkFlagDirname("out")
+	cmd.AddCommand(backupCmd)
+}
+
+func (w *backupWriter) write(name string, data []byte, count int) {
+	path := filepath.Join(w.dir, name)
+	subcommands.DieNotNil(os.MkdirAll(filepath.Dir(path), 0o700))
+	subcommands.DieNotNil(os.WriteFile(path, data, 0o600))
+	w.manifest.Files[filepath.ToSlash(name)] = count
+	logrus.Debugf("Saved %s", path)
+}
+
+func (w *backupWriter) writeJson(name string, v interface{}, count int) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	subcommands.DieNotNil(err)
+	w.write(name, append(data, '\n'), count)
+}
+
+func doBackup(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	dir, _ := cmd.Flags().GetString("out")
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		subcommands.DieNotNil(fmt.Errorf("Directory %s is not empty", dir))
+	}
+	w := backupWriter{
+		dir: dir,
+		manifest: backupManifest{
+			Factory:       factory,
+			CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+			FioctlVersion: version.Commit,
+			Files:         make(map[string]int),
+		},
+	}
+
+	fmt.Println("= Saving factory state")
+	bundle, err := fetchBundle(factory)
+	subcommands.DieNotNil(err)
+	buf, err := bundle.Marshal()
+	subcommands.DieNotNil(err)
+	w.write("factory.yaml", buf, 1)
+
+	fmt.Println("= Saving TUF metadata")
+	backupRoots(&w, factory, false)
+	backupRoots(&w, factory, true)
+	targets, err := api.TargetsListRaw(factory)
+	subcommands.DieNotNil(err)
+	w.write("tuf/targets.json", *targets, 1)
+	prodTargets, err := api.ProdTargetsList(factory, false)
+	subcommands.DieNotNil(err)
+	w.writeJson("tuf/prod-targets.json", prodTargets, len(prodTargets))
+
+	fmt.Println("= Saving configuration history")
+	dcl, err := api.FactoryListConfig(factory)
+	backupConfigs(&w, "config/factory.json", dcl, err)
+	groups, err := api.FactoryListDeviceGroup(factory)
+	subcommands.DieNotNil(err)
+	for _, g := range *groups {
+		dcl, err := api.GroupListConfig(factory, g.Name)
+		backupConfigs(&w, "config/groups/"+g.Name+".json", dcl, err)
+	}
+
+	fmt.Println("= Saving device inventory")
+	var devices []client.Device
+	it := api.DeviceIter(false, "", factory, "", "", "", "", 1000)
+	for it.Next() {
+		devices = append(devices, it.Value())
+	}
+	subcommands.DieNotNil(it.Err())
+	w.writeJson("devices.json", devices, len(devices))
+
+	fmt.Println("= Saving wave history")
+	var waves []client.Wave
+	for page := 1; ; page++ {
+		wl, err := api.FactoryListWaves(factory, 100, page)
+		subcommands.DieNotNil(err)
+		waves = append(waves, wl.Waves...)
+		if wl.Next == nil || len(wl.Waves) == 0 {
+			break
+		}
+	}
+	w.writeJson("waves.json", waves, len(waves))
+
+	fmt.Println("= Saving triggers and event queues")
+	triggers, err := api.FactoryTriggers(factory)
+	subcommands.DieNotNil(err)
+	for _, t := range triggers {
+		for i := range t.Secrets {
+			t.Secrets[i].Value = nil
+		}
+	}
+	w.writeJson("triggers.json", triggers, len(triggers))
+	queues, err := api.EventQueuesList(factory)
+	subcommands.DieNotNil(err)
+	w.writeJson("event-queues.json", queues, len(queues))
+
+	w.writeJson("manifest.json", w.manifest, 1)
+	fmt.Println("Factory snapshot saved to", dir)
+}
+
+func backupRoots(w *backupWriter, factory string, prod bool) {
+	dir := "tuf/ci/"
+	if prod {
+		dir = "tuf/prod/"
+	}
+	root, err := api.TufRootGet(factory)
+	if prod {
+		root, err = api.TufProdRootGet(factory)
+		if herr := client.AsHttpError(err); herr != nil && herr.Response.StatusCode == 404 {
+			logrus.Debug("The factory has no production root")
+			return
+		}
+	}
+	subcommands.DieNotNil(err)
+	for ver := 1; ver <= root.Signed.Version; ver++ {
+		data, err := api.TufRootGetRaw(factory, prod, ver)
+		subcommands.DieNotNil(err)
+		w.write(fmt.Sprintf("%s%d.root.json", dir, ver), *data, 1)
+	}
+}
+
+func backupConfigs(w *backupWriter, name string, dcl *client.DeviceConfigList, err error) {
+	var configs []client.DeviceConfig
+	for {
+		subcommands.DieNotNil(err)
+		configs = append(configs, dcl.Configs...)
+		if dcl.Next == nil {
+			break
+		}
+		dcl, err = api.FactoryListConfigCont(*dcl.Next)
+	}
+	for i := range configs {
+		for j := range configs[i].Files {
+			if !configs[i].Files[j].Unencrypted {
+				configs[i].Files[j].Value = ""
+			}
+		}
+	}
+	w.writeJson(name, configs, len(configs))
+}
@@ -0,0 +1,312 @@
+package factory
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/foundriesio/fioctl/client"
+)
+
+const bundleVersion = 1
+
+type BundleDeviceGroup struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+}
+
+type BundleConfigFile struct {
+	Name        string   `yaml:"name"`
+	Value       string   `yaml:"value,omitempty"`
+	Unencrypted bool     `yaml:"unencrypted"`
+	OnChanged   []string `yaml:"on-changed,omitempty"`
+}
+
+type BundleGroupConfig struct {
+	Group string             `yaml:"group"`
+	Files []BundleConfigFile `yaml:"files"`
+}
+
+type BundleEventQueue struct {
+	Label   string `yaml:"label"`
+	Type    string `yaml:"type"`
+	PushUrl string `yaml:"push-url,omitempty"`
+}
+
+type BundleTeam struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Scopes      []string `yaml:"scopes,omitempty"`
+	Groups      []string `yaml:"groups,omitempty"`
+}
+
+// Bundle is a declarative representation of a factory state.
+// Secret values are never exported; only their names are kept to detect drift.
+type Bundle struct {
+	Version      int                 `yaml:"version"`
+	Factory      string              `yaml:"factory"`
+	DeviceGroups []BundleDeviceGroup `yaml:"device-groups"`
+	Config       []BundleConfigFile  `yaml:"config"`
+	Secrets      []string            `yaml:"secrets"`
+	EventQueues  []BundleEventQueue  `yaml:"event-queues"`
+	Teams        []BundleTeam        `yaml:"teams"`
+	GroupConfig  []BundleGroupConfig `yaml:"group-config,omitempty"`
+	// Tags are only managed for the targets listed in a bundle, and are never exported
+	TargetTags map[string][]string `yaml:"target-tags,omitempty"`
+}
+
+func fetchBundle(factory string) (*Bundle, error) {
+	b := Bundle{Version: bundleVersion, Factory: factory}
+
+	groups, err := api.FactoryListDeviceGroup(factory)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch device groups: %w", err)
+	}
+	for _, g := range *groups {
+		b.DeviceGroups = append(b.DeviceGroups, BundleDeviceGroup{g.Name, g.Description})
+	}
+	sort.Slice(b.DeviceGroups, func(i, j int) bool {
+		return b.DeviceGroups[i].Name < b.DeviceGroups[j].Name
+	})
+
+	dcl, err := api.FactoryListConfig(factory)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch factory config: %w", err)
+	}
+	b.Config = bundleConfigFiles(dcl)
+
+	for _, g := range b.DeviceGroups {
+		dcl, err := api.GroupListConfig(factory, g.Name)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to fetch device group %s config: %w", g.Name, err)
+		}
+		if files := bundleConfigFiles(dcl); len(files) > 0 {
+			b.GroupConfig = append(b.GroupConfig, BundleGroupConfig{g.Name, files})
+		}
+	}
+
+	triggers, err := api.FactoryTriggers(factory)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch CI triggers: %w", err)
+	}
+	for _, t := range triggers {
+		for _, s := range t.Secrets {
+			b.Secrets = append(b.Secrets, s.Name)
+		}
+	}
+	sort.Strings(b.Secrets)
+
+	queues, err := api.EventQueuesList(factory)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch event queues: %w", err)
+	}
+	for _, q := range queues {
+		b.EventQueues = append(b.EventQueues, BundleEventQueue{q.Label, q.Type, q.PushUrl})
+	}
+	sort.Slice(b.EventQueues, func(i, j int) bool {
+		return b.EventQueues[i].Label < b.EventQueues[j].Label
+	})
+
+	teams, err := api.TeamsList(factory)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch teams: %w", err)
+	}
+	for _, t := range teams {
+		details, err := api.TeamDetails(factory, t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to fetch team %s: %w", t.Name, err)
+		}
+		b.Teams = append(b.Teams, BundleTeam{
+			Name:        details.Name,
+			Description: details.Description,
+			Scopes:      details.Scopes,
+			Groups:      details.Groups,
+		})
+	}
+	sort.Slice(b.Teams, func(i, j int) bool { return b.Teams[i].Name < b.Teams[j].Name })
+
+	return &b, nil
+}
+
+func bundleConfigFiles(dcl *client.DeviceConfigList) []BundleConfigFile {
+	var files []BundleConfigFile
+	if len(dcl.Configs) > 0 {
+		for _, f := range dcl.Configs[0].Files {
+			bf := BundleConfigFile{Name: f.Name, Unencrypted: f.Unencrypted, OnChanged: f.OnChanged}
+			if f.Unencrypted {
+				// Encrypted values can only be decrypted by devices, there is no point to export them
+				bf.Value = f.Value
+			}
+			files = append(files, bf)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// fetchTargetTags returns the current tags of the given targets.
+// Targets missing in the factory are not included into the result.
+func fetchTargetTags(factory string, names []string) (map[string][]string, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	tags := make(map[string][]string, len(names))
+	it := api.TargetIter(factory)
+	defer it.Close()
+	for len(tags) < len(wanted) && it.Next() {
+		name, target := it.Value()
+		if wanted[name] {
+			custom, err := api.TargetCustom(target)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse target %s: %w", name, err)
+			}
+			tags[name] = custom.Tags
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to fetch targets: %w", err)
+	}
+	return tags, nil
+}
+
+// loadBundle reads a bundle from a file, or from all YAML files in a directory.
+// Each file in a directory contains a part of the bundle, e.g. only device groups.
+func loadBundle(path string) (*Bundle, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		b, err := loadBundleFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if b.Version != bundleVersion {
+			return nil, fmt.Errorf("Unsupported bundle version: %d", b.Version)
+		}
+		return b, nil
+	}
+
+	b := Bundle{Version: bundleVersion}
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(name); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		part, err := loadBundleFile(name)
+		if err != nil {
+			return err
+		}
+		if part.Version != 0 && part.Version != bundleVersion {
+			return fmt.Errorf("Unsupported bundle version %d in %s", part.Version, name)
+		}
+		if err = b.merge(part); err != nil {
+			return fmt.Errorf("Unable to merge %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func loadBundleFile(path string) (*Bundle, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err = yaml.UnmarshalStrict(buf, &b); err != nil {
+		return nil, fmt.Errorf("Unable to parse bundle %s: %w", path, err)
+	}
+	return &b, nil
+}
+
+func assertUnique(kind string, names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("Duplicate %s: %s", kind, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Merge a part of the bundle into this bundle. Resources must not be defined twice.
+func (b *Bundle) merge(part *Bundle) error {
+	b.DeviceGroups = append(b.DeviceGroups, part.DeviceGroups...)
+	b.Config = append(b.Config, part.Config...)
+	b.Secrets = append(b.Secrets, part.Secrets...)
+	b.EventQueues = append(b.EventQueues, part.EventQueues...)
+	b.Teams = append(b.Teams, part.Teams...)
+	b.GroupConfig = append(b.GroupConfig, part.GroupConfig...)
+	for name, tags := range part.TargetTags {
+		if b.TargetTags == nil {
+			b.TargetTags = make(map[string][]string)
+		}
+		if _, ok := b.TargetTags[name]; ok {
+			return fmt.Errorf("Duplicate target tags: %s", name)
+		}
+		b.TargetTags[name] = tags
+	}
+
+	var groups, files, queues, teams, groupConfigs []string
+	for _, g := range b.DeviceGroups {
+		groups = append(groups, g.Name)
+	}
+	for _, f := range b.Config {
+		files = append(files, f.Name)
+	}
+	for _, q := range b.EventQueues {
+		queues = append(queues, q.Label)
+	}
+	for _, t := range b.Teams {
+		teams = append(teams, t.Name)
+	}
+	for _, g := range b.GroupConfig {
+		groupConfigs = append(groupConfigs, g.Group)
+	}
+	for _, err := range []error{
+		assertUnique("device group", groups),
+		assertUnique("config file", files),
+		assertUnique("secret", b.Secrets),
+		assertUnique("event queue", queues),
+		assertUnique("team", teams),
+		assertUnique("device group config", groupConfigs),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bundle) Marshal() ([]byte, error) {
+	return yaml.Marshal(b)
+}
+
+// Convert a bundle config file into a format accepted by the API
+func (f BundleConfigFile) AsConfigFile() client.ConfigFile {
+	return client.ConfigFile{
+		Name:        f.Name,
+		Value:       f.Value,
+		Unencrypted: f.Unencrypted,
+		OnChanged:   f.OnChanged,
+	}
+}
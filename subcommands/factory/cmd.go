@@ -0,0 +1,31 @@
+package factory
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	api *client.Api
+)
+
+var cmd = &cobra.Command{
+	Use:   "factory",
+	Short: "Set up, back up, export and apply the state of a factory",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		api = subcommands.Login(cmd)
+	},
+	Long: `These sub-commands allow you to manage the state of your Factory as a
+declarative bundle. The bundle is a YAML file which can be kept under version
+control, reviewed, and applied to the same or another Factory.
+
+The bundle covers device groups, factory configuration files, CI trigger
+secrets, event queues (web hooks), and team scopes.`,
+}
+
+func NewCommand() *cobra.Command {
+	subcommands.RequireFactory(cmd)
+	return cmd
+}
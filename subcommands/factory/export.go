@@ -0,0 +1,51 @@
+package factory
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the factory state into a declarative bundle",
+		Long: `Export the factory state into a declarative YAML bundle.
+
+Values of encrypted configuration files and CI secrets are never exported.
+Only their names are saved, so that "fioctl factory apply" can detect them.`,
+		Example: `
+  # Save the factory state into a file:
+  fioctl factory export --out factory.yaml
+
+  # Print the factory state to STDOUT:
+  fioctl factory export`,
+		Run:  doExport,
+		Args: cobra.NoArgs,
+	}
+	exportCmd.Flags().StringP("out", "o", "", "File to save the bundle to. Default is STDOUT.")
+	_ = exportCmd.MarkFlagFilename("out")
+	cmd.AddCommand(exportCmd)
+}
+
+func doExport(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	out, _ := cmd.Flags().GetString("out")
+	logrus.Debugf("Exporting factory state for %s", factory)
+
+	bundle, err := fetchBundle(factory)
+	subcommands.DieNotNil(err)
+	buf, err := bundle.Marshal()
+	subcommands.DieNotNil(err)
+
+	if len(out) == 0 {
+		_, err = os.Stdout.Write(buf)
+	} else {
+		err = os.WriteFile(out, buf, 0o644)
+	}
+	subcommands.DieNotNil(err)
+}
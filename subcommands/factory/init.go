@@ -0,0 +1,158 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Walk through the first time setup of a new factory",
+		Long: `Walk through the first time setup of a new factory:
+
+1. Take ownership of the TUF root: generate offline TUF root and targets keys,
+   and replace the initial keys owned by Foundries.io with them.
+2. Optionally, create the PKI of the device gateway. Its root CA key can be
+   created on a PKCS#11 compatible HSM.
+3. Create the first device group.
+4. Create the CI trigger, optionally with secrets needed by CI builds.
+
+Each step asks for a confirmation and can be skipped. The steps run the same
+commands you would otherwise run by hand, e.g. "fioctl keys tuf rotate-all-keys".`,
+		Run:  doInit,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(initCmd)
+}
+
+// Runs another fioctl command for the same factory, just like the user would do it.
+func runFioctl(cmd *cobra.Command, args ...string) {
+	args = append(args, "--factory", viper.GetString("factory"))
+	root := cmd.Root()
+	root.SetArgs(args)
+	subcommands.DieNotNil(root.Execute())
+}
+
+func validateKeyType(val string) error {
+	switch strings.ToLower(val) {
+	case "ed25519", "rsa":
+		return nil
+	}
+	return errors.New("Supported key types are: ed25519, rsa")
+}
+
+func doInit(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	fmt.Println("Setting up factory", factory)
+
+	fmt.Println("\n== Step 1: Take ownership of the TUF root")
+	if subcommands.PromptYesNo("Generate offline TUF keys and take ownership of the TUF root?", true) {
+		initTufKeys(cmd)
+	}
+
+	fmt.Println("\n== Step 2: Create the device gateway PKI")
+	if subcommands.PromptYesNo("Create the device gateway PKI now?", false) {
+		initPki(cmd)
+	}
+
+	fmt.Println("\n== Step 3: Create the first device group")
+	if subcommands.PromptYesNo("Create a device group?", true) {
+		initDeviceGroup(factory)
+	}
+
+	fmt.Println("\n== Step 4: Create the CI trigger")
+	initCiTrigger(factory)
+
+	fmt.Println("\nThe factory is set up. Keep the offline keys in a secure place.")
+}
+
+func initTufKeys(cmd *cobra.Command) {
+	rootKeys := subcommands.Prompt("File to store the offline TUF root keys in", "offline-tuf-root-keys.tgz")
+	if _, err := os.Stat(rootKeys); err == nil {
+		fmt.Println("The file already exists, the TUF root ownership was probably taken before.")
+		fmt.Println("To rotate the keys use: fioctl keys tuf rotate-all-keys")
+		return
+	}
+	targetsKeys := subcommands.Prompt(
+		"File to store the offline TUF targets keys in (keeping them apart from root keys is recommended)",
+		"offline-tuf-targets-keys.tgz")
+	keyType := subcommands.PromptValid("Key type (ed25519, rsa)", "ed25519", validateKeyType)
+
+	fmt.Println("= Taking ownership of the TUF root")
+	runFioctl(cmd, "keys", "tuf", "rotate-all-keys", "--first-time",
+		"--keys", rootKeys, "--targets-keys", targetsKeys, "--key-type", keyType,
+		"--changelog", "Take ownership of the TUF root during factory setup")
+	fmt.Println("The offline TUF keys are saved to:", rootKeys, targetsKeys)
+}
+
+func initPki(cmd *cobra.Command) {
+	dir := subcommands.Prompt("Directory to store the PKI files in", "factory-pki")
+	subcommands.DieNotNil(os.MkdirAll(dir, 0o700))
+	args := []string{"keys", "ca", "create", dir}
+	if subcommands.PromptYesNo("Create the root CA key on a PKCS#11 HSM?", false) {
+		module := subcommands.PromptValid("Path to the PKCS#11 module", "", func(val string) error {
+			if _, err := os.Stat(val); err != nil {
+				return err
+			}
+			return nil
+		})
+		pin := subcommands.PromptValid("The PIN to set up on the HSM", "", func(val string) error {
+			if len(val) == 0 {
+				return errors.New("The PIN is required")
+			}
+			return nil
+		})
+		args = append(args, "--hsm-module", module, "--hsm-pin", pin)
+	}
+	// The ca create changes the working directory
+	cwd, err := os.Getwd()
+	subcommands.DieNotNil(err)
+	runFioctl(cmd, args...)
+	subcommands.DieNotNil(os.Chdir(cwd))
+}
+
+func initDeviceGroup(factory string) {
+	name := subcommands.Prompt("Device group name", "default")
+	description := subcommands.Prompt("Device group description", "")
+	var desc *string
+	if len(description) > 0 {
+		desc = &description
+	}
+	_, err := api.FactoryCreateDeviceGroup(factory, name, desc)
+	subcommands.DieNotNil(err)
+	fmt.Println("Device group created:", name)
+}
+
+func initCiTrigger(factory string) {
+	triggers, err := api.FactoryTriggers(factory)
+	subcommands.DieNotNil(err)
+	if len(triggers) > 0 {
+		fmt.Println("The factory already has a CI trigger")
+		return
+	}
+	if !subcommands.PromptYesNo("Create the CI trigger?", true) {
+		return
+	}
+
+	trigger := client.ProjectTrigger{Type: "simple"}
+	fmt.Println("Enter secrets needed by CI builds, e.g. tokens to access private git repositories.")
+	for {
+		name := subcommands.Prompt("Secret name (empty to finish)", "")
+		if len(name) == 0 {
+			break
+		}
+		value := subcommands.Prompt("Secret value", "")
+		trigger.Secrets = append(trigger.Secrets, client.ProjectSecret{Name: name, Value: &value})
+	}
+	subcommands.DieNotNil(api.FactoryUpdateTrigger(factory, trigger))
+	fmt.Println("CI trigger created")
+}
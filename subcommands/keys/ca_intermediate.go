@@ -0,0 +1,301 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const intermediatesFile = "intermediates.json"
+
+// caIntermediate is a record of an intermediate CA issued from the factory root CA,
+// kept in the PKI directory, so that it can be listed and revoked later by its name.
+type caIntermediate struct {
+	Name        string     `json:"name"`
+	Fingerprint string     `json:"fingerprint"`
+	PathLen     int        `json:"pathlen"`
+	CreatedAt   time.Time  `json:"created-at"`
+	NotAfter    time.Time  `json:"not-after"`
+	RevokedAt   *time.Time `json:"revoked-at,omitempty"`
+}
+
+var intermediateNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+var (
+	intermediateName    string
+	intermediatePathLen int
+	intermediateValid   string
+	intermediateCsr     string
+	intermediateRootKey caKeyFlags
+)
+
+func init() {
+	createCmd := &cobra.Command{
+		Use:   "create-intermediate <PKI Directory>",
+		Short: "Issue an intermediate device CA, e.g. for a contract manufacturer",
+		Long: `Issue an intermediate CA signed by the factory root CA, and make the device gateway trust it.
+A contract manufacturer can use the intermediate CA to sign device certificates during
+device registration, without access to the factory root CA or the local device CA.
+
+The key of the intermediate CA is created in the PKI directory as <name>.key.
+To keep the key with the manufacturer, pass their certificate signing request with --csr instead.
+
+The factory root CA key may be a file or a key on a PKCS#11 token or PIV smartcard,
+as with "fioctl keys ca sign-csr".`,
+		Run:  doCreateIntermediate,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Issue an intermediate CA valid for a year, which can only sign device certificates:
+  fioctl keys ca create-intermediate /path/to/pki --name cm-shanghai --pathlen 0 --valid 1y
+
+  # Issue an intermediate CA for a key generated by the manufacturer:
+  fioctl keys ca create-intermediate /path/to/pki --name cm-shanghai --csr cm-shanghai.csr`,
+	}
+	createCmd.Flags().StringVarP(&intermediateName, "name", "", "", "A unique name of the intermediate CA")
+	createCmd.Flags().IntVarP(&intermediatePathLen, "pathlen", "", 0,
+		"The maximum number of CAs allowed below the intermediate CA")
+	createCmd.Flags().StringVarP(&intermediateValid, "valid", "", "1y",
+		"How long the intermediate CA is valid for, e.g. 1y, 180d, or 72h")
+	createCmd.Flags().StringVarP(&intermediateCsr, "csr", "", "",
+		"Sign this certificate signing request rather than creating a new key")
+	intermediateRootKey.addFlags(createCmd, "The private key of the factory root CA (default factory_ca.key)")
+	_ = createCmd.MarkFlagRequired("name")
+	caCmd.AddCommand(createCmd)
+
+	caCmd.AddCommand(&cobra.Command{
+		Use:   "list-intermediates <PKI Directory>",
+		Short: "List intermediate CAs issued from the PKI directory",
+		Run:   doListIntermediates,
+		Args:  cobra.ExactArgs(1),
+	})
+
+	caCmd.AddCommand(&cobra.Command{
+		Use:   "revoke-intermediate <PKI Directory> <name>",
+		Short: "Revoke an intermediate CA, so that the device gateway no longer trusts it",
+		Long: `Revoke an intermediate CA, so that the device gateway no longer trusts it.
+Devices with certificates signed by this intermediate CA lose access to the device gateway.`,
+		Run:  doRevokeIntermediate,
+		Args: cobra.ExactArgs(2),
+	})
+}
+
+// parseValidity adds a validity period like "1y", "180d", or a Go duration like "72h" to the given time.
+func parseValidity(start time.Time, validity string) (time.Time, error) {
+	if n := len(validity); n > 1 && (validity[n-1] == 'y' || validity[n-1] == 'd') {
+		val, err := strconv.Atoi(validity[:n-1])
+		if err == nil && val > 0 {
+			if validity[n-1] == 'y' {
+				return start.AddDate(val, 0, 0), nil
+			}
+			return start.AddDate(0, 0, val), nil
+		}
+	} else if d, err := time.ParseDuration(validity); err == nil && d > 0 {
+		return start.Add(d), nil
+	}
+	return start, fmt.Errorf("Invalid validity period: %s", validity)
+}
+
+func loadIntermediates() []caIntermediate {
+	var records []caIntermediate
+	buf, err := os.ReadFile(intermediatesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return records
+	}
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(json.Unmarshal(buf, &records), "Invalid "+intermediatesFile+":")
+	return records
+}
+
+func saveIntermediates(records []caIntermediate) {
+	buf, err := json.MarshalIndent(records, "", "  ")
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.WriteFile(intermediatesFile, buf, 0600))
+}
+
+func doCreateIntermediate(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	if !intermediateNameRe.MatchString(intermediateName) {
+		subcommands.DieNotNil(subcommands.ValidationError("Invalid intermediate CA name: %s", intermediateName))
+	}
+	if intermediatePathLen < 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The --pathlen must not be negative"))
+	}
+	now := time.Now()
+	notAfter, err := parseValidity(now, intermediateValid)
+	if err != nil {
+		subcommands.DieNotNil(subcommands.ValidationError("%s", err))
+	}
+
+	var pubKey crypto.PublicKey
+	if len(intermediateCsr) > 0 {
+		pubKey = readCsr(intermediateCsr).PublicKey
+	}
+	if len(intermediateRootKey.keyFile) > 0 {
+		intermediateRootKey.keyFile, err = filepath.Abs(intermediateRootKey.keyFile)
+		subcommands.DieNotNil(err)
+	}
+	subcommands.DieNotNil(os.Chdir(args[0]))
+
+	records := loadIntermediates()
+	for _, r := range records {
+		if r.Name == intermediateName {
+			subcommands.DieNotNil(fmt.Errorf("An intermediate CA named %s already exists", intermediateName))
+		}
+	}
+	keyFile, crtFile := intermediateName+".key", intermediateName+".pem"
+	for _, path := range []string{keyFile, crtFile} {
+		if _, err := os.Stat(path); err == nil {
+			subcommands.DieNotNil(errors.New("Refusing to overwrite an existing file: " + path))
+		}
+	}
+
+	rootCert := loadLocalCa("factory_ca.pem")
+	signer, err := intermediateRootKey.signer(rootCert, "factory_ca.key")
+	subcommands.DieNotNil(err)
+
+	if pubKey == nil {
+		logrus.Debugf("Creating a key for the intermediate CA %s", intermediateName)
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		subcommands.DieNotNil(err)
+		der, err := x509.MarshalECPrivateKey(key)
+		subcommands.DieNotNil(err)
+		writeFile(keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), 0400)
+		pubKey = key.Public()
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: intermediateName, OrganizationalUnit: []string{factory}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            intermediatePathLen,
+		MaxPathLenZero:        intermediatePathLen == 0,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, rootCert, pubKey, signer)
+	subcommands.DieNotNil(err, "Failed to sign the intermediate CA:")
+	certs, err := parseCaCerts(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	subcommands.DieNotNil(err)
+	newCa := certs[0]
+	writeFile(crtFile, newCa.Pem, 0400)
+
+	resp, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	trusted, err := parseCaCerts(resp.CaCrt)
+	subcommands.DieNotNil(err)
+	fmt.Println("Making the device gateway trust the intermediate CA", crtFile)
+	subcommands.DieNotNil(api.FactoryPatchCA(factory, client.CaCerts{CaCrt: joinCaCerts(append(trusted, newCa))}))
+
+	records = append(records, caIntermediate{
+		Name:        intermediateName,
+		Fingerprint: newCa.Fingerprint,
+		PathLen:     intermediatePathLen,
+		CreatedAt:   now.UTC().Round(time.Second),
+		NotAfter:    notAfter.UTC().Round(time.Second),
+	})
+	saveIntermediates(records)
+	if len(intermediateCsr) == 0 {
+		fmt.Printf("Share %s and %s with the manufacturer over a secure channel\n", crtFile, keyFile)
+	} else {
+		fmt.Printf("Share %s with the manufacturer\n", crtFile)
+	}
+}
+
+func doListIntermediates(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	subcommands.DieNotNil(os.Chdir(args[0]))
+	records := loadIntermediates()
+	if len(records) == 0 {
+		fmt.Println("No intermediate CAs were issued from this PKI directory")
+		return
+	}
+
+	resp, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	trusted, err := parseCaCerts(resp.CaCrt)
+	subcommands.DieNotNil(err)
+	isTrusted := make(map[string]bool, len(trusted))
+	for _, c := range trusted {
+		isTrusted[c.Fingerprint] = true
+	}
+
+	t := subcommands.Tabby(0, "NAME", "PATHLEN", "CREATED", "EXPIRES", "STATUS", "FINGERPRINT")
+	for _, r := range records {
+		status := "trusted"
+		if r.RevokedAt != nil {
+			status = "revoked " + r.RevokedAt.Format(time.RFC3339)
+		} else if !isTrusted[r.Fingerprint] {
+			status = "not trusted"
+		} else if time.Now().After(r.NotAfter) {
+			status = "expired"
+		}
+		t.AddLine(r.Name, r.PathLen, r.CreatedAt.Format(time.RFC3339), r.NotAfter.Format(time.RFC3339),
+			status, r.Fingerprint[:16])
+	}
+	t.Print()
+}
+
+func doRevokeIntermediate(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	name := args[1]
+	subcommands.DieNotNil(os.Chdir(args[0]))
+	records := loadIntermediates()
+	idx := -1
+	for i, r := range records {
+		if r.Name == name {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("No intermediate CA named %s was issued from this PKI directory", name)))
+	}
+	if records[idx].RevokedAt != nil {
+		subcommands.DieNotNil(fmt.Errorf("The intermediate CA %s is already revoked", name))
+	}
+
+	resp, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	trusted, err := parseCaCerts(resp.CaCrt)
+	subcommands.DieNotNil(err)
+	var keep []caCert
+	for _, c := range trusted {
+		if c.Fingerprint != records[idx].Fingerprint {
+			keep = append(keep, c)
+		}
+	}
+	if len(keep) == len(trusted) {
+		logrus.Warnf("The intermediate CA %s is not trusted by the device gateway", name)
+	} else {
+		if len(keep) == 0 {
+			subcommands.DieNotNil(errors.New("Refusing to revoke the only device CA trusted by the device gateway"))
+		}
+		fmt.Println("Removing the intermediate CA from the device gateway")
+		subcommands.DieNotNil(api.FactoryPatchCA(factory, client.CaCerts{CaCrt: joinCaCerts(keep)}))
+	}
+	revokedAt := time.Now().UTC().Round(time.Second)
+	records[idx].RevokedAt = &revokedAt
+	saveIntermediates(records)
+	fmt.Println("The intermediate CA", name, "is revoked")
+}
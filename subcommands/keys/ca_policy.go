@@ -0,0 +1,219 @@
+package keys
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// The policy is kept in the factory config, so that it is shared by everyone provisioning devices
+const deviceCertPolicyFile = "device-cert-policy"
+
+var (
+	uuidRe          = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([0-9a-f])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	uuidSchemes     = []string{"any", "1", "3", "4", "5", "6", "7", "8"}
+	policySanTypes  = []string{"dns", "ip", "uri", "email"}
+	policyCnPattern string
+	policyUuid      string
+	policySans      []string
+)
+
+// deviceCertPolicy restricts the subjects of device certificates signed by local CAs.
+type deviceCertPolicy struct {
+	// A regular expression the whole common name must match
+	CnPattern string `json:"cn-pattern,omitempty"`
+	// The common name must be a UUID: "any" or a specific UUID version
+	UuidScheme string `json:"uuid-scheme,omitempty"`
+	// Subject alternative name types a certificate must have: dns, ip, uri, or email
+	RequiredSans []string `json:"required-sans,omitempty"`
+}
+
+func init() {
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Manage the policy for subjects of device certificates",
+		Long: `The factory device certificate policy restricts the common names (device UUIDs) and
+subject alternative names of device certificates. It is enforced when signing device
+certificates with "fioctl keys ca sign-csr", so that provisioning mistakes are rejected
+at signing time. Registered devices can be checked against the policy with "policy check".`,
+	}
+	caCmd.AddCommand(policyCmd)
+
+	policyCmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show the device certificate policy of the factory",
+		Run:   doShowPolicy,
+		Args:  cobra.NoArgs,
+	})
+
+	setCmd := &cobra.Command{
+		Use:   "set",
+		Short: "Set the device certificate policy of the factory",
+		Long: `Set the device certificate policy of the factory, replacing the current one.
+Running this command without flags removes all restrictions.`,
+		Run:  doSetPolicy,
+		Args: cobra.NoArgs,
+		Example: `
+  # Only allow version 4 UUIDs as common names, and require a DNS name:
+  fioctl keys ca policy set --uuid 4 --require-san dns
+
+  # Only allow common names with a serial number prefix:
+  fioctl keys ca policy set --cn-pattern 'SN[0-9]{8}-.+'`,
+	}
+	setCmd.Flags().StringVarP(&policyCnPattern, "cn-pattern", "", "",
+		"A regular expression the whole common name must match")
+	setCmd.Flags().StringVarP(&policyUuid, "uuid", "", "",
+		"Require the common name to be a UUID of this version: "+strings.Join(uuidSchemes, ", "))
+	setCmd.Flags().StringSliceVarP(&policySans, "require-san", "", nil,
+		"Require subject alternative names of these types: "+strings.Join(policySanTypes, ", "))
+	policyCmd.AddCommand(setCmd)
+
+	policyCmd.AddCommand(&cobra.Command{
+		Use:   "check",
+		Short: "Check the UUIDs of registered devices against the device certificate policy",
+		Run:   doCheckPolicy,
+		Args:  cobra.NoArgs,
+	})
+}
+
+func (p deviceCertPolicy) validate() error {
+	if len(p.CnPattern) > 0 {
+		if _, err := regexp.Compile(p.CnPattern); err != nil {
+			return fmt.Errorf("Invalid common name pattern: %w", err)
+		}
+	}
+	if len(p.UuidScheme) > 0 && !slices.Contains(uuidSchemes, p.UuidScheme) {
+		return fmt.Errorf("Unsupported UUID scheme: %s", p.UuidScheme)
+	}
+	for _, san := range p.RequiredSans {
+		if !slices.Contains(policySanTypes, san) {
+			return fmt.Errorf("Unsupported subject alternative name type: %s", san)
+		}
+	}
+	return nil
+}
+
+// checkCommonName returns an error if the common name of a device certificate violates the policy.
+func (p deviceCertPolicy) checkCommonName(cn string) error {
+	if len(p.CnPattern) > 0 {
+		if !regexp.MustCompile("^(?:" + p.CnPattern + ")$").MatchString(cn) {
+			return fmt.Errorf("The common name %s does not match the pattern %s", cn, p.CnPattern)
+		}
+	}
+	if len(p.UuidScheme) > 0 {
+		m := uuidRe.FindStringSubmatch(cn)
+		if m == nil {
+			return fmt.Errorf("The common name %s is not a lower case UUID", cn)
+		}
+		if p.UuidScheme != "any" && m[1] != p.UuidScheme {
+			return fmt.Errorf("The common name %s is a version %s UUID, version %s is required", cn, m[1], p.UuidScheme)
+		}
+	}
+	return nil
+}
+
+// checkCsr returns an error if a device certificate request violates the policy.
+func (p deviceCertPolicy) checkCsr(csr *x509.CertificateRequest) error {
+	if err := p.checkCommonName(csr.Subject.CommonName); err != nil {
+		return err
+	}
+	for _, san := range p.RequiredSans {
+		var found bool
+		switch san {
+		case "dns":
+			found = len(csr.DNSNames) > 0
+		case "ip":
+			found = len(csr.IPAddresses) > 0
+		case "uri":
+			found = len(csr.URIs) > 0
+		case "email":
+			found = len(csr.EmailAddresses) > 0
+		}
+		if !found {
+			return fmt.Errorf("The certificate request has no %s subject alternative name", san)
+		}
+	}
+	return nil
+}
+
+// loadDeviceCertPolicy returns the policy of the factory, or nil if none is set.
+func loadDeviceCertPolicy(factory string) *deviceCertPolicy {
+	dcl, err := api.FactoryListConfig(factory)
+	subcommands.DieNotNil(err)
+	if len(dcl.Configs) == 0 {
+		return nil
+	}
+	for _, cfgFile := range dcl.Configs[0].Files {
+		if cfgFile.Name == deviceCertPolicyFile {
+			var policy deviceCertPolicy
+			subcommands.DieNotNil(json.Unmarshal([]byte(cfgFile.Value), &policy), "Invalid device certificate policy:")
+			return &policy
+		}
+	}
+	return nil
+}
+
+func doShowPolicy(cmd *cobra.Command, args []string) {
+	policy := loadDeviceCertPolicy(viper.GetString("factory"))
+	if policy == nil {
+		fmt.Println("No device certificate policy is set")
+		return
+	}
+	buf, err := json.MarshalIndent(policy, "", "  ")
+	subcommands.DieNotNil(err)
+	fmt.Println(string(buf))
+}
+
+func doSetPolicy(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	policy := deviceCertPolicy{CnPattern: policyCnPattern, UuidScheme: policyUuid}
+	for _, san := range policySans {
+		policy.RequiredSans = append(policy.RequiredSans, strings.ToLower(san))
+	}
+	if err := policy.validate(); err != nil {
+		subcommands.DieNotNil(subcommands.ValidationError("%s", err))
+	}
+	buf, err := json.Marshal(policy)
+	subcommands.DieNotNil(err)
+	cfg := client.ConfigCreateRequest{
+		Reason: "Set device certificate policy",
+		Files: []client.ConfigFile{
+			{
+				Name:        deviceCertPolicyFile,
+				Unencrypted: true,
+				Value:       string(buf),
+			},
+		},
+	}
+	subcommands.DieNotNil(api.FactoryPatchConfig(factory, cfg, false))
+	fmt.Println("Device certificate policy updated")
+}
+
+func doCheckPolicy(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	policy := loadDeviceCertPolicy(factory)
+	if policy == nil {
+		fmt.Println("No device certificate policy is set")
+		return
+	}
+	violations := 0
+	for _, d := range listAllDevices(factory) {
+		if err := policy.checkCommonName(d.Uuid); err != nil {
+			fmt.Printf("%s\t%s\n", d.Name, err)
+			violations += 1
+		}
+	}
+	if violations > 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("%d registered devices violate the device certificate policy", violations))
+	}
+	fmt.Println("All registered devices comply with the device certificate policy")
+}
@@ -0,0 +1,378 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const (
+	caRotationFile = "ca-rotation.json"
+
+	caRotationPhaseDual    = "dual-ca"
+	caRotationPhaseRetired = "retired"
+)
+
+// caRotation is the state of a device CA rotation, kept in the PKI directory between the phases.
+type caRotation struct {
+	Factory   string    `json:"factory"`
+	Phase     string    `json:"phase"`
+	StartedAt time.Time `json:"started-at"`
+	// SHA256 fingerprints of the device CAs trusted before the rotation
+	OldCas []string `json:"old-cas"`
+	NewCa  string   `json:"new-ca"`
+	// SHA256 fingerprints of device public keys when the rotation started.
+	// A device with a different key has re-enrolled with a new certificate.
+	Devices map[string]string `json:"devices"`
+}
+
+var (
+	rotateCaFile  string
+	rotateForce   bool
+	rotatePending bool
+)
+
+func init() {
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the device CA without downtime",
+		Long: `Rotate the CA which signs device client certificates in stages, so that devices never lose
+access to the device gateway:
+
+1. "start" creates a new local device CA, and makes the device gateway trust it alongside the old CAs.
+2. Devices re-enroll with certificates signed by the new CA, e.g. using "fioctl config rotate-certs".
+   Use "status" to track how many devices have re-enrolled.
+3. "finish" retires the old CAs once all devices have re-enrolled.
+
+The state of the rotation is kept in the ` + caRotationFile + ` file of the PKI directory.`,
+	}
+	caCmd.AddCommand(rotateCmd)
+
+	startCmd := &cobra.Command{
+		Use:   "start <PKI Directory>",
+		Short: "Start a rotation by trusting a new device CA alongside the old ones",
+		Run:   doRotateCaStart,
+		Args:  cobra.ExactArgs(1),
+		Example: `
+  # Create a new local device CA using the factory root CA in the PKI directory:
+  fioctl keys ca rotate start /path/to/pki
+
+  # Introduce a device CA created by other means, e.g. on an HSM:
+  fioctl keys ca rotate start /path/to/pki --ca-file new-device-ca.pem`,
+	}
+	startCmd.Flags().StringVarP(&rotateCaFile, "ca-file", "", "",
+		"Introduce this device CA certificate rather than creating a new local CA")
+	rotateCmd.AddCommand(startCmd)
+
+	statusCmd := &cobra.Command{
+		Use:   "status <PKI Directory>",
+		Short: "Show the progress of devices re-enrolling with the new device CA",
+		Run:   doRotateCaStatus,
+		Args:  cobra.ExactArgs(1),
+	}
+	statusCmd.Flags().BoolVarP(&rotatePending, "pending", "", false, "List devices which have not re-enrolled yet")
+	rotateCmd.AddCommand(statusCmd)
+
+	finishCmd := &cobra.Command{
+		Use:   "finish <PKI Directory>",
+		Short: "Retire the old device CAs",
+		Long: `Retire the old device CAs, so that the device gateway only trusts the new device CA.
+Devices which have not re-enrolled yet lose access to the device gateway,
+so this command fails unless all devices have re-enrolled or the --force flag is set.`,
+		Run:  doRotateCaFinish,
+		Args: cobra.ExactArgs(1),
+	}
+	finishCmd.Flags().BoolVarP(&rotateForce, "force", "", false, "Retire the old CAs even if some devices have not re-enrolled")
+	rotateCmd.AddCommand(finishCmd)
+
+	cancelCmd := &cobra.Command{
+		Use:   "cancel <PKI Directory>",
+		Short: "Cancel a rotation, so that the device gateway no longer trusts the new device CA",
+		Run:   doRotateCaCancel,
+		Args:  cobra.ExactArgs(1),
+	}
+	rotateCmd.AddCommand(cancelCmd)
+}
+
+type caCert struct {
+	Fingerprint string
+	Cert        *x509.Certificate
+	Pem         string
+}
+
+func parseCaCerts(bundle string) ([]caCert, error) {
+	var certs []caCert
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse certificate: %w", err)
+		}
+		certs = append(certs, caCert{
+			Fingerprint: fmt.Sprintf("%x", sha256.Sum256(block.Bytes)),
+			Cert:        c,
+			Pem:         string(pem.EncodeToMemory(block)),
+		})
+	}
+	return certs, nil
+}
+
+func joinCaCerts(certs []caCert) string {
+	pems := make([]string, len(certs))
+	for idx, c := range certs {
+		pems[idx] = c.Pem
+	}
+	return strings.Join(pems, "")
+}
+
+func loadCaRotation(factory string) *caRotation {
+	buf, err := os.ReadFile(caRotationFile)
+	if errors.Is(err, os.ErrNotExist) {
+		subcommands.DieNotNil(errors.New("No device CA rotation was started in this PKI directory"))
+	}
+	subcommands.DieNotNil(err)
+	var state caRotation
+	subcommands.DieNotNil(json.Unmarshal(buf, &state), "Invalid "+caRotationFile+":")
+	if state.Factory != factory {
+		subcommands.DieNotNil(fmt.Errorf("The rotation in this PKI directory belongs to the factory %s", state.Factory))
+	}
+	return &state
+}
+
+func saveCaRotation(state *caRotation) {
+	buf, err := json.MarshalIndent(state, "", "  ")
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.WriteFile(caRotationFile, buf, 0600))
+}
+
+func listAllDevices(factory string) []client.Device {
+	var devices []client.Device
+	it := api.DeviceIter(false, "", factory, "", "", "", "", 1000)
+	for it.Next() {
+		devices = append(devices, it.Value())
+	}
+	subcommands.DieNotNil(it.Err())
+	return devices
+}
+
+func devicePubKeyFingerprint(d client.Device) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.TrimSpace(d.PublicKey))))
+}
+
+func doRotateCaStart(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	var newCaPem []byte
+	if len(rotateCaFile) > 0 {
+		// Read before changing into the PKI directory, so that a relative path works
+		var err error
+		newCaPem, err = os.ReadFile(rotateCaFile)
+		subcommands.DieNotNil(err)
+	}
+	subcommands.DieNotNil(os.Chdir(args[0]))
+
+	if buf, err := os.ReadFile(caRotationFile); err == nil {
+		var state caRotation
+		if json.Unmarshal(buf, &state) == nil && state.Phase == caRotationPhaseDual {
+			subcommands.DieNotNil(errors.New("A device CA rotation is already in progress. Finish or cancel it first"))
+		}
+	}
+
+	certs, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	oldCas, err := parseCaCerts(certs.CaCrt)
+	subcommands.DieNotNil(err)
+
+	if newCaPem == nil {
+		if _, err := os.Stat("create_device_ca"); err != nil {
+			subcommands.DieNotNil(errors.New(
+				"The create_device_ca script is missing in the PKI directory. Use the --ca-file flag instead"))
+		}
+		suffix := time.Now().UTC().Format("20060102150405")
+		keyFile, crtFile := "local-ca-"+suffix+".key", "local-ca-"+suffix+".pem"
+		fmt.Println("Creating a new local device CA:", crtFile)
+		run("./create_device_ca", keyFile, crtFile)
+		newCaPem, err = os.ReadFile(crtFile)
+		subcommands.DieNotNil(err)
+	}
+	newCas, err := parseCaCerts(string(newCaPem))
+	subcommands.DieNotNil(err)
+	if len(newCas) != 1 || !newCas[0].Cert.IsCA {
+		subcommands.DieNotNil(errors.New("The new device CA must be a single CA certificate"))
+	}
+	newCa := newCas[0]
+	for _, c := range oldCas {
+		if c.Fingerprint == newCa.Fingerprint {
+			subcommands.DieNotNil(errors.New("The new device CA is already trusted by the device gateway"))
+		}
+	}
+
+	fmt.Println("Recording public keys of devices to track their re-enrollment")
+	state := caRotation{
+		Factory:   factory,
+		Phase:     caRotationPhaseDual,
+		StartedAt: time.Now().UTC().Round(time.Second),
+		NewCa:     newCa.Fingerprint,
+		Devices:   make(map[string]string),
+	}
+	for _, c := range oldCas {
+		state.OldCas = append(state.OldCas, c.Fingerprint)
+	}
+	for _, d := range listAllDevices(factory) {
+		state.Devices[d.Name] = devicePubKeyFingerprint(d)
+	}
+
+	fmt.Println("Making the device gateway trust the new device CA alongside the old ones")
+	subcommands.DieNotNil(api.FactoryPatchCA(factory, client.CaCerts{CaCrt: joinCaCerts(append(oldCas, newCa))}))
+	saveCaRotation(&state)
+
+	fmt.Printf("Phase 1 of 3 completed: %d old and 1 new device CAs are trusted.\n", len(oldCas))
+	fmt.Println("Next, re-enroll devices with certificates signed by the new CA, e.g. using \"fioctl config rotate-certs\".")
+	fmt.Println("Track the progress with: fioctl keys ca rotate status", args[0])
+}
+
+func doRotateCaStatus(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	subcommands.DieNotNil(os.Chdir(args[0]))
+	state := loadCaRotation(factory)
+
+	fmt.Println("Phase:", state.Phase)
+	fmt.Println("Started at:", subcommands.FormatTimestamp(state.StartedAt))
+
+	certs, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	trusted, err := parseCaCerts(certs.CaCrt)
+	subcommands.DieNotNil(err)
+	fmt.Println("\n## Device CAs trusted by the device gateway")
+	t := subcommands.Tabby(1, "ROLE", "SUBJECT", "NOT AFTER", "FINGERPRINT")
+	for _, c := range trusted {
+		role := "other"
+		if c.Fingerprint == state.NewCa {
+			role = "new"
+		} else if slices.Contains(state.OldCas, c.Fingerprint) {
+			role = "old"
+		}
+		t.AddLine(role, c.Cert.Subject, subcommands.FormatTimestamp(c.Cert.NotAfter), c.Fingerprint[:16])
+	}
+	t.Print()
+
+	if state.Phase != caRotationPhaseDual {
+		return
+	}
+	reenrolled, added, pending := caRotationProgress(factory, state)
+	total := reenrolled + len(pending)
+	fmt.Println("\n## Device re-enrollment")
+	fmt.Printf(" Re-enrolled: %d of %d", reenrolled, total)
+	if total > 0 {
+		fmt.Printf(" (%d%%)", reenrolled*100/total)
+	}
+	fmt.Println()
+	fmt.Println(" New devices:", added)
+	fmt.Println(" Pending:", len(pending))
+	if rotatePending {
+		for _, name := range pending {
+			fmt.Println("  ", name)
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Println("\nAll devices have re-enrolled. Retire the old CAs with: fioctl keys ca rotate finish", args[0])
+	}
+}
+
+// caRotationProgress compares the device public keys to those recorded when the rotation started.
+func caRotationProgress(factory string, state *caRotation) (reenrolled, added int, pending []string) {
+	for _, d := range listAllDevices(factory) {
+		fp, ok := state.Devices[d.Name]
+		if !ok {
+			added += 1
+		} else if fp != devicePubKeyFingerprint(d) {
+			reenrolled += 1
+		} else {
+			pending = append(pending, d.Name)
+		}
+	}
+	sort.Strings(pending)
+	return
+}
+
+func doRotateCaFinish(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	subcommands.DieNotNil(os.Chdir(args[0]))
+	state := loadCaRotation(factory)
+	if state.Phase != caRotationPhaseDual {
+		subcommands.DieNotNil(errors.New("The device CA rotation is already finished"))
+	}
+
+	_, _, pending := caRotationProgress(factory, state)
+	if len(pending) > 0 {
+		if !rotateForce {
+			subcommands.DieNotNil(fmt.Errorf(
+				"%d devices have not re-enrolled yet and would lose access. Use --force to retire the old CAs anyway",
+				len(pending)))
+		}
+		logrus.Warnf("%d devices have not re-enrolled and will lose access to the device gateway", len(pending))
+	}
+
+	certs, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	trusted, err := parseCaCerts(certs.CaCrt)
+	subcommands.DieNotNil(err)
+	var keep []caCert
+	for _, c := range trusted {
+		if !slices.Contains(state.OldCas, c.Fingerprint) {
+			keep = append(keep, c)
+		}
+	}
+	if slices.IndexFunc(keep, func(c caCert) bool { return c.Fingerprint == state.NewCa }) < 0 {
+		subcommands.DieNotNil(errors.New("The new device CA is no longer trusted by the device gateway, refusing to retire the old CAs"))
+	}
+
+	fmt.Printf("Retiring %d old device CAs\n", len(trusted)-len(keep))
+	subcommands.DieNotNil(api.FactoryPatchCA(factory, client.CaCerts{CaCrt: joinCaCerts(keep)}))
+	state.Phase = caRotationPhaseRetired
+	saveCaRotation(state)
+	fmt.Println("Phase 3 of 3 completed: only the new device CA is trusted.")
+}
+
+func doRotateCaCancel(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	subcommands.DieNotNil(os.Chdir(args[0]))
+	state := loadCaRotation(factory)
+	if state.Phase != caRotationPhaseDual {
+		subcommands.DieNotNil(errors.New("The device CA rotation is already finished, it can not be cancelled"))
+	}
+
+	certs, err := api.FactoryGetCA(factory)
+	subcommands.DieNotNil(err)
+	trusted, err := parseCaCerts(certs.CaCrt)
+	subcommands.DieNotNil(err)
+	var keep []caCert
+	for _, c := range trusted {
+		if c.Fingerprint != state.NewCa {
+			keep = append(keep, c)
+		}
+	}
+	fmt.Println("Removing the new device CA from the device gateway")
+	subcommands.DieNotNil(api.FactoryPatchCA(factory, client.CaCerts{CaCrt: joinCaCerts(keep)}))
+	subcommands.DieNotNil(os.Remove(caRotationFile))
+	fmt.Println("The device CA rotation is cancelled")
+}
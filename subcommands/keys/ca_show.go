@@ -61,12 +61,12 @@ func doShowCA(cmd *cobra.Command, args []string) {
 	}
 
 	fmt.Println("## Change Metadata")
-	fmt.Println("Created at:", resp.ChangeMeta.CreatedAt)
+	fmt.Println("Created at:", subcommands.FormatTime(resp.ChangeMeta.CreatedAt))
 	if len(resp.ChangeMeta.CreatedBy) > 0 {
 		fmt.Println("Created by:", resp.ChangeMeta.CreatedBy)
 	}
 	if len(resp.ChangeMeta.UpdatedAt) > 0 {
-		fmt.Println("Updated at:", resp.ChangeMeta.UpdatedAt)
+		fmt.Println("Updated at:", subcommands.FormatTime(resp.ChangeMeta.UpdatedAt))
 	}
 	if len(resp.ChangeMeta.UpdatedBy) > 0 {
 		fmt.Println("Updated by:", resp.ChangeMeta.UpdatedBy)
@@ -162,7 +162,7 @@ func prettyPrint(cert string) {
 		fmt.Println("\tIssuer:", c.Issuer)
 		fmt.Println("\tValidity")
 		fmt.Println("\t\tNot Before:", c.NotBefore)
-		fmt.Println("\t\tNot After:", c.NotAfter)
+		fmt.Println("\t\tNot After:", subcommands.FormatTimestamp(c.NotAfter))
 		fmt.Println("\tSubject:", c.Subject)
 		fmt.Println("\tSubject Public Key Info")
 		switch pub := c.PublicKey.(type) {
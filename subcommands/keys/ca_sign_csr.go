@@ -0,0 +1,154 @@
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	signCsrCa   string
+	signCsrOut  string
+	signCsrDays int
+	signCsrKey  caKeyFlags
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "sign-csr <PKI Directory> <CSR file>",
+		Short: "Sign a device certificate signing request with a local CA",
+		Long: `Sign a device certificate signing request with a local CA, so that the device can
+connect to the device gateway without communicating with Foundries.io web services during manufacturing.
+
+The private key of the CA can be a file in the PKI directory, or a key on a PKCS#11 token or
+a PIV smartcard (e.g. a YubiKey), so that it never exists as a file on the provisioning workstation.
+Signing with a token requires the "openssl" command with the pkcs11 engine (libp11).
+
+The certificate request must comply with the device certificate policy of the factory,
+see "fioctl keys ca policy".`,
+		Run:  doSignCsr,
+		Args: cobra.ExactArgs(2),
+		Example: `
+  # Sign with the local-ca.key file in the PKI directory:
+  fioctl keys ca sign-csr /path/to/pki device.csr --out device.crt
+
+  # Sign with the CA key in the slot 9c of a YubiKey:
+  fioctl keys ca sign-csr /path/to/pki device.csr --out device.crt \
+    --hsm-module /usr/lib/libykcs11.so --hsm-pin 123456 --piv-slot 9c
+
+  # Sign with a key labeled "local-ca" on a PKCS#11 token:
+  fioctl keys ca sign-csr /path/to/pki device.csr --out device.crt \
+    --hsm-module /usr/lib/softhsm/libsofthsm2.so --hsm-pin 1234 \
+    --hsm-token-label device-gateway-root --hsm-key-label local-ca`,
+	}
+	caCmd.AddCommand(cmd)
+	cmd.Flags().StringVarP(&signCsrCa, "ca", "", "local-ca.pem", "The certificate of the CA in the PKI directory to sign with")
+	cmd.Flags().StringVarP(&signCsrOut, "out", "o", "", "Write the device certificate to this file rather than STDOUT")
+	cmd.Flags().IntVarP(&signCsrDays, "days", "", 7300, "The number of days the device certificate is valid for")
+	signCsrKey.addFlags(cmd, "The private key of the CA. Defaults to the CA certificate name with a .key extension")
+}
+
+// loadLocalCa reads a CA certificate from the PKI directory (the current directory)
+func loadLocalCa(crtFile string) *x509.Certificate {
+	buf, err := os.ReadFile(crtFile)
+	subcommands.DieNotNil(err)
+	certs, err := parseCaCerts(string(buf))
+	subcommands.DieNotNil(err)
+	if len(certs) != 1 || !certs[0].Cert.IsCA {
+		subcommands.DieNotNil(fmt.Errorf("%s must contain a single CA certificate", crtFile))
+	}
+	return certs[0].Cert
+}
+
+func caKeyFileFor(crtFile string) string {
+	return strings.TrimSuffix(crtFile, ".pem") + ".key"
+}
+
+func readCsr(csrFile string) *x509.CertificateRequest {
+	buf, err := os.ReadFile(csrFile)
+	subcommands.DieNotNil(err)
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		subcommands.DieNotNil(fmt.Errorf("No PEM encoded certificate request found in %s", csrFile))
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	subcommands.DieNotNil(err, "Failed to parse certificate request:")
+	subcommands.DieNotNil(csr.CheckSignature(), "Invalid certificate request signature:")
+	return csr
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	subcommands.DieNotNil(err)
+	return serial
+}
+
+func doSignCsr(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	// Resolve paths before changing into the PKI directory, so that relative paths work
+	csr := readCsr(args[1])
+	if len(signCsrOut) > 0 {
+		var err error
+		signCsrOut, err = filepath.Abs(signCsrOut)
+		subcommands.DieNotNil(err)
+	}
+	subcommands.DieNotNil(os.Chdir(args[0]))
+	logrus.Debugf("Signing device CSR for %s with %s", factory, signCsrCa)
+
+	if len(csr.Subject.CommonName) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The certificate request has no common name"))
+	}
+	if len(csr.Subject.OrganizationalUnit) != 1 || csr.Subject.OrganizationalUnit[0] != factory {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The organizational unit of the certificate request must be the factory name: %s", factory))
+	}
+	if policy := loadDeviceCertPolicy(factory); policy != nil {
+		if err := policy.checkCsr(csr); err != nil {
+			subcommands.DieNotNil(subcommands.ValidationError("Device certificate policy violation: %s", err))
+		}
+	}
+
+	caCert := loadLocalCa(signCsrCa)
+	signer, err := signCsrKey.signer(caCert, caKeyFileFor(signCsrCa))
+	subcommands.DieNotNil(err)
+
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               csr.Subject,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(0, 0, signCsrDays),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, csr.PublicKey, signer)
+	subcommands.DieNotNil(err, "Failed to sign the certificate:")
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	if len(signCsrOut) == 0 {
+		fmt.Print(string(crt))
+		return
+	}
+	if _, err := os.Stat(signCsrOut); err == nil {
+		subcommands.DieNotNil(errors.New("Refusing to overwrite an existing file: " + signCsrOut))
+	}
+	subcommands.DieNotNil(os.WriteFile(signCsrOut, crt, 0644))
+	fmt.Println("Device certificate written to", signCsrOut)
+}
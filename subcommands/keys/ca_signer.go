@@ -0,0 +1,277 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// PIV slots are exposed by the Yubico PKCS#11 module (ykcs11) as keys with these IDs
+var pivSlotKeyIds = map[string]byte{
+	"9a": 1, // Authentication
+	"9c": 2, // Digital Signature
+	"9d": 3, // Key Management
+	"9e": 4, // Card Authentication
+}
+
+// caKeyFlags locate the private key of a local CA: either a PEM file in the PKI directory,
+// or a key on a PKCS#11 token or a PIV smartcard, which never leaves the device.
+type caKeyFlags struct {
+	keyFile       string
+	hsmModule     string
+	hsmPin        string
+	hsmTokenLabel string
+	hsmKeyLabel   string
+	pivSlot       string
+}
+
+func (f *caKeyFlags) addFlags(cmd *cobra.Command, keyFileHelp string) {
+	cmd.Flags().StringVarP(&f.keyFile, "ca-key", "", "", keyFileHelp)
+	cmd.Flags().StringVarP(&f.hsmModule, "hsm-module", "", "",
+		"Sign with a key on a PKCS#11 token or a PIV smartcard using this module, e.g. libykcs11.so")
+	cmd.Flags().StringVarP(&f.hsmPin, "hsm-pin", "", "", "The PKCS#11 PIN of the token, if using one")
+	cmd.Flags().StringVarP(&f.hsmTokenLabel, "hsm-token-label", "", "",
+		"The label of the PKCS#11 token holding the key. Any token is used if not set")
+	cmd.Flags().StringVarP(&f.hsmKeyLabel, "hsm-key-label", "", "", "The label of the CA key on the PKCS#11 token")
+	cmd.Flags().StringVarP(&f.pivSlot, "piv-slot", "", "",
+		"The PIV slot of the CA key on a smartcard: 9a, 9c, 9d, or 9e. Requires the ykcs11 module")
+}
+
+func (f *caKeyFlags) useToken() bool {
+	return len(f.hsmModule) > 0
+}
+
+// signer returns a signer for the private key of the given CA certificate.
+// The keyFile is used unless the flags select a key on a token.
+func (f *caKeyFlags) signer(caCert *x509.Certificate, keyFile string) (crypto.Signer, error) {
+	if !f.useToken() {
+		if len(f.pivSlot) > 0 || len(f.hsmKeyLabel) > 0 {
+			return nil, errors.New("The --hsm-module flag is required to use a key on a token")
+		}
+		if len(f.keyFile) > 0 {
+			keyFile = f.keyFile
+		}
+		return loadCaKeyFile(caCert, keyFile)
+	}
+
+	if len(f.hsmPin) == 0 {
+		return nil, errors.New("The --hsm-pin flag is required with --hsm-module")
+	}
+	uri := "pkcs11:"
+	var attrs []string
+	if len(f.hsmTokenLabel) > 0 {
+		attrs = append(attrs, "token="+pkcs11UriEscape(f.hsmTokenLabel))
+	}
+	if len(f.pivSlot) > 0 {
+		id, ok := pivSlotKeyIds[strings.ToLower(f.pivSlot)]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported PIV slot: %s", f.pivSlot)
+		}
+		attrs = append(attrs, fmt.Sprintf("id=%%%02x", id))
+	} else if len(f.hsmKeyLabel) > 0 {
+		attrs = append(attrs, "object="+pkcs11UriEscape(f.hsmKeyLabel))
+	} else {
+		return nil, errors.New("Either the --hsm-key-label or the --piv-slot flag is required with --hsm-module")
+	}
+	uri += strings.Join(append(attrs, "type=private"), ";")
+	return &tokenSigner{module: f.hsmModule, pin: f.hsmPin, uri: uri, pub: caCert.PublicKey}, nil
+}
+
+func pkcs11UriEscape(val string) string {
+	return strings.ReplaceAll(url.PathEscape(val), ";", "%3B")
+}
+
+func loadCaKeyFile(caCert *x509.Certificate, keyFile string) (crypto.Signer, error) {
+	buf, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, rest := pem.Decode(buf)
+	if block != nil && block.Type == "EC PARAMETERS" {
+		// Keys generated by "openssl ecparam -genkey" are prefixed with the curve parameters
+		block, _ = pem.Decode(rest)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("No PEM encoded private key found in %s", keyFile)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("Unsupported private key type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", keyFile, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported private key in %s", keyFile)
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(caCert.PublicKey) {
+		return nil, fmt.Errorf("The private key in %s does not match the CA certificate", keyFile)
+	}
+	return signer, nil
+}
+
+// tokenSigner signs digests with a key on a PKCS#11 token using the OpenSSL pkcs11 engine (libp11).
+// If the PIN is not set, it is asked for by askPin before the first signature.
+// The notice is printed before each signature, e.g. to ask the user to touch the token.
+type tokenSigner struct {
+	module string
+	pin    string
+	uri    string
+	pub    crypto.PublicKey
+	askPin func() (string, error)
+	notice string
+}
+
+func (s *tokenSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *tokenSigner) onDevice() {}
+
+func (s *tokenSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	args := []string{"pkeyutl", "-sign", "-engine", "pkcs11", "-keyform", "engine", "-inkey", s.uri}
+	switch s.pub.(type) {
+	case ed25519.PublicKey:
+		// Ed25519 signs the message itself rather than a digest of it
+		args = append(args, "-rawin")
+	case *rsa.PublicKey:
+		var hashName string
+		switch opts.HashFunc() {
+		case crypto.SHA256:
+			hashName = "sha256"
+		case crypto.SHA384:
+			hashName = "sha384"
+		case crypto.SHA512:
+			hashName = "sha512"
+		default:
+			return nil, fmt.Errorf("Unsupported signature hash: %s", opts.HashFunc())
+		}
+		// Let OpenSSL wrap the digest into a PKCS#1 v1.5 DigestInfo structure, or pad it for RSA-PSS.
+		args = append(args, "-pkeyopt", "digest:"+hashName)
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			saltLen := strconv.Itoa(pss.SaltLength)
+			if pss.SaltLength == rsa.PSSSaltLengthEqualsHash {
+				saltLen = "digest"
+			} else if pss.SaltLength == rsa.PSSSaltLengthAuto {
+				saltLen = "max"
+			}
+			args = append(args, "-pkeyopt", "rsa_padding_mode:pss", "-pkeyopt", "rsa_pss_saltlen:"+saltLen)
+		}
+	}
+	if len(s.pin) == 0 && s.askPin != nil {
+		pin, err := s.askPin()
+		if err != nil {
+			return nil, err
+		}
+		s.pin = pin
+	}
+	if len(s.notice) > 0 {
+		fmt.Fprintln(os.Stderr, s.notice)
+	}
+	// An ECDSA signature of a raw digest is already ASN.1 encoded, as expected by the crypto/x509.
+	sig, err := tokenOpenssl(s.module, s.pin, digest, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to sign with the key %s: %w", s.uri, err)
+	}
+
+	// Check the signature, so that a wrong key on the token is caught before the signature is used
+	switch pub := s.pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, sig) {
+			err = errors.New("invalid Ed25519 signature")
+		}
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			err = rsa.VerifyPSS(pub, opts.HashFunc(), digest, sig, pss)
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, opts.HashFunc(), digest, sig)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			err = errors.New("invalid ECDSA signature")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("The key %s returned a signature which does not verify: %w", s.uri, err)
+	}
+	return sig, nil
+}
+
+// tokenPublicKey reads the public key of a key on a PKCS#11 token.
+func tokenPublicKey(module, pin, uri string) (crypto.PublicKey, error) {
+	out, err := tokenOpenssl(module, pin, nil, "pkey", "-engine", "pkcs11", "-inform", "engine", "-pubin", "-in", uri, "-pubout")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the public key %s: %w", uri, err)
+	}
+	block, _ := pem.Decode(out)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM encoded public key found for %s", uri)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// tokenOpenssl runs an OpenSSL command with the pkcs11 engine (libp11) configured to use a PKCS#11 module,
+// the same way the PKI scripts provided by Foundries.io use the HSM.
+// If the input is set, it is passed to the command with the -in option.
+// Without a PIN, the engine does not log in to the token, which is enough to read public keys.
+func tokenOpenssl(module, pin string, input []byte, args ...string) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "fioctl-pkcs11-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The PIN is passed via a private OpenSSL config file rather than the command line,
+	// so that it is not visible to other users in the process list.
+	conf := fmt.Sprintf(`openssl_conf = openssl_init
+[openssl_init]
+engines = engine_section
+[engine_section]
+pkcs11 = pkcs11_section
+[pkcs11_section]
+engine_id = pkcs11
+MODULE_PATH = %s
+init = 0
+`, module)
+	if len(pin) > 0 {
+		conf += "PIN = " + pin + "\n"
+	}
+	confFile := filepath.Join(tmpDir, "openssl.cnf")
+	if err := os.WriteFile(confFile, []byte(conf), 0600); err != nil {
+		return nil, err
+	}
+	if input != nil {
+		inFile := filepath.Join(tmpDir, "input")
+		if err := os.WriteFile(inFile, input, 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "-in", inFile)
+	}
+
+	cmd := exec.Command("openssl", args...)
+	cmd.Env = append(os.Environ(), "OPENSSL_CONF="+confFile)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
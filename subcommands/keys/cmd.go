@@ -42,6 +42,13 @@ var tufCmd = &cobra.Command{
 to ensure that you are in complete control of your OTA metadata.`,
 }
 
+// offline makes a command work without logging in, e.g. on an air-gapped machine,
+// as it only works with local files.
+func offline(cmd *cobra.Command) *cobra.Command {
+	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {}
+	return cmd
+}
+
 func NewCommand() *cobra.Command {
 	subcommands.RequireFactory(cmd)
 	cmd.AddCommand(caCmd)
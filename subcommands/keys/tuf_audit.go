@@ -0,0 +1,273 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	auditCmd := &cobra.Command{
+		Use:   "audit [--keys=<tuf-root-keys.tgz>]",
+		Short: "Report the inventory of the factory's TUF keys and their hygiene",
+		Long: `Download the current CI and production TUF root metadata, and report every key ID they trust:
+its roles, key type and size, and whether it is an online key held by Foundries.io or an offline key.
+The expiry date and the signing thresholds of each root are reported too.
+
+With --keys, the keys of an offline TUF keys archive are matched against the roots, and those which
+are no longer referenced by either root are reported, so that they can be removed or destroyed.`,
+		Example: `
+  # Report the TUF keys, and which offline keys in the archive are no longer used:
+  fioctl keys audit --keys tuf-root-keys.tgz
+  # Feed the report into a compliance tool:
+  fioctl keys audit --json`,
+		Run:  doKeysAudit,
+		Args: cobra.NoArgs,
+	}
+	auditCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to match against the roots.")
+	_ = auditCmd.MarkFlagFilename("keys")
+	auditCmd.Flags().Bool("json", false, "Print the report as JSON")
+	auditCmd.Flags().Int("expiry-warning-days", 30, "Warn about TUF roots expiring in fewer days")
+	cmd.AddCommand(auditCmd)
+}
+
+type tufAuditRole struct {
+	Threshold int      `json:"threshold"`
+	KeyIds    []string `json:"keyids"`
+}
+
+type tufAuditRoot struct {
+	Name    string                  `json:"name"`
+	Version int                     `json:"version"`
+	Expires time.Time               `json:"expires"`
+	Roles   map[string]tufAuditRole `json:"roles"`
+}
+
+type tufAuditKey struct {
+	Id      string   `json:"keyid"`
+	Roles   []string `json:"roles"`
+	Roots   []string `json:"roots"`
+	Type    string   `json:"keytype"`
+	Bits    int      `json:"bits"`
+	Online  bool     `json:"online"`
+	InCreds *bool    `json:"in-creds,omitempty"`
+}
+
+type tufAuditCredsKey struct {
+	Id   string `json:"keyid"`
+	Name string `json:"name"`
+}
+
+type tufAuditReport struct {
+	Factory         string             `json:"factory"`
+	Roots           []tufAuditRoot     `json:"roots"`
+	Keys            []tufAuditKey      `json:"keys"`
+	UnusedCredsKeys []tufAuditCredsKey `json:"unused-creds-keys,omitempty"`
+	Warnings        []string           `json:"warnings"`
+}
+
+// tufKeyBits returns the size of a TUF public key in bits, or 0 if it can not be parsed.
+func tufKeyBits(key client.AtsKey) int {
+	pub, err := parseTufPublicKey(key)
+	if err != nil {
+		return 0
+	}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return 256
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	}
+	return 0
+}
+
+func doKeysAudit(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	credsFile, _ := cmd.Flags().GetString("keys")
+	asJson, _ := cmd.Flags().GetBool("json")
+	expiryDays, _ := cmd.Flags().GetInt("expiry-warning-days")
+	logrus.Debugf("Auditing TUF keys of %s", factory)
+
+	ciRoot, err := api.TufRootGet(factory)
+	subcommands.DieNotNil(err)
+	prodRoot, err := api.TufProdRootGet(factory)
+	subcommands.DieNotNil(err)
+	onlineKey, err := api.TufTargetsOnlineKey(factory)
+	subcommands.DieNotNil(err, "Unable to fetch the online targets key:")
+
+	report := tufAuditReport{Factory: factory, Warnings: []string{}}
+	keys := make(map[string]*tufAuditKey)
+	// Key IDs by their public key values, to match the keys of the archive
+	public := make(map[string]string)
+	now := time.Now()
+	for _, r := range []struct {
+		name string
+		root *client.AtsTufRoot
+	}{{"ci", ciRoot}, {"prod", prodRoot}} {
+		auditRoot := tufAuditRoot{
+			Name:    r.name,
+			Version: r.root.Signed.Version,
+			Expires: r.root.Signed.Expires,
+			Roles:   make(map[string]tufAuditRole),
+		}
+		if left := r.root.Signed.Expires.Sub(now); left <= 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("The %s root version %d expired on %s",
+				r.name, r.root.Signed.Version, subcommands.FormatTimestamp(r.root.Signed.Expires)))
+		} else if left < time.Duration(expiryDays)*24*time.Hour {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("The %s root version %d expires in %d days",
+				r.name, r.root.Signed.Version, int(left.Hours()/24)))
+		}
+		for role, def := range r.root.Signed.Roles {
+			auditRoot.Roles[string(role)] = tufAuditRole{Threshold: def.Threshold, KeyIds: def.KeyIDs}
+			if def.Threshold > len(def.KeyIDs) {
+				report.Warnings = append(report.Warnings, fmt.Sprintf(
+					"The %s role of the %s root requires %d signatures, but has only %d keys",
+					role, r.name, def.Threshold, len(def.KeyIDs)))
+			}
+			for _, id := range def.KeyIDs {
+				key, ok := keys[id]
+				if !ok {
+					pub := r.root.Signed.Keys[id]
+					key = &tufAuditKey{Id: id, Type: pub.KeyType, Bits: tufKeyBits(pub)}
+					keys[id] = key
+					public[strings.TrimSpace(pub.KeyValue.Public)] = id
+				}
+				if !slices.Contains(key.Roles, string(role)) {
+					key.Roles = append(key.Roles, string(role))
+				}
+				if !slices.Contains(key.Roots, r.name) {
+					key.Roots = append(key.Roots, r.name)
+				}
+				switch role {
+				case tuf.CanonicalSnapshotRole, tuf.CanonicalTimestampRole:
+					key.Online = true
+				case tuf.CanonicalTargetsRole:
+					key.Online = key.Online || r.root.Signed.Keys[id].KeyValue.Public == onlineKey.KeyValue.Public
+				}
+			}
+		}
+		report.Roots = append(report.Roots, auditRoot)
+	}
+
+	if len(credsFile) > 0 {
+		creds, err := GetOfflineCreds(credsFile)
+		subcommands.DieNotNil(err)
+		for _, key := range keys {
+			inCreds := false
+			key.InCreds = &inCreds
+		}
+		for base, id := range credsKeyIds(credsFile, creds) {
+			var pub client.AtsKey
+			subcommands.DieNotNil(json.Unmarshal(creds[base+".pub"], &pub))
+			if rootId, ok := public[strings.TrimSpace(pub.KeyValue.Public)]; ok {
+				inCreds := true
+				keys[rootId].InCreds = &inCreds
+			} else {
+				report.UnusedCredsKeys = append(report.UnusedCredsKeys, tufAuditCredsKey{Id: id, Name: base})
+			}
+		}
+		sort.Slice(report.UnusedCredsKeys, func(i, j int) bool {
+			return report.UnusedCredsKeys[i].Name < report.UnusedCredsKeys[j].Name
+		})
+		if len(report.UnusedCredsKeys) > 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf(
+				"%d keys in %s are no longer used by the roots", len(report.UnusedCredsKeys), credsFile))
+		}
+	}
+
+	for _, key := range keys {
+		sort.Strings(key.Roles)
+		report.Keys = append(report.Keys, *key)
+	}
+	// Root keys first, then by role and ID
+	sort.Slice(report.Keys, func(i, j int) bool {
+		ki, kj := report.Keys[i], report.Keys[j]
+		if oi, oj := tufAuditKeyOrder(ki.Roles), tufAuditKeyOrder(kj.Roles); oi != oj {
+			return oi < oj
+		}
+		return ki.Id < kj.Id
+	})
+
+	if asJson {
+		buf, err := json.MarshalIndent(report, "", "  ")
+		subcommands.DieNotNil(err)
+		fmt.Println(string(buf))
+		return
+	}
+
+	for _, root := range report.Roots {
+		fmt.Printf("%s root: version %d, expires %s\n",
+			strings.ToUpper(root.Name), root.Version, subcommands.FormatTimestamp(root.Expires))
+		roles := make([]string, 0, len(root.Roles))
+		for role := range root.Roles {
+			roles = append(roles, role)
+		}
+		sort.Slice(roles, func(i, j int) bool {
+			return tufAuditKeyOrder(roles[i:i+1]) < tufAuditKeyOrder(roles[j:j+1])
+		})
+		for _, role := range roles {
+			fmt.Printf("  %-10s threshold %d of %d keys\n", role, root.Roles[role].Threshold, len(root.Roles[role].KeyIds))
+		}
+	}
+	fmt.Println()
+
+	t := subcommands.Tabby(0, "KEY ID", "ROLES", "ROOTS", "TYPE", "BITS", "CUSTODY", "IN CREDS")
+	for _, key := range report.Keys {
+		custody := "offline"
+		if key.Online {
+			custody = "online"
+		}
+		inCreds := "-"
+		if key.InCreds != nil {
+			inCreds = "no"
+			if *key.InCreds {
+				inCreds = "yes"
+			}
+		}
+		t.AddLine(key.Id, strings.Join(key.Roles, ","), strings.Join(key.Roots, ","), key.Type, key.Bits, custody, inCreds)
+	}
+	t.Print()
+
+	if len(report.UnusedCredsKeys) > 0 {
+		fmt.Println("\nKeys in", credsFile, "no longer used by the roots:")
+		for _, key := range report.UnusedCredsKeys {
+			fmt.Printf("  %s  %s\n", key.Id, key.Name)
+		}
+	}
+	if len(report.Warnings) > 0 {
+		fmt.Println("\nWarnings:")
+		for _, w := range report.Warnings {
+			fmt.Println("  " + w)
+		}
+	}
+}
+
+// tufAuditRoleOrder lists the roles from the most to the least sensitive.
+var tufAuditRoleOrder = map[string]int{"root": 0, "targets": 1, "snapshot": 2, "timestamp": 3}
+
+// tufAuditKeyOrder returns the order of the most sensitive role of a key.
+func tufAuditKeyOrder(roles []string) int {
+	order := len(tufAuditRoleOrder)
+	for _, role := range roles {
+		if o, ok := tufAuditRoleOrder[role]; ok && o < order {
+			order = o
+		}
+	}
+	return order
+}
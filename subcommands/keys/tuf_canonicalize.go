@@ -0,0 +1,277 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	canonicalizeCmd := &cobra.Command{
+		Use:   "canonicalize <file.json> [--pubkey=<key>...]",
+		Short: "Print the canonical JSON of a TUF document, and verify its signatures",
+		Long: `Print the canonical JSON form of a TUF document, the form which fioctl signs and verifies,
+so that external tooling can check that it produces the very same bytes.
+
+The document is checked for what has no single canonical form, and fails the command:
+- a key repeated in an object, as tools disagree on which of the values is used;
+- a number which is not an integer, or is written with a fraction or an exponent, e.g. 1.0 or 1e3;
+- data after the JSON document.
+
+If the document has a "signed" part, as TUF metadata does, its signatures are verified against
+the public keys given with --pubkey. A public key is either a PEM file, or a TUF key in JSON,
+e.g. a .pub file of an offline TUF keys archive. The command fails unless each given key made
+a valid signature. Signatures made by other keys are listed, but not verified.
+
+This command works without a network connection.`,
+		Example: `
+  # Print the canonical form of the signed part of a TUF root, the bytes the root keys sign:
+  fioctl keys tuf canonicalize --signed root.json
+  # Verify the signatures of custom delegated metadata against a delegation key:
+  fioctl keys tuf canonicalize --check --pubkey delegation.pub.pem firmware.json
+  # Save the canonical form of a document:
+  fioctl keys tuf canonicalize --out canonical.json doc.json`,
+		Run:  doTufCanonicalize,
+		Args: cobra.ExactArgs(1),
+	}
+	canonicalizeCmd.Flags().StringArray("pubkey", nil,
+		"Verify the signatures against this public key, a PEM file or a TUF key in JSON, or keychain:<name>. Can be repeated.")
+	_ = canonicalizeCmd.MarkFlagFilename("pubkey")
+	canonicalizeCmd.Flags().Bool("signed", false, `Print the canonical form of the "signed" part only, which is what is signed.`)
+	canonicalizeCmd.Flags().Bool("check", false,
+		"Do not print the canonical form, but fail if the document is not in it already.")
+	canonicalizeCmd.Flags().StringP("out", "o", "", "File to write the canonical form to (default: standard output)")
+	_ = canonicalizeCmd.MarkFlagFilename("out")
+	canonicalizeCmd.MarkFlagsMutuallyExclusive("check", "out")
+	canonicalizeCmd.MarkFlagsMutuallyExclusive("check", "signed")
+	tufCmd.AddCommand(offline(canonicalizeCmd))
+}
+
+func doTufCanonicalize(cmd *cobra.Command, args []string) {
+	pubFiles, _ := cmd.Flags().GetStringArray("pubkey")
+	signedOnly, _ := cmd.Flags().GetBool("signed")
+	check, _ := cmd.Flags().GetBool("check")
+	out, _ := cmd.Flags().GetString("out")
+
+	raw, err := os.ReadFile(args[0])
+	subcommands.DieNotNil(err)
+	problems, err := lintCanonicalJson(raw)
+	if err != nil {
+		subcommands.DieNotNil(subcommands.ValidationError("%s is not valid JSON: %s", args[0], err))
+	}
+	if len(problems) > 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("%s has no canonical JSON form:\n  %s",
+			args[0], strings.Join(problems, "\n  ")))
+	}
+
+	var doc map[string]json.RawMessage
+	hasSigned := false
+	if err := json.Unmarshal(raw, &doc); err == nil {
+		_, hasSigned = doc["signed"]
+	}
+	if signedOnly && !hasSigned {
+		subcommands.DieNotNil(subcommands.ValidationError(`%s has no "signed" part`, args[0]))
+	}
+	if len(pubFiles) > 0 && !hasSigned {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			`%s has no "signed" part, so it has no signatures to verify`, args[0]))
+	}
+
+	canonical, err := canonicalJson(raw)
+	subcommands.DieNotNil(err, "Unable to canonicalize "+args[0]+":")
+	if hasSigned {
+		msg, sigs, err := client.CanonicalTufSigned(raw)
+		subcommands.DieNotNil(err, "Unable to canonicalize "+args[0]+":")
+		if len(pubFiles) > 0 {
+			verifyTufDocumentSignatures(msg, sigs, pubFiles)
+		}
+		if signedOnly {
+			canonical = msg
+		}
+	}
+
+	if check {
+		if !bytes.Equal(raw, canonical) {
+			subcommands.DieNotNil(subcommands.ValidationError("%s is not in canonical JSON form", args[0]))
+		}
+		fmt.Fprintln(os.Stderr, "=", args[0], "is in canonical JSON form")
+	} else if len(out) > 0 {
+		subcommands.DieNotNil(os.WriteFile(out, canonical, 0644))
+	} else {
+		os.Stdout.Write(canonical)
+	}
+}
+
+// verifyTufDocumentSignatures checks that each of the given public keys made a valid signature of the message.
+// The results are printed to STDERR, so that they do not mix with the canonical form printed to STDOUT.
+func verifyTufDocumentSignatures(msg []byte, sigs []tuf.Signature, pubFiles []string) {
+	keys := make(map[string]client.AtsKey)
+	names := make(map[string]string)
+	for _, path := range pubFiles {
+		id, key := readTufPublicKeyFile(path)
+		keys[id] = key
+		names[id] = path
+	}
+
+	valid := make(map[string]bool)
+	for _, sig := range sigs {
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			// External tooling may compute key IDs differently, so the signature is tried with each given key
+			for id, k := range keys {
+				if client.VerifyTufSignature(k, msg, sig.Signature) == nil {
+					fmt.Fprintf(os.Stderr, "  signature by %s: OK, made by %s with another key ID\n", sig.KeyID, id)
+					valid[id] = true
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				fmt.Fprintf(os.Stderr, "  signature by %s: not verified, the public key is not given\n", sig.KeyID)
+			}
+			continue
+		}
+		if err := client.VerifyTufSignature(key, msg, sig.Signature); err != nil {
+			fmt.Fprintf(os.Stderr, "  signature by %s: FAILED: %s\n", sig.KeyID, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  signature by %s: OK\n", sig.KeyID)
+		valid[sig.KeyID] = true
+	}
+
+	var missing []string
+	for id := range keys {
+		if !valid[id] {
+			missing = append(missing, fmt.Sprintf("%s (%s)", id, names[id]))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf(
+			"The document has no valid signature by the keys:\n  %s", strings.Join(missing, "\n  "))))
+	}
+}
+
+// readTufPublicKeyFile reads a public key, either from a PEM file or from a TUF key in JSON, and returns its key ID.
+func readTufPublicKeyFile(path string) (string, client.AtsKey) {
+	buf, err := readTufKeyFile(path)
+	subcommands.DieNotNil(err)
+	if !bytes.HasPrefix(bytes.TrimSpace(buf), []byte("{")) {
+		kp := importTufKeyPair(path, "")
+		return kp.signer.Id, kp.atsPub
+	}
+	var key client.AtsKey
+	subcommands.DieNotNil(json.Unmarshal(buf, &key), "Unable to parse "+path+":")
+	id, err := tufPublicKeyId(key)
+	subcommands.DieNotNil(err, path+":")
+	return id, key
+}
+
+// canonicalJsonInt is how an integer is written in canonical JSON.
+var canonicalJsonInt = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// jsonLintFrame is an object or an array being walked by lintCanonicalJson.
+type jsonLintFrame struct {
+	object  bool
+	keys    map[string]bool
+	key     string
+	needKey bool
+	index   int
+}
+
+// lintCanonicalJson returns what prevents a JSON document from having a single canonical form,
+// with the path of each problem. An error is returned for an invalid JSON document.
+func lintCanonicalJson(raw []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var stack []*jsonLintFrame
+	var problems []string
+	where := func() string {
+		path := "$"
+		for _, f := range stack {
+			if f.object {
+				path += "." + f.key
+			} else {
+				path += fmt.Sprintf("[%d]", f.index)
+			}
+		}
+		return path
+	}
+	done := func() {
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.object {
+				top.needKey = true
+			} else {
+				top.index++
+			}
+		}
+	}
+
+	started := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			if !started {
+				return nil, errors.New("the document is empty")
+			} else if len(stack) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return problems, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if started && len(stack) == 0 {
+			problems = append(problems, "$: data after the JSON document")
+			return problems, nil
+		}
+		started = true
+
+		if len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].needKey {
+			top := stack[len(stack)-1]
+			if tok == json.Delim('}') {
+				stack = stack[:len(stack)-1]
+				done()
+				continue
+			}
+			top.key = tok.(string)
+			top.needKey = false
+			if top.keys[top.key] {
+				problems = append(problems, where()+": the key is repeated")
+			}
+			top.keys[top.key] = true
+			continue
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			switch v {
+			case '{':
+				stack = append(stack, &jsonLintFrame{object: true, keys: make(map[string]bool), needKey: true})
+			case '[':
+				stack = append(stack, &jsonLintFrame{})
+			case ']':
+				stack = stack[:len(stack)-1]
+				done()
+			}
+		case json.Number:
+			if !canonicalJsonInt.MatchString(v.String()) {
+				problems = append(problems, fmt.Sprintf("%s: the number %s is not an integer in canonical form", where(), v))
+			}
+			done()
+		default:
+			done()
+		}
+	}
+}
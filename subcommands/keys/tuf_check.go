@@ -0,0 +1,128 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	checkCmd := &cobra.Command{
+		Use:   "check --keys=<tuf-root-keys.tgz>",
+		Short: "Check that an offline TUF keys archive can sign for the factory",
+		Long: `Check that an offline TUF keys archive contains the private keys authorized for the root and
+targets roles of the current production TUF root, and of the updated root if TUF root updates are
+in progress. Each private key is checked by signing a probe message and verifying it with the public
+key from the root, so a mismatching key is caught too.
+
+Run this before a signing ceremony to make sure that the right keys are at hand.
+The command fails if a role does not have enough keys in the archive to meet its threshold.`,
+		Run:  doKeysCheck,
+		Args: cobra.NoArgs,
+	}
+	checkCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to check.")
+	_ = checkCmd.MarkFlagFilename("keys")
+	AddTufSignerFlags(checkCmd)
+	cmd.AddCommand(checkCmd)
+}
+
+// checkTufCredsKey tells if the creds contain the private key for a key of the root.
+func checkTufCredsKey(id string, key client.AtsKey, creds OfflineCreds) error {
+	signer, err := FindTufSigner(id, key.KeyValue.Public, creds)
+	if errors.Is(err, client.ErrTufKeyNotFound) {
+		return errors.New("not in the archive")
+	} else if err != nil {
+		return err
+	}
+	probe := []byte("fioctl keys check " + id)
+	sigs, err := SignTufMeta(probe, *signer)
+	if err != nil {
+		return fmt.Errorf("unable to sign with the private key: %w", err)
+	}
+	if err := client.VerifyTufSignature(key, probe, sigs[0].Signature); err != nil {
+		return errors.New("the private key in the archive does not match the public key")
+	}
+	return nil
+}
+
+// checkTufCredsRoot prints which keys of the root and targets roles are in the creds, and
+// returns false if a role does not have enough of them to meet its threshold.
+func checkTufCredsRoot(title string, root *client.AtsTufRoot, onlineKey *client.AtsKey, creds OfflineCreds) bool {
+	fmt.Printf("%s (version %d):\n", title, root.Signed.Version)
+	ok := true
+	for _, role := range []tuf.RoleName{tuf.CanonicalRootRole, tuf.CanonicalTargetsRole} {
+		def := root.Signed.Roles[role]
+		if def == nil {
+			continue
+		}
+		required := def.Threshold
+		found := 0
+		for _, id := range def.KeyIDs {
+			key := root.Signed.Keys[id]
+			if onlineKey != nil && key.KeyValue.Public == onlineKey.KeyValue.Public {
+				fmt.Printf("  %-8s %s  online key, held by Foundries.io\n", role, id)
+				required -= 1
+				continue
+			}
+			if err := checkTufCredsKey(id, key, creds); err != nil {
+				fmt.Printf("  %-8s %s  FAILED: %s\n", role, id, err)
+			} else {
+				fmt.Printf("  %-8s %s  OK\n", role, id)
+				found += 1
+			}
+		}
+		if found < required {
+			fmt.Printf("  The %s role requires %d offline key(s), but %d are in the archive\n", role, required, found)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func doKeysCheck(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	logrus.Debugf("Checking offline TUF keys %s for %s", keysFile, factory)
+
+	creds, err := GetSigningCreds(keysFile)
+	subcommands.DieNotNil(err)
+	if len(keysFile) == 0 {
+		keysFile = "the external key stores"
+	}
+
+	onlineKey, err := api.TufTargetsOnlineKey(factory)
+	subcommands.DieNotNil(err, "Unable to fetch the online targets key:")
+	root, err := api.TufProdRootGet(factory)
+	subcommands.DieNotNil(err)
+	ok := checkTufCredsRoot("Current TUF root", root, onlineKey, creds)
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	if updates.Status != client.TufRootUpdatesStatusNone {
+		_, newCiRoot := checkTufRootUpdatesStatus(updates, false)
+		var newProdRoot *client.AtsTufRoot
+		if updates.Updated.ProdRoot != "" {
+			subcommands.DieNotNil(
+				json.Unmarshal([]byte(updates.Updated.ProdRoot), &newProdRoot), "Updated prod root",
+			)
+		} else {
+			newProdRoot = genProdTufRoot(newCiRoot)
+		}
+		fmt.Println()
+		ok = checkTufCredsRoot("Updated TUF root in progress", newProdRoot, onlineKey, creds) && ok
+	}
+
+	if !ok {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("The keys in %s are not enough to sign the TUF root of %s", keysFile, factory)))
+	}
+	fmt.Printf("\nThe keys in %s can sign the TUF root of %s\n", keysFile, factory)
+}
@@ -0,0 +1,139 @@
+package keys
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var checkExpiryOutput subcommands.ListOutput
+
+func init() {
+	checkCmd := &cobra.Command{
+		Use:   "check-expiry [--warn=<period>]",
+		Short: "Check that the TUF metadata of the factory does not expire soon",
+		Long: `Check the expiry of the CI and production TUF root metadata and of the production targets of each tag.
+Devices stop accepting updates once the metadata they need expires, so expiring metadata must be re-signed in time.
+
+The command exits with the code 8 if any metadata expires within the warning period,
+and with the code 9 if any metadata has already expired, so that it can be run by cron or a monitoring system.`,
+		Example: `
+  # Alert when any TUF metadata expires within 30 days:
+  fioctl keys tuf check-expiry --warn 30d || send-alert
+  # Only print the metadata which needs re-signing:
+  fioctl keys tuf check-expiry --warn 2w --quiet`,
+		Run:  doTufCheckExpiry,
+		Args: cobra.NoArgs,
+	}
+	checkCmd.Flags().String("warn", "30d", "Warning period, e.g. 30d, 2w, or a Go duration like 72h")
+	checkCmd.Flags().BoolP("quiet", "q", false, "Only print the metadata which expires within the warning period")
+	checkExpiryOutput.AddFlags(checkCmd, "days-left")
+	tufCmd.AddCommand(checkCmd)
+}
+
+// parseExpiryWarning parses a warning period like "30d", "2w", or a Go duration like "72h".
+func parseExpiryWarning(period string) (time.Duration, error) {
+	if n := len(period); n > 1 && (period[n-1] == 'd' || period[n-1] == 'w') {
+		val, err := strconv.Atoi(period[:n-1])
+		if err == nil && val >= 0 {
+			days := val
+			if period[n-1] == 'w' {
+				days *= 7
+			}
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(period); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("Invalid warning period: %s", period)
+}
+
+type tufExpiry struct {
+	name    string
+	version int
+	expires time.Time
+	fix     string
+}
+
+func doTufCheckExpiry(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	period, _ := cmd.Flags().GetString("warn")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	warn, err := parseExpiryWarning(period)
+	if err != nil {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeValidation, err))
+	}
+	logrus.Debugf("Checking the expiry of TUF metadata of %s", factory)
+
+	const rootFix = "run a TUF root update: 'fioctl keys tuf updates init', then 'rotate-offline-key --role=root' and 'apply'"
+	var expiries []tufExpiry
+	ciRoot, err := api.TufRootGet(factory)
+	subcommands.DieNotNil(err)
+	expiries = append(expiries, tufExpiry{"CI root", ciRoot.Signed.Version, ciRoot.Signed.Expires, rootFix})
+	prodRoot, err := api.TufProdRootGet(factory)
+	subcommands.DieNotNil(err)
+	expiries = append(expiries, tufExpiry{"production root", prodRoot.Signed.Version, prodRoot.Signed.Expires, rootFix})
+
+	prodTargets, err := api.ProdTargetsList(factory, false)
+	subcommands.DieNotNil(err)
+	tags := make([]string, 0, len(prodTargets))
+	for tag := range prodTargets {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		targets := prodTargets[tag]
+		expiries = append(expiries, tufExpiry{"production targets " + tag, targets.Signed.Version, targets.Signed.Expires,
+			"complete a new wave for the tag with 'fioctl waves init', 'rollout', and 'complete'"})
+	}
+
+	now := time.Now()
+	var expired, expiring []tufExpiry
+	t := checkExpiryOutput.NewTable("METADATA", "VERSION", "EXPIRES", "DAYS LEFT", "STATUS")
+	for _, e := range expiries {
+		left := e.expires.Sub(now)
+		status := "OK"
+		if left <= 0 {
+			status = "EXPIRED"
+			expired = append(expired, e)
+		} else if left < warn {
+			status = "EXPIRING"
+			expiring = append(expiring, e)
+		} else if quiet {
+			continue
+		}
+		t.AddLine(e.name, e.version, e.expires.UTC().Format(time.RFC3339), int(left.Hours()/24), status)
+	}
+	t.Print()
+
+	if len(expired)+len(expiring) == 0 {
+		return
+	}
+	if checkExpiryOutput.Format == subcommands.OutputFormatTable {
+		fmt.Println("\nTo re-sign the metadata:")
+		for _, e := range append(expired, expiring...) {
+			fmt.Printf("  %s: %s\n", e.name, e.fix)
+		}
+	}
+	names := func(list []tufExpiry) string {
+		var s []string
+		for _, e := range list {
+			s = append(s, e.name)
+		}
+		return strings.Join(s, ", ")
+	}
+	if len(expired) > 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeExpired,
+			fmt.Errorf("TUF metadata has expired: %s", names(expired))))
+	}
+	subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeExpiring,
+		fmt.Errorf("TUF metadata expires within %s: %s", period, names(expiring))))
+}
@@ -42,7 +42,7 @@ func doCopyTargets(cmd *cobra.Command, args []string) {
 
 	targetsCreds, err := createTargetsCreds(factory, *root, creds)
 	subcommands.DieNotNil(err)
-	saveTufCreds(args[1], targetsCreds)
+	subcommands.DieNotNil(client.SaveOfflineCredsCopy(args[1], credsFile, targetsCreds))
 }
 
 func createTargetsCreds(factory string, root client.AtsTufRoot, creds OfflineCreds) (OfflineCreds, error) {
@@ -0,0 +1,52 @@
+package keys
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var tufDelegationsCmd = &cobra.Command{
+	Use:   "delegations",
+	Short: "Manage delegated TUF targets roles for your factory",
+	Long: `These sub-commands allow you to delegate the signing of some targets to other keys than
+the factory's targets keys, e.g. to give each team the signing authority over its own targets
+without sharing the main targets key.
+
+A delegated targets role may sign those targets whose names match its path patterns,
+e.g. "team-a-*", or "intel-corei7-64-lmp-*" for the targets of a hardware ID.
+The delegations are listed in the CI targets metadata, which is re-signed by Foundries.io
+with the online targets key after each change.`,
+}
+
+var delegationsListOutput subcommands.ListOutput
+
+func init() {
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List delegated TUF targets roles",
+		Run:     doTufDelegationsList,
+		Args:    cobra.NoArgs,
+	}
+	delegationsListOutput.AddFlags(listCmd, "name")
+	tufDelegationsCmd.AddCommand(listCmd)
+	tufCmd.AddCommand(tufDelegationsCmd)
+}
+
+func doTufDelegationsList(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	delegations, err := api.TufDelegationsGet(factory)
+	subcommands.DieNotNil(err)
+
+	t := delegationsListOutput.NewTable("NAME", "PATHS", "THRESHOLD", "TERMINATING", "KEYS")
+	for _, role := range delegations.Roles {
+		t.AddLine(role.Name, strings.Join(role.Paths, ","), role.Threshold,
+			strconv.FormatBool(role.Terminating), strings.Join(role.KeyIDs, ","))
+	}
+	t.Print()
+}
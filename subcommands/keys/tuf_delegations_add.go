@@ -0,0 +1,112 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var tufDelegationNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+func init() {
+	addCmd := &cobra.Command{
+		Use:   "add <name> --keys=<team-keys.tgz> (--path=<pattern>|--hardware-id=<hwid>)...",
+		Short: "Add a delegated TUF targets role with a new signing key",
+		Long: `Add a delegated TUF targets role with a new signing key.
+
+A new key pair is generated for the role, and saved to the given offline TUF keys,
+which are created if they do not exist. Hand this file over to the team owning the role.
+The role may sign the targets matching any of its path patterns; a hardware ID is a shortcut
+for the pattern matching the targets built for it.`,
+		Example: `
+- Delegate the signing of the targets of a team:
+  fioctl keys tuf delegations add team-a --keys=team-a-keys.tgz --path='team-a-*'
+- Delegate the signing of the targets of two hardware IDs, and stop looking for other delegations of them:
+  fioctl keys tuf delegations add imx --keys=imx-keys.tgz \
+    --hardware-id=imx8mm-lpddr4-evk --hardware-id=imx8mp-lpddr4-evk --terminating`,
+		Run:  doTufDelegationsAdd,
+		Args: cobra.ExactArgs(1),
+	}
+	addCmd.Flags().StringP("keys", "k", "", "Path to <team-keys.tgz> to save the new key of the role to.")
+	_ = addCmd.MarkFlagFilename("keys")
+	_ = addCmd.MarkFlagRequired("keys")
+	addTufKeyTypeFlag(addCmd)
+	addCmd.Flags().StringArray("path", nil, "A pattern of the target names the role may sign, e.g. 'team-a-*'. Can be repeated.")
+	addCmd.Flags().StringArray("hardware-id", nil, "A hardware ID the role may sign the targets of. Can be repeated.")
+	addCmd.Flags().Bool("terminating", false, "Do not look for other delegations of the targets matching the role.")
+	tufDelegationsCmd.AddCommand(addCmd)
+}
+
+func doTufDelegationsAdd(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	name := args[0]
+	keysFile, _ := cmd.Flags().GetString("keys")
+	keyTypeStr, _ := cmd.Flags().GetString("key-type")
+	keyType := ParseTufKeyType(keyTypeStr)
+	paths, _ := cmd.Flags().GetStringArray("path")
+	hwids, _ := cmd.Flags().GetStringArray("hardware-id")
+	terminating, _ := cmd.Flags().GetBool("terminating")
+
+	if !tufDelegationNameRe.MatchString(name) {
+		subcommands.DieNotNil(subcommands.ValidationError("Invalid role name: %s", name))
+	}
+	switch strings.ToLower(name) {
+	case "root", "targets", "snapshot", "timestamp":
+		subcommands.DieNotNil(subcommands.ValidationError("The role name is reserved by TUF: %s", name))
+	}
+	for _, hwid := range hwids {
+		// Targets are named after the hardware ID they are built for, e.g. intel-corei7-64-lmp-42
+		paths = append(paths, hwid+"-lmp-*")
+	}
+	if len(paths) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("At least one --path or --hardware-id is required"))
+	}
+
+	var creds OfflineCreds
+	var err error
+	if _, statErr := os.Stat(keysFile); errors.Is(statErr, os.ErrNotExist) {
+		fmt.Println("= Creating new offline TUF keys:", keysFile)
+		creds = make(OfflineCreds)
+	} else {
+		creds, err = GetOfflineCreds(keysFile)
+		subcommands.DieNotNil(err)
+		subcommands.AssertWritable(keysFile)
+	}
+
+	delegations, err := api.TufDelegationsGet(factory)
+	subcommands.DieNotNil(err)
+	for _, role := range delegations.Roles {
+		if role.Name == name {
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict,
+				fmt.Errorf("The delegated role %s already exists", name)))
+		}
+	}
+
+	kp := genTufKeyPair(keyType)
+	if delegations.Keys == nil {
+		delegations.Keys = make(map[string]client.AtsKey)
+	}
+	delegations.Keys[kp.signer.Id] = kp.atsPub
+	delegations.Roles = append(delegations.Roles, client.TufDelegation{
+		Name:        name,
+		KeyIDs:      []string{kp.signer.Id},
+		Paths:       paths,
+		Threshold:   1,
+		Terminating: terminating,
+	})
+	saveTufKeyPair(creds, "tufrepo/keys/fioctl-delegation-"+name+"-"+kp.signer.Id, kp)
+	fmt.Printf("= New key of the delegated role %s: %s\n", name, kp.signer.Id)
+
+	fmt.Println("= Uploading new TUF delegations")
+	saveTempTufCreds(keysFile, creds)
+	err = api.TufDelegationsPut(factory, *delegations)
+	handleTufRootUpdatesUpload(cmd, err, keysFile)
+}
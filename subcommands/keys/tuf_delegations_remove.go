@@ -0,0 +1,63 @@
+package keys
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	removeCmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a delegated TUF targets role",
+		Long: `Remove a delegated TUF targets role.
+
+The keys of the role are removed from the delegations unless another role uses them.
+Targets signed by the role are no longer trusted by devices once the CI targets metadata is updated.`,
+		Run:  doTufDelegationsRemove,
+		Args: cobra.ExactArgs(1),
+	}
+	tufDelegationsCmd.AddCommand(removeCmd)
+}
+
+func doTufDelegationsRemove(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	name := args[0]
+
+	delegations, err := api.TufDelegationsGet(factory)
+	subcommands.DieNotNil(err)
+
+	found := false
+	roles := delegations.Roles[:0]
+	for _, role := range delegations.Roles {
+		if role.Name == name {
+			found = true
+		} else {
+			roles = append(roles, role)
+		}
+	}
+	if !found {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("The delegated role %s does not exist", name)))
+	}
+	delegations.Roles = roles
+
+	inuse := make(map[string]bool)
+	for _, role := range delegations.Roles {
+		for _, kid := range role.KeyIDs {
+			inuse[kid] = true
+		}
+	}
+	for kid := range delegations.Keys {
+		if !inuse[kid] {
+			fmt.Println("= Removing unused key:", kid)
+			delete(delegations.Keys, kid)
+		}
+	}
+
+	fmt.Println("= Uploading new TUF delegations")
+	subcommands.DieNotNil(api.TufDelegationsPut(factory, *delegations))
+}
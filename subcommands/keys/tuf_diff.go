@@ -0,0 +1,180 @@
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	diffCmd := &cobra.Command{
+		Use:   "diff [--from=<version>] [--to=<version>] [--prod]",
+		Short: "Show the changes between two versions of the TUF root",
+		Long: `Show the changes between two versions of the factory's TUF root metadata in a human-readable form:
+the keys added and removed, the changes of the roles, their keys and thresholds, and of the expiry date.
+
+By default, the latest version is compared to the version before it.`,
+		Example: `
+  # Show what the latest root key rotation changed:
+  fioctl keys tuf diff
+  # Show the changes between the production root versions 5 and 6:
+  fioctl keys tuf diff --from 5 --to 6 --prod`,
+		Run:  doTufDiff,
+		Args: cobra.NoArgs,
+	}
+	diffCmd.Flags().Int("from", 0, "Version of the root to compare from (default: the version before --to)")
+	diffCmd.Flags().Int("to", 0, "Version of the root to compare to (default: the latest version)")
+	diffCmd.Flags().Bool("prod", false, "Compare versions of the production root")
+	tufCmd.AddCommand(diffCmd)
+}
+
+func getTufRootVersion(factory string, prod bool, version int) *client.AtsTufRoot {
+	raw, err := api.TufRootGetRaw(factory, prod, version)
+	subcommands.DieNotNil(err)
+	var root client.AtsTufRoot
+	subcommands.DieNotNil(json.Unmarshal(*raw, &root), "Invalid root metadata:")
+	return &root
+}
+
+func doTufDiff(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	from, _ := cmd.Flags().GetInt("from")
+	to, _ := cmd.Flags().GetInt("to")
+	prod, _ := cmd.Flags().GetBool("prod")
+
+	if to < 0 || from < 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("Versions must be positive numbers"))
+	}
+	var toRoot *client.AtsTufRoot
+	if to == 0 {
+		toRoot = getTufRootVersion(factory, prod, -1)
+		to = toRoot.Signed.Version
+	} else {
+		toRoot = getTufRootVersion(factory, prod, to)
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 {
+		subcommands.DieNotNil(subcommands.ValidationError("There is no root version before version %d", to))
+	} else if from == to {
+		subcommands.DieNotNil(subcommands.ValidationError("The versions to compare must differ"))
+	}
+	fromRoot := getTufRootVersion(factory, prod, from)
+
+	kind := "CI"
+	if prod {
+		kind = "production"
+	}
+	fmt.Printf("Changes of the %s TUF root from version %d to %d:\n", kind, from, to)
+	changes := diffTufRoots(fromRoot, toRoot)
+	if len(changes) == 0 {
+		fmt.Println("  No changes besides the version")
+	}
+	for _, line := range changes {
+		switch line[0] {
+		case '+':
+			color.Green("  " + line)
+		case '-':
+			color.Red("  " + line)
+		default:
+			fmt.Println("  " + line)
+		}
+	}
+	if reason := toRoot.Signed.Reason; reason != nil && len(reason.Message) > 0 {
+		fmt.Printf("\nChangelog of version %d: %s (%s)\n", to, reason.Message, subcommands.FormatTimestamp(reason.Timestamp))
+	}
+}
+
+// describeTufKey returns a short description of a TUF key, e.g. "ED25519 256 bits".
+func describeTufKey(key client.AtsKey) string {
+	if bits := tufKeyBits(key); bits > 0 {
+		return fmt.Sprintf("%s %d bits", key.KeyType, bits)
+	}
+	return key.KeyType
+}
+
+// diffTufRoots returns the changes between two roots, one per line. Lines of added items start with a "+",
+// and lines of removed items with a "-".
+func diffTufRoots(from, to *client.AtsTufRoot) []string {
+	var changes []string
+	if !from.Signed.Expires.Equal(to.Signed.Expires) {
+		changes = append(changes, fmt.Sprintf("expires: %s -> %s",
+			subcommands.FormatTimestamp(from.Signed.Expires), subcommands.FormatTimestamp(to.Signed.Expires)))
+	}
+	if from.Signed.Consistent != to.Signed.Consistent {
+		changes = append(changes, fmt.Sprintf("consistent_snapshot: %v -> %v", from.Signed.Consistent, to.Signed.Consistent))
+	}
+
+	for _, id := range sortedKeys(to.Signed.Keys) {
+		if _, ok := from.Signed.Keys[id]; !ok {
+			changes = append(changes, fmt.Sprintf("+ key %s (%s)", id, describeTufKey(to.Signed.Keys[id])))
+		}
+	}
+	for _, id := range sortedKeys(from.Signed.Keys) {
+		if _, ok := to.Signed.Keys[id]; !ok {
+			changes = append(changes, fmt.Sprintf("- key %s (%s)", id, describeTufKey(from.Signed.Keys[id])))
+		}
+	}
+
+	roles := make(map[tuf.RoleName]bool)
+	for role := range from.Signed.Roles {
+		roles[role] = true
+	}
+	for role := range to.Signed.Roles {
+		roles[role] = true
+	}
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, string(role))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return tufAuditKeyOrder(names[i:i+1]) < tufAuditKeyOrder(names[j:j+1]) ||
+			tufAuditKeyOrder(names[i:i+1]) == tufAuditKeyOrder(names[j:j+1]) && names[i] < names[j]
+	})
+	for _, name := range names {
+		before, after := from.Signed.Roles[tuf.RoleName(name)], to.Signed.Roles[tuf.RoleName(name)]
+		if before == nil {
+			changes = append(changes, fmt.Sprintf("+ role %s: threshold %d of keys %s",
+				name, after.Threshold, strings.Join(after.KeyIDs, ", ")))
+			continue
+		} else if after == nil {
+			changes = append(changes, fmt.Sprintf("- role %s: threshold %d of keys %s",
+				name, before.Threshold, strings.Join(before.KeyIDs, ", ")))
+			continue
+		}
+		if before.Threshold != after.Threshold {
+			changes = append(changes, fmt.Sprintf("%s: threshold %d -> %d", name, before.Threshold, after.Threshold))
+		}
+		for _, id := range after.KeyIDs {
+			if !slices.Contains(before.KeyIDs, id) {
+				changes = append(changes, fmt.Sprintf("+ %s key %s", name, id))
+			}
+		}
+		for _, id := range before.KeyIDs {
+			if !slices.Contains(after.KeyIDs, id) {
+				changes = append(changes, fmt.Sprintf("- %s key %s", name, id))
+			}
+		}
+	}
+	return changes
+}
+
+func sortedKeys(keys map[string]client.AtsKey) []string {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
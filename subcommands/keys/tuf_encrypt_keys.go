@@ -0,0 +1,294 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const passphraseHelperHelp = `Passphrases are asked for on the terminal. Alternatively, set a passphrase helper in the
+FIOCTL_PASSPHRASE_HELPER environment variable or the "passphrase-helper" option of the config file.
+It is a command which is run with a key ID as its last argument, and prints the passphrase of that key,
+e.g. "pass show fioctl/tuf" or a script reading a password manager. Without a passphrase helper,
+the passphrases stored in the OS keychain with "fioctl keys tuf keychain set-passphrase" are used.`
+
+func init() {
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt-keys --keys=<tuf-root-keys.tgz>",
+		Short: "Protect the private keys in an offline TUF keys archive with passphrases",
+		Long: `Encrypt each private key in an offline TUF keys archive with its own passphrase, so that
+the keys remain protected even if the archive leaks. Keys are stored as encrypted PKCS#8 (PBES2 with
+AES-256-CBC), which can also be decrypted with openssl. Keys which are already encrypted are kept.
+
+Commands signing with the keys ask for the passphrases of the keys they need.
+Keys generated by a key rotation are not encrypted; run this command again after the rotation.
+
+` + passphraseHelperHelp,
+		Run:  doEncryptKeys,
+		Args: cobra.NoArgs,
+	}
+	encryptCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to encrypt.")
+	encryptCmd.Flags().StringP("out", "o", "", "Path to save the encrypted archive to (default: replace the archive)")
+	encryptCmd.Flags().BoolP("same-passphrase", "", false, "Use the same passphrase for all keys")
+	encryptCmd.Flags().Bool("keychain", false, "Also store the passphrases in the OS keychain, so that they are not asked for again")
+	_ = encryptCmd.MarkFlagFilename("keys")
+	_ = encryptCmd.MarkFlagRequired("keys")
+	tufCmd.AddCommand(offline(encryptCmd))
+
+	decryptCmd := &cobra.Command{
+		Use:   "decrypt-keys --keys=<tuf-root-keys.tgz>",
+		Short: "Remove the passphrases from the private keys in an offline TUF keys archive",
+		Long: `Decrypt the private keys in an offline TUF keys archive, e.g. to use the archive with an older fioctl.
+
+` + passphraseHelperHelp,
+		Run:  doDecryptKeys,
+		Args: cobra.NoArgs,
+	}
+	decryptCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to decrypt.")
+	decryptCmd.Flags().StringP("out", "o", "", "Path to save the decrypted archive to (default: replace the archive)")
+	_ = decryptCmd.MarkFlagFilename("keys")
+	_ = decryptCmd.MarkFlagRequired("keys")
+	tufCmd.AddCommand(offline(decryptCmd))
+}
+
+var tufKeyPassphrases = make(map[string][]byte)
+
+// tufKeyPassphrase returns the passphrase of a key from the passphrase helper or the OS keychain, or asks the user.
+// Passphrases are remembered for the life of the command, so that each one is only asked once.
+func tufKeyPassphrase(keyid string) ([]byte, error) {
+	if passphrase, ok := tufKeyPassphrases[keyid]; ok {
+		return passphrase, nil
+	}
+	var passphrase []byte
+	if len(tufPassphraseHelper()) == 0 {
+		passphrase = tufKeychainPassphrase(keyid)
+	}
+	if passphrase == nil {
+		var err error
+		if passphrase, err = askTufKeyPassphrase(keyid); err != nil {
+			return nil, err
+		}
+	}
+	tufKeyPassphrases[keyid] = passphrase
+	return passphrase, nil
+}
+
+func tufPassphraseHelper() string {
+	if helper := os.Getenv("FIOCTL_PASSPHRASE_HELPER"); len(helper) > 0 {
+		return helper
+	}
+	return viper.GetString("passphrase-helper")
+}
+
+// askTufKeyPassphrase returns the passphrase of a key from the passphrase helper, or asks the user.
+func askTufKeyPassphrase(keyid string) ([]byte, error) {
+	var passphrase []byte
+	if helper := tufPassphraseHelper(); len(helper) > 0 {
+		args := append(strings.Fields(helper), keyid)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("Passphrase helper failed: %w", err)
+		}
+		passphrase = bytes.TrimRight(out, "\r\n")
+	} else {
+		answer, err := subcommands.PromptSecret("Passphrase of the TUF key " + keyid)
+		if err != nil {
+			return nil, fmt.Errorf("%w. Set FIOCTL_PASSPHRASE_HELPER to provide passphrases, "+
+				"or store them in the OS keychain with \"fioctl keys tuf keychain set-passphrase\"", err)
+		}
+		passphrase = []byte(answer)
+	}
+	return passphrase, nil
+}
+
+// tufPublicKeyId returns the ID of a TUF public key, the same way GenTufKeyId does for a private key.
+func tufPublicKeyId(key client.AtsKey) (string, error) {
+	pub, err := parseTufPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
+
+func parseTufPublicKey(key client.AtsKey) (crypto.PublicKey, error) {
+	switch strings.ToUpper(key.KeyType) {
+	case client.TufKeyTypeNameEd25519:
+		raw, err := hex.DecodeString(key.KeyValue.Public)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("Invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(raw), nil
+	case client.TufKeyTypeNameRSA, client.TufKeyTypeNameEcdsaP256:
+		block, _ := pem.Decode([]byte(key.KeyValue.Public))
+		if block == nil {
+			return nil, fmt.Errorf("Invalid %s public key", key.KeyType)
+		}
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("Unsupported key type: %s", key.KeyType)
+}
+
+// tufCredsPrivateKeys returns the names of the private keys in the creds, with the IDs of their public keys.
+func tufCredsPrivateKeys(creds OfflineCreds) (names []string, ids map[string]string) {
+	ids = make(map[string]string)
+	for name := range creds {
+		if !strings.HasSuffix(name, ".sec") {
+			continue
+		}
+		var pub client.AtsKey
+		pubName := strings.TrimSuffix(name, ".sec") + ".pub"
+		subcommands.DieNotNil(json.Unmarshal(creds[pubName], &pub), "Unable to parse JSON for "+pubName+":")
+		id, err := tufPublicKeyId(pub)
+		subcommands.DieNotNil(err, pubName+":")
+		names = append(names, name)
+		ids[name] = id
+	}
+	sort.Strings(names)
+	return
+}
+
+func saveConvertedCreds(cmd *cobra.Command, credsFile string, creds OfflineCreds) {
+	out, _ := cmd.Flags().GetString("out")
+	if len(out) > 0 {
+		subcommands.DieNotNil(client.SaveOfflineCredsCopy(out, credsFile, creds))
+		fmt.Println("Saved the keys to", out)
+		return
+	}
+	tmp := saveTempTufCreds(credsFile, creds)
+	subcommands.DieNotNil(os.Rename(tmp, credsFile))
+	fmt.Println("Saved the keys to", credsFile)
+}
+
+func doEncryptKeys(cmd *cobra.Command, args []string) {
+	credsFile, _ := cmd.Flags().GetString("keys")
+	samePassphrase, _ := cmd.Flags().GetBool("same-passphrase")
+	useKeychain, _ := cmd.Flags().GetBool("keychain")
+	creds, err := GetOfflineCreds(credsFile)
+	subcommands.DieNotNil(err)
+
+	var shared []byte
+	names, ids := tufCredsPrivateKeys(creds)
+	passphrases := make(map[string][]byte)
+	for _, name := range names {
+		var key client.AtsKey
+		subcommands.DieNotNil(json.Unmarshal(creds[name], &key), "Unable to parse JSON for "+name+":")
+		if client.IsEncryptedTufKey(key.KeyValue.Private) {
+			fmt.Println("Already encrypted:", name)
+			continue
+		}
+		pk, err := ParseTufKeyType(key.KeyType).ParseKey(key.KeyValue.Private)
+		subcommands.DieNotNil(err, name+":")
+
+		passphrase := shared
+		if passphrase == nil {
+			passphrase = newTufKeyPassphrase(ids[name], name)
+			if samePassphrase {
+				shared = passphrase
+			}
+		}
+		key.KeyValue.Private, err = client.EncryptTufKey(pk, passphrase)
+		subcommands.DieNotNil(err)
+		creds[name], err = json.Marshal(key)
+		subcommands.DieNotNil(err)
+		fmt.Println("Encrypted:", name)
+		passphrases[ids[name]] = passphrase
+	}
+	if len(passphrases) == 0 {
+		fmt.Println("There are no keys to encrypt in", credsFile)
+		return
+	}
+	saveConvertedCreds(cmd, credsFile, creds)
+
+	if useKeychain {
+		// Only once the keys are saved, so that the keychain never has the passphrase of a key which is not encrypted
+		keyids := make([]string, 0, len(passphrases))
+		for keyid := range passphrases {
+			keyids = append(keyids, keyid)
+		}
+		sort.Strings(keyids)
+		for _, keyid := range keyids {
+			subcommands.DieNotNil(keyring.Set(tufKeychainPassphraseService, keyid, string(passphrases[keyid])),
+				"Unable to store the passphrase in the OS keychain:")
+			fmt.Println("Stored the passphrase of the key", keyid, "in the OS keychain")
+		}
+	}
+}
+
+// newTufKeyPassphrase returns a new passphrase for a key, asking for it twice to catch typos.
+func newTufKeyPassphrase(keyid, name string) []byte {
+	if len(tufPassphraseHelper()) > 0 {
+		passphrase, err := tufKeyPassphrase(keyid)
+		subcommands.DieNotNil(err)
+		return passphrase
+	}
+	for {
+		fmt.Println("Key", name)
+		first, err := subcommands.PromptSecret("New passphrase of the TUF key " + keyid)
+		subcommands.DieNotNil(err, "Set FIOCTL_PASSPHRASE_HELPER to provide passphrases:")
+		if len(first) == 0 {
+			fmt.Println("The passphrase can not be empty")
+			continue
+		}
+		second, err := subcommands.PromptSecret("Repeat the passphrase")
+		subcommands.DieNotNil(err)
+		if first == second {
+			return []byte(first)
+		}
+		fmt.Println("The passphrases do not match, please try again")
+	}
+}
+
+func doDecryptKeys(cmd *cobra.Command, args []string) {
+	credsFile, _ := cmd.Flags().GetString("keys")
+	creds, err := GetOfflineCreds(credsFile)
+	subcommands.DieNotNil(err)
+
+	names, ids := tufCredsPrivateKeys(creds)
+	decrypted := 0
+	for _, name := range names {
+		var key client.AtsKey
+		subcommands.DieNotNil(json.Unmarshal(creds[name], &key), "Unable to parse JSON for "+name+":")
+		if !client.IsEncryptedTufKey(key.KeyValue.Private) {
+			continue
+		}
+		passphrase, err := tufKeyPassphrase(ids[name])
+		subcommands.DieNotNil(err)
+		pk, err := client.DecryptTufKey(key.KeyValue.Private, passphrase)
+		subcommands.DieNotNil(err, name+":")
+		key.KeyValue.Private, _, err = ParseTufKeyType(key.KeyType).SaveKeyPair(pk)
+		subcommands.DieNotNil(err)
+		creds[name], err = json.Marshal(key)
+		subcommands.DieNotNil(err)
+		fmt.Println("Decrypted:", name)
+		decrypted += 1
+	}
+	if decrypted == 0 {
+		fmt.Println("There are no encrypted keys in", credsFile)
+		return
+	}
+	saveConvertedCreds(cmd, credsFile, creds)
+}
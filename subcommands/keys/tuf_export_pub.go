@@ -0,0 +1,182 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	exportCmd := &cobra.Command{
+		Use:   "export-pub --key-id=<id> [--format=pem|ssh|jwk]",
+		Short: "Export a TUF public key in a standard format",
+		Long: `Export a public key of the factory's TUF root metadata in a standard format, so that it can be fed
+to external verification tooling and hardware provisioning scripts:
+
+- pem: a PKIX "PUBLIC KEY" PEM block, as read by OpenSSL.
+- ssh: a line of the OpenSSH authorized_keys format.
+- jwk: a JSON Web Key, with the TUF key ID as its "kid".
+
+The key is looked up in the CI and production TUF roots, and the key ID may be shortened to any unique prefix.
+With --keys, the key is looked up in the offline TUF keys instead, which does not need access to the server.`,
+		Example: `
+  # Export the root key as a PEM file:
+  fioctl keys tuf export-pub --key-id 4f1c7a --format pem --out root.pem
+  # Export a key of an offline TUF keys archive on an air-gapped machine:
+  fioctl keys tuf export-pub --keys tuf-root-keys.tgz --key-id 4f1c7a --format jwk`,
+		Run:  doTufExportPub,
+		Args: cobra.NoArgs,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if keysFile, _ := cmd.Flags().GetString("keys"); len(keysFile) == 0 {
+				api = subcommands.Login(cmd)
+			}
+		},
+	}
+	exportCmd.Flags().String("key-id", "", "ID, or a unique prefix of the ID, of the key to export")
+	_ = exportCmd.MarkFlagRequired("key-id")
+	exportCmd.Flags().String("format", "pem", "Output format: pem, ssh, or jwk")
+	exportCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to look the key up in.")
+	_ = exportCmd.MarkFlagFilename("keys")
+	exportCmd.Flags().StringP("out", "o", "", "File to write the key to (default: standard output)")
+	_ = exportCmd.MarkFlagFilename("out")
+	tufCmd.AddCommand(exportCmd)
+}
+
+func doTufExportPub(cmd *cobra.Command, args []string) {
+	keyId, _ := cmd.Flags().GetString("key-id")
+	format, _ := cmd.Flags().GetString("format")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	out, _ := cmd.Flags().GetString("out")
+
+	format = strings.ToLower(format)
+	if format != "pem" && format != "ssh" && format != "jwk" {
+		subcommands.DieNotNil(subcommands.ValidationError("Unsupported format: %s. Supported: pem, ssh, jwk", format))
+	}
+
+	keys := make(map[string]client.AtsKey)
+	if len(keysFile) > 0 {
+		creds, err := GetOfflineCreds(keysFile)
+		subcommands.DieNotNil(err)
+		for base, id := range credsKeyIds(keysFile, creds) {
+			var pub client.AtsKey
+			subcommands.DieNotNil(json.Unmarshal(creds[base+".pub"], &pub))
+			keys[id] = pub
+		}
+	} else {
+		factory := viper.GetString("factory")
+		ciRoot, err := api.TufRootGet(factory)
+		subcommands.DieNotNil(err)
+		prodRoot, err := api.TufProdRootGet(factory)
+		subcommands.DieNotNil(err)
+		for _, root := range []*client.AtsTufRoot{ciRoot, prodRoot} {
+			for id, key := range root.Signed.Keys {
+				keys[id] = key
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	keyId = matchTufKeyId(keyId, ids)
+
+	pub, err := parseTufPublicKey(keys[keyId])
+	subcommands.DieNotNil(err)
+	var exported []byte
+	switch format {
+	case "pem":
+		exported, err = exportTufPublicKeyPem(pub)
+	case "ssh":
+		exported, err = exportTufPublicKeySsh(pub, keyId)
+	case "jwk":
+		exported, err = exportTufPublicKeyJwk(pub, keyId)
+	}
+	subcommands.DieNotNil(err)
+
+	if len(out) > 0 {
+		subcommands.DieNotNil(os.WriteFile(out, exported, 0644))
+	} else {
+		os.Stdout.Write(exported)
+	}
+}
+
+func exportTufPublicKeyPem(pub interface{}) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func exportTufPublicKeySsh(pub interface{}, keyId string) ([]byte, error) {
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	// MarshalAuthorizedKey ends the line with a newline, which goes after the comment
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))
+	return []byte(fmt.Sprintf("%s tuf-%s\n", line, keyId)), nil
+}
+
+// exportTufPublicKeyJwk returns a JSON Web Key (RFC 7517), with the algorithm TUF signs with for the key type.
+func exportTufPublicKeyJwk(pub interface{}, keyId string) ([]byte, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := map[string]string{"kid": keyId, "use": "sig"}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		jwk["kty"], jwk["crv"], jwk["alg"] = "OKP", "Ed25519", "EdDSA"
+		jwk["x"] = b64(k)
+	case *rsa.PublicKey:
+		jwk["kty"], jwk["alg"] = "RSA", "PS256"
+		jwk["n"] = b64(k.N.Bytes())
+		jwk["e"] = b64(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk["kty"], jwk["crv"], jwk["alg"] = "EC", "P-256", "ES256"
+		jwk["x"] = b64(k.X.FillBytes(make([]byte, size)))
+		jwk["y"] = b64(k.Y.FillBytes(make([]byte, size)))
+	default:
+		return nil, fmt.Errorf("Unsupported public key type: %T", pub)
+	}
+	buf, err := json.MarshalIndent(jwk, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, '\n'), nil
+}
+
+// matchTufKeyId returns the key ID which starts with the given prefix, and dies unless there is exactly one.
+func matchTufKeyId(prefix string, ids []string) string {
+	var matches []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
+		}
+	}
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("Key not found: %s", prefix)))
+	} else if len(matches) > 1 {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The key ID prefix %s is ambiguous, it matches: %s", prefix, strings.Join(matches, ", ")))
+	}
+	return matches[0]
+}
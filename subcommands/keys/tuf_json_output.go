@@ -0,0 +1,172 @@
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// tufCommandResult is a summary of the changes made by a command to the TUF keys and roots,
+// printed with --output=json, and recorded in the key ceremony transcript with --transcript.
+// It is collected by the functions doing these changes, so that the shortcut commands chaining several
+// "tuf updates" subcommands print a single summary.
+type tufCommandResult struct {
+	Factory      string          `json:"factory"`
+	Txid         string          `json:"txid,omitempty"`
+	DryRun       bool            `json:"dry-run,omitempty"`
+	NewKeys      []tufResultKey  `json:"new-keys,omitempty"`
+	RemovedKeys  []tufResultKey  `json:"removed-keys,omitempty"`
+	CiRoot       *tufResultRoot  `json:"ci-root,omitempty"`
+	ProdRoot     *tufResultRoot  `json:"prod-root,omitempty"`
+	SignedBy     []string        `json:"signed-by,omitempty"`
+	ResignedTags []string        `json:"resigned-tags,omitempty"`
+	KeysFiles    []string        `json:"keys-files,omitempty"`
+	Applied      bool            `json:"applied,omitempty"`
+	seen         map[string]bool // Avoids duplicates when several subcommands report the same change
+}
+
+type tufResultKey struct {
+	Role    string `json:"role"`
+	Id      string `json:"keyid"`
+	KeyType string `json:"key-type,omitempty"`
+	Online  bool   `json:"online,omitempty"`
+}
+
+type tufResultRoot struct {
+	Version int       `json:"version"`
+	Expires time.Time `json:"expires"`
+	Sha256  string    `json:"sha256"`
+}
+
+// tufResult is only set while a command is run with --output=json or --transcript; all its methods do nothing otherwise.
+var tufResult *tufCommandResult
+
+// tufProgress is where the commands changing the TUF keys or roots print their progress messages:
+// STDOUT, or STDERR while the summary of changes is printed as JSON to STDOUT.
+var tufProgress io.Writer = os.Stdout
+
+// addTufResultFlags adds the --output and --transcript flags to a command changing the TUF keys or roots.
+// With --output=json, the progress messages are printed to STDERR, and the summary of changes to STDOUT.
+// With --transcript, the summary of changes is appended to a key ceremony transcript, even if the command fails.
+// It must be called once the command's Run function is set.
+func addTufResultFlags(cmd *cobra.Command) {
+	var format string
+	subcommands.AddOutputFlag(cmd, &format,
+		"Output format, supported: text, json. With json, a summary of the changes is printed to STDOUT, "+
+			"and progress messages to STDERR")
+	addTufTranscriptFlags(cmd)
+	run := cmd.Run
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if format != subcommands.OutputFormatText && format != subcommands.OutputFormatJson {
+			subcommands.DieNotNil(subcommands.ValidationError("Unsupported output format: %s", format))
+		}
+		asJson := format == subcommands.OutputFormatJson
+		transcriptFile, _ := cmd.Flags().GetString("transcript")
+		if (!asJson && len(transcriptFile) == 0) || tufResult != nil {
+			run(cmd, args)
+			return
+		}
+		var transcript *tufTranscript
+		if len(transcriptFile) > 0 {
+			keyFile, _ := cmd.Flags().GetString("transcript-key")
+			transcript = openTufTranscript(transcriptFile, keyFile)
+		}
+		result := &tufCommandResult{Factory: viper.GetString("factory"), seen: make(map[string]bool)}
+		tufResult = result
+		if transcript != nil {
+			subcommands.AddLastWill(func() {
+				// Only if this command failed, and not one run after it, e.g. by the wizard
+				if tufResult == result {
+					if err := transcript.append(cmd, result, "failed"); err != nil {
+						fmt.Fprintln(os.Stderr, "ERROR: Unable to append to the transcript:", err)
+					}
+				}
+			})
+		}
+		if asJson {
+			tufProgress = os.Stderr
+		}
+		run(cmd, args)
+		tufProgress = os.Stdout
+
+		sort.Strings(tufResult.ResignedTags)
+		if transcript != nil {
+			subcommands.DieNotNil(transcript.append(cmd, tufResult, "ok"), "Unable to append to the transcript:")
+		}
+		if asJson {
+			printTufResult(cmd.OutOrStdout(), tufResult)
+		}
+		tufResult = nil
+	}
+}
+
+// printTufResult prints the summary of changes as JSON.
+func printTufResult(out io.Writer, result *tufCommandResult) {
+	buf, err := json.MarshalIndent(result, "", "  ")
+	subcommands.DieNotNil(err)
+	fmt.Fprintln(out, string(buf))
+}
+
+func (r *tufCommandResult) setTxid(txid string) {
+	if r != nil && len(txid) > 0 {
+		r.Txid = txid
+	}
+}
+
+func (r *tufCommandResult) addNewKey(role, id, keyType string, online bool) {
+	if r != nil {
+		r.NewKeys = append(r.NewKeys, tufResultKey{Role: role, Id: id, KeyType: keyType, Online: online})
+	}
+}
+
+func (r *tufCommandResult) addRemovedKey(role, id string) {
+	if r != nil {
+		r.RemovedKeys = append(r.RemovedKeys, tufResultKey{Role: role, Id: id})
+	}
+}
+
+// setRoots records the new TUF roots staged, or to be staged in a dry run.
+func (r *tufCommandResult) setRoots(dryRun bool, ciRoot, prodRoot *client.AtsTufRoot) {
+	if r == nil {
+		return
+	}
+	r.DryRun = r.DryRun || dryRun
+	r.CiRoot = &tufResultRoot{ciRoot.Signed.Version, ciRoot.Signed.Expires, tufRootChecksum(ciRoot)}
+	r.ProdRoot = &tufResultRoot{prodRoot.Signed.Version, prodRoot.Signed.Expires, tufRootChecksum(prodRoot)}
+}
+
+func (r *tufCommandResult) addSigner(id string) {
+	if r != nil && !r.seen["signer:"+id] {
+		r.seen["signer:"+id] = true
+		r.SignedBy = append(r.SignedBy, id)
+	}
+}
+
+func (r *tufCommandResult) addResignedTag(tag string) {
+	if r != nil && !r.seen["tag:"+tag] {
+		r.seen["tag:"+tag] = true
+		r.ResignedTags = append(r.ResignedTags, tag)
+	}
+}
+
+func (r *tufCommandResult) addKeysFile(file string) {
+	if r != nil && !r.seen["file:"+file] {
+		r.seen["file:"+file] = true
+		r.KeysFiles = append(r.KeysFiles, file)
+	}
+}
+
+func (r *tufCommandResult) setApplied() {
+	if r != nil {
+		r.Applied = true
+	}
+}
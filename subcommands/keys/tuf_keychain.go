@@ -0,0 +1,228 @@
+package keys
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// The OS keychain entries of the TUF keys: the passphrases of the encrypted keys of offline TUF keys archives
+// by key IDs, and small PEM keys, e.g. the key signing a key ceremony transcript, by names.
+const (
+	tufKeychainPassphraseService = "fioctl-tuf-passphrase"
+	tufKeychainKeyService        = "fioctl-tuf-key"
+	// tufKeychainKeyPrefix is put before the name of a PEM key in the OS keychain, where a PEM file is expected.
+	tufKeychainKeyPrefix = "keychain:"
+)
+
+var tufKeychainCmd = &cobra.Command{
+	Use:   "keychain",
+	Short: "Store TUF key passphrases and small keys in the OS keychain",
+	Long: `These sub-commands store secrets of the TUF keys in the OS keychain: the macOS Keychain,
+the Windows Credential Manager, or the Secret Service on Linux, e.g. GNOME Keyring or KWallet.
+
+- The passphrases of the encrypted keys of an offline TUF keys archive, so that commands signing
+  with them do not ask for them every time. A passphrase helper, if set, is used instead.
+- Small PEM keys, e.g. the key signing a key ceremony transcript. A key stored under a name is used
+  by passing keychain:<name> instead of the path of a PEM file, e.g. --transcript-key=keychain:ceremony.
+  The Windows Credential Manager only holds about 2.5 KB, which is too little for large RSA keys.
+
+The keychain can not be listed by fioctl; use the keychain tools of the OS to review the entries,
+which are stored under the "` + tufKeychainPassphraseService + `" and "` + tufKeychainKeyService + `" services.`,
+}
+
+func init() {
+	setPassphraseCmd := &cobra.Command{
+		Use:   "set-passphrase --keys=<tuf-root-keys.tgz> [--key-id=<id>]",
+		Short: "Store the passphrases of the encrypted keys of an offline TUF keys archive in the OS keychain",
+		Long: `Store the passphrases of the encrypted keys of an offline TUF keys archive in the OS keychain.
+Each passphrase is checked by decrypting its key before it is stored.
+
+` + passphraseHelperHelp,
+		Example: `
+  # Store the passphrases of all encrypted keys of an archive:
+  fioctl keys tuf keychain set-passphrase --keys=tuf-root-keys.tgz
+  # Store the passphrase of one key:
+  fioctl keys tuf keychain set-passphrase --keys=tuf-root-keys.tgz --key-id=4f1c7a`,
+		Run:  doTufKeychainSetPassphrase,
+		Args: cobra.NoArgs,
+	}
+	setPassphraseCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> holding the encrypted keys.")
+	_ = setPassphraseCmd.MarkFlagFilename("keys")
+	_ = setPassphraseCmd.MarkFlagRequired("keys")
+	setPassphraseCmd.Flags().String("key-id", "",
+		"ID, or a unique prefix of the ID, of the key to store the passphrase of (default: all encrypted keys).")
+	tufKeychainCmd.AddCommand(offline(setPassphraseCmd))
+
+	deletePassphraseCmd := &cobra.Command{
+		Use:   "delete-passphrase --key-id=<id> [--keys=<tuf-root-keys.tgz>]",
+		Short: "Remove the passphrase of a TUF key from the OS keychain",
+		Run:   doTufKeychainDeletePassphrase,
+		Args:  cobra.NoArgs,
+	}
+	deletePassphraseCmd.Flags().String("key-id", "",
+		"ID of the key to remove the passphrase of. With --keys, a unique prefix of the ID is enough.")
+	_ = deletePassphraseCmd.MarkFlagRequired("key-id")
+	deletePassphraseCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to look the key ID up in.")
+	_ = deletePassphraseCmd.MarkFlagFilename("keys")
+	tufKeychainCmd.AddCommand(offline(deletePassphraseCmd))
+
+	setKeyCmd := &cobra.Command{
+		Use:   "set-key <name> <key.pem>",
+		Short: "Store a PEM key in the OS keychain",
+		Long: `Store a PEM key in the OS keychain under a name, so that it can be used by passing
+keychain:<name> instead of the path of a PEM file. A key with the same name is replaced.
+The PEM file is not removed; remove it once the key is stored, if it has no other use.`,
+		Example: `
+  # Keep the key signing the key ceremony transcript in the keychain:
+  fioctl keys tuf keychain set-key ceremony operator.key.pem
+  fioctl keys tuf updates sign --keys=tuf-root-keys.tgz --transcript=ceremony.jsonl --transcript-key=keychain:ceremony`,
+		Run:  doTufKeychainSetKey,
+		Args: cobra.ExactArgs(2),
+	}
+	tufKeychainCmd.AddCommand(offline(setKeyCmd))
+
+	deleteKeyCmd := &cobra.Command{
+		Use:   "delete-key <name>",
+		Short: "Remove a PEM key from the OS keychain",
+		Run:   doTufKeychainDeleteKey,
+		Args:  cobra.ExactArgs(1),
+	}
+	tufKeychainCmd.AddCommand(offline(deleteKeyCmd))
+
+	tufCmd.AddCommand(tufKeychainCmd)
+}
+
+func doTufKeychainSetPassphrase(cmd *cobra.Command, args []string) {
+	credsFile, _ := cmd.Flags().GetString("keys")
+	prefix, _ := cmd.Flags().GetString("key-id")
+	creds, err := GetOfflineCreds(credsFile)
+	subcommands.DieNotNil(err)
+
+	names, ids := tufCredsPrivateKeys(creds)
+	var encrypted []string
+	var encryptedIds []string
+	keys := make(map[string]client.AtsKey)
+	for _, name := range names {
+		var key client.AtsKey
+		subcommands.DieNotNil(json.Unmarshal(creds[name], &key), "Unable to parse JSON for "+name+":")
+		if client.IsEncryptedTufKey(key.KeyValue.Private) {
+			encrypted = append(encrypted, name)
+			encryptedIds = append(encryptedIds, ids[name])
+			keys[name] = key
+		}
+	}
+	if len(encrypted) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There are no encrypted keys in %s", credsFile)))
+	}
+	if len(prefix) > 0 {
+		keyId := matchTufKeyId(prefix, encryptedIds)
+		for idx, id := range encryptedIds {
+			if id == keyId {
+				encrypted = encrypted[idx : idx+1]
+				break
+			}
+		}
+	}
+
+	for _, name := range encrypted {
+		keyId := ids[name]
+		passphrase, err := askTufKeyPassphrase(keyId)
+		subcommands.DieNotNil(err)
+		_, err = client.DecryptTufKey(keys[name].KeyValue.Private, passphrase)
+		subcommands.DieNotNil(err, name+":")
+		subcommands.DieNotNil(keyring.Set(tufKeychainPassphraseService, keyId, string(passphrase)),
+			"Unable to store the passphrase in the OS keychain:")
+		fmt.Println("Stored the passphrase of the key", keyId)
+	}
+}
+
+func doTufKeychainDeletePassphrase(cmd *cobra.Command, args []string) {
+	keyId, _ := cmd.Flags().GetString("key-id")
+	credsFile, _ := cmd.Flags().GetString("keys")
+	if len(credsFile) > 0 {
+		creds, err := GetOfflineCreds(credsFile)
+		subcommands.DieNotNil(err)
+		_, ids := tufCredsPrivateKeys(creds)
+		all := make([]string, 0, len(ids))
+		for _, id := range ids {
+			all = append(all, id)
+		}
+		keyId = matchTufKeyId(keyId, all)
+	}
+	err := keyring.Delete(tufKeychainPassphraseService, keyId)
+	if errors.Is(err, keyring.ErrNotFound) {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There is no passphrase of the key %s in the OS keychain", keyId)))
+	}
+	subcommands.DieNotNil(err, "Unable to remove the passphrase from the OS keychain:")
+	fmt.Println("Removed the passphrase of the key", keyId)
+}
+
+func doTufKeychainSetKey(cmd *cobra.Command, args []string) {
+	name, path := args[0], args[1]
+	if len(name) == 0 || strings.ContainsAny(name, " \t\n") {
+		subcommands.DieNotNil(subcommands.ValidationError("Invalid key name: %q. It must not be empty, nor have spaces.", name))
+	}
+	data, err := os.ReadFile(path)
+	subcommands.DieNotNil(err)
+	if block, _ := pem.Decode(data); block == nil {
+		subcommands.DieNotNil(subcommands.ValidationError("No PEM data found in %s", path))
+	}
+	err = keyring.Set(tufKeychainKeyService, name, string(data))
+	if errors.Is(err, keyring.ErrSetDataTooBig) {
+		err = fmt.Errorf("The key %s is too big for the OS keychain", path)
+	}
+	subcommands.DieNotNil(err, "Unable to store the key in the OS keychain:")
+	fmt.Printf("Stored the key %s, use it as %s%s\n", path, tufKeychainKeyPrefix, name)
+}
+
+func doTufKeychainDeleteKey(cmd *cobra.Command, args []string) {
+	err := keyring.Delete(tufKeychainKeyService, args[0])
+	if errors.Is(err, keyring.ErrNotFound) {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There is no key named %s in the OS keychain", args[0])))
+	}
+	subcommands.DieNotNil(err, "Unable to remove the key from the OS keychain:")
+	fmt.Println("Removed the key", args[0])
+}
+
+// tufKeychainPassphrase returns the passphrase of a key from the OS keychain, or nil if it is not there.
+// An unavailable keychain, e.g. on a headless Linux machine, is not an error: the passphrase is asked for instead.
+func tufKeychainPassphrase(keyid string) []byte {
+	passphrase, err := keyring.Get(tufKeychainPassphraseService, keyid)
+	if err != nil {
+		if !errors.Is(err, keyring.ErrNotFound) {
+			logrus.Debugf("Unable to read the passphrase of %s from the OS keychain: %s", keyid, err)
+		}
+		return nil
+	}
+	return []byte(passphrase)
+}
+
+// readTufKeyFile reads a key file, or a PEM key from the OS keychain for a keychain:<name> path.
+func readTufKeyFile(path string) ([]byte, error) {
+	if !strings.HasPrefix(path, tufKeychainKeyPrefix) {
+		return os.ReadFile(path)
+	}
+	name := strings.TrimPrefix(path, tufKeychainKeyPrefix)
+	data, err := keyring.Get(tufKeychainKeyService, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There is no key named %s in the OS keychain", name))
+	} else if err != nil {
+		return nil, fmt.Errorf("Unable to read the key %s from the OS keychain: %w", name, err)
+	}
+	return []byte(data), nil
+}
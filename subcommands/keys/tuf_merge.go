@@ -0,0 +1,222 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	mergeCmd := &cobra.Command{
+		Use:   "merge <creds.tgz> <creds.tgz>... --out=<combined.tgz>",
+		Short: "Combine offline TUF keys archives into one",
+		Long: `Combine several offline TUF keys archives into one, e.g. to bring the root keys and the targets keys
+kept in separate custody together for a signing ceremony.
+
+Files present in several archives with the same content are merged into one.
+A key present in several archives under different names, or in different forms (e.g. encrypted
+in one of them), is taken from the first archive it is in. Different files with the same name,
+or different private keys for the same key ID, are a conflict, and nothing is written.`,
+		Run:  doKeysMerge,
+		Args: cobra.MinimumNArgs(2),
+		Example: `
+  # Combine the root keys and the targets keys for a key rotation:
+  fioctl keys merge root-keys.tgz targets-keys.tgz --out tuf-root-keys.tgz`,
+	}
+	mergeCmd.Flags().StringP("out", "o", "", "Path to save the combined archive to")
+	_ = mergeCmd.MarkFlagRequired("out")
+	cmd.AddCommand(offline(mergeCmd))
+
+	extractCmd := &cobra.Command{
+		Use:   "extract --keys=<creds.tgz> --key-id=<id> --out=<single.tgz>",
+		Short: "Copy some keys of an offline TUF keys archive into a new archive",
+		Long: `Copy the given keys of an offline TUF keys archive into a new archive, e.g. to hand the targets
+keys over to a release team while keeping the root keys in a safe. A key ID can be abbreviated
+to a unique prefix. Use "fioctl keys usage" or "fioctl keys check" to find the key IDs of the roles.`,
+		Run:  doKeysExtract,
+		Args: cobra.NoArgs,
+		Example: `
+  # Copy a targets key to a new archive:
+  fioctl keys extract --keys tuf-root-keys.tgz --key-id 81eef5fb --out targets-keys.tgz`,
+	}
+	extractCmd.Flags().StringP("keys", "k", "", "Path to <creds.tgz> to copy the keys from")
+	extractCmd.Flags().StringSliceP("key-id", "", nil, "ID of a key to copy, can be repeated")
+	extractCmd.Flags().StringP("out", "o", "", "Path to save the new archive to")
+	_ = extractCmd.MarkFlagFilename("keys")
+	_ = extractCmd.MarkFlagRequired("keys")
+	_ = extractCmd.MarkFlagRequired("key-id")
+	_ = extractCmd.MarkFlagRequired("out")
+	cmd.AddCommand(offline(extractCmd))
+}
+
+// credsKeyIds returns the key IDs of the key pairs in the creds, by the name of their files without the extension.
+func credsKeyIds(credsFile string, creds OfflineCreds) map[string]string {
+	ids := make(map[string]string)
+	for name, content := range creds {
+		if !strings.HasSuffix(name, ".pub") {
+			continue
+		}
+		var pub client.AtsKey
+		if err := json.Unmarshal(content, &pub); err != nil {
+			subcommands.DieNotNil(fmt.Errorf("%s: unable to parse JSON for %s: %w", credsFile, name, err))
+		}
+		id, err := tufPublicKeyId(pub)
+		subcommands.DieNotNil(err, credsFile+": "+name+":")
+		ids[strings.TrimSuffix(name, ".pub")] = id
+	}
+	return ids
+}
+
+// credsKeyBase returns the name of a key pair file without the extension, or "" for other files.
+func credsKeyBase(name string) string {
+	for _, ext := range []string{".pub", ".sec"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return ""
+}
+
+// samePrivateKey tells if two private key files may hold the same key.
+// An encrypted key can not be compared without its passphrase, so it is assumed to be the same.
+func samePrivateKey(a, b []byte) bool {
+	var keyA, keyB client.AtsKey
+	if json.Unmarshal(a, &keyA) != nil || json.Unmarshal(b, &keyB) != nil {
+		return false
+	}
+	if client.IsEncryptedTufKey(keyA.KeyValue.Private) || client.IsEncryptedTufKey(keyB.KeyValue.Private) {
+		return true
+	}
+	return keyA.KeyValue.Private == keyB.KeyValue.Private
+}
+
+func refuseOverwrite(path string) {
+	if _, err := os.Stat(path); err == nil {
+		subcommands.DieNotNil(subcommands.ValidationError("The file %s already exists, refusing to overwrite it", path))
+	}
+}
+
+func doKeysMerge(cmd *cobra.Command, args []string) {
+	out, _ := cmd.Flags().GetString("out")
+	refuseOverwrite(out)
+
+	merged := make(OfflineCreds)
+	origin := make(map[string]string)
+	// The archive each key ID is taken from, and under which name
+	keyOrigin := make(map[string]string)
+	keyBase := make(map[string]string)
+	var conflicts []string
+	for _, credsFile := range args {
+		creds, err := GetOfflineCreds(credsFile)
+		subcommands.DieNotNil(err, credsFile+":")
+		ids := credsKeyIds(credsFile, creds)
+
+		names := make([]string, 0, len(creds))
+		for name := range creds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			content := creds[name]
+			base := credsKeyBase(name)
+			if id, ok := ids[base]; ok {
+				if from, seen := keyOrigin[id]; seen && from != credsFile {
+					ext := strings.TrimPrefix(name, base)
+					taken := merged[keyBase[id]+ext]
+					if keyBase[id] == base && bytes.Equal(taken, content) {
+						continue
+					}
+					if ext == ".sec" && !samePrivateKey(taken, content) {
+						conflicts = append(conflicts, fmt.Sprintf(
+							"the private keys of %s differ in %s and %s", id, from, credsFile))
+						continue
+					}
+					fmt.Printf("Key %s in %s is already taken from %s, skipping %s\n", id, credsFile, from, name)
+					continue
+				}
+				keyOrigin[id] = credsFile
+				keyBase[id] = base
+			}
+			if existing, ok := merged[name]; ok {
+				if !bytes.Equal(existing, content) {
+					conflicts = append(conflicts, fmt.Sprintf("%s differs in %s and %s", name, origin[name], credsFile))
+				}
+				continue
+			}
+			merged[name] = content
+			origin[name] = credsFile
+		}
+	}
+	if len(conflicts) > 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict,
+			fmt.Errorf("The archives conflict, nothing was written:\n  %s", strings.Join(conflicts, "\n  "))))
+	}
+
+	saveTufCreds(out, merged)
+	fmt.Printf("Saved %d keys from %d archives to %s\n", len(keyOrigin), len(args), out)
+}
+
+func doKeysExtract(cmd *cobra.Command, args []string) {
+	credsFile, _ := cmd.Flags().GetString("keys")
+	wanted, _ := cmd.Flags().GetStringSlice("key-id")
+	out, _ := cmd.Flags().GetString("out")
+	if len(wanted) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("At least one --key-id is required"))
+	}
+	for _, prefix := range wanted {
+		if len(prefix) == 0 {
+			subcommands.DieNotNil(subcommands.ValidationError("A key ID can not be empty"))
+		}
+	}
+	refuseOverwrite(out)
+
+	creds, err := GetOfflineCreds(credsFile)
+	subcommands.DieNotNil(err)
+	ids := credsKeyIds(credsFile, creds)
+
+	bases := make(map[string]bool)
+	for _, prefix := range wanted {
+		var matches []string
+		for base, id := range ids {
+			if strings.HasPrefix(id, prefix) {
+				matches = append(matches, base)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+				fmt.Errorf("There is no key with the ID %s in %s", prefix, credsFile)))
+		case 1:
+			bases[matches[0]] = true
+		default:
+			sort.Strings(matches)
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The key ID %s is ambiguous in %s, it matches: %s", prefix, credsFile, strings.Join(matches, ", ")))
+		}
+	}
+
+	extracted := make(OfflineCreds)
+	for name, content := range creds {
+		if bases[credsKeyBase(name)] {
+			extracted[name] = content
+		}
+	}
+	names := make([]string, 0, len(extracted))
+	for name := range extracted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println("Copying", name)
+	}
+	saveTufCreds(out, extracted)
+	fmt.Println("Saved the keys to", out)
+}
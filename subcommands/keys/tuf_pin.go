@@ -0,0 +1,132 @@
+package keys
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	pinProd     bool
+	pinRootFile string
+)
+
+func init() {
+	pinCmd := &cobra.Command{
+		Use:   "pin",
+		Short: "Manage the TUF root pinned by this machine",
+		Long: `Fioctl verifies the TUF root and targets metadata it downloads against a TUF root pinned locally.
+This ensures that a compromised API can not feed falsified metadata into signing ceremonies.
+
+The latest root of a factory is pinned on the first use (trust on first use).
+Newer roots are only accepted when they are signed by the keys of the pinned root,
+after which they become pinned. Use these commands to check and explicitly set the pinned root.
+The verification can be disabled for a single command with the --no-tuf-pin flag.`,
+	}
+	tufCmd.AddCommand(pinCmd)
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the TUF root pinned for the factory",
+		Run:   doPinShow,
+		Args:  cobra.NoArgs,
+	}
+	showCmd.Flags().BoolVarP(&pinProd, "prod", "", false, "Show the pinned production root")
+	pinCmd.AddCommand(showCmd)
+
+	setCmd := &cobra.Command{
+		Use:   "set",
+		Short: "Pin a TUF root for the factory",
+		Long: `Pin a TUF root for the factory, replacing the currently pinned root.
+By default, the latest root is fetched from the server. It is more secure to pin a root
+obtained out of band, e.g. from the offline TUF keys owner, using the --root flag.`,
+		Run:  doPinSet,
+		Args: cobra.NoArgs,
+		Example: `
+  # Pin the root received from the TUF keys owner:
+  fioctl keys tuf pin set --root 5.root.json
+
+  # Pin the latest production root as returned by the server:
+  fioctl keys tuf pin set --prod`,
+	}
+	setCmd.Flags().BoolVarP(&pinProd, "prod", "", false, "Pin the production root")
+	setCmd.Flags().StringVarP(&pinRootFile, "root", "", "", "Pin the root from this file rather than from the server")
+	pinCmd.AddCommand(setCmd)
+
+	resetCmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Forget the TUF root pinned for the factory",
+		Long:  "Forget the TUF root pinned for the factory. The latest root will be pinned again on the next use.",
+		Run:   doPinReset,
+		Args:  cobra.NoArgs,
+	}
+	resetCmd.Flags().BoolVarP(&pinProd, "prod", "", false, "Forget the pinned production root")
+	pinCmd.AddCommand(resetCmd)
+}
+
+func pinStore() client.TufPinStore {
+	if len(subcommands.Config.TufPinDir) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("TUF root pinning is disabled by the --no-tuf-pin flag"))
+	}
+	return client.TufPinStore{Dir: subcommands.Config.TufPinDir}
+}
+
+func doPinShow(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	store := pinStore()
+	root, _, err := store.Load(factory, pinProd)
+	subcommands.DieNotNil(err)
+	if root == nil {
+		fmt.Println("No TUF root is pinned yet. The latest root will be pinned on the first use.")
+		return
+	}
+	fmt.Println("File:", store.Path(factory, pinProd))
+	fmt.Println("Version:", root.Signed.Version)
+	fmt.Println("Expires:", subcommands.FormatTimestamp(root.Signed.Expires))
+	for _, name := range []string{tufRoleNameRoot, tufRoleNameTargets} {
+		role := root.Signed.Roles[tuf.RoleName(strings.ToLower(name))]
+		if role == nil {
+			continue
+		}
+		ids := append([]string{}, role.KeyIDs...)
+		sort.Strings(ids)
+		fmt.Printf("%s keys (threshold %d):\n", name, role.Threshold)
+		for _, id := range ids {
+			fmt.Println(" ", id)
+		}
+	}
+}
+
+func doPinSet(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	store := pinStore()
+
+	var raw []byte
+	if len(pinRootFile) > 0 {
+		var err error
+		raw, err = os.ReadFile(pinRootFile)
+		subcommands.DieNotNil(err)
+	} else {
+		body, err := api.TufRootGetRaw(factory, pinProd, -1)
+		subcommands.DieNotNil(err)
+		raw = *body
+	}
+	root, err := client.VerifyTufRoot(nil, raw)
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(store.Save(factory, pinProd, raw))
+	fmt.Printf("Pinned the TUF root version %d to %s\n", root.Signed.Version, store.Path(factory, pinProd))
+}
+
+func doPinReset(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	subcommands.DieNotNil(pinStore().Remove(factory, pinProd))
+	fmt.Println("The pinned TUF root is forgotten")
+}
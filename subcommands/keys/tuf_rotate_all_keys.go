@@ -37,8 +37,10 @@ Migrate an old factory to use Ed25519 key type for all TUF signing keys (online
 	rotate.Flags().StringP("targets-keys", "K", "", "Path to <offline-targets-creds.tgz> used to sign prod & wave TUF targets.")
 	_ = rotate.MarkFlagFilename("targets-keys")
 	rotate.Flags().BoolP("first-time", "", false, "Used for the first customer rotation. The command will download the initial root key.")
-	rotate.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA.")
+	addTufKeyTypeFlag(rotate)
 	rotate.Flags().StringP("changelog", "m", "", "Reason for doing rotation. Saved in root metadata for tracking change history.")
+	addTufExpiresFlag(rotate)
+	addTufResultFlags(rotate)
 	tufCmd.AddCommand(rotate)
 }
 
@@ -47,6 +49,7 @@ func doRotateAllKeys(cmd *cobra.Command, unusedArgs []string) {
 	keyType, _ := cmd.Flags().GetString("key-type")
 	ParseTufKeyType(keyType) // fails on error
 	changelog, _ := cmd.Flags().GetString("changelog")
+	expires, _ := cmd.Flags().GetString("expires")
 	if changelog == "" {
 		changelog = "Rotate all TUF root signing keys"
 	}
@@ -61,7 +64,7 @@ func doRotateAllKeys(cmd *cobra.Command, unusedArgs []string) {
 	// Detach from the parent, so that command calls below use correct args.
 	tufCmd.RemoveCommand(tufUpdatesCmd)
 
-	fmt.Println("= Creating new TUF updates transaction")
+	fmt.Fprintln(tufProgress, "= Creating new TUF updates transaction")
 	args := []string{"init", "-m", changelog}
 	if firstTime {
 		args = append(args, "--first-time", "-k", credsFile)
@@ -70,6 +73,9 @@ func doRotateAllKeys(cmd *cobra.Command, unusedArgs []string) {
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 
 	args = []string{"rotate-offline-key", "-r", "root", "-k", credsFile, "-y", keyType}
+	if expires != "" {
+		args = append(args, "--expires", expires)
+	}
 	tufUpdatesCmd.SetArgs(args)
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 
@@ -85,7 +91,7 @@ func doRotateAllKeys(cmd *cobra.Command, unusedArgs []string) {
 	tufUpdatesCmd.SetArgs(args)
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 
-	fmt.Println("= Applying staged TUF root changes")
+	fmt.Fprintln(tufProgress, "= Applying staged TUF root changes")
 	tufUpdatesCmd.SetArgs([]string{"apply"})
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 }
@@ -48,8 +48,10 @@ When you rotate the TUF targets offline signing key:
 	rotate.Flags().StringP("targets-keys", "K", "", "Path to <offline-targets-creds.tgz> used to sign prod & wave TUF targets.")
 	_ = rotate.MarkFlagFilename("targets-keys")
 	rotate.Flags().BoolP("first-time", "", false, "Used for the first customer rotation. The command will download the initial root key.")
-	rotate.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA.")
+	addTufKeyTypeFlag(rotate)
 	rotate.Flags().StringP("changelog", "m", "", "Reason for doing rotation. Saved in root metadata for tracking change history.")
+	addTufExpiresFlag(rotate)
+	addTufResultFlags(rotate)
 	tufCmd.AddCommand(rotate)
 
 	legacyRotateRoot := &cobra.Command{
@@ -67,7 +69,8 @@ Instead, please, use a new approach to rotate TUF root key:
 	}
 	legacyRotateRoot.Flags().BoolP("initial", "", false, "Used for the first customer rotation. The command will download the initial root key")
 	legacyRotateRoot.Flags().StringP("changelog", "m", "", "Reason for doing rotation. Saved in root metadata for tracking change history")
-	legacyRotateRoot.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA.")
+	addTufKeyTypeFlag(legacyRotateRoot)
+	addTufResultFlags(legacyRotateRoot)
 	cmd.AddCommand(legacyRotateRoot)
 
 	legacyRotateTargets := &cobra.Command{
@@ -87,8 +90,9 @@ Instead, please, use a new approach to rotate TUF targets key:
 		Annotations: map[string]string{tufCmdAnnotation: tufCmdRotateTargetsLegacy},
 		Args:        cobra.ExactArgs(1),
 	}
-	legacyRotateTargets.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA.")
+	addTufKeyTypeFlag(legacyRotateTargets)
 	legacyRotateTargets.Flags().StringP("changelog", "m", "", "Reason for doing rotation. Saved in root metadata for tracking change history.")
+	addTufResultFlags(legacyRotateTargets)
 	cmd.AddCommand(legacyRotateTargets)
 }
 
@@ -102,6 +106,7 @@ func doRotateOfflineKey(cmd *cobra.Command, args []string) {
 	keyType, _ := cmd.Flags().GetString("key-type")
 	ParseTufKeyType(keyType) // fails on error
 	changelog, _ := cmd.Flags().GetString("changelog")
+	expires, _ := cmd.Flags().GetString("expires")
 	cmdName := cmd.Annotations[tufCmdAnnotation]
 	switch cmdName {
 	case tufCmdRotateOfflineKey:
@@ -143,7 +148,7 @@ func doRotateOfflineKey(cmd *cobra.Command, args []string) {
 	// Detach from the parent, so that command calls below use correct args.
 	tufCmd.RemoveCommand(tufUpdatesCmd)
 
-	fmt.Println("= Creating new TUF updates transaction")
+	fmt.Fprintln(tufProgress, "= Creating new TUF updates transaction")
 	args = []string{"init", "-m", changelog}
 	if firstTime {
 		args = append(args, "--first-time", "-k", credsFile)
@@ -152,13 +157,16 @@ func doRotateOfflineKey(cmd *cobra.Command, args []string) {
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 
 	args = []string{"rotate-offline-key", "-r", roleName, "-k", credsFile, "-y", keyType, "-s"}
+	if expires != "" {
+		args = append(args, "--expires", expires)
+	}
 	if targetsCredsFile != "" {
 		args = append(args, "-K", targetsCredsFile)
 	}
 	tufUpdatesCmd.SetArgs(args)
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 
-	fmt.Println("= Applying staged TUF root changes")
+	fmt.Fprintln(tufProgress, "= Applying staged TUF root changes")
 	tufUpdatesCmd.SetArgs([]string{"apply"})
 	subcommands.DieNotNil(tufUpdatesCmd.Execute())
 }
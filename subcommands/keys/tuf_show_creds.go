@@ -0,0 +1,154 @@
+package keys
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var showCredsOutput subcommands.ListOutput
+
+func init() {
+	showCmd := &cobra.Command{
+		Use:   "show-creds <tuf-root-keys.tgz>",
+		Short: "List the keys in an offline TUF keys archive",
+		Long: `List each key of an offline TUF keys archive, e.g. tuf-root-keys.tgz or tuf-targets-keys.tgz:
+its key ID, its role inferred from its file name, its key type, how its private key is held, and when
+it was added to the archive. Archives saved by older versions of fioctl do not keep when keys were added.
+
+The private key is one of:
+- plain: the private key is in the archive.
+- encrypted: the private key is in the archive, protected by a passphrase.
+- yubikey, tpm: the archive references a key held by a device.
+- none: only the public key is in the archive, e.g. for a key held by an HSM or a cloud KMS,
+  or split with split-key.
+
+This command works offline. With --check-roots, it also tells which keys are referenced by the
+factory's CI and production TUF roots, which requires access to the server.`,
+		Example: `
+  # List the keys of an archive on an air-gapped machine:
+  fioctl keys tuf show-creds tuf-root-keys.tgz
+  # Find the keys which are no longer used by the factory:
+  fioctl keys tuf show-creds tuf-root-keys.tgz --check-roots`,
+		Run:  doTufShowCreds,
+		Args: cobra.ExactArgs(1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if checkRoots, _ := cmd.Flags().GetBool("check-roots"); checkRoots {
+				api = subcommands.Login(cmd)
+			}
+		},
+	}
+	showCmd.Flags().Bool("check-roots", false, "Tell which keys are referenced by the factory's TUF roots")
+	showCredsOutput.AddFlags(showCmd, "role,added-at")
+	tufCmd.AddCommand(showCmd)
+}
+
+func doTufShowCreds(cmd *cobra.Command, args []string) {
+	credsFile := args[0]
+	checkRoots, _ := cmd.Flags().GetBool("check-roots")
+
+	// The archive is read as is, without looking for the YubiKeys or TPMs its keys reference
+	creds, err := client.LoadOfflineCreds(credsFile)
+	subcommands.DieNotNil(err)
+	times, err := client.OfflineCredsTimes(credsFile)
+	subcommands.DieNotNil(err)
+
+	// Root names of the roots referencing each key ID
+	var inRoots map[string][]string
+	if checkRoots {
+		factory := viper.GetString("factory")
+		ciRoot, err := api.TufRootGet(factory)
+		subcommands.DieNotNil(err)
+		prodRoot, err := api.TufProdRootGet(factory)
+		subcommands.DieNotNil(err)
+		inRoots = make(map[string][]string)
+		for _, r := range []struct {
+			name string
+			root *client.AtsTufRoot
+		}{{"ci", ciRoot}, {"prod", prodRoot}} {
+			for _, role := range r.root.Signed.Roles {
+				for _, kid := range role.KeyIDs {
+					if len(inRoots[kid]) == 0 || inRoots[kid][len(inRoots[kid])-1] != r.name {
+						inRoots[kid] = append(inRoots[kid], r.name)
+					}
+				}
+			}
+		}
+	}
+
+	ids := credsKeyIds(credsFile, creds)
+	bases := make([]string, 0, len(ids))
+	for base := range ids {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+
+	columns := []string{"KEY ID", "ROLE", "TYPE", "PRIVATE KEY", "ADDED AT", "FILE"}
+	if checkRoots {
+		columns = append(columns, "IN ROOTS")
+	}
+	t := showCredsOutput.NewTable(columns...)
+	for _, base := range bases {
+		var pub client.AtsKey
+		subcommands.DieNotNil(json.Unmarshal(creds[base+".pub"], &pub))
+		added := ""
+		if at := times[base+".pub"]; !at.IsZero() {
+			added = subcommands.FormatTimestamp(at)
+		}
+		row := []interface{}{
+			ids[base], tufCredsKeyRole(base), pub.KeyType, tufCredsPrivateKey(creds, base), added, base,
+		}
+		if checkRoots {
+			roots := strings.Join(inRoots[ids[base]], ",")
+			if len(roots) == 0 {
+				roots = "unused"
+			}
+			row = append(row, roots)
+		}
+		t.AddLine(row...)
+	}
+	t.Print()
+}
+
+// tufCredsKeyRole infers the role of a key from its file name in the offline TUF keys.
+func tufCredsKeyRole(base string) string {
+	name := path.Base(base)
+	switch {
+	case name == "root" || name == "first-root" || strings.HasPrefix(name, "fioctl-root-"):
+		return "root"
+	case name == "targets" || strings.HasPrefix(name, "fioctl-targets-"):
+		return "targets"
+	case strings.HasPrefix(name, "fioctl-delegation-"):
+		// The key ID follows the name of the delegated role, which may have dashes
+		role := strings.TrimPrefix(name, "fioctl-delegation-")
+		if idx := strings.LastIndex(role, "-"); idx > 0 {
+			role = role[:idx]
+		}
+		return "delegation:" + role
+	}
+	return "unknown"
+}
+
+// tufCredsPrivateKey tells how the private key of a key in the offline TUF keys is held.
+func tufCredsPrivateKey(creds OfflineCreds, base string) string {
+	if sec, ok := creds[base+".sec"]; ok {
+		var priv client.AtsKey
+		if err := json.Unmarshal(sec, &priv); err == nil && client.IsEncryptedTufKey(priv.KeyValue.Private) {
+			return "encrypted"
+		}
+		return "plain"
+	}
+	for _, ref := range []string{yubikeyRefSuffix, tpmRefSuffix} {
+		if _, ok := creds[base+ref]; ok {
+			return strings.TrimPrefix(ref, ".")
+		}
+	}
+	return "none"
+}
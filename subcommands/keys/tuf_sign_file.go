@@ -0,0 +1,177 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	canonical "github.com/docker/go/canonical/json"
+	"github.com/spf13/cobra"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	signFileCmd := &cobra.Command{
+		Use:   "sign-file --keys=<tuf-root-keys.tgz> --out=<signatures.json> [--key-id=<id>] <file.json>",
+		Short: "Sign a TUF root exported for signing, or any TUF metadata, on an air-gapped machine",
+		Long: `Sign a TUF root exported by "fioctl keys tuf updates export-unsigned" with the offline root keys.
+
+This command works without a network connection, so that it can run on an air-gapped machine.
+The TUF root is signed with all of its current and new root keys in the given offline TUF keys.
+The detached signatures are saved to a file, which is then merged into the TUF root updates
+transaction with "fioctl keys tuf updates import-signature" on a machine connected to the network.
+
+With --key-id, any TUF-style JSON document is signed instead, e.g. custom delegated metadata, with the keys
+of the given IDs. If the document has a "signed" part, as TUF metadata does, that part is signed;
+otherwise the whole document is. It is signed in its canonical JSON form, and the detached signatures
+are saved as a "signatures" block, which can be put next to the "signed" part of the document.`,
+		Example: `
+  # Sign the exported TUF root with the offline root keys:
+  fioctl keys sign-file --keys=tuf-root-keys.tgz --out=/media/usb/signatures.json /media/usb/unsigned-root.json
+  # Sign custom delegated metadata with a delegation key:
+  fioctl keys sign-file --keys=tuf-root-keys.tgz --key-id=4f1c7a --out=sigs.json firmware.json`,
+		Run:  doKeysSignFile,
+		Args: cobra.ExactArgs(1),
+	}
+	signFileCmd.Flags().StringArrayP("keys", "k", nil, "Path to <tuf-root-keys.tgz> used to sign TUF root. Can be repeated.")
+	_ = signFileCmd.MarkFlagFilename("keys")
+	signFileCmd.Flags().StringP("out", "o", "", "Path to save the signatures to.")
+	signFileCmd.Flags().StringArray("key-id", nil,
+		"Sign any TUF metadata with the key of this ID, or a unique prefix of it. Can be repeated.")
+	_ = signFileCmd.MarkFlagRequired("out")
+	_ = signFileCmd.MarkFlagFilename("out")
+	addTufSigningKeyIdFlag(signFileCmd)
+	AddTufSignerFlags(signFileCmd)
+	cmd.AddCommand(offline(signFileCmd))
+}
+
+func doKeysSignFile(cmd *cobra.Command, args []string) {
+	keysFiles, _ := cmd.Flags().GetStringArray("keys")
+	outFile, _ := cmd.Flags().GetString("out")
+	keyIds, _ := cmd.Flags().GetStringArray("key-id")
+
+	buf, err := os.ReadFile(args[0])
+	subcommands.DieNotNil(err)
+	if len(keyIds) > 0 {
+		signTufDocument(args[0], buf, getSigningCredsFiles(keysFiles), keyIds, outFile)
+		return
+	}
+	var unsigned tufUnsignedRoot
+	subcommands.DieNotNil(json.Unmarshal(buf, &unsigned), "Unable to parse "+args[0]+":")
+	if unsigned.CurCiRoot == nil || unsigned.CiRoot == nil || unsigned.ProdRoot == nil {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"%s is not a TUF root exported by 'fioctl keys tuf updates export-unsigned'. Use --key-id to sign any TUF metadata.",
+			args[0]))
+	}
+
+	creds := getSigningCredsFiles(keysFiles)
+	printTufRootToSign(unsigned)
+	signers := findNewTufRootSigners(unsigned.CurCiRoot, unsigned.CiRoot, creds)
+
+	sigs := tufDetachedSignatures{Factory: unsigned.Factory}
+	for _, root := range []struct {
+		root *client.AtsTufRoot
+		sigs *[]tuf.Signature
+	}{{unsigned.CiRoot, &sigs.CiRoot}, {unsigned.ProdRoot, &sigs.ProdRoot}} {
+		msg, err := canonical.MarshalCanonical(root.root.Signed)
+		subcommands.DieNotNil(err)
+		*root.sigs, err = SignTufMeta(msg, signers...)
+		subcommands.DieNotNil(err)
+	}
+	for _, signer := range signers {
+		fmt.Println("= Signed with root key", signer.Id)
+	}
+
+	buf, err = subcommands.MarshalIndent(sigs, "", "  ")
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.WriteFile(outFile, buf, 0644))
+	fmt.Println("= Signatures saved to", outFile)
+}
+
+// printTufRootToSign shows what is about to be signed, so that it can be reviewed on the air-gapped machine.
+func printTufRootToSign(unsigned tufUnsignedRoot) {
+	signed := unsigned.CiRoot.Signed
+	fmt.Printf("= Signing TUF root version %d of factory %s\n", signed.Version, unsigned.Factory)
+	fmt.Println("  Expires:", signed.Expires.Format("2006-01-02 15:04:05 MST"))
+	for _, root := range []struct {
+		name string
+		root *client.AtsTufRoot
+	}{{"Current", unsigned.CurCiRoot}, {"New", unsigned.CiRoot}} {
+		role := root.root.Signed.Roles["root"]
+		if role == nil {
+			subcommands.DieNotNil(errors.New("The exported TUF root has no root role"))
+		}
+		fmt.Printf("  %s root keys (threshold %d): %s\n", root.name, role.Threshold, strings.Join(role.KeyIDs, ", "))
+	}
+}
+
+// signTufDocument signs the canonical JSON of a TUF-style document with the keys of the given IDs,
+// and saves the detached signatures.
+func signTufDocument(path string, raw []byte, creds OfflineCreds, keyIds []string, outFile string) {
+	var doc map[string]json.RawMessage
+	subcommands.DieNotNil(json.Unmarshal(raw, &doc), "Unable to parse "+path+":")
+	var msg []byte
+	var err error
+	if _, ok := doc["signed"]; ok {
+		msg, _, err = client.CanonicalTufSigned(raw)
+		fmt.Println("= Signing the signed part of", path)
+	} else {
+		msg, err = canonicalJson(raw)
+		fmt.Println("= Signing the whole of", path)
+	}
+	subcommands.DieNotNil(err, "Unable to canonicalize "+path+":")
+
+	// Public keys by key IDs, of both the offline TUF keys and the keys held elsewhere
+	pubs := make(map[string]string)
+	for base, id := range credsKeyIds("offline TUF keys", creds) {
+		var pub client.AtsKey
+		subcommands.DieNotNil(json.Unmarshal(creds[base+".pub"], &pub))
+		pubs[id] = pub.KeyValue.Public
+	}
+	for _, signer := range tufSignerOpts.ExternalSigners {
+		if pub, err := client.TufPublicKeyValue(signer); err == nil {
+			pubs[signer.Id] = pub
+		}
+	}
+	ids := make([]string, 0, len(pubs))
+	for id := range pubs {
+		ids = append(ids, id)
+	}
+
+	var signers []TufSigner
+	for _, prefix := range keyIds {
+		id := matchTufKeyId(prefix, ids)
+		signer, err := FindTufSigner(id, pubs[id], creds)
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err))
+		signers = append(signers, *signer)
+	}
+	sigs, err := SignTufMeta(msg, signers...)
+	subcommands.DieNotNil(err)
+	for _, signer := range signers {
+		fmt.Println("= Signed with key", signer.Id)
+	}
+
+	buf, err := subcommands.MarshalIndent(struct {
+		Signatures []tuf.Signature `json:"signatures"`
+	}{sigs}, "", "  ")
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.WriteFile(outFile, buf, 0644))
+	fmt.Println("= Signatures saved to", outFile)
+}
+
+// canonicalJson returns the canonical form of a JSON document, keeping numbers as they are.
+func canonicalJson(raw []byte) ([]byte, error) {
+	dec := canonical.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return canonical.MarshalCanonical(doc)
+}
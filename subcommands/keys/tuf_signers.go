@@ -0,0 +1,465 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const vaultKeyHelp = `Sign with this key of the HashiCorp Vault transit engine; the key never leaves Vault.
+Can be repeated, e.g. to use one Vault key per role. Keys which are not in Vault are taken from --keys.
+The Vault server is set by the VAULT_ADDR, VAULT_TOKEN, and VAULT_NAMESPACE environment variables.`
+
+const hsmKeyLabelHelp = `Sign with the key of this label on a PKCS#11 token; the key never leaves the token.
+Can be repeated, e.g. to use one key per role. Keys which are not on the token are taken from --keys.
+Requires the OpenSSL pkcs11 engine (libp11) and the --hsm-module and --hsm-pin flags.`
+
+const kmsKeyHelp = `Sign with this asymmetric key of a cloud KMS; the key never leaves KMS. Supported keys are:
+- AWS KMS RSA and ECC_NIST_P256 keys given by ARN, ID, or alias.
+- Google Cloud KMS Ed25519, EC P-256, and RSA-PSS keys given by
+  gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>[/cryptoKeyVersions/<version>].
+- Azure Key Vault RSA and EC P-256 keys given by https://<vault>.vault.azure.net/keys/<name>[/<version>].
+Can be repeated, e.g. to use one KMS key per role. Keys which are not in KMS are taken from --keys.
+The KMS is detected from the key, unless it is set with --key-backend. Commands which do not take
+the ID of a TUF key in --key-id also take the KMS keys in --key-id, e.g. --key-backend=azure-kv --key-id=<URL>.
+The credentials are read the same way as by the AWS CLI, gcloud, and the Azure CLI, e.g. from AWS_PROFILE,
+GOOGLE_APPLICATION_CREDENTIALS, or AZURE_TENANT_ID, AZURE_CLIENT_ID, and AZURE_CLIENT_SECRET.`
+
+// tufSignerOpts are passed to client.FindTufSigner by FindTufSigner. They hold the keys selected by the flags
+// of the running command, and the keys on devices referenced by the offline TUF keys it read, e.g. a YubiKey.
+var tufSignerOpts = client.TufSignerOptions{Passphrase: tufKeyPassphrase}
+
+// deviceSigner is implemented by the signers of keys on a device, e.g. a YubiKey, an HSM, or a TPM.
+// Such a key signs one digest at a time, and may prompt for a PIN or a touch, so it must not be used concurrently.
+type deviceSigner interface {
+	onDevice()
+}
+
+// AddTufSignerFlags adds the flags selecting TUF keys held outside of the offline TUF keys archive
+// to a command signing TUF metadata. The keys are looked up by FindTufSigner before the command runs.
+func AddTufSignerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("vault-key", nil, vaultKeyHelp)
+	cmd.Flags().String("vault-mount", "transit", "The path of the Vault transit engine")
+	cmd.Flags().StringArray("hsm-key-label", nil, hsmKeyLabelHelp)
+	cmd.Flags().String("hsm-module", "",
+		"The PKCS#11 module of the token holding the TUF keys, e.g. libsofthsm2.so (default for YubiKeys: libykcs11.so)")
+	cmd.Flags().String("hsm-pin", "", "The PKCS#11 PIN of the token. The PIN of a YubiKey is asked for if not set")
+	cmd.Flags().String("hsm-token-label", "", "The label of the PKCS#11 token holding the TUF keys. Any token is used if not set")
+	cmd.Flags().StringArray("kms-key", nil, kmsKeyHelp)
+	cmd.Flags().String("key-backend", "",
+		"The cloud KMS holding the --kms-key keys: "+strings.Join(kmsKeyBackends, ", ")+" (default: detected from the key)")
+	// A few commands already take the ID of a TUF key in --key-id; they only take KMS keys in --kms-key
+	if cmd.Flags().Lookup("key-id") == nil {
+		cmd.Flags().StringArray("key-id", nil, "A key of the --key-backend to sign with, the same as --kms-key")
+		_ = cmd.Flags().SetAnnotation("key-id", kmsKeyIdAnnotation, []string{"true"})
+	}
+	cmd.PreRun = func(cmd *cobra.Command, args []string) {
+		// Not all commands signing TUF metadata sign the TUF root, and have this flag
+		tufSigningKeyIds, _ = cmd.Flags().GetStringArray("signing-key-id")
+		loadTufExternalSigners(cmd)
+	}
+}
+
+// keyStoreApi returns the API client which makes the requests to the external key stores.
+// The offline commands, and the commands of other packages, e.g. waves init, do not log in with this package.
+func keyStoreApi() *client.Api {
+	if api != nil {
+		return api
+	}
+	return subcommands.OfflineApi()
+}
+
+func vaultTransitConfig(cmd *cobra.Command) client.VaultTransitConfig {
+	mount, _ := cmd.Flags().GetString("vault-mount")
+	cfg := client.VaultTransitConfig{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     mount,
+	}
+	if len(cfg.Addr) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The VAULT_ADDR environment variable is required to use Vault keys"))
+	}
+	if len(cfg.Token) == 0 {
+		// The token saved by "vault login"
+		if home, err := os.UserHomeDir(); err == nil {
+			if token, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				cfg.Token = strings.TrimSpace(string(token))
+			}
+		}
+	}
+	return cfg
+}
+
+// awsKmsConfig reads the AWS credentials the same way as the AWS CLI: from the environment variables,
+// or from a profile of the shared credentials file.
+func awsKmsConfig() client.AwsKmsConfig {
+	cfg := client.AwsKmsConfig{
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_KMS"),
+	}
+	if len(cfg.Region) == 0 {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if len(cfg.Endpoint) == 0 {
+		cfg.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if len(cfg.AccessKeyId) > 0 {
+		return cfg
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if len(path) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return cfg
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if len(profile) == 0 {
+		profile = "default"
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return cfg
+	}
+	section := ""
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, val, found := strings.Cut(line, "=")
+		if !found || section != profile {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			cfg.AccessKeyId = val
+		case "aws_secret_access_key":
+			cfg.SecretAccessKey = val
+		case "aws_session_token":
+			cfg.SessionToken = val
+		}
+	}
+	return cfg
+}
+
+// gcpKmsConfig reads the Google Cloud access token from the GOOGLE_OAUTH_ACCESS_TOKEN environment variable,
+// or exchanges the application default credentials for one.
+func gcpKmsConfig() (client.GcpKmsConfig, error) {
+	cfg := client.GcpKmsConfig{
+		AccessToken: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		Endpoint:    os.Getenv("CLOUDSDK_API_ENDPOINT_OVERRIDES_CLOUDKMS"),
+	}
+	if len(cfg.AccessToken) > 0 {
+		return cfg, nil
+	}
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(path) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return cfg, err
+		}
+		path = filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to read the Google Cloud credentials, set GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	cfg.AccessToken, err = keyStoreApi().GcpAccessToken(buf)
+	return cfg, err
+}
+
+// azureKeyVaultConfig gets an Azure access token for the service principal set by the AZURE_TENANT_ID,
+// AZURE_CLIENT_ID, and AZURE_CLIENT_SECRET environment variables, or from the Azure CLI.
+func azureKeyVaultConfig() (client.AzureKeyVaultConfig, error) {
+	var cfg client.AzureKeyVaultConfig
+	tenantId := os.Getenv("AZURE_TENANT_ID")
+	clientId := os.Getenv("AZURE_CLIENT_ID")
+	secret := os.Getenv("AZURE_CLIENT_SECRET")
+	if len(tenantId) > 0 && len(clientId) > 0 && len(secret) > 0 {
+		authority := os.Getenv("AZURE_AUTHORITY_HOST")
+		if len(authority) == 0 {
+			authority = "https://login.microsoftonline.com"
+		}
+		var err error
+		cfg.AccessToken, err = keyStoreApi().AzureAccessToken(authority, tenantId, clientId, secret, client.AzureKeyVaultScope)
+		return cfg, err
+	}
+
+	out, err := exec.Command(
+		"az", "account", "get-access-token", "--scope", client.AzureKeyVaultScope, "--query", "accessToken", "--output", "tsv",
+	).Output()
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to get an Azure access token, run \"az login\" or set AZURE_CLIENT_SECRET: %w", err)
+	}
+	cfg.AccessToken = strings.TrimSpace(string(out))
+	return cfg, nil
+}
+
+// kmsKeyIdAnnotation marks the --key-id flag when it takes KMS keys, rather than the ID of a TUF key.
+const kmsKeyIdAnnotation = "fioctl_kms_key_id"
+
+// kmsKeyBackends are the values of the --key-backend flag.
+var kmsKeyBackends = []string{"aws-kms", "gcp-kms", "azure-kv"}
+
+// kmsKeyBackend returns the value of the --key-backend flag, after checking it.
+func kmsKeyBackend(cmd *cobra.Command) string {
+	backend, _ := cmd.Flags().GetString("key-backend")
+	if len(backend) > 0 && !slices.Contains(kmsKeyBackends, backend) {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"Unsupported --key-backend %s, supported: %s", backend, strings.Join(kmsKeyBackends, ", ")))
+	}
+	return backend
+}
+
+// kmsTufSigner returns a signer for a key of AWS KMS, Google Cloud KMS, or Azure Key Vault.
+// The backend is one of kmsKeyBackends, or empty to detect it from the key name.
+func kmsTufSigner(backend, name string) (*client.TufSigner, error) {
+	if len(backend) == 0 {
+		backend = "aws-kms"
+		if client.IsAzureKeyVaultKeyUrl(name) {
+			backend = "azure-kv"
+		} else if strings.HasPrefix(name, client.GcpKmsKeyUriPrefix) {
+			backend = "gcp-kms"
+		}
+	}
+	switch backend {
+	case "azure-kv":
+		if !client.IsAzureKeyVaultKeyUrl(name) {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"Invalid Azure Key Vault key %s, expected https://<vault>.vault.azure.net/keys/<name>[/<version>]", name))
+		}
+		cfg, err := azureKeyVaultConfig()
+		if err != nil {
+			return nil, err
+		}
+		return keyStoreApi().NewAzureKeyVaultSigner(cfg, name)
+	case "gcp-kms":
+		if !strings.HasPrefix(name, client.GcpKmsKeyUriPrefix) {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"Invalid Google Cloud KMS key %s, expected %s...", name, client.GcpKmsKeyUriPrefix))
+		}
+		cfg, err := gcpKmsConfig()
+		if err != nil {
+			return nil, err
+		}
+		return keyStoreApi().NewGcpKmsSigner(cfg, name)
+	}
+	return keyStoreApi().NewAwsKmsSigner(awsKmsConfig(), name)
+}
+
+// hsmConfig locates the PKCS#11 token holding TUF keys.
+type hsmConfig struct {
+	module     string
+	pin        string
+	tokenLabel string
+}
+
+func tufHsmConfig(cmd *cobra.Command) hsmConfig {
+	var cfg hsmConfig
+	cfg.module, _ = cmd.Flags().GetString("hsm-module")
+	cfg.pin, _ = cmd.Flags().GetString("hsm-pin")
+	cfg.tokenLabel, _ = cmd.Flags().GetString("hsm-token-label")
+	if len(cfg.module) == 0 || len(cfg.pin) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The --hsm-module and --hsm-pin flags are required to use keys on a PKCS#11 token"))
+	}
+	return cfg
+}
+
+// hsmTufSigner returns a signer for the key of the given label on a PKCS#11 token.
+func hsmTufSigner(cfg hsmConfig, label string) (*client.TufSigner, error) {
+	uri := "pkcs11:"
+	if len(cfg.tokenLabel) > 0 {
+		uri += "token=" + pkcs11UriEscape(cfg.tokenLabel) + ";"
+	}
+	uri += "object=" + pkcs11UriEscape(label)
+	pub, err := tokenPublicKey(cfg.module, cfg.pin, uri+";type=public")
+	if err != nil {
+		return nil, err
+	}
+	var keyType client.TufKeyType
+	switch pubKey := pub.(type) {
+	case ed25519.PublicKey:
+		keyType, _ = client.ParseTufKeyType(client.TufKeyTypeNameEd25519)
+	case *rsa.PublicKey:
+		keyType, _ = client.ParseTufKeyType(client.TufKeyTypeNameRSA)
+	case *ecdsa.PublicKey:
+		if pubKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("Unsupported curve of the PKCS#11 key %s: %s, only P-256 is supported", label, pubKey.Curve.Params().Name)
+		}
+		keyType, _ = client.ParseTufKeyType(client.TufKeyTypeNameEcdsaP256)
+	default:
+		return nil, fmt.Errorf("Unsupported type of the PKCS#11 key %s: %T, only Ed25519, RSA, and ECDSA P-256 keys are supported", label, pub)
+	}
+	key := &tokenSigner{module: cfg.module, pin: cfg.pin, uri: uri + ";type=private", pub: pub}
+	id, err := client.GenTufKeyId(key)
+	if err != nil {
+		return nil, err
+	}
+	return &client.TufSigner{Id: id, Type: keyType, Key: key}, nil
+}
+
+func loadTufExternalSigners(cmd *cobra.Command) {
+	if module, _ := cmd.Flags().GetString("hsm-module"); len(module) > 0 {
+		yubikeyConfig.module = module
+	}
+	yubikeyConfig.pin, _ = cmd.Flags().GetString("hsm-pin")
+
+	names, _ := cmd.Flags().GetStringArray("vault-key")
+	if len(names) > 0 {
+		cfg := vaultTransitConfig(cmd)
+		for _, name := range names {
+			signer, err := keyStoreApi().NewVaultTransitSigner(cfg, name)
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err))
+			fmt.Fprintf(tufProgress, "= Using Vault key %s, keyid: %s\n", name, signer.Id)
+			tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+		}
+	}
+
+	labels, _ := cmd.Flags().GetStringArray("hsm-key-label")
+	if len(labels) > 0 {
+		cfg := tufHsmConfig(cmd)
+		for _, label := range labels {
+			signer, err := hsmTufSigner(cfg, label)
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err))
+			fmt.Fprintf(tufProgress, "= Using PKCS#11 key %s, keyid: %s\n", label, signer.Id)
+			tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+		}
+	}
+
+	kmsKeys, _ := cmd.Flags().GetStringArray("kms-key")
+	if f := cmd.Flags().Lookup("key-id"); f != nil && f.Annotations[kmsKeyIdAnnotation] != nil {
+		keyIds, _ := cmd.Flags().GetStringArray("key-id")
+		kmsKeys = append(kmsKeys, keyIds...)
+	}
+	backend := kmsKeyBackend(cmd)
+	for _, name := range kmsKeys {
+		signer, err := kmsTufSigner(backend, name)
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err))
+		fmt.Fprintf(tufProgress, "= Using KMS key %s, keyid: %s\n", name, signer.Id)
+		tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+	}
+}
+
+// GetSigningCreds reads the offline TUF keys for a command signing TUF metadata.
+// The archive is optional when the keys are held elsewhere, e.g. in Vault, an HSM, or a cloud KMS.
+func GetSigningCreds(credsFile string) (OfflineCreds, error) {
+	if len(credsFile) == 0 {
+		if len(tufSignerOpts.ExternalSigners) > 0 {
+			return make(OfflineCreds), nil
+		}
+		return nil, subcommands.ValidationError("The --keys flag is required, unless the keys are held elsewhere (--vault-key, --hsm-key-label, --kms-key, --key-id)")
+	}
+	return GetOfflineCreds(credsFile)
+}
+
+// getSigningCredsFiles reads and combines the offline TUF keys from several files for a command signing
+// TUF metadata. If no files are given, only the keys held elsewhere are used, e.g. in Vault or an HSM.
+func getSigningCredsFiles(keysFiles []string) OfflineCreds {
+	if len(keysFiles) == 0 {
+		keysFiles = []string{""}
+	}
+	creds := make(OfflineCreds)
+	for _, keysFile := range keysFiles {
+		fileCreds, err := GetSigningCreds(keysFile)
+		subcommands.DieNotNil(err)
+		for name, content := range fileCreds {
+			creds[name] = content
+		}
+	}
+	return creds
+}
+
+// externalTufKeyPair returns the key pair of a key held outside of the offline TUF keys for a key rotation.
+// It only has the public key, as the private key never leaves the external key store.
+func externalTufKeyPair(signer *client.TufSigner, err error) TufKeyPair {
+	subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err))
+	pubKey, err := client.TufPublicKeyValue(*signer)
+	subcommands.DieNotNil(err)
+	pub := client.AtsKey{
+		KeyType:  signer.Type.Name(),
+		KeyValue: client.AtsKeyVal{Public: pubKey},
+	}
+	atsPubBytes, err := json.Marshal(pub)
+	subcommands.DieNotNil(err)
+	tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+	return TufKeyPair{signer: *signer, atsPub: pub, atsPubBytes: atsPubBytes}
+}
+
+// addNewTufKeyFlags adds the flags of a key rotation selecting a new key held outside of the offline TUF keys.
+func addNewTufKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().String("new-vault-key", "",
+		"Rotate to this key of the HashiCorp Vault transit engine, instead of generating a new key.")
+	cmd.Flags().String("new-hsm-key-label", "",
+		"Rotate to the key of this label on a PKCS#11 token, instead of generating a new key. See --hsm-module.")
+	cmd.Flags().String("new-kms-key", "",
+		"Rotate to this key of a cloud KMS, instead of generating a new key. See --kms-key for the supported keys.")
+	cmd.Flags().Bool("yubikey", false,
+		"Rotate to a key generated in a PIV slot of the YubiKey, which asks for the PIN and a touch to sign. Requires ykman.")
+	cmd.Flags().String("yubikey-slot", "9c", "The PIV slot of the YubiKey for the new key: 9a, 9c, 9d, or 9e")
+	cmd.Flags().Bool("tpm", false,
+		"Rotate to a key generated in the TPM 2.0 of this computer, which can not be copied out of it. Requires tpm2-tools.")
+	cmd.MarkFlagsMutuallyExclusive("new-vault-key", "new-hsm-key-label", "new-kms-key", "yubikey", "tpm")
+}
+
+// hasNewExternalTufKey tells if a key rotation uses a new key held outside of the offline TUF keys.
+// A key on a YubiKey or a TPM is not external, as the offline TUF keys keep a reference to it.
+// A key generated elsewhere is external when only its public key is imported.
+func hasNewExternalTufKey(cmd *cobra.Command) bool {
+	return cmd.Flags().Changed("new-vault-key") || cmd.Flags().Changed("new-hsm-key-label") ||
+		cmd.Flags().Changed("new-kms-key") || (cmd.Flags().Changed("pubkey") && !cmd.Flags().Changed("privkey"))
+}
+
+// genOfflineTufKeyPair returns the new key of a key rotation: either a key of an external key store
+// if one of the --new-vault-key, --new-hsm-key-label, or --new-kms-key flags is set, a new key on
+// the YubiKey or the TPM if the --yubikey or --tpm flag is set, a key generated elsewhere if the
+// --pubkey flag is set, or a new key pair of the type set by the --key-type flag.
+func genOfflineTufKeyPair(cmd *cobra.Command) TufKeyPair {
+	if yubikey, _ := cmd.Flags().GetBool("yubikey"); yubikey {
+		return genYubikeyTufKeyPair(cmd)
+	}
+	if tpm, _ := cmd.Flags().GetBool("tpm"); tpm {
+		return genTpmTufKeyPair(cmd)
+	}
+	if pubFile, _ := cmd.Flags().GetString("pubkey"); len(pubFile) > 0 {
+		privFile, _ := cmd.Flags().GetString("privkey")
+		return importTufKeyPair(pubFile, privFile)
+	}
+	if !hasNewExternalTufKey(cmd) {
+		keyTypeStr, _ := cmd.Flags().GetString("key-type")
+		return genTufKeyPair(ParseTufKeyType(keyTypeStr))
+	}
+	if cmd.Flags().Changed("key-type") {
+		subcommands.DieNotNil(errors.New("The --key-type flag can not be used with a key of an external key store, the type of that key is used"))
+	}
+	if name, _ := cmd.Flags().GetString("new-vault-key"); len(name) > 0 {
+		return externalTufKeyPair(keyStoreApi().NewVaultTransitSigner(vaultTransitConfig(cmd), name))
+	}
+	if name, _ := cmd.Flags().GetString("new-kms-key"); len(name) > 0 {
+		return externalTufKeyPair(kmsTufSigner(kmsKeyBackend(cmd), name))
+	}
+	label, _ := cmd.Flags().GetString("new-hsm-key-label")
+	return externalTufKeyPair(hsmTufSigner(tufHsmConfig(cmd), label))
+}
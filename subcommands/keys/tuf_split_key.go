@@ -0,0 +1,321 @@
+package keys
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	splitCmd := &cobra.Command{
+		Use:   "split-key --keys=<tuf-root-keys.tgz> --shares=<n> --threshold=<m> --out-dir=<dir>",
+		Short: "Split an offline TUF private key into shares for several custodians",
+		Long: `Split an offline TUF private key into shares using Shamir's secret sharing, so that no single
+person holds the full key. Any threshold number of shares restores the key with "fioctl keys tuf combine-key",
+while fewer shares reveal nothing about it.
+
+Each share is saved to its own file in the output directory, to be handed over to one custodian.
+A share file also holds the public key, so that the restored key can be checked.
+An encrypted key is split as is, and still needs its passphrase after it is restored.`,
+		Example: `
+- Split the root key, so that any 3 of 5 custodians can restore it:
+  fioctl keys tuf split-key --keys=tuf-root-keys.tgz --shares=5 --threshold=3 --out-dir=shares/
+- Split the targets key, or one of several root keys:
+  fioctl keys tuf split-key --keys=tuf-root-keys.tgz --key-id=81eef5fb --shares=3 --threshold=2 --out-dir=shares/`,
+		Run:  doTufSplitKey,
+		Args: cobra.NoArgs,
+	}
+	splitCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> holding the key to split.")
+	splitCmd.Flags().String("key-id", "", "ID of the key to split, or its unique prefix (default: the root key).")
+	splitCmd.Flags().Int("shares", 0, "Number of shares to split the key into.")
+	splitCmd.Flags().Int("threshold", 0, "Number of shares needed to restore the key.")
+	splitCmd.Flags().StringP("out-dir", "o", "", "Directory to save the share files to.")
+	_ = splitCmd.MarkFlagFilename("keys")
+	_ = splitCmd.MarkFlagRequired("keys")
+	_ = splitCmd.MarkFlagRequired("shares")
+	_ = splitCmd.MarkFlagRequired("threshold")
+	_ = splitCmd.MarkFlagDirname("out-dir")
+	_ = splitCmd.MarkFlagRequired("out-dir")
+	tufCmd.AddCommand(offline(splitCmd))
+
+	combineCmd := &cobra.Command{
+		Use:   "combine-key <share.json>... --keys=<tuf-root-keys.tgz>",
+		Short: "Restore an offline TUF private key from the shares made by split-key",
+		Long: `Restore an offline TUF private key from at least a threshold number of the shares made by
+"fioctl keys tuf split-key". The restored key is checked against its public key, and added to the given
+offline TUF keys, which are created if they do not exist.`,
+		Example: `
+- Restore the root key from the shares of 3 custodians:
+  fioctl keys tuf combine-key alice.json bob.json carol.json --keys=tuf-root-keys.tgz`,
+		Run:  doTufCombineKey,
+		Args: cobra.MinimumNArgs(1),
+	}
+	combineCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to add the restored key to.")
+	_ = combineCmd.MarkFlagFilename("keys")
+	_ = combineCmd.MarkFlagRequired("keys")
+	tufCmd.AddCommand(offline(combineCmd))
+}
+
+// tufKeyShare is a share of an offline TUF private key file, as saved by split-key.
+type tufKeyShare struct {
+	KeyId     string          `json:"key-id"`
+	Name      string          `json:"name"`
+	Public    json.RawMessage `json:"public"`
+	Threshold int             `json:"threshold"`
+	Shares    int             `json:"shares"`
+	Index     int             `json:"index"`
+	Share     string          `json:"share"`
+}
+
+func doTufSplitKey(cmd *cobra.Command, args []string) {
+	credsFile, _ := cmd.Flags().GetString("keys")
+	prefix, _ := cmd.Flags().GetString("key-id")
+	numShares, _ := cmd.Flags().GetInt("shares")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	outDir, _ := cmd.Flags().GetString("out-dir")
+
+	if numShares < 2 || numShares > 255 {
+		subcommands.DieNotNil(subcommands.ValidationError("The number of shares must be between 2 and 255"))
+	}
+	if threshold < 2 || threshold > numShares {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The threshold must be between 2 and the number of shares (%d)", numShares))
+	}
+
+	creds, err := GetOfflineCreds(credsFile)
+	subcommands.DieNotNil(err)
+	names, ids := tufCredsPrivateKeys(creds)
+	var matches []string
+	for _, name := range names {
+		if len(prefix) > 0 && strings.HasPrefix(ids[name], prefix) ||
+			len(prefix) == 0 && strings.HasPrefix(name, "tufrepo/keys/fioctl-root-") {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 && len(prefix) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There is no root private key in %s, select a key with --key-id", credsFile)))
+	} else if len(matches) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("There is no private key with the ID %s in %s", prefix, credsFile)))
+	} else if len(matches) > 1 {
+		var found []string
+		for _, name := range matches {
+			found = append(found, ids[name])
+		}
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"There are several private keys in %s, select one with --key-id:\n  %s", credsFile, strings.Join(found, "\n  ")))
+	}
+	name := matches[0]
+	kid := ids[name]
+	var priv client.AtsKey
+	subcommands.DieNotNil(json.Unmarshal(creds[name], &priv), "Unable to parse JSON for "+name+":")
+	if len(priv.KeyValue.Private) == 0 {
+		// YubiKey and TPM keys only have a reference to the device holding the private key
+		subcommands.DieNotNil(subcommands.ValidationError("The key %s is not held in %s, it can not be split", kid, credsFile))
+	}
+
+	shares, err := shamirSplit(creds[name], numShares, threshold)
+	subcommands.DieNotNil(err)
+
+	subcommands.DieNotNil(os.MkdirAll(outDir, 0o700))
+	paths := make([]string, numShares)
+	for i := range shares {
+		paths[i] = filepath.Join(outDir, fmt.Sprintf("%.8s-share-%d-of-%d.json", kid, i+1, numShares))
+		refuseOverwrite(paths[i])
+	}
+	base := strings.TrimSuffix(name, ".sec")
+	for i, share := range shares {
+		buf, err := subcommands.MarshalIndent(tufKeyShare{
+			KeyId:     kid,
+			Name:      base,
+			Public:    creds[base+".pub"],
+			Threshold: threshold,
+			Shares:    numShares,
+			Index:     i + 1,
+			Share:     hex.EncodeToString(share),
+		}, "", "  ")
+		subcommands.DieNotNil(err)
+		subcommands.DieNotNil(os.WriteFile(paths[i], buf, 0o600))
+	}
+	fmt.Printf("= Split the key %s into %d shares, %d of which restore it:\n", kid, numShares, threshold)
+	for _, path := range paths {
+		fmt.Println("  ", path)
+	}
+	fmt.Println("Hand each share over to a different custodian, and remove the key from any archive which is not kept in a safe.")
+}
+
+func doTufCombineKey(cmd *cobra.Command, args []string) {
+	credsFile, _ := cmd.Flags().GetString("keys")
+
+	var first tufKeyShare
+	xs := make([]byte, 0, len(args))
+	ys := make([][]byte, 0, len(args))
+	seen := make(map[int]string)
+	for i, path := range args {
+		buf, err := os.ReadFile(path)
+		subcommands.DieNotNil(err)
+		var share tufKeyShare
+		subcommands.DieNotNil(json.Unmarshal(buf, &share), "Unable to parse "+path+":")
+		if i == 0 {
+			first = share
+		} else if share.KeyId != first.KeyId || share.Threshold != first.Threshold || share.Shares != first.Shares {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The share %s is not of the same split as %s", path, args[0]))
+		}
+		if share.Index < 1 || share.Index > share.Shares {
+			subcommands.DieNotNil(subcommands.ValidationError("The share %s has an invalid index: %d", path, share.Index))
+		}
+		if prev, ok := seen[share.Index]; ok {
+			subcommands.DieNotNil(subcommands.ValidationError("The shares %s and %s are the same share", prev, path))
+		}
+		seen[share.Index] = path
+		y, err := hex.DecodeString(share.Share)
+		subcommands.DieNotNil(err, "Unable to parse "+path+":")
+		xs = append(xs, byte(share.Index))
+		ys = append(ys, y)
+	}
+	if len(args) < first.Threshold {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The key %s needs %d shares, only %d are given", first.KeyId, first.Threshold, len(args)))
+	}
+
+	secret, err := shamirCombine(xs, ys)
+	subcommands.DieNotNil(err)
+	var pub, priv client.AtsKey
+	subcommands.DieNotNil(json.Unmarshal(first.Public, &pub), "Unable to parse the public key in the shares:")
+	errCorrupted := fmt.Errorf("The shares do not restore the key %s; some of them are corrupted or of another split", first.KeyId)
+	if json.Unmarshal(secret, &priv) != nil {
+		subcommands.DieNotNil(errCorrupted)
+	}
+	if client.IsEncryptedTufKey(priv.KeyValue.Private) {
+		fmt.Println("= The restored key is encrypted, it can not be checked without its passphrase")
+	} else {
+		keyType, err := client.ParseTufKeyType(priv.KeyType)
+		subcommands.DieNotNil(err)
+		pk, err := keyType.ParseKey(priv.KeyValue.Private)
+		if err != nil || genTufKeyId(pk) != first.KeyId {
+			subcommands.DieNotNil(errCorrupted)
+		}
+	}
+	if id, err := tufPublicKeyId(pub); err != nil || id != first.KeyId {
+		subcommands.DieNotNil(errCorrupted)
+	}
+
+	var creds OfflineCreds
+	if _, statErr := os.Stat(credsFile); errors.Is(statErr, os.ErrNotExist) {
+		fmt.Println("= Creating new offline TUF keys:", credsFile)
+		creds = make(OfflineCreds)
+	} else {
+		creds, err = GetOfflineCreds(credsFile)
+		subcommands.DieNotNil(err)
+		subcommands.AssertWritable(credsFile)
+	}
+	for base, id := range credsKeyIds(credsFile, creds) {
+		if id == first.KeyId {
+			if _, ok := creds[base+".sec"]; ok {
+				subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict,
+					fmt.Errorf("The key %s is already in %s", first.KeyId, credsFile)))
+			}
+		}
+	}
+	creds[first.Name+".pub"] = first.Public
+	creds[first.Name+".sec"] = secret
+	tmp := saveTempTufCreds(credsFile, creds)
+	subcommands.DieNotNil(os.Rename(tmp, credsFile))
+	fmt.Printf("= Restored the key %s to %s\n", first.KeyId, credsFile)
+}
+
+// shamirSplit splits the secret into n shares, any m of which restore it. Each byte of the secret is the
+// constant term of a random polynomial of degree m-1 over GF(2^8), and share i holds its values at x=i.
+func shamirSplit(secret []byte, n, m int) ([][]byte, error) {
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+	coefs := make([]byte, m)
+	for pos, b := range secret {
+		if _, err := rand.Read(coefs[1:]); err != nil {
+			return nil, err
+		}
+		coefs[0] = b
+		for i := range shares {
+			x := byte(i + 1)
+			// Horner's method
+			var y byte
+			for j := m - 1; j >= 0; j-- {
+				y = gf256Mul(y, x) ^ coefs[j]
+			}
+			shares[i][pos] = y
+		}
+	}
+	return shares, nil
+}
+
+// shamirCombine restores the secret from the shares at the given x values by Lagrange interpolation at x=0.
+func shamirCombine(xs []byte, shares [][]byte) ([]byte, error) {
+	size := len(shares[0])
+	for _, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("The shares have different sizes")
+		}
+	}
+	sorted := append([]byte(nil), xs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return nil, errors.New("The shares are not distinct")
+		}
+	}
+	secret := make([]byte, size)
+	for i, xi := range xs {
+		// The Lagrange basis polynomial of xi at x=0; subtraction is XOR in GF(2^8)
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gf256Mul(basis, gf256Div(xj, xj^xi))
+			}
+		}
+		for pos := range secret {
+			secret[pos] ^= gf256Mul(shares[i][pos], basis)
+		}
+	}
+	return secret, nil
+}
+
+// gf256Mul multiplies in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1.
+func gf256Mul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gf256Div divides in GF(2^8): a / b = a * b^254, since b^255 = 1 for any non-zero b.
+func gf256Div(a, b byte) byte {
+	inv := byte(1)
+	for i := 0; i < 254; i++ {
+		inv = gf256Mul(inv, b)
+	}
+	return gf256Mul(a, inv)
+}
@@ -0,0 +1,261 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// A key in a TPM is recorded in the offline TUF keys by a reference file next to its public key,
+// e.g. tufrepo/keys/fioctl-root-<keyid>.tpm, instead of the private key file.
+const tpmRefSuffix = ".tpm"
+
+// The first persistent handle tried for a new key; the owner hierarchy range ends at 0x817fffff
+const tpmFirstHandle = 0x81000100
+
+type tpmRef struct {
+	Handle   string `json:"handle"`
+	Password bool   `json:"password,omitempty"`
+}
+
+// tpmSigner signs digests with an RSA key persisted in a TPM 2.0 using tpm2-tools.
+type tpmSigner struct {
+	ref      tpmRef
+	pub      *rsa.PublicKey
+	password string
+}
+
+func (s *tpmSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *tpmSigner) onDevice() {}
+
+func (s *tpmSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	pss, ok := opts.(*rsa.PSSOptions)
+	if !ok || opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("Only RSA-PSS signatures with SHA-256 are supported by TPM keys")
+	}
+	if s.ref.Password && len(s.password) == 0 {
+		password, err := subcommands.PromptSecret("Password of the TPM key " + s.ref.Handle)
+		if err != nil {
+			return nil, err
+		}
+		s.password = password
+	}
+
+	tmpDir, err := os.MkdirTemp("", "fioctl-tpm-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	digestFile := filepath.Join(tmpDir, "digest")
+	sigFile := filepath.Join(tmpDir, "sig")
+	if err := os.WriteFile(digestFile, digest, 0600); err != nil {
+		return nil, err
+	}
+	args := []string{"-c", s.ref.Handle, "-g", "sha256", "-s", "rsapss", "-d", "-f", "plain", "-o", sigFile}
+	authArgs, err := tpmAuthArgs(tmpDir, s.password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tpm2("tpm2_sign", append(append(args, authArgs...), digestFile)...); err != nil {
+		return nil, err
+	}
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// TUF clients expect a salt of the hash length, which is what a TPM uses unless it runs in FIPS mode
+	if err := rsa.VerifyPSS(s.pub, crypto.SHA256, digest, sig, pss); err != nil {
+		return nil, fmt.Errorf("The TPM key %s returned a signature which does not verify with a salt length of %d: %w",
+			s.ref.Handle, pss.SaltLength, err)
+	}
+	return sig, nil
+}
+
+// tpmAuthArgs returns the arguments passing a password to tpm2-tools. The password is passed via
+// a private file rather than the command line, so that it is not visible to other users in the process list.
+func tpmAuthArgs(tmpDir, password string) ([]string, error) {
+	if len(password) == 0 {
+		return nil, nil
+	}
+	authFile := filepath.Join(tmpDir, "auth")
+	if err := os.WriteFile(authFile, []byte(password), 0600); err != nil {
+		return nil, err
+	}
+	return []string{"-p", "file:" + authFile}, nil
+}
+
+func tpm2(tool string, args ...string) ([]byte, error) {
+	cmd := exec.Command(tool, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", tool, err)
+	}
+	return out, nil
+}
+
+func tpmTufSigner(ref tpmRef, pub client.AtsKey) (*client.TufSigner, error) {
+	if _, err := strconv.ParseUint(strings.TrimPrefix(ref.Handle, "0x"), 16, 32); err != nil {
+		return nil, fmt.Errorf("Invalid TPM handle: %s", ref.Handle)
+	}
+	pubKey, err := parseTufPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pubKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Only RSA keys are supported in a TPM")
+	}
+	key := &tpmSigner{ref: ref, pub: rsaPub}
+	kid, err := client.GenTufKeyId(key)
+	if err != nil {
+		return nil, err
+	}
+	keyType, _ := client.ParseTufKeyType(client.TufKeyTypeNameRSA)
+	return &client.TufSigner{Id: kid, Type: keyType, Key: key}, nil
+}
+
+// loadTpmTufSigners adds the keys in the TPM referenced by the offline TUF keys to the external signers.
+func loadTpmTufSigners(creds OfflineCreds) error {
+	for name, content := range creds {
+		if !strings.HasSuffix(name, tpmRefSuffix) {
+			continue
+		}
+		var ref tpmRef
+		if err := json.Unmarshal(content, &ref); err != nil {
+			return fmt.Errorf("Unable to parse %s: %w", name, err)
+		}
+		pubFile := strings.TrimSuffix(name, tpmRefSuffix) + ".pub"
+		var pub client.AtsKey
+		if err := json.Unmarshal(creds[pubFile], &pub); err != nil {
+			return fmt.Errorf("Unable to parse the public key %s of the TPM key: %w", pubFile, err)
+		}
+		signer, err := tpmTufSigner(ref, pub)
+		if err != nil {
+			return fmt.Errorf("Invalid TPM key %s: %w", name, err)
+		}
+		tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+	}
+	return nil
+}
+
+// tpmFreeHandle returns the first persistent handle of the owner hierarchy which is not used yet.
+func tpmFreeHandle() (string, error) {
+	out, err := tpm2("tpm2_getcap", "handles-persistent")
+	if err != nil {
+		return "", err
+	}
+	used := make(map[uint64]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		handle := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+		if val, err := strconv.ParseUint(strings.TrimPrefix(handle, "0x"), 16, 32); err == nil {
+			used[val] = true
+		}
+	}
+	for handle := uint64(tpmFirstHandle); handle <= 0x817fffff; handle++ {
+		if !used[handle] {
+			return fmt.Sprintf("0x%x", handle), nil
+		}
+	}
+	return "", errors.New("The TPM has no free persistent handles")
+}
+
+// genTpmTufKeyPair generates a new RSA key in the TPM for a key rotation, and persists it.
+// The key can not be exported from the TPM; only the public key and a reference to the key's
+// persistent handle are saved to the offline TUF keys.
+func genTpmTufKeyPair(cmd *cobra.Command) TufKeyPair {
+	if cmd.Flags().Changed("key-type") {
+		subcommands.DieNotNil(subcommands.ValidationError("The --key-type flag can not be used with --tpm, only RSA keys are supported"))
+	}
+	handle, err := tpmFreeHandle()
+	subcommands.DieNotNil(err)
+
+	ref := tpmRef{Handle: handle}
+	password, err := subcommands.PromptSecret("Password to protect the TPM key (empty for none)")
+	if err == nil && len(password) > 0 {
+		confirm, err := subcommands.PromptSecret("Repeat the password")
+		subcommands.DieNotNil(err)
+		if confirm != password {
+			subcommands.DieNotNil(subcommands.ValidationError("The passwords do not match"))
+		}
+		ref.Password = true
+	}
+	if !ref.Password {
+		fmt.Fprintln(tufProgress, "= The TPM key is not protected by a password; any user with access to the TPM can sign with it")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "fioctl-tpm-")
+	subcommands.DieNotNil(err)
+	defer os.RemoveAll(tmpDir)
+	primary := filepath.Join(tmpDir, "primary.ctx")
+	keyPub := filepath.Join(tmpDir, "key.pub")
+	keyPriv := filepath.Join(tmpDir, "key.priv")
+	keyCtx := filepath.Join(tmpDir, "key.ctx")
+	pubPem := filepath.Join(tmpDir, "key.pem")
+	authArgs, err := tpmAuthArgs(tmpDir, password)
+	subcommands.DieNotNil(err)
+
+	fmt.Fprintf(tufProgress, "= Generating an RSA key in the TPM at the persistent handle %s\n", handle)
+	_, err = tpm2("tpm2_createprimary", "-C", "o", "-g", "sha256", "-G", "ecc", "-c", primary)
+	subcommands.DieNotNil(err)
+	args := []string{"-C", primary, "-g", "sha256", "-G", "rsa2048", "-u", keyPub, "-r", keyPriv,
+		"-a", "fixedtpm|fixedparent|sensitivedataorigin|userwithauth|sign"}
+	_, err = tpm2("tpm2_create", append(args, authArgs...)...)
+	subcommands.DieNotNil(err)
+	_, err = tpm2("tpm2_load", "-C", primary, "-u", keyPub, "-r", keyPriv, "-c", keyCtx)
+	subcommands.DieNotNil(err)
+	_, err = tpm2("tpm2_evictcontrol", "-C", "o", "-c", keyCtx, handle)
+	subcommands.DieNotNil(err)
+	_, err = tpm2("tpm2_readpublic", "-c", handle, "-f", "pem", "-o", pubPem)
+	subcommands.DieNotNil(err)
+
+	pemBytes, err := os.ReadFile(pubPem)
+	subcommands.DieNotNil(err)
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		subcommands.DieNotNil(errors.New("Unable to parse the public key generated by the TPM"))
+	}
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		subcommands.DieNotNil(fmt.Errorf("Unable to parse the public key generated by the TPM: %w", err))
+	}
+	pub := client.AtsKey{
+		KeyType:  client.TufKeyTypeNameRSA,
+		KeyValue: client.AtsKeyVal{Public: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: block.Bytes}))},
+	}
+
+	signer, err := tpmTufSigner(ref, pub)
+	subcommands.DieNotNil(err)
+	// The password was just set, so it is not asked for again to sign the new TUF root
+	signer.Key.(*tpmSigner).password = password
+	atsPubBytes, err := json.Marshal(pub)
+	subcommands.DieNotNil(err)
+	refBytes, err := json.Marshal(ref)
+	subcommands.DieNotNil(err)
+	tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+	return TufKeyPair{
+		signer:       *signer,
+		atsPub:       pub,
+		atsPubBytes:  atsPubBytes,
+		keyRefSuffix: tpmRefSuffix,
+		keyRefBytes:  refBytes,
+	}
+}
@@ -0,0 +1,145 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	canonical "github.com/docker/go/canonical/json"
+	"github.com/spf13/cobra"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// tufTranscriptEntry is the signed part of an entry of a key ceremony transcript.
+// Each entry has the hash of the previous line, so that removing or changing an entry breaks the chain.
+type tufTranscriptEntry struct {
+	Time       time.Time             `json:"time"`
+	Command    string                `json:"command"`
+	Operator   tufTranscriptOperator `json:"operator"`
+	Status     string                `json:"status"`
+	Result     *tufCommandResult     `json:"result"`
+	PrevSha256 string                `json:"prev-sha256"`
+	PublicKey  client.AtsKey         `json:"public-key"`
+}
+
+type tufTranscriptOperator struct {
+	User string `json:"user"`
+	Host string `json:"host"`
+}
+
+// tufTranscriptLine is a line of a key ceremony transcript, signed the same way as TUF metadata.
+type tufTranscriptLine struct {
+	Signed     tufTranscriptEntry `json:"signed"`
+	Signatures []tuf.Signature    `json:"signatures"`
+}
+
+type tufTranscript struct {
+	path   string
+	signer TufSigner
+	pub    client.AtsKey
+}
+
+// addTufTranscriptFlags adds the flags to append an entry to a key ceremony transcript.
+func addTufTranscriptFlags(cmd *cobra.Command) {
+	cmd.Flags().String("transcript", "",
+		"Append a signed entry recording the changes made by this command to this key ceremony transcript.")
+	_ = cmd.MarkFlagFilename("transcript")
+	cmd.Flags().String("transcript-key", "", "Path to the PEM private key of the operator, used to sign the transcript, or keychain:<name> for a key in the OS keychain.")
+	_ = cmd.MarkFlagFilename("transcript-key")
+	cmd.MarkFlagsRequiredTogether("transcript", "transcript-key")
+}
+
+// openTufTranscript checks the transcript can be appended to, before any change is made.
+func openTufTranscript(path, keyFile string) *tufTranscript {
+	priv, err := readPemPrivateKey(keyFile)
+	subcommands.DieNotNil(err, keyFile+":")
+	keyType, err := tufKeyTypeOfPublicKey(priv.Public())
+	subcommands.DieNotNil(err, keyFile+":")
+	kp := tufKeyPairOf(keyType, priv)
+	_, err = tufTranscriptLastHash(path)
+	subcommands.DieNotNil(err)
+	return &tufTranscript{path: path, signer: kp.signer, pub: kp.atsPub}
+}
+
+// tufTranscriptLastHash checks the hash chain of a transcript, and returns the hash of its last line.
+func tufTranscriptLastHash(path string) (string, error) {
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	prev := ""
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Buffer(nil, len(buf)+1)
+	for idx := 1; scanner.Scan(); idx++ {
+		var line tufTranscriptLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return "", fmt.Errorf("Invalid line %d of the transcript %s: %w", idx, path, err)
+		}
+		if line.Signed.PrevSha256 != prev {
+			return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf(
+				"The line %d of the transcript %s does not follow the previous line: the transcript was changed", idx, path))
+		}
+		sum := sha256.Sum256(scanner.Bytes())
+		prev = hex.EncodeToString(sum[:])
+	}
+	return prev, scanner.Err()
+}
+
+// append signs and appends an entry to the transcript for the result of a command.
+func (t *tufTranscript) append(cmd *cobra.Command, result *tufCommandResult, status string) error {
+	prev, err := tufTranscriptLastHash(t.path)
+	if err != nil {
+		return err
+	}
+	entry := tufTranscriptEntry{
+		Time:       time.Now().UTC().Round(time.Second),
+		Command:    cmd.CommandPath(),
+		Operator:   currentTufOperator(),
+		Status:     status,
+		Result:     result,
+		PrevSha256: prev,
+		PublicKey:  t.pub,
+	}
+	signed, err := canonical.MarshalCanonical(entry)
+	if err != nil {
+		return err
+	}
+	sigs, err := SignTufMeta(signed, t.signer)
+	if err != nil {
+		return err
+	}
+	line, err := canonical.MarshalCanonical(tufTranscriptLine{Signed: entry, Signatures: sigs})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func currentTufOperator() (op tufTranscriptOperator) {
+	if u, err := user.Current(); err == nil {
+		op.User = u.Username
+	}
+	op.Host, _ = os.Hostname()
+	return
+}
@@ -51,13 +51,13 @@ func init() {
 		if isTufUpdatesShortcut {
 			if isTufUpdatesInitialized {
 				// Tuf updates initialized; but the shortcut failed before trying to apply it.
-				fmt.Println(`
+				fmt.Fprintln(tufProgress, `
 No changes were made to your Factory.
 Please, cancel the staged TUF root updates
 using the "fioctl keys tuf updates cancel" command, and try again later.`)
 			} else {
 				// The init phase failed itself, so there is no active transaction.
-				fmt.Println(`
+				fmt.Fprintln(tufProgress, `
 No changes were made to your Factory.
 Please, fix an error above and try again.`)
 			}
@@ -0,0 +1,113 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	add := &cobra.Command{
+		Use:   "add-offline-key --txid=<txid> --keys=<tuf-root-keys.tgz> [--threshold=<n>]",
+		Short: "Stage adding an offline TUF root key for the Factory",
+		Long: `Stage adding an offline TUF root key for the Factory.
+
+A TUF root may have several offline root keys, each held by another admin, with a threshold of
+the keys required to sign a new TUF root. This command generates a new root key, and adds it
+to the root keys. The new key is saved to the given offline TUF keys, which are created if they
+do not exist, so that each admin can keep their root key in a separate file.
+
+The new TUF root must be signed by a threshold of both the current and the new root keys.
+Each admin signs it with their root keys using "fioctl keys tuf updates sign".`,
+		Example: `
+- Add a second offline TUF root key kept by another admin, and require both root keys to sign:
+  fioctl keys tuf updates add-offline-key \
+    --txid=abc --keys=admin2-root-keys.tgz --threshold=2 --sign
+- Add an offline TUF root key generated on a YubiKey, keeping the current threshold:
+  fioctl keys tuf updates add-offline-key \
+    --txid=abc --keys=admin3-root-keys.tgz --yubikey --sign`,
+		Run: doTufUpdatesAddOfflineKey,
+	}
+	add.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	add.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> to save the new root key to, and sign TUF root with.")
+	_ = add.MarkFlagFilename("keys")
+	addTufKeyTypeFlag(add)
+	add.Flags().Int("threshold", 0, "The number of root keys required to sign TUF root. Unchanged if not set.")
+	add.Flags().BoolP("sign", "s", false, "Sign the new TUF root using the offline root keys.")
+	addNewTufKeyFlags(add)
+	addTufExpiresFlag(add)
+	addTufSigningKeyIdFlag(add)
+	AddTufSignerFlags(add)
+	addTufUpdatesDryRunFlag(add)
+	addTufResultFlags(add)
+	tufUpdatesCmd.AddCommand(add)
+}
+
+func doTufUpdatesAddOfflineKey(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	txid, _ := cmd.Flags().GetString("txid")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	shouldSign, _ := cmd.Flags().GetBool("sign")
+
+	if keysFile == "" && !hasNewExternalTufKey(cmd) {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The --keys option is required to add an offline TUF root key.",
+		))
+	}
+
+	var creds OfflineCreds
+	var err error
+	if _, statErr := os.Stat(keysFile); keysFile != "" && errors.Is(statErr, os.ErrNotExist) {
+		fmt.Fprintln(tufProgress, "= Creating new offline TUF keys:", keysFile)
+		creds = make(OfflineCreds)
+	} else {
+		creds, err = GetSigningCreds(keysFile)
+		subcommands.DieNotNil(err)
+		if keysFile != "" {
+			subcommands.AssertWritable(keysFile)
+		}
+	}
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	curCiRoot, newCiRoot := checkTufRootUpdatesStatus(updates, true)
+
+	role := newCiRoot.Signed.Roles["root"]
+	setTufRootThreshold(cmd, role, len(role.KeyIDs)+1, threshold)
+	kp := genOfflineTufKeyPair(cmd)
+	for _, kid := range role.KeyIDs {
+		if kid == kp.signer.Id {
+			subcommands.DieNotNil(fmt.Errorf("The key %s is already a TUF root key", kid))
+		}
+	}
+	newCiRoot.Signed.Keys[kp.signer.Id] = kp.atsPub
+	role.KeyIDs = append(role.KeyIDs, kp.signer.Id)
+	saveTufKeyPair(creds, "tufrepo/keys/fioctl-root-"+kp.signer.Id, kp)
+	fmt.Fprintf(tufProgress, "= New root keyid: %s (%d of %d root keys required)\n", kp.signer.Id, role.Threshold, len(role.KeyIDs))
+	tufResult.addNewKey("root", kp.signer.Id, kp.atsPub.KeyType, false)
+	tufSelectedKeyIds = append(tufSelectedKeyIds, kp.signer.Id)
+	setTufRootExpires(cmd, newCiRoot, true)
+
+	newCiRoot.Signatures = make([]tuf.Signature, 0)
+	newProdRoot := genProdTufRoot(newCiRoot)
+	if shouldSign {
+		signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
+	}
+
+	if keysFile == "" {
+		// The new key is in an external key store, so there is nothing to save
+		subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
+		return
+	}
+	saveTempTufCreds(keysFile, creds)
+	err = putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil)
+	handleTufRootUpdatesUpload(cmd, err, keysFile)
+}
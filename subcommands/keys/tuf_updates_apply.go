@@ -20,6 +20,7 @@ func init() {
 		Run:   doTufUpdatesApply,
 	}
 	applyCmd.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	addTufResultFlags(applyCmd)
 	tufUpdatesCmd.AddCommand(applyCmd)
 }
 
@@ -58,7 +59,8 @@ If the error persists, please, contact the customer support.`
 		err = fmt.Errorf(msg, err)
 	}
 	subcommands.DieNotNil(err)
+	tufResult.setApplied()
 
-	fmt.Println(`The staged TUF root updates were applied to your Factory.
+	fmt.Fprintln(tufProgress, `The staged TUF root updates were applied to your Factory.
 Please, make sure that the updated TUF keys file(s) are stored in a safe place.`)
 }
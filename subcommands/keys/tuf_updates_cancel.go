@@ -21,6 +21,6 @@ func init() {
 func doTufUpdatesCancel(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	subcommands.DieNotNil(api.TufRootUpdatesCancel(factory))
-	fmt.Println(`The staged TUF root updates were canceled.
+	fmt.Fprintln(tufProgress, `The staged TUF root updates were canceled.
 No other changes were made to your Factory.`)
 }
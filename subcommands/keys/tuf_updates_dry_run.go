@@ -0,0 +1,55 @@
+package keys
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// addTufUpdatesDryRunFlag adds the --dry-run flag to a command staging a change of the TUF root.
+func addTufUpdatesDryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("dry-run", false,
+		"Print the new TUF root and targets signatures instead of uploading them. New offline TUF keys are saved to <keys>.dry-run.")
+}
+
+func isTufUpdatesDryRun(cmd *cobra.Command) bool {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	return dryRun
+}
+
+// putTufRootUpdates uploads the new TUF root and production targets signatures to the TUF root updates
+// transaction. With --dry-run, they are printed for a review instead.
+func putTufRootUpdates(
+	cmd *cobra.Command, factory, txid string,
+	ciRoot, prodRoot *client.AtsTufRoot, targetsSigs map[string][]tuf.Signature,
+) error {
+	tufResult.setTxid(txid)
+	tufResult.setRoots(isTufUpdatesDryRun(cmd), ciRoot, prodRoot)
+	if !isTufUpdatesDryRun(cmd) {
+		fmt.Fprintln(tufProgress, "= Uploading new TUF root")
+		if err := api.TufRootUpdatesPut(factory, txid, ciRoot, prodRoot, targetsSigs); err != nil {
+			return &tufUploadError{err, tufPendingUpload{factory, txid, ciRoot, prodRoot, targetsSigs}}
+		}
+		return nil
+	}
+
+	fmt.Fprintln(tufProgress, "= Dry run: the new TUF root is not uploaded")
+	for _, meta := range []struct {
+		name  string
+		value interface{}
+	}{{"New CI root", ciRoot}, {"New production root", prodRoot}, {"New production targets signatures", targetsSigs}} {
+		if sigs, ok := meta.value.(map[string][]tuf.Signature); ok && len(sigs) == 0 {
+			continue
+		}
+		buf, err := subcommands.MarshalIndent(meta.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tufProgress, "\n%s:\n%s\n", meta.name, buf)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package keys
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const (
+	// tufRootDefaultValidity is how long a new TUF root is valid for, unless set with --expires.
+	tufRootDefaultValidity = "1y"
+	// tufRootMinValidity is the shortest validity of a new TUF root: devices must have time to fetch it,
+	// and admins to rotate it again, before it expires.
+	tufRootMinValidity = 30 * 24 * time.Hour
+)
+
+// addTufExpiresFlag adds the --expires flag to a command staging a change of the TUF root.
+// The flag is validated before running the command, so that no key is generated for an invalid expiry.
+// It must be called once the command's Run function is set.
+func addTufExpiresFlag(cmd *cobra.Command) {
+	cmd.Flags().String("expires", "",
+		"When the new TUF root expires: a period like 90d or 2y, or a time in RFC 3339 format. "+
+			"The TUF root must be valid for at least 30 days.")
+	run := cmd.Run
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if value, _ := cmd.Flags().GetString("expires"); len(value) > 0 {
+			_, err := parseTufExpires(time.Now(), value)
+			subcommands.DieNotNil(err)
+		}
+		run(cmd, args)
+	}
+}
+
+// parseTufExpires returns when a TUF root expires, given a period like "90d" or "2y", or a time in RFC 3339 format.
+func parseTufExpires(now time.Time, value string) (time.Time, error) {
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if expires, err = parseValidity(now, value); err != nil {
+			return expires, subcommands.ValidationError(
+				"Invalid TUF root expiry: %s. Expected a period like 90d or 2y, or a time in RFC 3339 format.", value)
+		}
+	}
+	expires = expires.UTC().Round(time.Second)
+	if expires.Before(now.Add(tufRootMinValidity)) {
+		return expires, subcommands.ValidationError("The TUF root must be valid for at least %d days, but it would expire on %s.",
+			int(tufRootMinValidity.Hours()/24), subcommands.FormatTimestamp(expires))
+	}
+	return expires, nil
+}
+
+// setTufRootExpires sets when the new TUF root expires, from the --expires flag.
+// Without that flag, the expiry is reset to the default validity if the change requires a fresh TUF root,
+// e.g. for a new root key, and is kept unchanged otherwise. It returns if the expiry was changed.
+func setTufRootExpires(cmd *cobra.Command, root *client.AtsTufRoot, refresh bool) bool {
+	value, _ := cmd.Flags().GetString("expires")
+	if len(value) == 0 {
+		if !refresh {
+			return false
+		}
+		value = tufRootDefaultValidity
+	}
+	expires, err := parseTufExpires(time.Now(), value)
+	subcommands.DieNotNil(err)
+	if root.Signed.Expires.Equal(expires) {
+		return false
+	}
+	root.Signed.Expires = expires
+	fmt.Fprintln(tufProgress, "= New TUF root expires:", subcommands.FormatTimestamp(expires))
+	return true
+}
@@ -0,0 +1,79 @@
+package keys
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// tufUnsignedRoot is the staged TUF root carried to an air-gapped machine to be signed there.
+// The current CI root tells which root keys may sign the new root.
+type tufUnsignedRoot struct {
+	Factory   string             `json:"factory"`
+	CurCiRoot *client.AtsTufRoot `json:"current-ci-root"`
+	CiRoot    *client.AtsTufRoot `json:"ci-root"`
+	ProdRoot  *client.AtsTufRoot `json:"prod-root"`
+}
+
+// tufDetachedSignatures are the signatures of the staged TUF root made on an air-gapped machine.
+type tufDetachedSignatures struct {
+	Factory  string          `json:"factory"`
+	CiRoot   []tuf.Signature `json:"ci-root"`
+	ProdRoot []tuf.Signature `json:"prod-root"`
+}
+
+func init() {
+	export := &cobra.Command{
+		Use:   "export-unsigned --out=<unsigned-root.json>",
+		Short: "Export the staged TUF root to be signed on an air-gapped machine",
+		Long: `Export the staged TUF root to be signed on an air-gapped machine.
+
+The exported file holds the staged CI and production TUF root, which can be carried to an offline
+machine on removable media, and signed there with "fioctl keys sign-file". The resulting signatures
+are then merged into the transaction with "fioctl keys tuf updates import-signature".
+This way the offline TUF root keys never have to be on a machine connected to the network.
+
+The signatures are only valid for the exported content, so the TUF root must be exported again
+if the staged changes are modified before the signatures are imported.`,
+		Example: `
+- Sign the staged TUF root with the offline root keys kept on an air-gapped machine:
+  1. On the online machine, export the staged TUF root:
+     fioctl keys tuf updates export-unsigned --out=/media/usb/unsigned-root.json
+  2. On the air-gapped machine, sign it with the offline root keys:
+     fioctl keys sign-file --keys=tuf-root-keys.tgz --out=/media/usb/signatures.json /media/usb/unsigned-root.json
+  3. On the online machine, import the signatures, and apply the staged changes:
+     fioctl keys tuf updates import-signature --txid=abc --signatures=/media/usb/signatures.json
+     fioctl keys tuf updates apply --txid=abc`,
+		Run:  doTufUpdatesExportUnsigned,
+		Args: cobra.NoArgs,
+	}
+	export.Flags().StringP("out", "o", "", "Path to save the staged TUF root to.")
+	_ = export.MarkFlagRequired("out")
+	_ = export.MarkFlagFilename("out")
+	tufUpdatesCmd.AddCommand(export)
+}
+
+func doTufUpdatesExportUnsigned(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	outFile, _ := cmd.Flags().GetString("out")
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	curCiRoot, newCiRoot, newProdRoot := getStagedTufRoots(updates)
+	// Only the signed content is needed to sign the root; existing signatures are kept by the transaction
+	newCiRoot.Signatures = make([]tuf.Signature, 0)
+	newProdRoot.Signatures = make([]tuf.Signature, 0)
+
+	unsigned := tufUnsignedRoot{Factory: factory, CurCiRoot: curCiRoot, CiRoot: newCiRoot, ProdRoot: newProdRoot}
+	buf, err := subcommands.MarshalIndent(unsigned, "", "  ")
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.WriteFile(outFile, buf, 0644))
+	fmt.Fprintf(tufProgress, "= Staged TUF root version %d exported to %s\n", newCiRoot.Signed.Version, outFile)
+}
@@ -0,0 +1,97 @@
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	canonical "github.com/docker/go/canonical/json"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	importCmd := &cobra.Command{
+		Use:   "import-signature --txid=<txid> --signatures=<signatures.json>",
+		Short: "Add signatures of the staged TUF root made on an air-gapped machine",
+		Long: `Add signatures of the staged TUF root made on an air-gapped machine by "fioctl keys sign-file".
+
+Each signature is verified against the current and new root keys before it is added to the staged TUF root.
+The signatures made before are kept, so that the signatures of several admins can be imported one by one.
+If the staged TUF root was modified after it was exported, the signatures are rejected, and the TUF root
+must be exported and signed again.`,
+		Example: `
+- Import the signatures made on an air-gapped machine:
+  fioctl keys tuf updates import-signature --txid=abc --signatures=/media/usb/signatures.json`,
+		Run:  doTufUpdatesImportSignature,
+		Args: cobra.NoArgs,
+	}
+	importCmd.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	importCmd.Flags().StringArray("signatures", nil, "Path to <signatures.json> made by 'fioctl keys sign-file'. Can be repeated.")
+	_ = importCmd.MarkFlagRequired("signatures")
+	_ = importCmd.MarkFlagFilename("signatures")
+	addTufUpdatesDryRunFlag(importCmd)
+	addTufResultFlags(importCmd)
+	tufUpdatesCmd.AddCommand(importCmd)
+}
+
+func doTufUpdatesImportSignature(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	txid, _ := cmd.Flags().GetString("txid")
+	sigsFiles, _ := cmd.Flags().GetStringArray("signatures")
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	curCiRoot, newCiRoot, newProdRoot := getStagedTufRoots(updates)
+
+	for _, sigsFile := range sigsFiles {
+		buf, err := os.ReadFile(sigsFile)
+		subcommands.DieNotNil(err)
+		var sigs tufDetachedSignatures
+		subcommands.DieNotNil(json.Unmarshal(buf, &sigs), "Unable to parse "+sigsFile+":")
+		if sigs.Factory != factory {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The signatures in %s are made for the factory %s, not %s", sigsFile, sigs.Factory, factory))
+		}
+		fmt.Fprintln(tufProgress, "= Importing signatures from", sigsFile)
+		subcommands.DieNotNil(importTufRootSignatures(curCiRoot, newCiRoot, sigs.CiRoot), sigsFile+": CI root:")
+		subcommands.DieNotNil(importTufRootSignatures(curCiRoot, newProdRoot, sigs.ProdRoot), sigsFile+": prod root:")
+		for _, sig := range sigs.CiRoot {
+			fmt.Fprintln(tufProgress, "  by root key", sig.KeyID)
+			tufResult.addSigner(sig.KeyID)
+		}
+	}
+	printTufRootThresholds(curCiRoot, newCiRoot)
+
+	subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
+}
+
+// importTufRootSignatures adds the signatures to the new root, replacing those of the same keys.
+func importTufRootSignatures(curRoot, newRoot *client.AtsTufRoot, sigs []tuf.Signature) error {
+	if len(sigs) == 0 {
+		return subcommands.ValidationError("There are no signatures")
+	}
+	msg, err := canonical.MarshalCanonical(newRoot.Signed)
+	if err != nil {
+		return err
+	}
+	for _, sig := range sigs {
+		if err := verifyTufRootSignature(curRoot, newRoot, msg, sig); err != nil {
+			return subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf(
+				"Invalid signature by the key %s: %w\n"+
+					"If the staged TUF root changed since it was exported, please, export and sign it again.", sig.KeyID, err))
+		}
+		kept := newRoot.Signatures[:0]
+		for _, prev := range newRoot.Signatures {
+			if prev.KeyID != sig.KeyID {
+				kept = append(kept, prev)
+			}
+		}
+		newRoot.Signatures = append(kept, sig)
+	}
+	return nil
+}
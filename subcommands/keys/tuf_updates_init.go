@@ -23,6 +23,7 @@ func init() {
 	initCmd.Flags().StringP("keys", "k", "", "Path to <offline-creds.tgz> used to store initial root key.")
 	_ = initCmd.MarkFlagFilename("keys")
 	initCmd.MarkFlagsRequiredTogether("first-time", "keys")
+	addTufResultFlags(initCmd)
 	tufUpdatesCmd.AddCommand(initCmd)
 }
 
@@ -43,8 +44,9 @@ Please make sure you aren't accidentally overwriting another factory's keys`))
 	subcommands.DieNotNil(err)
 
 	isTufUpdatesInitialized = true
+	tufResult.setTxid(res.TransactionId)
 	if !isTufUpdatesShortcut {
-		fmt.Printf(`A new transaction to update TUF root keys started.
+		fmt.Fprintf(tufProgress, `A new transaction to update TUF root keys started.
 Your transaction ID is %s .
 Please, keep it secret and only share with participants of the transaction.
 Only the user who initiated the transaction can make changes to it without the transaction ID.
@@ -0,0 +1,101 @@
+package keys
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	remove := &cobra.Command{
+		Use:   "remove-offline-key --txid=<txid> --key-id=<keyid> [--threshold=<n>]",
+		Short: "Stage removing an offline TUF root key from the Factory",
+		Long: `Stage removing an offline TUF root key from the Factory.
+
+The TUF root must keep at least one offline root key. If the current threshold is higher than
+the number of remaining root keys, a new threshold must be set with the --threshold flag.
+The removed key is not deleted from the offline TUF keys holding it.
+
+The new TUF root must be signed by a threshold of both the current and the new root keys.
+Each admin signs it with their root keys using "fioctl keys tuf updates sign".`,
+		Example: `
+- Remove an offline TUF root key of a former admin, and require one of the remaining root keys to sign:
+  fioctl keys tuf updates remove-offline-key \
+    --txid=abc --key-id=6b8c9d... --threshold=1 --keys=admin1-root-keys.tgz --sign`,
+		Run: doTufUpdatesRemoveOfflineKey,
+	}
+	remove.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	remove.Flags().StringP("key-id", "i", "", "The ID of the TUF root key to remove.")
+	_ = remove.MarkFlagRequired("key-id")
+	remove.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
+	_ = remove.MarkFlagFilename("keys")
+	remove.Flags().Int("threshold", 0, "The number of root keys required to sign TUF root. Unchanged if not set.")
+	remove.Flags().BoolP("sign", "s", false, "Sign the new TUF root using the offline root keys.")
+	addTufExpiresFlag(remove)
+	addTufSigningKeyIdFlag(remove)
+	AddTufSignerFlags(remove)
+	addTufUpdatesDryRunFlag(remove)
+	addTufResultFlags(remove)
+	tufUpdatesCmd.AddCommand(remove)
+}
+
+func doTufUpdatesRemoveOfflineKey(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	txid, _ := cmd.Flags().GetString("txid")
+	keyId, _ := cmd.Flags().GetString("key-id")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	shouldSign, _ := cmd.Flags().GetBool("sign")
+
+	var creds OfflineCreds
+	if shouldSign {
+		var err error
+		creds, err = GetSigningCreds(keysFile)
+		subcommands.DieNotNil(err)
+	}
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	curCiRoot, newCiRoot := checkTufRootUpdatesStatus(updates, true)
+
+	removeOfflineRootKey(cmd, newCiRoot, keyId, threshold)
+	setTufRootExpires(cmd, newCiRoot, false)
+
+	newCiRoot.Signatures = make([]tuf.Signature, 0)
+	removeUnusedTufKeys(newCiRoot)
+	newProdRoot := genProdTufRoot(newCiRoot)
+	if shouldSign {
+		signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
+	}
+
+	subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
+}
+
+// removeOfflineRootKey removes a key from the root role of the new TUF root, and checks its threshold can still be met.
+func removeOfflineRootKey(cmd *cobra.Command, root *client.AtsTufRoot, keyId string, threshold int) {
+	role := root.Signed.Roles["root"]
+	keyIds := make([]string, 0, len(role.KeyIDs))
+	for _, kid := range role.KeyIDs {
+		if kid != keyId {
+			keyIds = append(keyIds, kid)
+		}
+	}
+	if len(keyIds) == len(role.KeyIDs) {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("The key %s is not a TUF root key", keyId)))
+	}
+	if len(keyIds) == 0 {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The key %s is the only TUF root key. Please, use rotate-offline-key instead.", keyId))
+	}
+	setTufRootThreshold(cmd, role, len(keyIds), threshold)
+	role.KeyIDs = keyIds
+	fmt.Fprintf(tufProgress, "= Removing root keyid: %s (%d of %d root keys required)\n", keyId, role.Threshold, len(role.KeyIDs))
+	tufResult.addRemovedKey("root", keyId)
+}
@@ -0,0 +1,219 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	resume := &cobra.Command{
+		Use:   "resume --keys=<tuf-root-keys.tgz> [--targets-keys=<tuf-targets-keys.tgz>] [--rollback]",
+		Short: "Resume a TUF root update interrupted after new offline keys were generated",
+		Long: `Resume a TUF root update interrupted after new offline TUF keys were generated, e.g. when the upload
+of the new TUF root failed because of a broken connection, or the offline TUF keys could not be replaced.
+
+The new keys are kept in a temporary copy of the offline TUF keys, next to them, with a ".tmp" suffix.
+This command reconciles that copy with the TUF root staged on the server:
+
+- If the staged TUF root already has the new keys, the upload did succeed, and the offline TUF keys
+  are replaced with the temporary copy.
+- Otherwise, the upload is re-attempted, and the offline TUF keys are replaced once it succeeds.
+- With --rollback, the temporary copy is removed instead, as its new keys are not used by any TUF root.
+  The key rotation can then be run again.`,
+		Example: `
+  # Finish a key rotation whose upload failed:
+  fioctl keys tuf updates resume --keys=tuf-root-keys.tgz
+  # Drop the new keys of a failed key rotation, to start it again:
+  fioctl keys tuf updates resume --keys=tuf-root-keys.tgz --rollback`,
+		Run:  doTufUpdatesResume,
+		Args: cobra.NoArgs,
+	}
+	resume.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> of the interrupted TUF root update.")
+	_ = resume.MarkFlagFilename("keys")
+	_ = resume.MarkFlagRequired("keys")
+	resume.Flags().StringP("targets-keys", "K", "", "Path to <tuf-targets-keys.tgz>, if the new targets key is saved separately.")
+	_ = resume.MarkFlagFilename("targets-keys")
+	resume.Flags().Bool("rollback", false, "Remove the new keys, instead of re-attempting the upload.")
+	addTufResultFlags(resume)
+	tufUpdatesCmd.AddCommand(resume)
+}
+
+// tufPendingUpload is an upload of a new TUF root which failed in a way that the server may have staged it.
+// It is saved next to the temporary offline TUF keys with the new keys of that TUF root.
+type tufPendingUpload struct {
+	Factory     string                     `json:"factory"`
+	Txid        string                     `json:"txid"`
+	CiRoot      *client.AtsTufRoot         `json:"ci-root"`
+	ProdRoot    *client.AtsTufRoot         `json:"prod-root"`
+	TargetsSigs map[string][]tuf.Signature `json:"targets-signatures,omitempty"`
+}
+
+type tufUploadError struct {
+	err    error
+	upload tufPendingUpload
+}
+
+func (e *tufUploadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tufUploadError) Unwrap() error {
+	return e.err
+}
+
+// rejected tells if the server refused the upload, so that the new TUF root is surely not staged.
+func (e *tufUploadError) rejected() bool {
+	herr := client.AsHttpError(e.err)
+	return herr != nil && herr.Response.StatusCode >= 400 && herr.Response.StatusCode < 500
+}
+
+func tufPendingUploadFile(keysFile string) string {
+	return keysFile + ".upload.json"
+}
+
+// keepTufPendingUpload saves a failed upload of a new TUF root for the resume command, and dies.
+func keepTufPendingUpload(keysFiles []string, uploadErr *tufUploadError) {
+	buf, err := subcommands.MarshalIndent(uploadErr.upload, "", "  ")
+	subcommands.DieNotNil(err)
+	subcommands.DieNotNil(os.WriteFile(tufPendingUploadFile(keysFiles[0]), buf, 0600))
+
+	resume := "fioctl keys tuf updates resume --keys=" + keysFiles[0]
+	if len(keysFiles) > 1 {
+		resume += " --targets-keys=" + keysFiles[1]
+	}
+	fmt.Fprintln(tufProgress, "\nERROR: The upload of the new TUF root failed, but the server may have staged it.")
+	for _, keysFile := range keysFiles {
+		fmt.Fprintln(tufProgress, "The new offline TUF keys are kept in:", keysFile+".tmp")
+	}
+	fmt.Fprintf(tufProgress, "Run '%s' to finish the TUF root update.\n", resume)
+	subcommands.DieNotNil(uploadErr)
+}
+
+func doTufUpdatesResume(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	targetsKeysFile, _ := cmd.Flags().GetString("targets-keys")
+	rollback, _ := cmd.Flags().GetBool("rollback")
+
+	keysFiles := []string{keysFile}
+	if len(targetsKeysFile) > 0 && targetsKeysFile != keysFile {
+		keysFiles = append(keysFiles, targetsKeysFile)
+	}
+	// The key IDs in the temporary copies, which are not in the offline TUF keys yet
+	var interrupted []string
+	newKeyIds := make(map[string]bool)
+	for _, file := range keysFiles {
+		if _, err := os.Stat(file + ".tmp"); err != nil {
+			continue
+		}
+		interrupted = append(interrupted, file)
+		tmpCreds, err := GetOfflineCreds(file + ".tmp")
+		subcommands.DieNotNil(err)
+		oldIds := make(map[string]bool)
+		if _, err := os.Stat(file); err == nil {
+			creds, err := GetOfflineCreds(file)
+			subcommands.DieNotNil(err)
+			for _, id := range credsKeyIds(file, creds) {
+				oldIds[id] = true
+			}
+		}
+		for _, id := range credsKeyIds(file+".tmp", tmpCreds) {
+			if !oldIds[id] {
+				newKeyIds[id] = true
+			}
+		}
+	}
+	if len(interrupted) == 0 {
+		fmt.Fprintln(tufProgress, "= Nothing to resume: there are no temporary offline TUF keys for", strings.Join(keysFiles, ", "))
+		removeTufPendingUpload(keysFile)
+		return
+	}
+
+	var pending *tufPendingUpload
+	if buf, err := os.ReadFile(tufPendingUploadFile(keysFile)); err == nil {
+		pending = &tufPendingUpload{}
+		subcommands.DieNotNil(json.Unmarshal(buf, pending), "Invalid "+tufPendingUploadFile(keysFile)+":")
+		if pending.Factory != factory {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The interrupted TUF root update is for the factory %s, not %s", pending.Factory, factory))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		subcommands.DieNotNil(err)
+	}
+
+	// The new keys are looked up in the staged TUF root, or in the current one if the update was applied since
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	var root *client.AtsTufRoot
+	if updates.Status == client.TufRootUpdatesStatusNone {
+		root, err = api.TufRootGet(factory)
+		subcommands.DieNotNil(err)
+	} else {
+		_, root = checkTufRootUpdatesStatus(updates, false)
+	}
+	ids := make([]string, 0, len(newKeyIds))
+	var found []string
+	for id := range newKeyIds {
+		ids = append(ids, id)
+		if _, ok := root.Signed.Keys[id]; ok {
+			found = append(found, id)
+		}
+	}
+	sort.Strings(ids)
+	sort.Strings(found)
+	fmt.Fprintln(tufProgress, "= New offline TUF keys of the interrupted update:", strings.Join(ids, ", "))
+
+	switch {
+	case len(found) > 0 && len(found) == len(ids):
+		fmt.Fprintln(tufProgress, "= The TUF root on the server has the new keys, the upload did succeed")
+		finishTufUpdatesResume(cmd, nil, interrupted, keysFile)
+	case len(found) > 0:
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict, fmt.Errorf(
+			"The TUF root on the server has only some of the new keys: %s. Please, check the temporary offline "+
+				"TUF keys and the staged TUF root with 'fioctl keys tuf updates review' before fixing them by hand.",
+			strings.Join(found, ", "))))
+	case !rollback && pending == nil:
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The TUF root on the server does not have the new keys, and there is no upload to re-attempt. " +
+				"Use --rollback to remove the new keys, so that the TUF root update can be started again."))
+	case rollback:
+		for _, file := range interrupted {
+			subcommands.DieNotNil(os.Remove(file + ".tmp"))
+			fmt.Fprintln(tufProgress, "= Removed the new offline TUF keys in", file+".tmp")
+		}
+		removeTufPendingUpload(keysFile)
+		fmt.Fprintln(tufProgress, "= Rolled back, the TUF root update can be started again")
+	default:
+		fmt.Fprintln(tufProgress, "= Re-attempting the upload of the new TUF root")
+		err := putTufRootUpdates(cmd, factory, pending.Txid, pending.CiRoot, pending.ProdRoot, pending.TargetsSigs)
+		finishTufUpdatesResume(cmd, err, interrupted, keysFile)
+	}
+}
+
+// finishTufUpdatesResume replaces the offline TUF keys with their temporary copies once the upload succeeded.
+func finishTufUpdatesResume(cmd *cobra.Command, err error, keysFiles []string, pendingKeysFile string) {
+	if err != nil {
+		// The temporary copies and the upload are kept, so that it can be re-attempted again
+		subcommands.DieNotNil(err)
+	}
+	fmt.Fprintln(tufProgress, "= Replacing the offline TUF keys with their temporary copies")
+	handleTufRootUpdatesUpload(cmd, nil, keysFiles...)
+	removeTufPendingUpload(pendingKeysFile)
+}
+
+func removeTufPendingUpload(keysFile string) {
+	if err := os.Remove(tufPendingUploadFile(keysFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(tufProgress, "Failed to remove %s: %v\n", tufPendingUploadFile(keysFile), err)
+	}
+}
@@ -19,12 +19,21 @@ func init() {
 	review := &cobra.Command{
 		Use:   "review",
 		Short: "Show the Factory's TUF root metadata",
-		Run:   doTufUpdatesReview,
+		Long: `Show the Factory's TUF root metadata, and the TUF root updates staged for it.
+
+With --wait, the command then waits for the staged TUF root updates to be applied or cancelled,
+e.g. by other admins, so that a CI pipeline driving a key rotation can block on its completion.
+It fails if the updates are cancelled, if applying them fails, or once the --timeout is reached.`,
+		Example: `
+  # Wait up to 2 hours for other admins to sign and apply the staged TUF root updates:
+  fioctl keys tuf updates review --wait --timeout 2h`,
+		Run: doTufUpdatesReview,
 	}
 	review.Flags().BoolP("raw", "", false, "Show the raw root.json")
 	review.Flags().BoolP("diff", "", false, "Show the unified diff between current and staged root.json")
 	review.MarkFlagsMutuallyExclusive("raw", "diff")
 	review.Flags().BoolP("prod", "", false, "Show the production root.json")
+	addTufWaitFlags(review)
 	tufUpdatesCmd.AddCommand(review)
 }
 
@@ -33,6 +42,7 @@ func doTufUpdatesReview(cmd *cobra.Command, args []string) {
 	showRaw, _ := cmd.Flags().GetBool("raw")
 	showDiff, _ := cmd.Flags().GetBool("diff")
 	showProd, _ := cmd.Flags().GetBool("prod")
+	wait, _ := cmd.Flags().GetBool("wait")
 	if showProd && !showRaw && !showDiff {
 		subcommands.DieNotNil(errors.New(
 			"If the flag 'prod' is set then one of the flags [raw diff] must also be set",
@@ -68,7 +78,7 @@ func doTufUpdatesReview(cmd *cobra.Command, args []string) {
 		if showRaw {
 			bytes, err := subcommands.MarshalIndent(rootToShow, "", "  ")
 			subcommands.DieNotNil(err)
-			fmt.Println(string(bytes))
+			fmt.Fprintln(tufProgress, string(bytes))
 		} else {
 			var baseRootToShow *client.AtsTufRoot
 			if showProd {
@@ -99,45 +109,49 @@ func doTufUpdatesReview(cmd *cobra.Command, args []string) {
 				} else if line[0] == '-' {
 					color.Red(line)
 				} else {
-					fmt.Println(line)
+					fmt.Fprintln(tufProgress, line)
 				}
 			}
 		}
 	} else if updates.Status == client.TufRootUpdatesStatusNone {
-		fmt.Println("There are no TUF root updates in progress.")
+		fmt.Fprintln(tufProgress, "There are no TUF root updates in progress.")
 		// There can be no errors for existing root: it is impossible to upload erroneous TUF root.
 		if len(updates.Issues.Warnings) > 0 {
-			fmt.Println("\nThese updates to your existing TUF metadata are recommended:")
+			fmt.Fprintln(tufProgress, "\nThese updates to your existing TUF metadata are recommended:")
 			for _, issue := range updates.Issues.Warnings {
-				fmt.Printf(" - %s\n", issue.Message)
+				fmt.Fprintf(tufProgress, " - %s\n", issue.Message)
 			}
 		}
 	} else {
-		fmt.Println("The following TUF root updates are staged for your factory:")
+		fmt.Fprintln(tufProgress, "The following TUF root updates are staged for your factory:")
 		for _, amendment := range updates.Amendments {
-			fmt.Printf(" - %s\n", amendment.Message)
+			fmt.Fprintf(tufProgress, " - %s\n", amendment.Message)
 		}
 		if len(updates.Issues.Errors) > 0 {
-			fmt.Println("\nThese updates to your staged TUF root are mandatory before applying it:")
+			fmt.Fprintln(tufProgress, "\nThese updates to your staged TUF root are mandatory before applying it:")
 			for _, issue := range updates.Issues.Errors {
-				fmt.Printf(" - %s\n", issue.Message)
+				fmt.Fprintf(tufProgress, " - %s\n", issue.Message)
 			}
 		}
 		if len(updates.Issues.Warnings) > 0 {
-			fmt.Println("\nThese updates to your staged TUF root are recommended:")
+			fmt.Fprintln(tufProgress, "\nThese updates to your staged TUF root are recommended:")
 			for _, issue := range updates.Issues.Warnings {
-				fmt.Printf(" - %s\n", issue.Message)
+				fmt.Fprintf(tufProgress, " - %s\n", issue.Message)
 			}
 		}
 
 		if updates.Status == client.TufRootUpdatesStatusApplying {
-			fmt.Println(`
+			fmt.Fprintln(tufProgress, `
 These changes are currently being applied. No more changes can be staged.
 If the previous 'fioctl keys tuf updates apply' command failed, please, try to run it again.`)
 		} else {
-			fmt.Println(`
+			fmt.Fprintln(tufProgress, `
 Once your are satisfied with your TUF updates, please, run 'fioctl keys tuf updates apply'.
 If you want to cancel staged TUF updates, please, run 'fioctl keys tuf updates cancel'.`)
 		}
 	}
+
+	if wait {
+		waitTufRootUpdates(cmd, factory, updates)
+	}
 }
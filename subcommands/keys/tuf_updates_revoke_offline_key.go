@@ -0,0 +1,141 @@
+package keys
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	revoke := &cobra.Command{
+		Use:   "revoke-offline-key --txid=<txid> --key-id=<keyid> [--threshold=<n>]",
+		Short: "Stage revoking a compromised offline TUF key",
+		Long: `Stage revoking a compromised offline TUF key, by removing its key ID from the TUF root.
+
+No new key is generated, and the revoked key is not needed: this only requires the remaining root keys
+to sign the new TUF root, so that a compromised key can be revoked before deciding how to replace it.
+The key ID may be shortened to any unique prefix.
+
+The revocation fails, leaving the staged TUF root unchanged, if the remaining keys can not meet
+the thresholds of the TUF root:
+- A root key can be revoked if other root keys remain. If the root threshold is higher than
+  the number of remaining root keys, a new threshold must be set with the --threshold flag.
+- An offline targets key can be revoked if other offline targets keys remain, as the production
+  targets must be signed by the online and an offline targets key. Otherwise, replace it with
+  "rotate-offline-key --role=targets", or "set-offline-key --role=targets", instead.
+- Online keys are held by Foundries.io, and are replaced with "rotate-online-key".
+
+The new TUF root must be signed by a threshold of both the current and the new root keys.
+Each admin signs it with their root keys using "fioctl keys tuf updates sign".`,
+		Example: `
+- Revoke a compromised offline targets key, once another one was added with add-offline-key --role=targets:
+  fioctl keys tuf updates revoke-offline-key --txid=abc --key-id=2e4f81 --keys=admin1-root-keys.tgz --sign
+- Revoke a compromised root key, and require one of the remaining root keys to sign:
+  fioctl keys tuf updates revoke-offline-key \
+    --txid=abc --key-id=6b8c9d --threshold=1 --keys=admin1-root-keys.tgz --sign`,
+		Run:  doTufUpdatesRevokeOfflineKey,
+		Args: cobra.NoArgs,
+	}
+	revoke.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	revoke.Flags().StringP("key-id", "i", "", "ID, or a unique prefix of the ID, of the key to revoke.")
+	_ = revoke.MarkFlagRequired("key-id")
+	revoke.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
+	_ = revoke.MarkFlagFilename("keys")
+	revoke.Flags().Int("threshold", 0, "The number of root keys required to sign TUF root. Unchanged if not set.")
+	revoke.Flags().BoolP("sign", "s", false, "Sign the new TUF root using the offline root keys.")
+	addTufExpiresFlag(revoke)
+	addTufSigningKeyIdFlag(revoke)
+	AddTufSignerFlags(revoke)
+	addTufUpdatesDryRunFlag(revoke)
+	addTufResultFlags(revoke)
+	subcommands.AddConfirmFlag(revoke)
+	tufUpdatesCmd.AddCommand(revoke)
+}
+
+func doTufUpdatesRevokeOfflineKey(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	txid, _ := cmd.Flags().GetString("txid")
+	keyId, _ := cmd.Flags().GetString("key-id")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	shouldSign, _ := cmd.Flags().GetBool("sign")
+
+	var creds OfflineCreds
+	if shouldSign {
+		var err error
+		creds, err = GetSigningCreds(keysFile)
+		subcommands.DieNotNil(err)
+	}
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	curCiRoot, newCiRoot := checkTufRootUpdatesStatus(updates, true)
+
+	rootKeyIds := newCiRoot.Signed.Roles["root"].KeyIDs
+	targetsKeyIds := newCiRoot.Signed.Roles["targets"].KeyIDs
+	keyId = matchTufKeyId(keyId, append(append([]string{}, rootKeyIds...), targetsKeyIds...))
+
+	for roleName, onlineId := range updates.Updated.OnlineKeys {
+		if onlineId == keyId {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The key %s is the online TUF %s key. Please, use rotate-online-key instead.", keyId, roleName))
+		}
+	}
+	role := "root"
+	if slices.Contains(targetsKeyIds, keyId) {
+		role = "targets"
+		removeOfflineTargetsKey(newCiRoot, keyId)
+	} else {
+		removeOfflineRootKey(cmd, newCiRoot, keyId, threshold)
+	}
+	setTufRootExpires(cmd, newCiRoot, false)
+
+	if !isTufUpdatesDryRun(cmd) {
+		preview := subcommands.NewPreview("Offline TUF keys to revoke:")
+		preview.SetOutput(tufProgress)
+		preview.Remove("%s key %s", role, keyId)
+		if !preview.Confirm(cmd) {
+			return
+		}
+	}
+
+	newCiRoot.Signatures = make([]tuf.Signature, 0)
+	removeUnusedTufKeys(newCiRoot)
+	newProdRoot := genProdTufRoot(newCiRoot)
+	if shouldSign {
+		signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
+	}
+
+	subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
+}
+
+// removeOfflineTargetsKey removes a key from the targets role of the new TUF root, and checks the thresholds
+// of both the CI and the production targets roles can still be met.
+func removeOfflineTargetsKey(root *client.AtsTufRoot, keyId string) {
+	role := root.Signed.Roles["targets"]
+	keyIds := make([]string, 0, len(role.KeyIDs))
+	for _, kid := range role.KeyIDs {
+		if kid != keyId {
+			keyIds = append(keyIds, kid)
+		}
+	}
+	threshold := genProdTufRoot(root).Signed.Roles["targets"].Threshold
+	if role.Threshold > threshold {
+		threshold = role.Threshold
+	}
+	if len(keyIds) < threshold {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"Revoking the key %s leaves %d TUF targets keys, while the targets must be signed by %d of them. "+
+				"Please, replace it using rotate-offline-key --role=targets, or set-offline-key --role=targets instead.",
+			keyId, len(keyIds), threshold))
+	}
+	role.KeyIDs = keyIds
+	fmt.Fprintf(tufProgress, "= Removing targets keyid: %s (%d targets keys remain)\n", keyId, len(role.KeyIDs))
+	tufResult.addRemovedKey("targets", keyId)
+}
@@ -0,0 +1,117 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	rotate := &cobra.Command{
+		Use:   "rotate-all-offline-keys --txid=<txid> --keys=<tuf-root-keys.tgz>",
+		Short: "Stage rotation of both offline TUF signing keys for the Factory",
+		Long: `Stage rotation of both the offline TUF root and targets signing keys for the Factory in one step.
+
+This is the same as rotating the root key and then the targets key with "rotate-offline-key", but the
+production targets are re-signed with the new targets key, and the new TUF root is signed with both the
+old and new root keys, in a single upload. Both new keys are saved into the offline TUF keys only once
+the upload succeeds, so that a failure does not leave one of them behind.
+
+If there is an active wave in your factory, the TUF targets rotation is not allowed.`,
+		Example: `
+- Rotate both offline TUF keys, and keep them in the same file:
+  fioctl keys tuf updates rotate-all-offline-keys --txid=abc --keys=tuf-root-keys.tgz
+- Rotate both offline TUF keys, and store the new targets key in a separate file:
+  fioctl keys tuf updates rotate-all-offline-keys \
+    --txid=abc --keys=tuf-root-keys.tgz --targets-keys=tuf-targets-keys.tgz`,
+		Run:  doTufUpdatesRotateAllOfflineKeys,
+		Args: cobra.NoArgs,
+	}
+	rotate.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	rotate.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
+	_ = rotate.MarkFlagFilename("keys")
+	_ = rotate.MarkFlagRequired("keys")
+	rotate.Flags().StringP("targets-keys", "K", "",
+		"Path to <tuf-targets-keys.tgz> to save the new targets key to (default: the --keys file).")
+	_ = rotate.MarkFlagFilename("targets-keys")
+	addTufKeyTypeFlag(rotate)
+	addTufExpiresFlag(rotate)
+	addTufSigningKeyIdFlag(rotate)
+	AddTufSignerFlags(rotate)
+	addTufUpdatesDryRunFlag(rotate)
+	addTufResultFlags(rotate)
+	tufUpdatesCmd.AddCommand(rotate)
+}
+
+func doTufUpdatesRotateAllOfflineKeys(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	txid, _ := cmd.Flags().GetString("txid")
+	keyTypeStr, _ := cmd.Flags().GetString("key-type")
+	keyType := ParseTufKeyType(keyTypeStr)
+	keysFile, _ := cmd.Flags().GetString("keys")
+	targetsKeysFile, _ := cmd.Flags().GetString("targets-keys")
+	separateTargets := targetsKeysFile != "" && targetsKeysFile != keysFile
+
+	creds, err := GetSigningCreds(keysFile)
+	subcommands.DieNotNil(err)
+	subcommands.AssertWritable(keysFile)
+	targetsCreds := creds
+	if separateTargets {
+		if _, err := os.Stat(targetsKeysFile); err == nil {
+			targetsCreds, err = GetOfflineCreds(targetsKeysFile)
+			subcommands.DieNotNil(err)
+			subcommands.AssertWritable(targetsKeysFile)
+		} else if errors.Is(err, fs.ErrNotExist) {
+			targetsCreds = make(OfflineCreds, 0)
+		} else {
+			subcommands.DieNotNil(err)
+		}
+	}
+	// Check both temporary files in advance, so that none is left behind when the other one exists
+	assertNoTempTufCreds(keysFile)
+	if separateTargets {
+		assertNoTempTufCreds(targetsKeysFile)
+	}
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	curCiRoot, newCiRoot := checkTufRootUpdatesStatus(updates, true)
+	onlineTargetsId := updates.Updated.OnlineKeys["targets"]
+	if onlineTargetsId == "" {
+		subcommands.DieNotNil(errors.New("Unable to find online target key for factory"))
+	}
+
+	oldKeyIdx := findRotatedTufRootKey(newCiRoot, creds)
+	newRootKey, creds := replaceOfflineRootKey(newCiRoot, oldKeyIdx, creds, genTufKeyPair(keyType))
+	fmt.Fprintln(tufProgress, "= New root keyid:", newRootKey.Id)
+	newTargetsKey, targetsCreds := replaceOfflineTargetsKey(
+		newCiRoot, onlineTargetsId, targetsCreds, genTufKeyPair(keyType),
+	)
+	fmt.Fprintln(tufProgress, "= New target keyid:", newTargetsKey.Id)
+	setTufRootExpires(cmd, newCiRoot, true)
+	newCiRoot.Signatures = make([]tuf.Signature, 0)
+	removeUnusedTufKeys(newCiRoot)
+	newProdRoot := genProdTufRoot(newCiRoot)
+
+	fmt.Fprintln(tufProgress, "= Re-signing prod targets")
+	newTargetsSigs, err := resignProdTargets(factory, newCiRoot, onlineTargetsId, targetsCreds)
+	subcommands.DieNotNil(err)
+
+	signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
+
+	keysFiles := []string{keysFile}
+	saveTempTufCreds(keysFile, creds)
+	if separateTargets {
+		keysFiles = append(keysFiles, targetsKeysFile)
+		saveTempTufCreds(targetsKeysFile, targetsCreds)
+	}
+	err = putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, newTargetsSigs)
+	handleTufRootUpdatesUpload(cmd, err, keysFiles...)
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"time"
+	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 
 	canonical "github.com/docker/go/canonical/json"
 	tuf "github.com/theupdateframework/notary/tuf/data"
@@ -27,7 +30,10 @@ The new offline signing key will be used in both CI and production TUF root.
 
 When you rotate the TUF targets offline signing key:
 - if there are production targets in your factory, they are re-signed using the new key.
-- if there is an active wave in your factory, the TUF targets rotation is not allowed.`,
+- if there is an active wave in your factory, the TUF targets rotation is not allowed.
+
+The new TUF root expires in a year after a root key rotation, unless set with --expires.
+The production targets keep their expiry, which is set for each wave by "fioctl waves init".`,
 		Example: `
 - Rotate offline TUF root key and re-sign the new TUF root with both old and new keys:
   fioctl keys tuf updates rotate-offline-key \
@@ -40,7 +46,36 @@ When you rotate the TUF targets offline signing key:
     --txid=abc --role=targets --keys=tuf-root-keys.tgz --sign
 - Rotate offline TUF targets key and store the new key in a separate file (and re-sign TUF root):
   fioctl keys tuf updates rotate-offline-key \
-    --txid=abc --role=targets --keys=tuf-root-keys.tgz --targets-keys=tuf-targets-keys.tgz --sign`,
+    --txid=abc --role=targets --keys=tuf-root-keys.tgz --targets-keys=tuf-targets-keys.tgz --sign
+- Rotate offline TUF root key to a key of the Vault transit engine, signing with the old key in an archive:
+  fioctl keys tuf updates rotate-offline-key \
+    --txid=abc --role=root --keys=tuf-root-keys.tgz --new-vault-key=root-2024 --sign
+- Rotate offline TUF root key to a key generated on an HSM, and sign the new TUF root with both keys:
+  fioctl keys tuf updates rotate-offline-key \
+    --txid=abc --role=root --keys=tuf-root-keys.tgz --sign \
+    --hsm-module=/usr/lib/softhsm/libsofthsm2.so --hsm-pin=1234 --hsm-token-label=tuf --new-hsm-key-label=root-2024
+- Rotate offline TUF targets key to an RSA key of AWS KMS:
+  fioctl keys tuf updates rotate-offline-key \
+    --txid=abc --role=targets --keys=tuf-root-keys.tgz --sign \
+    --new-kms-key=arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab
+- Rotate offline TUF root key to a key of Google Cloud KMS, signing with the old key of Google Cloud KMS:
+  fioctl keys tuf updates rotate-offline-key --txid=abc --role=root --sign \
+    --kms-key=gcpkms://projects/acme/locations/global/keyRings/tuf/cryptoKeys/root-2023 \
+    --new-kms-key=gcpkms://projects/acme/locations/global/keyRings/tuf/cryptoKeys/root-2024
+- Rotate offline TUF targets key to an RSA key of Azure Key Vault:
+  fioctl keys tuf updates rotate-offline-key \
+    --txid=abc --role=targets --keys=tuf-root-keys.tgz --sign \
+    --new-kms-key=https://acme-tuf.vault.azure.net/keys/targets-2024
+- Rotate offline TUF root key to a new key of Azure Key Vault, signing with the old key of Azure Key Vault:
+  fioctl keys tuf updates rotate-offline-key --txid=abc --role=root --sign \
+    --key-backend=azure-kv --key-id=https://acme-tuf.vault.azure.net/keys/tuf-root \
+    --new-kms-key=https://acme-tuf.vault.azure.net/keys/tuf-root-2024
+- Rotate offline TUF root key to a key generated on a YubiKey, which asks for the PIN and a touch to sign:
+  fioctl keys tuf updates rotate-offline-key \
+    --txid=abc --role=root --keys=tuf-root-keys.tgz --yubikey --sign
+- Rotate offline TUF root key to a key generated in the TPM of this computer:
+  fioctl keys tuf updates rotate-offline-key \
+    --txid=abc --role=root --keys=tuf-root-keys.tgz --tpm --sign`,
 		Run: doTufUpdatesRotateOfflineKey,
 	}
 	rotate.Flags().StringP("role", "r", "", "TUF role name, supported: Root, Targets.")
@@ -50,8 +85,14 @@ When you rotate the TUF targets offline signing key:
 	_ = rotate.MarkFlagFilename("keys")
 	rotate.Flags().StringP("targets-keys", "K", "", "Path to <tuf-targets-keys.tgz> used to sign prod & wave TUF targets.")
 	_ = rotate.MarkFlagFilename("targets-keys")
-	rotate.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA.")
+	addTufKeyTypeFlag(rotate)
 	rotate.Flags().BoolP("sign", "s", false, "Sign the new TUF root using the offline root keys.")
+	addNewTufKeyFlags(rotate)
+	addTufExpiresFlag(rotate)
+	addTufSigningKeyIdFlag(rotate)
+	AddTufSignerFlags(rotate)
+	addTufUpdatesDryRunFlag(rotate)
+	addTufResultFlags(rotate)
 	tufUpdatesCmd.AddCommand(rotate)
 }
 
@@ -71,13 +112,12 @@ func doTufUpdatesRotateOfflineKey(cmd *cobra.Command, args []string) {
 func doTufUpdatesRotateOfflineRootKey(cmd *cobra.Command) {
 	factory := viper.GetString("factory")
 	txid, _ := cmd.Flags().GetString("txid")
-	keyTypeStr, _ := cmd.Flags().GetString("key-type")
-	keyType := ParseTufKeyType(keyTypeStr)
 	keysFile, _ := cmd.Flags().GetString("keys")
 	targetsKeysFile, _ := cmd.Flags().GetString("targets-keys")
 	shouldSign, _ := cmd.Flags().GetBool("sign")
+	newExternalKey := hasNewExternalTufKey(cmd)
 
-	if keysFile == "" {
+	if keysFile == "" && !newExternalKey {
 		subcommands.DieNotNil(errors.New(
 			"The --keys option is required to rotate the offline TUF root key.",
 		))
@@ -88,9 +128,11 @@ func doTufUpdatesRotateOfflineRootKey(cmd *cobra.Command) {
 		))
 	}
 
-	creds, err := GetOfflineCreds(keysFile)
+	creds, err := GetSigningCreds(keysFile)
 	subcommands.DieNotNil(err)
-	subcommands.AssertWritable(keysFile)
+	if keysFile != "" {
+		subcommands.AssertWritable(keysFile)
+	}
 
 	var updates client.TufRootUpdates
 	updates, err = api.TufRootUpdatesGet(factory)
@@ -101,8 +143,10 @@ func doTufUpdatesRotateOfflineRootKey(cmd *cobra.Command) {
 	// A rotation is pretty easy:
 	// 1. change the who's listed as the root key
 	// 2. sign the new root.json with both the old and new root
-	newKey, newCreds := replaceOfflineRootKey(newCiRoot, creds, keyType)
-	fmt.Println("= New root keyid:", newKey.Id)
+	oldKeyIdx := findRotatedTufRootKey(newCiRoot, creds)
+	newKey, newCreds := replaceOfflineRootKey(newCiRoot, oldKeyIdx, creds, genOfflineTufKeyPair(cmd))
+	fmt.Fprintln(tufProgress, "= New root keyid:", newKey.Id)
+	setTufRootExpires(cmd, newCiRoot, true)
 	newCiRoot.Signatures = make([]tuf.Signature, 0)
 	removeUnusedTufKeys(newCiRoot)
 	newProdRoot := genProdTufRoot(newCiRoot)
@@ -111,30 +155,33 @@ func doTufUpdatesRotateOfflineRootKey(cmd *cobra.Command) {
 		signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, newCreds)
 	}
 
-	fmt.Println("= Uploading new TUF root")
-	tmpFile := saveTempTufCreds(keysFile, newCreds)
-	err = api.TufRootUpdatesPut(factory, txid, newCiRoot, newProdRoot, nil)
-	handleTufRootUpdatesUpload(tmpFile, keysFile, err)
+	if keysFile == "" {
+		// The new key is in an external key store, so there is nothing to save
+		subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
+		return
+	}
+	saveTempTufCreds(keysFile, newCreds)
+	err = putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil)
+	handleTufRootUpdatesUpload(cmd, err, keysFile)
 }
 
 func doTufUpdatesRotateOfflineTargetsKey(cmd *cobra.Command) {
 	factory := viper.GetString("factory")
 	txid, _ := cmd.Flags().GetString("txid")
-	keyTypeStr, _ := cmd.Flags().GetString("key-type")
-	keyType := ParseTufKeyType(keyTypeStr)
 	keysFile, _ := cmd.Flags().GetString("keys")
 	targetsKeysFile, _ := cmd.Flags().GetString("targets-keys")
 	shouldSign, _ := cmd.Flags().GetBool("sign")
+	newExternalKey := hasNewExternalTufKey(cmd)
 
 	if targetsKeysFile == "" {
 		targetsKeysFile = keysFile
 	}
-	if targetsKeysFile == "" {
+	if targetsKeysFile == "" && !newExternalKey {
 		subcommands.DieNotNil(errors.New(
 			"The --keys or --targets-keys option is required to rotate the offline TUF targets key.",
 		))
 	}
-	if shouldSign && keysFile == "" {
+	if shouldSign && keysFile == "" && len(tufSignerOpts.ExternalSigners) == 0 {
 		subcommands.DieNotNil(errors.New("The --keys option is required to sign the new TUF root."))
 	}
 
@@ -142,7 +189,10 @@ func doTufUpdatesRotateOfflineTargetsKey(cmd *cobra.Command) {
 		creds, targetsCreds OfflineCreds
 		err                 error
 	)
-	if _, err := os.Stat(targetsKeysFile); err == nil {
+	if targetsKeysFile == "" {
+		// The new key is in an external key store, so there is nothing to save
+		targetsCreds = make(OfflineCreds, 0)
+	} else if _, err := os.Stat(targetsKeysFile); err == nil {
 		targetsCreds, err = GetOfflineCreds(targetsKeysFile)
 		subcommands.DieNotNil(err)
 		subcommands.AssertWritable(targetsKeysFile)
@@ -157,7 +207,7 @@ func doTufUpdatesRotateOfflineTargetsKey(cmd *cobra.Command) {
 		if keysFile == targetsKeysFile {
 			creds = targetsCreds
 		} else {
-			creds, err = GetOfflineCreds(keysFile)
+			creds, err = GetSigningCreds(keysFile)
 			subcommands.DieNotNil(err)
 		}
 	}
@@ -178,13 +228,16 @@ func doTufUpdatesRotateOfflineTargetsKey(cmd *cobra.Command) {
 		subcommands.DieNotNil(errors.New("Unable to find online target key for factory"))
 	}
 	subcommands.DieNotNil(err)
-	newKey, newCreds := replaceOfflineTargetsKey(newCiRoot, onlineTargetsId, targetsCreds, keyType)
-	fmt.Println("= New target keyid:", newKey.Id)
+	newKey, newCreds := replaceOfflineTargetsKey(
+		newCiRoot, onlineTargetsId, targetsCreds, genOfflineTufKeyPair(cmd),
+	)
+	fmt.Fprintln(tufProgress, "= New target keyid:", newKey.Id)
+	setTufRootExpires(cmd, newCiRoot, false)
 	newCiRoot.Signatures = make([]tuf.Signature, 0)
 	removeUnusedTufKeys(newCiRoot)
 	newProdRoot := genProdTufRoot(newCiRoot)
 
-	fmt.Println("= Re-signing prod targets")
+	fmt.Fprintln(tufProgress, "= Re-signing prod targets")
 	newTargetsSigs, err := resignProdTargets(factory, newCiRoot, onlineTargetsId, newCreds)
 	subcommands.DieNotNil(err)
 
@@ -192,38 +245,92 @@ func doTufUpdatesRotateOfflineTargetsKey(cmd *cobra.Command) {
 		signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
 	}
 
-	fmt.Println("= Uploading new TUF root")
-	tmpFile := saveTempTufCreds(targetsKeysFile, newCreds)
-	err = api.TufRootUpdatesPut(factory, txid, newCiRoot, newProdRoot, newTargetsSigs)
-	handleTufRootUpdatesUpload(tmpFile, targetsKeysFile, err)
+	if targetsKeysFile == "" {
+		subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, newTargetsSigs))
+		return
+	}
+	saveTempTufCreds(targetsKeysFile, newCreds)
+	err = putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, newTargetsSigs)
+	handleTufRootUpdatesUpload(cmd, err, targetsKeysFile)
+}
+
+// findRotatedTufRootKey returns the index of the root key to rotate. With several root keys,
+// the one in the given offline TUF keys is rotated, and others are kept. If the offline TUF keys
+// have several of them, the one to rotate is selected with --signing-key-id.
+func findRotatedTufRootKey(root *client.AtsTufRoot, creds OfflineCreds) int {
+	keyIds := root.Signed.Roles["root"].KeyIDs
+	if len(keyIds) == 1 {
+		return 0
+	}
+	var inCreds []string
+	for _, kid := range keyIds {
+		if isTufRootKeyInCreds(root, kid, creds) {
+			inCreds = append(inCreds, kid)
+		}
+	}
+	if len(inCreds) > 1 {
+		if len(tufSigningKeyIds) != 1 {
+			sort.Strings(inCreds)
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The offline TUF keys have several root keys:\n  %s\n"+
+					"Please, select the one to rotate with --signing-key-id, "+
+					"or use remove-offline-key and add-offline-key instead.", strings.Join(inCreds, "\n  ")))
+		}
+		id, err := matchTufSigningKeyId(tufSigningKeyIds[0], inCreds)
+		subcommands.DieNotNil(err)
+		tufSelectedKeyIds = append(tufSelectedKeyIds, id)
+		inCreds = []string{id}
+	}
+	found := -1
+	if len(inCreds) == 1 {
+		found = slices.Index(keyIds, inCreds[0])
+	}
+	if found < 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning, errors.New(
+			"None of the offline TUF root keys is in the keys archive. Please, use add-offline-key instead.",
+		)))
+	}
+	return found
 }
 
 func replaceOfflineRootKey(
-	root *client.AtsTufRoot, creds OfflineCreds, keyType TufKeyType,
+	root *client.AtsTufRoot, oldKeyIdx int, creds OfflineCreds, kp TufKeyPair,
 ) (*TufSigner, OfflineCreds) {
-	kp := genTufKeyPair(keyType)
 	root.Signed.Keys[kp.signer.Id] = kp.atsPub
-	root.Signed.Expires = time.Now().AddDate(1, 0, 0).UTC().Round(time.Second) // 1 year validity
-	root.Signed.Roles["root"].KeyIDs = []string{kp.signer.Id}
+	root.Signed.Roles["root"].KeyIDs[oldKeyIdx] = kp.signer.Id
 
-	base := "tufrepo/keys/fioctl-root-" + kp.signer.Id
-	creds[base+".pub"] = kp.atsPubBytes
-	creds[base+".sec"] = kp.atsPrivBytes
+	saveTufKeyPair(creds, "tufrepo/keys/fioctl-root-"+kp.signer.Id, kp)
+	tufResult.addNewKey("root", kp.signer.Id, kp.atsPub.KeyType, false)
+	tufSelectedKeyIds = append(tufSelectedKeyIds, kp.signer.Id)
 	return &kp.signer, creds
 }
 
 func replaceOfflineTargetsKey(
-	root *client.AtsTufRoot, onlineTargetsId string, creds OfflineCreds, keyType TufKeyType,
+	root *client.AtsTufRoot, onlineTargetsId string, creds OfflineCreds, kp TufKeyPair,
 ) (*TufSigner, OfflineCreds) {
-	kp := genTufKeyPair(keyType)
 	root.Signed.Keys[kp.signer.Id] = kp.atsPub
 	root.Signed.Roles["targets"].KeyIDs = []string{onlineTargetsId, kp.signer.Id}
 	root.Signed.Roles["targets"].Threshold = 1
 
-	base := "tufrepo/keys/fioctl-targets-" + kp.signer.Id
+	saveTufKeyPair(creds, "tufrepo/keys/fioctl-targets-"+kp.signer.Id, kp)
+	tufResult.addNewKey("targets", kp.signer.Id, kp.atsPub.KeyType, false)
+	return &kp.signer, creds
+}
+
+// saveTufKeyPair adds a new key pair to the offline TUF keys.
+// A key held elsewhere, e.g. in Vault or a cloud KMS, has no private key to save.
+// A key on a device, e.g. a YubiKey or a TPM, is saved as a reference to it.
+func saveTufKeyPair(creds OfflineCreds, base string, kp TufKeyPair) {
+	if kp.keyRefBytes != nil {
+		creds[base+".pub"] = kp.atsPubBytes
+		creds[base+kp.keyRefSuffix] = kp.keyRefBytes
+		return
+	}
+	if kp.atsPrivBytes == nil {
+		return
+	}
 	creds[base+".pub"] = kp.atsPubBytes
 	creds[base+".sec"] = kp.atsPrivBytes
-	return &kp.signer, creds
 }
 
 func resignProdTargets(
@@ -249,31 +356,107 @@ func resignProdTargets(
 		signers = append(signers, *signer)
 	}
 
-	signatureMap := make(map[string][]tuf.Signature)
-	for tag, targets := range targetsMap {
-		bytes, err := canonical.MarshalCanonical(targets.Signed)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to marshal targets for tag %s: %w", tag, err)
+	tags := make([]string, 0, len(targetsMap))
+	for tag := range targetsMap {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	// Signing with RSA keys is slow, so tags are signed concurrently by a pool of workers.
+	// Each tag has its own result channel, so that progress is reported in the order of tags.
+	type resignResult struct {
+		signatures []tuf.Signature
+		err        error
+	}
+	results := make([]chan resignResult, len(tags))
+	for idx := range tags {
+		results[idx] = make(chan resignResult, 1)
+	}
+	jobs := make(chan int)
+	workers := runtime.NumCPU()
+	for _, signer := range signers {
+		if _, ok := signer.Key.(deviceSigner); ok {
+			workers = 1
 		}
-		signatures, err := SignTufMeta(bytes, signers...)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to re-sign targets for tag %s: %w", tag, err)
+	}
+	if workers > len(tags) {
+		workers = len(tags)
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for idx := range jobs {
+				var res resignResult
+				tag := tags[idx]
+				if bytes, err := canonical.MarshalCanonical(targetsMap[tag].Signed); err != nil {
+					res.err = fmt.Errorf("Failed to marshal targets for tag %s: %w", tag, err)
+				} else if res.signatures, err = SignTufMeta(bytes, signers...); err != nil {
+					res.err = fmt.Errorf("Failed to re-sign targets for tag %s: %w", tag, err)
+				}
+				results[idx] <- res
+			}
+		}()
+	}
+	go func() {
+		for idx := range tags {
+			jobs <- idx
+		}
+		close(jobs)
+	}()
+
+	signatureMap := make(map[string][]tuf.Signature)
+	var firstErr error
+	for idx, tag := range tags {
+		res := <-results[idx]
+		if res.err != nil {
+			fmt.Fprintf(tufProgress, "   [%d/%d] %s: failed\n", idx+1, len(tags), tag)
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
 		}
-		signatureMap[tag] = signatures
+		fmt.Fprintf(tufProgress, "   [%d/%d] %s: re-signed\n", idx+1, len(tags), tag)
+		tufResult.addResignedTag(tag)
+		signatureMap[tag] = res.signatures
+	}
+	if firstErr != nil {
+		return nil, firstErr
 	}
 	return signatureMap, nil
 }
 
-func handleTufRootUpdatesUpload(tmpKeysFile, keysFile string, err error) {
+// handleTufRootUpdatesUpload replaces the offline TUF keys with their temporary copies saved by saveTempTufCreds
+// once the new TUF root is uploaded. If the upload failed, the copies are removed, unless the server may have
+// staged the new TUF root anyway, e.g. when the connection broke; they are then kept for the resume command.
+func handleTufRootUpdatesUpload(cmd *cobra.Command, err error, keysFiles ...string) {
 	if err != nil {
-		if omg := os.Remove(tmpKeysFile); omg != nil {
-			fmt.Printf("Failed to remove a temporary keys file %s: %v.\n", tmpKeysFile, omg)
+		var uploadErr *tufUploadError
+		if errors.As(err, &uploadErr) && !uploadErr.rejected() {
+			// Dies, keeping the temporary copies
+			keepTufPendingUpload(keysFiles, uploadErr)
+		}
+		for _, keysFile := range keysFiles {
+			if omg := os.Remove(keysFile + ".tmp"); omg != nil {
+				fmt.Fprintf(tufProgress, "Failed to remove a temporary keys file %s: %v.\n", keysFile+".tmp", omg)
+			}
 		}
 		subcommands.DieNotNil(err)
 	}
-	if err = os.Rename(tmpKeysFile, keysFile); err != nil {
-		fmt.Println("\nERROR: Unable to update offline keys file.", err)
-		fmt.Println("Temp copy still available at:", tmpKeysFile)
-		fmt.Println("This temp file contains your new factory private key. You must copy this file.")
+	for _, keysFile := range keysFiles {
+		tmpKeysFile := keysFile + ".tmp"
+		if isTufUpdatesDryRun(cmd) {
+			dryRunFile := keysFile + ".dry-run"
+			subcommands.DieNotNil(os.Rename(tmpKeysFile, dryRunFile))
+			fmt.Fprintf(tufProgress, "= Dry run: %s is not changed, the new offline TUF keys are saved to %s\n", keysFile, dryRunFile)
+			tufResult.addKeysFile(dryRunFile)
+			continue
+		}
+		if err = os.Rename(tmpKeysFile, keysFile); err != nil {
+			fmt.Fprintln(tufProgress, "\nERROR: Unable to update offline keys file.", err)
+			fmt.Fprintln(tufProgress, "Temp copy still available at:", tmpKeysFile)
+			fmt.Fprintln(tufProgress, "This temp file contains your new factory private key. You must copy this file.")
+			fmt.Fprintln(tufProgress, "Run 'fioctl keys tuf updates resume --keys="+keysFile+"' to retry.")
+			continue
+		}
+		tufResult.addKeysFile(keysFile)
 	}
 }
@@ -19,6 +19,10 @@ func init() {
 
 The new online signing key will be used in both CI and production TUF root.
 
+Only the online keys of the given roles are rotated, the other online keys are kept. This allows to rotate
+a single online key suspected to be compromised, or to rotate the online keys one by one within the same
+transaction.
+
 When you rotate the TUF online signing key:
 - if there are CI or production targets in your factory, they are re-signed using the new key.
 - if there is an active wave in your factory, the TUF online key rotation is not allowed.
@@ -28,6 +32,8 @@ When you apply the online key rotation, these features are temporarily disabled
 - new CI targets upload (including the targets upload during CI builds).
 - automatic re-signing of expired TUF roles using online keys (both CI and production targets).`,
 		Example: `
+- Rotate only the online TUF timestamp key, keeping the targets and snapshot keys:
+  fioctl keys tuf updates rotate-online-key --txid=abc --role=timestamp
 - Rotate online TUF targets key and re-sign the new TUF root:
   fioctl keys tuf updates rotate-online-key \
     --txid=abc --role=targets --keys=tuf-root-keys.tgz --sign
@@ -36,23 +42,30 @@ When you apply the online key rotation, these features are temporarily disabled
     --txid=abc --role=targets,snapshot,timestamp --key-type=ed25519`,
 		Run: doTufUpdatesRotateOnlineKey,
 	}
-	rotate.Flags().StringSliceP("role", "r", nil, "TUF role name, supported: Targets, Snapshot, Timestamp.")
+	rotate.Flags().StringSliceP("role", "r", nil, "TUF role names to rotate the online keys of, supported: Targets, Snapshot, Timestamp.")
 	_ = rotate.MarkFlagRequired("role")
 	rotate.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
 	rotate.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
 	_ = rotate.MarkFlagFilename("keys")
-	rotate.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA.")
+	rotate.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519, "Key type, supported: Ed25519, RSA, ECDSA-P256.")
 	rotate.Flags().BoolP("sign", "s", false, "Sign the new TUF root using the offline root keys.")
-	rotate.MarkFlagsRequiredTogether("sign", "keys")
+	addTufSigningKeyIdFlag(rotate)
+	AddTufSignerFlags(rotate)
+	addTufUpdatesDryRunFlag(rotate)
+	addTufResultFlags(rotate)
 	tufUpdatesCmd.AddCommand(rotate)
 }
 
 func doTufUpdatesRotateOnlineKey(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	txid, _ := cmd.Flags().GetString("txid")
-	roleNames, _ := cmd.Flags().GetStringSlice("role")
-	for idx, roleName := range roleNames {
-		roleNames[idx] = strings.ToLower(ParseTufRoleNameOnline(roleName))
+	roleFlags, _ := cmd.Flags().GetStringSlice("role")
+	var roleNames []string
+	for _, roleName := range roleFlags {
+		roleName = strings.ToLower(ParseTufRoleNameOnline(roleName))
+		if !slices.Contains(roleNames, roleName) {
+			roleNames = append(roleNames, roleName)
+		}
 	}
 	keyTypeStr, _ := cmd.Flags().GetString("key-type")
 	keyType := ParseTufKeyType(keyTypeStr)
@@ -63,8 +76,22 @@ func doTufUpdatesRotateOnlineKey(cmd *cobra.Command, args []string) {
 	updates, err := api.TufRootUpdatesGet(factory)
 	subcommands.DieNotNil(err)
 	_, _ = checkTufRootUpdatesStatus(updates, true)
+	oldOnlineKeys := updates.Updated.OnlineKeys
+	for _, roleName := range roleNames {
+		if updates.Current == nil {
+			break
+		}
+		if curId := updates.Current.OnlineKeys[roleName]; len(curId) > 0 && curId != oldOnlineKeys[roleName] {
+			fmt.Fprintf(tufProgress, "= The online %s key was already rotated in this transaction, it is rotated again\n", roleName)
+		}
+	}
 
-	fmt.Println("= Generating new online TUF keys")
+	if isTufUpdatesDryRun(cmd) {
+		// The new online keys are generated by the server, so there is nothing to compute locally
+		fmt.Fprintln(tufProgress, "= Dry run: new online TUF keys are not generated for:", strings.Join(roleNames, ", "))
+		return
+	}
+	fmt.Fprintln(tufProgress, "= Generating new online TUF keys")
 	subcommands.DieNotNil(api.TufRootUpdatesGenerateOnlineKeys(
 		factory, txid, keyType.Name(), roleNames,
 	))
@@ -73,20 +100,28 @@ func doTufUpdatesRotateOnlineKey(cmd *cobra.Command, args []string) {
 	subcommands.DieNotNil(err, "Failed to fetch new online TUF keys")
 	for _, roleName := range []string{tufRoleNameTargets, tufRoleNameSnapshot, tufRoleNameTimestamp} {
 		roleName = strings.ToLower(roleName)
+		oldId, newId := oldOnlineKeys[roleName], updates.Updated.OnlineKeys[roleName]
 		if slices.Contains(roleNames, roleName) {
-			fmt.Printf("= New online %s keyid: %s\n", roleName, updates.Updated.OnlineKeys[roleName])
+			fmt.Fprintf(tufProgress, "= New online %s keyid: %s (was: %s)\n", roleName, newId, oldId)
+			tufResult.addNewKey(roleName, newId, keyType.Name(), true)
+		} else if len(newId) == 0 {
+			continue
+		} else if oldId == newId {
+			fmt.Fprintf(tufProgress, "= Kept online %s keyid: %s\n", roleName, newId)
+		} else {
+			fmt.Fprintf(tufProgress, "WARNING: The online %s key was rotated although it was not requested: %s (was: %s)\n",
+				roleName, newId, oldId)
 		}
 	}
 
 	if shouldSign {
-		creds, err := GetOfflineCreds(keysFile)
+		creds, err := GetSigningCreds(keysFile)
 		subcommands.DieNotNil(err)
 
 		curCiRoot, newCiRoot := checkTufRootUpdatesStatus(updates, true)
 		newProdRoot := genProdTufRoot(newCiRoot)
 		signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
 
-		fmt.Println("= Uploading new TUF root")
-		subcommands.DieNotNil(api.TufRootUpdatesPut(factory, txid, newCiRoot, newProdRoot, nil))
+		subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
 	}
 }
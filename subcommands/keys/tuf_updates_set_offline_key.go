@@ -0,0 +1,179 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	set := &cobra.Command{
+		Use:   "set-offline-key --role root|targets --txid=<txid> --pubkey=<key.pem> [--privkey=<key.pem>]",
+		Short: "Stage rotation of the offline TUF signing key to a key generated elsewhere",
+		Long: `Stage rotation of the offline TUF signing key for the Factory to a key pair generated elsewhere,
+e.g. by a corporate PKI or an HSM tool, instead of a key generated by fioctl.
+
+This works like "rotate-offline-key", but the new key is read from PEM files. The public key may be a
+PKIX public key or an X.509 certificate, and the private key a PKCS#8, PKCS#1, or SEC 1 private key.
+Ed25519, RSA, and ECDSA P-256 keys are supported.
+
+With --privkey, the key pair is saved into the offline TUF keys. Without it, e.g. for a key held by an HSM,
+only the public key is imported: the new TUF root, and the production targets after a targets key rotation,
+must then be signed with the key where it is held, selected by the --hsm-key-label or --kms-key flags.`,
+		Example: `
+- Rotate offline TUF root key to a key pair issued by a corporate PKI:
+  fioctl keys tuf updates set-offline-key \
+    --txid=abc --role=root --keys=tuf-root-keys.tgz --pubkey=root.pub.pem --privkey=root.key.pem --sign
+- Rotate offline TUF targets key to a key held by an HSM, and re-sign production targets with it:
+  fioctl keys tuf updates set-offline-key \
+    --txid=abc --role=targets --keys=tuf-root-keys.tgz --pubkey=targets.pub.pem --sign \
+    --hsm-module=/usr/lib/softhsm/libsofthsm2.so --hsm-pin=1234 --hsm-token-label=tuf --hsm-key-label=targets-2024`,
+		Run:  doTufUpdatesRotateOfflineKey,
+		Args: cobra.NoArgs,
+	}
+	set.Flags().StringP("role", "r", "", "TUF role name, supported: Root, Targets.")
+	_ = set.MarkFlagRequired("role")
+	set.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
+	set.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
+	_ = set.MarkFlagFilename("keys")
+	set.Flags().StringP("targets-keys", "K", "", "Path to <tuf-targets-keys.tgz> used to sign prod & wave TUF targets.")
+	_ = set.MarkFlagFilename("targets-keys")
+	set.Flags().String("pubkey", "", "Path to the PEM public key or certificate of the new key, or keychain:<name> for a key in the OS keychain.")
+	_ = set.MarkFlagFilename("pubkey")
+	_ = set.MarkFlagRequired("pubkey")
+	set.Flags().String("privkey", "", "Path to the PEM private key of the new key, if it is not held by an HSM, or keychain:<name> for a key in the OS keychain.")
+	_ = set.MarkFlagFilename("privkey")
+	set.Flags().BoolP("sign", "s", false, "Sign the new TUF root using the offline root keys.")
+	addTufExpiresFlag(set)
+	addTufSigningKeyIdFlag(set)
+	AddTufSignerFlags(set)
+	addTufUpdatesDryRunFlag(set)
+	addTufResultFlags(set)
+	tufUpdatesCmd.AddCommand(set)
+}
+
+// importTufKeyPair returns a key pair generated elsewhere, read from PEM files.
+// Without a private key file, only the public key is imported, and the key pair has nothing to save.
+func importTufKeyPair(pubFile, privFile string) TufKeyPair {
+	pub, err := readPemPublicKey(pubFile)
+	subcommands.DieNotNil(err, pubFile+":")
+	keyType, err := tufKeyTypeOfPublicKey(pub)
+	subcommands.DieNotNil(err, pubFile+":")
+
+	if len(privFile) > 0 {
+		priv, err := readPemPrivateKey(privFile)
+		subcommands.DieNotNil(err, privFile+":")
+		if eq, ok := priv.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !eq.Equal(pub) {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The private key %s does not match the public key %s", privFile, pubFile))
+		}
+		return tufKeyPairOf(keyType, priv)
+	}
+
+	var pubValue string
+	if edPub, ok := pub.(ed25519.PublicKey); ok {
+		pubValue = hex.EncodeToString(edPub)
+	} else {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		subcommands.DieNotNil(err)
+		pubValue = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	atsPub := client.AtsKey{KeyType: keyType.Name(), KeyValue: client.AtsKeyVal{Public: pubValue}}
+	atsPubBytes, err := json.Marshal(atsPub)
+	subcommands.DieNotNil(err)
+	id, err := tufPublicKeyId(atsPub)
+	subcommands.DieNotNil(err)
+	return TufKeyPair{signer: TufSigner{Id: id, Type: keyType}, atsPub: atsPub, atsPubBytes: atsPubBytes}
+}
+
+func readPemPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPemBlock(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("Unsupported PEM block for a public key: %s", block.Type)
+}
+
+func readPemPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPemBlock(path)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, errors.New("Encrypted private keys are not supported, please decrypt it first")
+	default:
+		return nil, fmt.Errorf("Unsupported PEM block for a private key: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported private key type: %T", key)
+	}
+	return signer, nil
+}
+
+func readPemBlock(path string) (*pem.Block, error) {
+	data, err := readTufKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM data found")
+	}
+	return block, nil
+}
+
+// tufKeyTypeOfPublicKey returns the TUF key type of a public key, if it is supported by TUF.
+func tufKeyTypeOfPublicKey(pub crypto.PublicKey) (TufKeyType, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return client.ParseTufKeyType(client.TufKeyTypeNameEd25519)
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits, this one has %d", k.N.BitLen())
+		}
+		return client.ParseTufKeyType(client.TufKeyTypeNameRSA)
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("Unsupported ECDSA curve: %s, only P-256 is supported", k.Curve.Params().Name)
+		}
+		return client.ParseTufKeyType(client.TufKeyTypeNameEcdsaP256)
+	}
+	return nil, fmt.Errorf("Unsupported public key type: %T", pub)
+}
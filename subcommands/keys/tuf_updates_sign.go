@@ -1,13 +1,12 @@
 package keys
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
 
-	"github.com/foundriesio/fioctl/client"
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
@@ -15,41 +14,51 @@ func init() {
 	signCmd := &cobra.Command{
 		Use:   "sign --txid=<txid> --keys=<tuf-root-keys.tgz>",
 		Short: "Sign the staged TUF root for your Factory with the offline root key",
-		Long:  "Sign the staged TUF root for your Factory with the offline root key",
-		Run:   doTufUpdatesSign,
+		Long: `Sign the staged TUF root for your Factory with the offline root key.
+
+When the TUF root has several offline root keys, it is signed with all of the root keys in the given
+offline TUF keys. The signatures made by other admins before are kept, so that each admin can sign
+with their own keys until the root threshold is met. The --keys flag can be repeated to sign with
+the root keys from several files at once.
+
+With --expires, the expiry of the staged TUF root is changed before signing it. As the signatures made
+before are then no longer valid, they are dropped, and the other admins must sign the TUF root again.`,
+		Example: `
+- Sign the staged TUF root with the root keys of two admins:
+  fioctl keys tuf updates sign --txid=abc --keys=admin1-root-keys.tgz --keys=admin2-root-keys.tgz
+- Sign the staged TUF root, and make it expire in 2 years instead:
+  fioctl keys tuf updates sign --txid=abc --keys=tuf-root-keys.tgz --expires=2y`,
+		Run: doTufUpdatesSign,
 	}
 	signCmd.Flags().StringP("txid", "x", "", "TUF root updates transaction ID.")
-	signCmd.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
+	signCmd.Flags().StringArrayP("keys", "k", nil, "Path to <tuf-root-keys.tgz> used to sign TUF root. Can be repeated.")
 	_ = signCmd.MarkFlagFilename("keys")
-	_ = signCmd.MarkFlagRequired("keys")
+	addTufExpiresFlag(signCmd)
+	addTufSigningKeyIdFlag(signCmd)
+	AddTufSignerFlags(signCmd)
+	addTufUpdatesDryRunFlag(signCmd)
+	addTufResultFlags(signCmd)
 	tufUpdatesCmd.AddCommand(signCmd)
 }
 
 func doTufUpdatesSign(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	txid, _ := cmd.Flags().GetString("txid")
-	keysFile, _ := cmd.Flags().GetString("keys")
+	keysFiles, _ := cmd.Flags().GetStringArray("keys")
 
-	creds, err := GetOfflineCreds(keysFile)
-	subcommands.DieNotNil(err)
+	creds := getSigningCredsFiles(keysFiles)
 
 	updates, err := api.TufRootUpdatesGet(factory)
 	subcommands.DieNotNil(err)
 
-	var curCiRoot, newCiRoot, newProdRoot *client.AtsTufRoot
-	curCiRoot, newCiRoot = checkTufRootUpdatesStatus(updates, true)
-	if updates.Updated.ProdRoot != "" {
-		subcommands.DieNotNil(
-			json.Unmarshal([]byte(updates.Updated.ProdRoot), &newProdRoot), "Updated prod root",
-		)
-	}
-	if newProdRoot == nil {
-		// User might still want to re-sign and apply updates even if there are no changes.
-		// E.g. this way the user can optimize the latest root.json size after the root key rotation
+	curCiRoot, newCiRoot, newProdRoot := getStagedTufRoots(updates)
+	if setTufRootExpires(cmd, newCiRoot, false) {
+		if len(newCiRoot.Signatures) > 0 {
+			fmt.Fprintln(tufProgress, "= Dropping the signatures made before the TUF root expiry was changed")
+		}
+		newCiRoot.Signatures = make([]tuf.Signature, 0)
 		newProdRoot = genProdTufRoot(newCiRoot)
 	}
-
 	signNewTufRoot(curCiRoot, newCiRoot, newProdRoot, creds)
-	fmt.Println("= Uploading new TUF root")
-	subcommands.DieNotNil(api.TufRootUpdatesPut(factory, txid, newCiRoot, newProdRoot, nil))
+	subcommands.DieNotNil(putTufRootUpdates(cmd, factory, txid, newCiRoot, newProdRoot, nil))
 }
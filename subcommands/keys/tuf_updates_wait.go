@@ -0,0 +1,77 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// addTufWaitFlags adds the flags to wait for the staged TUF root updates to complete.
+func addTufWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("wait", false,
+		"Wait for the staged TUF root updates to be applied or cancelled, e.g. by other admins. "+
+			"Fails if they are cancelled, or if applying them fails.")
+	cmd.Flags().Duration("timeout", time.Hour, "How long to wait for the staged TUF root updates to complete")
+	cmd.Flags().Duration("interval", 10*time.Second, "How often to check the status of the staged TUF root updates")
+}
+
+// waitTufRootUpdates polls the TUF root updates until they are applied or cancelled, and fails unless they are applied.
+// As the server only tells that no updates are in progress, the current TUF root then tells which happened:
+// it has the version of the staged TUF root once the updates are applied.
+func waitTufRootUpdates(cmd *cobra.Command, factory string, updates client.TufRootUpdates) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if timeout <= 0 || interval <= 0 {
+		subcommands.DieNotNil(subcommands.ValidationError("The --timeout and --interval must be positive"))
+	}
+	if updates.Status == client.TufRootUpdatesStatusNone {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			errors.New("There are no TUF root updates in progress to wait for.")))
+	}
+
+	_, newCiRoot := checkTufRootUpdatesStatus(updates, false)
+	stagedVersion := newCiRoot.Signed.Version
+	status := updates.Status
+	fmt.Fprintf(tufProgress, "\n= Waiting up to %s for the staged TUF root updates to be applied or cancelled\n", timeout)
+	deadline := time.Now().Add(timeout)
+	for {
+		if left := time.Until(deadline); left <= 0 {
+			subcommands.DieNotNil(fmt.Errorf(
+				"Timed out waiting for the staged TUF root updates to complete, their status is: %s", status))
+		} else if left < interval {
+			interval = left
+		}
+		time.Sleep(interval)
+		var err error
+		updates, err = api.TufRootUpdatesGet(factory)
+		subcommands.DieNotNil(err)
+		curCiRoot, newCiRoot := checkTufRootUpdatesStatus(updates, false)
+
+		switch updates.Status {
+		case client.TufRootUpdatesStatusNone:
+			if curCiRoot.Signed.Version >= stagedVersion {
+				fmt.Fprintf(tufProgress, "= The staged TUF root updates were applied, the TUF root version is now %d\n",
+					curCiRoot.Signed.Version)
+				return
+			}
+			subcommands.DieNotNil(errors.New("The staged TUF root updates were cancelled."))
+		case client.TufRootUpdatesStatusStarted:
+			if status == client.TufRootUpdatesStatusApplying {
+				subcommands.DieNotNil(errors.New(`Failed to apply the staged TUF root updates.
+Please, review them using "fioctl keys tuf updates review".`))
+			}
+			stagedVersion = newCiRoot.Signed.Version
+		case client.TufRootUpdatesStatusApplying:
+			stagedVersion = newCiRoot.Signed.Version
+		}
+		if updates.Status != status {
+			fmt.Fprintf(tufProgress, "= Status of the staged TUF root updates: %s\n", updates.Status)
+			status = updates.Status
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// tufWizardStep is the step the wizard is at, so that a failure tells where the ceremony stopped.
+var tufWizardStep string
+
+func init() {
+	wizard := &cobra.Command{
+		Use:   "wizard --keys=<tuf-root-keys.tgz> [--targets-keys=<tuf-targets-keys.tgz>]",
+		Short: "Interactively walk through a TUF key rotation ceremony",
+		Long: `Interactively walk through a TUF key rotation ceremony, running the "tuf updates" subcommands
+in the correct order, with the correct flags:
+
+1. init: start a new transaction, unless one is in progress.
+2. review: show the staged TUF root.
+3. rotate-offline-key --role=root: generate a new offline TUF root key.
+4. rotate-offline-key --role=targets: generate a new offline TUF targets key,
+   and re-sign the production targets with it.
+5. sign: sign the staged TUF root with the offline root keys.
+6. review --diff: show the changes to the TUF root.
+7. apply: apply the staged changes.
+
+Each step asks for a confirmation, and may be skipped. After each step, the checksums of the staged
+CI and production TUF root are printed, so that they can be recorded in a transcript of the ceremony
+and compared with what other admins see. A checksum is the SHA-256 of the canonical JSON of the signed
+part of a TUF root, which is what the root keys sign.
+
+With --transcript, each step which changes the TUF root appends a signed entry to a transcript of the ceremony.
+
+If the wizard stops, the changes staged before are kept. Run the wizard again to continue,
+or cancel them with "fioctl keys tuf updates cancel".`,
+		Example: `
+- Rotate both offline TUF keys, and keep the targets key in a separate file:
+  fioctl keys tuf updates wizard --keys=tuf-root-keys.tgz --targets-keys=tuf-targets-keys.tgz
+- Continue a transaction started by another admin:
+  fioctl keys tuf updates wizard --txid=abc --keys=tuf-root-keys.tgz`,
+		Run:  doTufUpdatesWizard,
+		Args: cobra.NoArgs,
+	}
+	wizard.Flags().StringP("txid", "x", "", "TUF root updates transaction ID, to continue a transaction started by another admin.")
+	wizard.Flags().StringP("keys", "k", "", "Path to <tuf-root-keys.tgz> used to sign TUF root.")
+	_ = wizard.MarkFlagRequired("keys")
+	_ = wizard.MarkFlagFilename("keys")
+	wizard.Flags().StringP("targets-keys", "K", "", "Path to <tuf-targets-keys.tgz> to save the new targets key to (default: the --keys file).")
+	_ = wizard.MarkFlagFilename("targets-keys")
+	addTufKeyTypeFlag(wizard)
+	wizard.Flags().BoolP("first-time", "", false, "Used for the first customer rotation. The command will download the initial root key.")
+	addTufExpiresFlag(wizard)
+	addTufTranscriptFlags(wizard)
+	tufUpdatesCmd.AddCommand(wizard)
+
+	subcommands.AddLastWill(func() {
+		if len(tufWizardStep) > 0 {
+			fmt.Fprintf(tufProgress, `
+The TUF updates wizard stopped at the step: %s.
+The changes staged before are kept. Please, fix an error above, and run the wizard again to continue,
+or cancel the staged changes using the "fioctl keys tuf updates cancel" command.
+`, tufWizardStep)
+		}
+	})
+}
+
+func doTufUpdatesWizard(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	txid, _ := cmd.Flags().GetString("txid")
+	keysFile, _ := cmd.Flags().GetString("keys")
+	targetsKeysFile, _ := cmd.Flags().GetString("targets-keys")
+	keyType, _ := cmd.Flags().GetString("key-type")
+	ParseTufKeyType(keyType) // fails on error
+	firstTime, _ := cmd.Flags().GetBool("first-time")
+	expires, _ := cmd.Flags().GetString("expires")
+	transcriptFile, _ := cmd.Flags().GetString("transcript")
+	transcriptKey, _ := cmd.Flags().GetString("transcript-key")
+	if len(transcriptFile) > 0 {
+		openTufTranscript(transcriptFile, transcriptKey) // fails on error
+	}
+
+	// Below the `tuf updates` subcommands are chained in a correct order.
+	// Detach from the parent, so that command calls below use correct args.
+	tufCmd.RemoveCommand(tufUpdatesCmd)
+	run := func(withTxid bool, args ...string) {
+		if withTxid && len(txid) > 0 {
+			args = append(args, "--txid", txid)
+		}
+		fmt.Fprintln(tufProgress, "= Running: fioctl keys tuf updates", strings.Join(args, " "))
+		if args[0] != "review" && len(transcriptFile) > 0 {
+			args = append(args, "--transcript", transcriptFile, "--transcript-key", transcriptKey)
+		}
+		tufUpdatesCmd.SetArgs(args)
+		subcommands.DieNotNil(tufUpdatesCmd.Execute())
+	}
+
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	tufWizardStep = "init"
+	if updates.Status == client.TufRootUpdatesStatusNone {
+		if len(txid) > 0 {
+			subcommands.DieNotNil(errors.New("There are no TUF root updates in progress to continue."))
+		}
+		fmt.Fprintln(tufProgress, "\nStep 1: start a new TUF root updates transaction.")
+		changelog := subcommands.PromptValid("Reason for the changes, saved in the TUF root", "", func(val string) error {
+			if len(val) == 0 {
+				return errors.New("The reason is required")
+			}
+			return nil
+		})
+		if !subcommands.PromptYesNo("Start a new transaction?", true) {
+			tufWizardStep = ""
+			return
+		}
+		initArgs := []string{"init", "-m", changelog}
+		if firstTime {
+			initArgs = append(initArgs, "--first-time", "-k", keysFile)
+		}
+		run(false, initArgs...)
+	} else {
+		fmt.Fprintln(tufProgress, "\nStep 1: continue the TUF root updates transaction in progress.")
+		if firstTime {
+			subcommands.DieNotNil(errors.New("The --first-time option is only valid to start a new transaction."))
+		}
+	}
+
+	tufWizardStep = "review"
+	fmt.Fprintln(tufProgress, "\nStep 2: review the staged TUF root.")
+	run(false, "review")
+	printTufWizardChecksums(factory)
+
+	tufWizardStep = "rotate the offline TUF root key"
+	fmt.Fprintln(tufProgress, "\nStep 3: rotate the offline TUF root key.")
+	if subcommands.PromptYesNo("Generate a new offline TUF root key in "+keysFile+"?", true) {
+		rotateArgs := []string{"rotate-offline-key", "-r", "root", "-k", keysFile, "-y", keyType}
+		if len(expires) > 0 {
+			rotateArgs = append(rotateArgs, "--expires", expires)
+		}
+		run(true, rotateArgs...)
+		printTufWizardChecksums(factory)
+	}
+
+	tufWizardStep = "rotate the offline TUF targets key"
+	fmt.Fprintln(tufProgress, "\nStep 4: rotate the offline TUF targets key, and re-sign the production targets with it.")
+	targetsFile := keysFile
+	if len(targetsKeysFile) > 0 {
+		targetsFile = targetsKeysFile
+	}
+	if subcommands.PromptYesNo("Generate a new offline TUF targets key in "+targetsFile+"?", true) {
+		rotateArgs := []string{"rotate-offline-key", "-r", "targets", "-k", keysFile, "-y", keyType}
+		if len(targetsKeysFile) > 0 {
+			rotateArgs = append(rotateArgs, "-K", targetsKeysFile)
+		}
+		run(true, rotateArgs...)
+		printTufWizardChecksums(factory)
+	}
+
+	tufWizardStep = "sign"
+	fmt.Fprintln(tufProgress, "\nStep 5: sign the staged TUF root with the offline root keys.")
+	if subcommands.PromptYesNo("Sign with the root keys in "+keysFile+"?", true) {
+		run(true, "sign", "-k", keysFile)
+		printTufWizardChecksums(factory)
+	}
+
+	tufWizardStep = "review the changes"
+	fmt.Fprintln(tufProgress, "\nStep 6: review the changes to the TUF root.")
+	if subcommands.PromptYesNo("Show the changes?", true) {
+		run(false, "review", "--diff")
+	}
+
+	tufWizardStep = ""
+	fmt.Fprintln(tufProgress, "\nStep 7: apply the staged changes.")
+	if !subcommands.PromptYesNo("Apply the staged TUF root updates to your Factory?", false) {
+		fmt.Fprintln(tufProgress, `The staged changes are kept. Other admins may sign them with "fioctl keys tuf updates sign".
+Apply them with "fioctl keys tuf updates apply", or cancel them with "fioctl keys tuf updates cancel".`)
+		return
+	}
+	run(true, "apply")
+}
+
+// printTufWizardChecksums prints the checksums of the staged TUF root, for a transcript of the ceremony.
+func printTufWizardChecksums(factory string) {
+	updates, err := api.TufRootUpdatesGet(factory)
+	subcommands.DieNotNil(err)
+	_, ciRoot, prodRoot := getStagedTufRoots(updates)
+	fmt.Fprintln(tufProgress, "= Checksums of the staged TUF root:")
+	for _, r := range []struct {
+		name string
+		root *client.AtsTufRoot
+	}{{"CI", ciRoot}, {"production", prodRoot}} {
+		fmt.Fprintf(tufProgress, "  %-10s root version %d: sha256 %s, signatures: %d\n",
+			r.name, r.root.Signed.Version, tufRootChecksum(r.root), len(r.root.Signatures))
+	}
+}
@@ -0,0 +1,257 @@
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var usageOutput subcommands.ListOutput
+
+func init() {
+	usageCmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show which TUF keys signed which metadata versions",
+		Long: `Walk the history of the CI and production TUF root metadata and the production targets
+of each tag, and show which key IDs signed which versions, and when each key was first and last used.
+
+Root versions are dated by their changelog, when it is present. The server only keeps the latest
+production targets of each tag, so older targets versions are not included.
+
+With --keys, the keys found in an offline TUF keys archive are marked, and those never used are listed.
+This helps to plan key rotations, and to audit which keys are still trusted.`,
+		Run:  doKeysUsage,
+		Args: cobra.NoArgs,
+		Example: `
+  # Show the usage of all keys, and which ones are in the offline keys archive
+  fioctl keys usage --keys tuf-root-keys.tgz`,
+	}
+	cmd.AddCommand(usageCmd)
+	usageCmd.Flags().StringP("keys", "k", "", "Path to <offline-creds.tgz> to mark the keys it contains")
+	usageOutput.AddFlags(usageCmd, "last-used")
+}
+
+// keyUse is a metadata version signed by a key.
+type keyUse struct {
+	Kind    string
+	Tag     string
+	Version int
+	At      time.Time
+}
+
+func (u keyUse) String() string {
+	s := fmt.Sprintf("%s v%d", u.Kind, u.Version)
+	if len(u.Tag) > 0 {
+		s = fmt.Sprintf("%s %s v%d", u.Kind, u.Tag, u.Version)
+	}
+	if !u.At.IsZero() {
+		s += " (" + subcommands.FormatTime(u.At.UTC().Format(time.RFC3339)) + ")"
+	}
+	return s
+}
+
+type tufKeyUsage struct {
+	Id      string
+	Roles   map[string]bool
+	InCreds bool
+	Uses    []keyUse
+}
+
+// firstLast returns the first use of a key, which is the oldest version it signed, and its last use.
+// The last use is the most recently dated one, or the last one in the order of versions if none is dated.
+func (k *tufKeyUsage) firstLast() (first, last string) {
+	if len(k.Uses) == 0 {
+		return "never", "never"
+	}
+	lastUse := k.Uses[len(k.Uses)-1]
+	var lastDated *keyUse
+	for idx, u := range k.Uses {
+		if !u.At.IsZero() && (lastDated == nil || u.At.After(lastDated.At)) {
+			lastDated = &k.Uses[idx]
+		}
+	}
+	if lastDated != nil {
+		lastUse = *lastDated
+	}
+	return k.Uses[0].String(), lastUse.String()
+}
+
+// signed summarizes the versions signed by a key, e.g. "root v1-3,5; prod targets main v12".
+func (k *tufKeyUsage) signed() string {
+	var order []string
+	versions := make(map[string][]int)
+	for _, u := range k.Uses {
+		kind := u.Kind
+		if len(u.Tag) > 0 {
+			kind += " " + u.Tag
+		}
+		if _, ok := versions[kind]; !ok {
+			order = append(order, kind)
+		}
+		versions[kind] = append(versions[kind], u.Version)
+	}
+	parts := make([]string, 0, len(order))
+	for _, kind := range order {
+		parts = append(parts, kind+" v"+versionRanges(versions[kind]))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// versionRanges formats a sorted list of versions compactly, e.g. "1-3,5".
+func versionRanges(versions []int) string {
+	var parts []string
+	for i := 0; i < len(versions); {
+		j := i
+		for j+1 < len(versions) && versions[j+1] == versions[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", versions[i], versions[j]))
+		} else {
+			parts = append(parts, fmt.Sprint(versions[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+type keyUsageReport struct {
+	keys map[string]*tufKeyUsage
+	// Public key values of all keys seen in the root versions
+	public map[string]string
+}
+
+func (r *keyUsageReport) key(id string) *tufKeyUsage {
+	k, ok := r.keys[id]
+	if !ok {
+		k = &tufKeyUsage{Id: id, Roles: make(map[string]bool)}
+		r.keys[id] = k
+	}
+	return k
+}
+
+func (r *keyUsageReport) addSignatures(sigs []tuf.Signature, use keyUse) {
+	for _, sig := range sigs {
+		k := r.key(sig.KeyID)
+		k.Uses = append(k.Uses, use)
+	}
+}
+
+// addRootHistory adds all versions of the CI or production root, from the first one to the latest.
+func (r *keyUsageReport) addRootHistory(factory string, prod bool) {
+	kind := "root"
+	if prod {
+		kind = "prod root"
+	}
+	latest, err := api.TufRootGetRaw(factory, prod, -1)
+	subcommands.DieNotNil(err)
+	var latestRoot client.AtsTufRoot
+	subcommands.DieNotNil(json.Unmarshal(*latest, &latestRoot), "Invalid root metadata:")
+
+	for ver := 1; ver <= latestRoot.Signed.Version; ver++ {
+		root := latestRoot
+		if ver < latestRoot.Signed.Version {
+			raw, err := api.TufRootGetRaw(factory, prod, ver)
+			if err != nil {
+				logrus.Warnf("Unable to fetch the %s version %d, skipping it: %s", kind, ver, err)
+				continue
+			}
+			root = client.AtsTufRoot{}
+			subcommands.DieNotNil(json.Unmarshal(*raw, &root), "Invalid root metadata:")
+		}
+		for id, key := range root.Signed.Keys {
+			r.public[strings.TrimSpace(key.KeyValue.Public)] = id
+		}
+		for role, def := range root.Signed.Roles {
+			for _, id := range def.KeyIDs {
+				r.key(id).Roles[string(role)] = true
+			}
+		}
+		use := keyUse{Kind: kind, Version: root.Signed.Version}
+		if root.Signed.Reason != nil {
+			use.At = root.Signed.Reason.Timestamp
+		}
+		r.addSignatures(root.Signatures, use)
+	}
+}
+
+func doKeysUsage(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	credsFile, _ := cmd.Flags().GetString("keys")
+	logrus.Debugf("Showing TUF key usage of %s", factory)
+
+	report := keyUsageReport{keys: make(map[string]*tufKeyUsage), public: make(map[string]string)}
+	report.addRootHistory(factory, false)
+	report.addRootHistory(factory, true)
+
+	prodTargets, err := api.ProdTargetsList(factory, false)
+	subcommands.DieNotNil(err)
+	tags := make([]string, 0, len(prodTargets))
+	for tag := range prodTargets {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		targets := prodTargets[tag]
+		report.addSignatures(targets.Signatures, keyUse{Kind: "prod targets", Tag: tag, Version: targets.Signed.Version})
+	}
+
+	unknownCreds := 0
+	if len(credsFile) > 0 {
+		creds, err := GetOfflineCreds(credsFile)
+		subcommands.DieNotNil(err)
+		for name, content := range creds {
+			if !strings.HasSuffix(name, ".pub") {
+				continue
+			}
+			var key client.AtsKey
+			if err := json.Unmarshal(content, &key); err != nil {
+				subcommands.DieNotNil(fmt.Errorf("Unable to parse JSON for %s: %w", name, err))
+			}
+			if id, ok := report.public[strings.TrimSpace(key.KeyValue.Public)]; ok {
+				report.key(id).InCreds = true
+			} else {
+				unknownCreds += 1
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(report.keys))
+	for id := range report.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	t := usageOutput.NewTable("KEY ID", "ROLES", "IN CREDS", "FIRST USED", "LAST USED", "SIGNED")
+	for _, id := range ids {
+		k := report.keys[id]
+		roles := make([]string, 0, len(k.Roles))
+		for role := range k.Roles {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		inCreds := "-"
+		if len(credsFile) > 0 {
+			inCreds = "no"
+			if k.InCreds {
+				inCreds = "yes"
+			}
+		}
+		first, last := k.firstLast()
+		t.AddLine(id, strings.Join(roles, ","), inCreds, first, last, k.signed())
+	}
+	t.Print()
+	if unknownCreds > 0 && usageOutput.Format == subcommands.OutputFormatTable {
+		fmt.Printf("\n%d key(s) in %s are not in any root version\n", unknownCreds, credsFile)
+	}
+}
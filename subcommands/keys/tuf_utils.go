@@ -1,20 +1,18 @@
 package keys
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/gzip"
 	"crypto"
-	"crypto/rand"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
+	"sort"
 	"strings"
 
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+
 	canonical "github.com/docker/go/canonical/json"
 	tuf "github.com/theupdateframework/notary/tuf/data"
 
@@ -22,13 +20,9 @@ import (
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
-type OfflineCreds map[string][]byte
+type OfflineCreds = client.OfflineCreds
 
-type TufSigner struct {
-	Id   string
-	Type TufKeyType
-	Key  crypto.Signer
-}
+type TufSigner = client.TufSigner
 
 type TufKeyPair struct {
 	signer       TufSigner
@@ -36,14 +30,25 @@ type TufKeyPair struct {
 	atsPrivBytes []byte
 	atsPub       client.AtsKey
 	atsPubBytes  []byte
+	// Set instead of the private key for a key on a device, e.g. a YubiKey, which can not leave it
+	keyRefSuffix string
+	keyRefBytes  []byte
 }
 
 func ParseTufKeyType(s string) TufKeyType {
-	t, err := parseTufKeyType(s)
+	t, err := client.ParseTufKeyType(s)
 	subcommands.DieNotNil(err)
 	return t
 }
 
+// addTufKeyTypeFlag adds the --key-type flag to a command generating offline TUF keys.
+// There is no flag to select the RSA signature scheme: RSA keys only sign with RSASSA-PSS,
+// as the devices do not verify PKCS#1 v1.5 signatures of TUF metadata.
+func addTufKeyTypeFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("key-type", "y", tufKeyTypeNameEd25519,
+		"Key type, supported: Ed25519, RSA, RSA-2048, RSA-3072, RSA-4096, ECDSA-P256. RSA keys sign with RSASSA-PSS.")
+}
+
 func ParseTufRoleNameOffline(s string) string {
 	r, err := parseTufRoleName(s, tufRoleNameRoot, tufRoleNameTargets)
 	subcommands.DieNotNil(err)
@@ -57,19 +62,20 @@ func ParseTufRoleNameOnline(s string) string {
 }
 
 func genTufKeyId(key crypto.Signer) string {
-	// # This has to match the exact logic used by ota-tuf (required by garage-sign):
-	// https://github.com/foundriesio/ota-tuf/blob/fio-changes/libtuf/src/main/scala/com/advancedtelematic/libtuf/crypt/TufCrypto.scala#L66-L71
-	// It sets a keyid to a signature of the key's canonical DER encoding (same logic for all keys).
-	// Note: this differs from the TUF spec, need to change once we deprecate the garage-sign.
-	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	id, err := client.GenTufKeyId(key)
 	subcommands.DieNotNil(err)
-	return fmt.Sprintf("%x", sha256.Sum256(pubBytes))
+	return id
 }
 
 func genTufKeyPair(keyType TufKeyType) TufKeyPair {
-	keyTypeName := keyType.Name()
 	pk, err := keyType.GenerateKey()
 	subcommands.DieNotNil(err)
+	return tufKeyPairOf(keyType, pk)
+}
+
+// tufKeyPairOf returns the key pair of a private key, to be saved into the offline TUF keys.
+func tufKeyPairOf(keyType TufKeyType, pk crypto.Signer) TufKeyPair {
+	keyTypeName := keyType.Name()
 	privKey, pubKey, err := keyType.SaveKeyPair(pk)
 	subcommands.DieNotNil(err)
 
@@ -103,153 +109,162 @@ func genTufKeyPair(keyType TufKeyType) TufKeyPair {
 }
 
 func SignTufMeta(metaBytes []byte, signers ...TufSigner) ([]tuf.Signature, error) {
-	signatures := make([]tuf.Signature, len(signers))
-
-	for idx, signer := range signers {
-		digest := metaBytes[:]
-		opts := signer.Type.SigOpts()
-		if opts.HashFunc() != crypto.Hash(0) {
-			// Golang expects the caller to hash the digest if needed by the signing method
-
-			h := opts.HashFunc().New()
-			h.Write(digest)
-			digest = h.Sum(nil)
-		}
-		sigBytes, err := signer.Key.Sign(rand.Reader, digest, opts)
-		if err != nil {
-			return nil, err
-		}
-		signatures[idx] = tuf.Signature{
-			KeyID:     signer.Id,
-			Method:    tuf.SigAlgorithm(signer.Type.SigName()),
-			Signature: sigBytes,
-		}
-	}
-	return signatures, nil
+	signatures, err := client.SignTufMeta(metaBytes, signers...)
+	return signatures, subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err)
 }
 
 func signTufRoot(root *client.AtsTufRoot, signers ...TufSigner) error {
-	bytes, err := canonical.MarshalCanonical(root.Signed)
-	if err != nil {
-		return err
-	}
-	signatures, err := SignTufMeta(bytes, signers...)
-	if err != nil {
-		return err
-	}
-	root.Signatures = signatures
-	return nil
+	return subcommands.WithErrorCode(subcommands.ErrorCodeSigning, client.SignTufRoot(root, signers...))
 }
 
 func saveTufCreds(path string, creds OfflineCreds) {
-	file, err := os.Create(path)
-	subcommands.DieNotNil(err)
-	defer file.Close()
-
-	gzipWriter := gzip.NewWriter(file)
-	defer gzipWriter.Close()
-
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
-
-	for name, val := range creds {
-		header := &tar.Header{
-			Name: name,
-			Size: int64(len(val)),
-		}
-		subcommands.DieNotNil(tarWriter.WriteHeader(header))
-		_, err := tarWriter.Write(val)
-		subcommands.DieNotNil(err)
-	}
+	subcommands.DieNotNil(client.SaveOfflineCreds(path, creds))
 }
 
 func saveTempTufCreds(credsFile string, creds OfflineCreds) string {
+	assertNoTempTufCreds(credsFile)
+	path := credsFile + ".tmp"
+	subcommands.DieNotNil(client.SaveOfflineCredsCopy(path, credsFile, creds))
+	return path
+}
+
+// assertNoTempTufCreds dies if a temporary copy of the offline TUF keys is left from a previous rotation.
+func assertNoTempTufCreds(credsFile string) {
 	path := credsFile + ".tmp"
 	if _, err := os.Stat(path); err == nil {
 		subcommands.DieNotNil(fmt.Errorf(`Backup file exists: %s
 This file may be from a previous failed key rotation and include critical data.
-Please move this file somewhere safe before re-running this command.`,
-			path,
+Please run 'fioctl keys tuf updates resume --keys=%s' to finish that key rotation,
+or move this file somewhere safe before re-running this command.`,
+			path, credsFile,
 		))
 	}
-	saveTufCreds(path, creds)
-	return path
 }
 
 func GetOfflineCreds(credsFile string) (OfflineCreds, error) {
-	f, err := os.Open(credsFile)
+	creds, err := client.LoadOfflineCreds(credsFile)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-
-	files := make(OfflineCreds)
-
-	gzf, err := gzip.NewReader(f)
-	if err != nil {
+	if err := loadYubikeyTufSigners(creds); err != nil {
 		return nil, err
 	}
-	tr := tar.NewReader(gzf)
+	return creds, loadTpmTufSigners(creds)
+}
 
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break // End of archive
+func FindTufSigner(keyid, pubkey string, creds OfflineCreds) (*TufSigner, error) {
+	signer, err := client.FindTufSigner(keyid, pubkey, creds, tufSignerOpts)
+	return signer, subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err)
+}
+
+// findTufRootSigners returns the signers of those root keys which are in the offline TUF keys.
+// The root may have several keys, each of them held by another admin.
+func findTufRootSigners(root *client.AtsTufRoot, creds OfflineCreds) ([]TufSigner, error) {
+	var signers []TufSigner
+	for _, kid := range root.Signed.Roles["root"].KeyIDs {
+		signer, err := FindTufSigner(kid, root.Signed.Keys[kid].KeyValue.Public, creds)
+		if errors.Is(err, client.ErrTufKeyNotFound) {
+			continue
 		} else if err != nil {
 			return nil, err
 		}
+		signers = append(signers, *signer)
+	}
+	return signers, nil
+}
+
+var (
+	// tufSigningKeyIds are the key IDs, or their prefixes, of the root keys selected to sign with --signing-key-id.
+	tufSigningKeyIds []string
+	// tufSelectedKeyIds are the IDs of the root keys generated or rotated by a command,
+	// which are selected without being set with --signing-key-id.
+	tufSelectedKeyIds []string
+)
+
+// addTufSigningKeyIdFlag adds the --signing-key-id flag to a command signing the TUF root,
+// so that an offline TUF keys archive shared by several custodians can be used. It is read by
+// the PreRun of AddTufSignerFlags, which must be called too.
+func addTufSigningKeyIdFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArray("signing-key-id", nil,
+		"Only sign with the root key of this ID, or a unique prefix of it, when the keys archive has several root keys. "+
+			"With several root keys, it also selects the one to rotate. Can be repeated.")
+}
 
-		if hdr.Typeflag == tar.TypeDir {
+// selectTufRootSigners returns the signers selected with --signing-key-id, or all of them if none is selected.
+// The root keys generated by the command are always selected, as they must sign the TUF root they are added to.
+// A selected key which is rotated signs only if it is still in the current TUF root.
+func selectTufRootSigners(signers []TufSigner) []TufSigner {
+	if len(tufSigningKeyIds) == 0 {
+		return signers
+	}
+	ids := make([]string, 0, len(signers))
+	for _, signer := range signers {
+		ids = append(ids, signer.Id)
+	}
+	selected := make([]string, 0, len(tufSigningKeyIds))
+	for _, prefix := range tufSigningKeyIds {
+		if slices.IndexFunc(tufSelectedKeyIds, func(id string) bool { return strings.HasPrefix(id, prefix) }) >= 0 {
 			continue
 		}
-
-		var b bytes.Buffer
-		if _, err = io.Copy(&b, tr); err != nil {
-			return nil, err
+		id, err := matchTufSigningKeyId(prefix, ids)
+		subcommands.DieNotNil(err)
+		selected = append(selected, id)
+	}
+	var res []TufSigner
+	for _, signer := range signers {
+		if slices.Contains(selected, signer.Id) || slices.Contains(tufSelectedKeyIds, signer.Id) {
+			res = append(res, signer)
 		}
-		files[hdr.Name] = b.Bytes()
 	}
-	return files, nil
+	return res
 }
 
-func FindTufSigner(keyid, pubkey string, creds OfflineCreds) (*TufSigner, error) {
-	pubkey = strings.TrimSpace(pubkey)
-	for k, v := range creds {
-		if strings.HasSuffix(k, ".pub") {
-			tk := client.AtsKey{}
-			if err := json.Unmarshal(v, &tk); err != nil {
-				return nil, fmt.Errorf("Unable to parse JSON for %s: %w", k, err)
-			}
-			if strings.TrimSpace(tk.KeyValue.Public) == pubkey {
-				pkname := strings.Replace(k, ".pub", ".sec", 1)
-				pkbytes := creds[pkname]
-				tk = client.AtsKey{}
-				if err := json.Unmarshal(pkbytes, &tk); err != nil {
-					return nil, fmt.Errorf("Unable to parse JSON for %s: %w", pkname, err)
-				}
-				keyType, err := parseTufKeyType(tk.KeyType)
-				if err != nil {
-					return nil, fmt.Errorf("Unsupported key type for %s: %s", pkname, tk.KeyType)
-				}
-				pk, err := keyType.ParseKey(tk.KeyValue.Private)
-				if err != nil {
-					return nil, fmt.Errorf("Unable to parse key value for %s: %w", pkname, err)
-				}
-				return &TufSigner{
-					Id:   keyid,
-					Type: keyType,
-					Key:  pk,
-				}, nil
-			}
+// matchTufSigningKeyId returns the one of the root key IDs available to sign which starts with the given prefix.
+func matchTufSigningKeyId(prefix string, ids []string) (string, error) {
+	var matches []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
 		}
 	}
-	return nil, fmt.Errorf("Can not find private key for: %s", keyid)
+	sort.Strings(matches)
+	available := append([]string{}, ids...)
+	sort.Strings(available)
+	switch {
+	case len(ids) == 0:
+		return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("The signing key %s is not in the keys archive: it has none of the current or new root keys", prefix))
+	case len(matches) == 0:
+		return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf(
+			"The signing key %s is not in the keys archive. The current and new root keys in it are:\n  %s",
+			prefix, strings.Join(available, "\n  ")))
+	case len(matches) > 1:
+		return "", subcommands.ValidationError("The signing key ID prefix %s is ambiguous, it matches:\n  %s",
+			prefix, strings.Join(matches, "\n  "))
+	}
+	return matches[0], nil
 }
 
-func findTufRootSigner(root *client.AtsTufRoot, creds OfflineCreds) (*TufSigner, error) {
-	kid := root.Signed.Roles["root"].KeyIDs[0]
-	pub := root.Signed.Keys[kid].KeyValue.Public
-	return FindTufSigner(kid, pub, creds)
+// isTufRootKeyInCreds tells if the private key of a root key is in the offline TUF keys.
+func isTufRootKeyInCreds(root *client.AtsTufRoot, kid string, creds OfflineCreds) bool {
+	_, err := FindTufSigner(kid, root.Signed.Keys[kid].KeyValue.Public, creds)
+	return err == nil
+}
+
+// setTufRootThreshold sets the number of root keys required to sign the root, if the --threshold flag is set.
+// The numKeys is the number of root keys after the change.
+func setTufRootThreshold(cmd *cobra.Command, role *tuf.RootRole, numKeys, threshold int) {
+	if cmd.Flags().Changed("threshold") {
+		if threshold < 1 || threshold > numKeys {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The --threshold must be between 1 and the number of root keys: %d", numKeys))
+		}
+		role.Threshold = threshold
+	} else if role.Threshold > numKeys {
+		subcommands.DieNotNil(subcommands.ValidationError(
+			"The root threshold of %d exceeds the number of root keys: %d. Please, set the --threshold.",
+			role.Threshold, numKeys))
+	}
 }
 
 func removeUnusedTufKeys(root *client.AtsTufRoot) {
@@ -268,7 +283,7 @@ func removeUnusedTufKeys(root *client.AtsTufRoot) {
 			}
 		}
 		if !found {
-			fmt.Println("= Removing unused key:", k)
+			fmt.Fprintln(tufProgress, "= Removing unused key:", k)
 			delete(root.Signed.Keys, k)
 		}
 	}
@@ -314,6 +329,22 @@ Please, run 'fioctl keys tuf updates init' to start over.`))
 	return
 }
 
+// getStagedTufRoots returns the current CI root, and the staged CI and prod roots to be signed.
+func getStagedTufRoots(updates client.TufRootUpdates) (curCiRoot, newCiRoot, newProdRoot *client.AtsTufRoot) {
+	curCiRoot, newCiRoot = checkTufRootUpdatesStatus(updates, true)
+	if updates.Updated.ProdRoot != "" {
+		subcommands.DieNotNil(
+			json.Unmarshal([]byte(updates.Updated.ProdRoot), &newProdRoot), "Updated prod root",
+		)
+	}
+	if newProdRoot == nil {
+		// User might still want to re-sign and apply updates even if there are no changes.
+		// E.g. this way the user can optimize the latest root.json size after the root key rotation
+		newProdRoot = genProdTufRoot(newCiRoot)
+	}
+	return
+}
+
 func genProdTufRoot(ciRoot *client.AtsTufRoot) (prodRoot *client.AtsTufRoot) {
 	// Deep copy in Golang is hard; use the marshal-unmarshal trick
 	body, err := json.Marshal(ciRoot)
@@ -323,17 +354,99 @@ func genProdTufRoot(ciRoot *client.AtsTufRoot) (prodRoot *client.AtsTufRoot) {
 	return
 }
 
+// tufRootChecksum returns the SHA-256 of the canonical JSON of the signed part of a TUF root, which its keys sign.
+func tufRootChecksum(root *client.AtsTufRoot) string {
+	signed, err := canonical.MarshalCanonical(root.Signed)
+	subcommands.DieNotNil(err)
+	return fmt.Sprintf("%x", sha256.Sum256(signed))
+}
+
 func signNewTufRoot(curCiRoot, newCiRoot, newProdRoot *client.AtsTufRoot, creds OfflineCreds) {
-	// Always sign with new root key; sign with old root key if it was rotated.
-	oldKey, err := findTufRootSigner(curCiRoot, creds)
+	signers := findNewTufRootSigners(curCiRoot, newCiRoot, creds)
+	fmt.Fprintln(tufProgress, "= Signing new TUF root")
+	for _, signer := range signers {
+		fmt.Fprintln(tufProgress, "  with root key", signer.Id)
+		tufResult.addSigner(signer.Id)
+	}
+	subcommands.DieNotNil(addTufRootSignatures(curCiRoot, newCiRoot, signers))
+	subcommands.DieNotNil(addTufRootSignatures(curCiRoot, newProdRoot, signers))
+	printTufRootThresholds(curCiRoot, newCiRoot)
+}
+
+// findNewTufRootSigners returns the signers of all root keys in the creds, both old and new; several admins
+// may need to sign one after another to meet the threshold of the old and new root keys.
+// With --signing-key-id, only the selected root keys sign.
+func findNewTufRootSigners(curCiRoot, newCiRoot *client.AtsTufRoot, creds OfflineCreds) []TufSigner {
+	oldSigners, err := findTufRootSigners(curCiRoot, creds)
+	subcommands.DieNotNil(err)
+	newSigners, err := findTufRootSigners(newCiRoot, creds)
 	subcommands.DieNotNil(err)
-	newKey, err := findTufRootSigner(newCiRoot, creds)
+	signers := newSigners
+	for _, old := range oldSigners {
+		found := false
+		for _, signer := range newSigners {
+			found = found || signer.Id == old.Id
+		}
+		if !found {
+			signers = append(signers, old)
+		}
+	}
+	signers = selectTufRootSigners(signers)
+	if len(signers) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			errors.New("None of the current or new offline TUF root keys is in the keys archive")))
+	}
+	return signers
+}
+
+// addTufRootSignatures signs the new root with the given signers, and keeps those signatures of other
+// root keys which are still valid, i.e. the ones made by other admins for the same root content.
+func addTufRootSignatures(curRoot, newRoot *client.AtsTufRoot, signers []TufSigner) error {
+	prevSigs := newRoot.Signatures
+	if err := signTufRoot(newRoot, signers...); err != nil {
+		return err
+	}
+	msg, err := canonical.MarshalCanonical(newRoot.Signed)
+	if err != nil {
+		return err
+	}
+	signed := make(map[string]bool)
+	for _, sig := range newRoot.Signatures {
+		signed[sig.KeyID] = true
+	}
+	for _, sig := range prevSigs {
+		if !signed[sig.KeyID] && verifyTufRootSignature(curRoot, newRoot, msg, sig) == nil {
+			newRoot.Signatures = append(newRoot.Signatures, sig)
+			signed[sig.KeyID] = true
+		}
+	}
+	return nil
+}
+
+// verifyTufRootSignature checks a signature of the new root made by one of the current or new root keys.
+func verifyTufRootSignature(curRoot, newRoot *client.AtsTufRoot, msg []byte, sig tuf.Signature) error {
+	for _, root := range []*client.AtsTufRoot{newRoot, curRoot} {
+		for _, kid := range root.Signed.Roles["root"].KeyIDs {
+			if kid == sig.KeyID {
+				return client.VerifyTufSignature(root.Signed.Keys[kid], msg, sig.Signature)
+			}
+		}
+	}
+	return fmt.Errorf("The key %s is not a TUF root key", sig.KeyID)
+}
+
+// printTufRootThresholds tells if the new root needs more signatures by other root keys.
+func printTufRootThresholds(curRoot, newRoot *client.AtsTufRoot) {
+	msg, err := canonical.MarshalCanonical(newRoot.Signed)
 	subcommands.DieNotNil(err)
-	signers := []TufSigner{*newKey}
-	if oldKey.Id != newKey.Id {
-		signers = append(signers, *oldKey)
+	for _, root := range []struct {
+		name string
+		root *client.AtsTufRoot
+	}{{"current", curRoot}, {"new", newRoot}} {
+		role := root.root.Signed.Roles["root"]
+		if err := client.VerifyTufRole(msg, newRoot.Signatures, root.root.Signed.Keys, role); err != nil {
+			fmt.Fprintf(tufProgress, "= The new TUF root needs more signatures by the %s root keys: %s\n", root.name, err)
+			fmt.Fprintln(tufProgress, "  Other admins should sign it with 'fioctl keys tuf updates sign' or 'import-signature'")
+		}
 	}
-	fmt.Println("= Signing new TUF root")
-	subcommands.DieNotNil(signTufRoot(newCiRoot, signers...))
-	subcommands.DieNotNil(signTufRoot(newProdRoot, signers...))
 }
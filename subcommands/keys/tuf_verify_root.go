@@ -0,0 +1,159 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	verifyCmd := &cobra.Command{
+		Use:   "verify-root",
+		Short: "Verify the whole chain of the factory's TUF root versions",
+		Long: `Fetch all versions of the CI and production TUF root metadata, from the first to the latest,
+and verify that each version is signed by a threshold of its own root keys and of the root keys of the
+previous version. This is the check made by devices when they update their root, and gives an independent
+proof that all root key rotations were done correctly.
+
+The first version is only checked to be signed by its own keys. To anchor the chain to a root
+obtained out of band, e.g. kept by the offline TUF keys owner, use the --trusted-root flag;
+the chain is then verified from the version of that root on.`,
+		Example: `
+  # Verify both chains:
+  fioctl keys tuf verify-root
+  # Verify the production chain, starting from the root version 3 kept in a safe:
+  fioctl keys tuf verify-root --prod --trusted-root 3.root.json`,
+		Run:  doTufVerifyRoot,
+		Args: cobra.NoArgs,
+	}
+	verifyCmd.Flags().Bool("ci", false, "Only verify the CI root chain")
+	verifyCmd.Flags().Bool("prod", false, "Only verify the production root chain")
+	verifyCmd.MarkFlagsMutuallyExclusive("ci", "prod")
+	verifyCmd.Flags().String("trusted-root", "", "Path to a root.json to anchor the chain to")
+	_ = verifyCmd.MarkFlagFilename("trusted-root")
+	tufCmd.AddCommand(verifyCmd)
+}
+
+func doTufVerifyRoot(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	ciOnly, _ := cmd.Flags().GetBool("ci")
+	prodOnly, _ := cmd.Flags().GetBool("prod")
+	trustedFile, _ := cmd.Flags().GetString("trusted-root")
+
+	var trustedRaw []byte
+	if len(trustedFile) > 0 {
+		var err error
+		trustedRaw, err = os.ReadFile(trustedFile)
+		subcommands.DieNotNil(err)
+	}
+
+	ok := true
+	if !prodOnly {
+		ok = verifyTufRootChain(factory, false, trustedRaw)
+	}
+	if !ciOnly {
+		if !prodOnly {
+			fmt.Println()
+		}
+		ok = verifyTufRootChain(factory, true, trustedRaw) && ok
+	}
+	if !ok {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			errors.New("The TUF root chain is broken")))
+	}
+}
+
+// verifyTufRootChain verifies each root version against the previous one, and prints the result of each.
+// A broken link does not stop the walk, so that all broken links are reported.
+func verifyTufRootChain(factory string, prod bool, trustedRaw []byte) bool {
+	kind := "CI"
+	if prod {
+		kind = "Production"
+	}
+	logrus.Debugf("Verifying the %s TUF root chain of %s", kind, factory)
+	latestRaw, err := api.TufRootGetRaw(factory, prod, -1)
+	subcommands.DieNotNil(err)
+	var latest client.AtsTufRoot
+	subcommands.DieNotNil(json.Unmarshal(*latestRaw, &latest), "Invalid root metadata:")
+
+	first := 1
+	var prev *client.AtsTufRoot
+	if trustedRaw != nil {
+		var trusted client.AtsTufRoot
+		subcommands.DieNotNil(json.Unmarshal(trustedRaw, &trusted), "Invalid trusted root:")
+		first = trusted.Signed.Version
+		if first < 1 {
+			subcommands.DieNotNil(subcommands.ValidationError("The trusted root is not a TUF root"))
+		} else if first > latest.Signed.Version {
+			subcommands.DieNotNil(subcommands.ValidationError(
+				"The trusted root version %d is newer than the latest %s root version %d",
+				first, kind, latest.Signed.Version))
+		}
+		prev = &trusted
+	}
+
+	fmt.Printf("%s TUF root chain (versions %d to %d):\n", kind, first, latest.Signed.Version)
+	ok := true
+	for ver := first; ver <= latest.Signed.Version; ver++ {
+		raw := latestRaw
+		if ver < latest.Signed.Version {
+			if raw, err = api.TufRootGetRaw(factory, prod, ver); err != nil {
+				fmt.Printf("  version %-3d FAILED: unable to fetch it: %s\n", ver, err)
+				ok = false
+				prev = nil
+				continue
+			}
+		}
+		var root client.AtsTufRoot
+		if err := json.Unmarshal(*raw, &root); err != nil {
+			fmt.Printf("  version %-3d FAILED: unable to parse it: %s\n", ver, err)
+			ok = false
+			prev = nil
+			continue
+		}
+
+		if ver == first && trustedRaw != nil {
+			// The served root must be the very one the user trusts
+			served, _, err1 := client.CanonicalTufSigned(*raw)
+			expected, _, err2 := client.CanonicalTufSigned(trustedRaw)
+			if err1 != nil || err2 != nil || !bytes.Equal(served, expected) {
+				// The next version is still verified against the trusted root, rather than the served one
+				fmt.Printf("  version %-3d FAILED: differs from the trusted root\n", ver)
+				ok = false
+			} else {
+				fmt.Printf("  version %-3d OK: matches the trusted root\n", ver)
+			}
+			continue
+		}
+
+		// The previous root is only used when it is the version right before
+		trusted := prev
+		if trusted != nil && trusted.Signed.Version != ver-1 {
+			trusted = nil
+		}
+		if _, err := client.VerifyTufRoot(trusted, *raw); err != nil {
+			fmt.Printf("  version %-3d FAILED: %s\n", ver, err)
+			ok = false
+			prev = nil
+			continue
+		}
+		if trusted == nil && ver > 1 {
+			fmt.Printf("  version %-3d OK: signed by its own root keys; the previous version could not be checked\n", ver)
+		} else if trusted == nil {
+			fmt.Printf("  version %-3d OK: signed by its own root keys\n", ver)
+		} else {
+			fmt.Printf("  version %-3d OK: signed by the root keys of version %d and its own\n", ver, ver-1)
+		}
+		prev = &root
+	}
+	return ok
+}
@@ -0,0 +1,206 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+// A key on a YubiKey is recorded in the offline TUF keys by a reference file next to its public key,
+// e.g. tufrepo/keys/fioctl-root-<keyid>.yubikey, instead of the private key file.
+const yubikeyRefSuffix = ".yubikey"
+
+type yubikeyRef struct {
+	Slot   string `json:"slot"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// yubikeyConfig sets how the YubiKey PIV keys are used; the flags of a command signing TUF metadata override it.
+var yubikeyConfig = struct {
+	module string
+	pin    string
+}{module: "libykcs11.so"}
+
+func yubikeyPin() (string, error) {
+	if len(yubikeyConfig.pin) == 0 {
+		pin, err := subcommands.PromptSecret("PIN of the YubiKey")
+		if err != nil {
+			return "", fmt.Errorf("%w. Set the --hsm-pin flag to provide the PIN", err)
+		}
+		yubikeyConfig.pin = pin
+	}
+	return yubikeyConfig.pin, nil
+}
+
+// yubikeyTufSigner returns a signer for the key in a PIV slot of a YubiKey. The public key is known
+// in advance, so the YubiKey is only needed to sign, and a signature by another YubiKey is rejected.
+func yubikeyTufSigner(ref yubikeyRef, pub client.AtsKey) (*client.TufSigner, error) {
+	id, ok := pivSlotKeyIds[strings.ToLower(ref.Slot)]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported PIV slot: %s", ref.Slot)
+	}
+	pubKey, err := parseTufPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	keyType, err := client.ParseTufKeyType(pub.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	uri := "pkcs11:"
+	if len(ref.Serial) > 0 {
+		// The token label set by the ykcs11 module
+		uri += "token=" + pkcs11UriEscape("YubiKey PIV #"+ref.Serial) + ";"
+	}
+	uri += fmt.Sprintf("id=%%%02x;type=private", id)
+	key := &tokenSigner{
+		module: yubikeyConfig.module,
+		uri:    uri,
+		pub:    pubKey,
+		askPin: yubikeyPin,
+		notice: "= Touch the YubiKey if it is blinking",
+	}
+	kid, err := client.GenTufKeyId(key)
+	if err != nil {
+		return nil, err
+	}
+	return &client.TufSigner{Id: kid, Type: keyType, Key: key}, nil
+}
+
+// loadYubikeyTufSigners adds the keys on YubiKeys referenced by the offline TUF keys to the external signers.
+func loadYubikeyTufSigners(creds OfflineCreds) error {
+	for name, content := range creds {
+		if !strings.HasSuffix(name, yubikeyRefSuffix) {
+			continue
+		}
+		var ref yubikeyRef
+		if err := json.Unmarshal(content, &ref); err != nil {
+			return fmt.Errorf("Unable to parse %s: %w", name, err)
+		}
+		pubFile := strings.TrimSuffix(name, yubikeyRefSuffix) + ".pub"
+		var pub client.AtsKey
+		if err := json.Unmarshal(creds[pubFile], &pub); err != nil {
+			return fmt.Errorf("Unable to parse the public key %s of the YubiKey key: %w", pubFile, err)
+		}
+		signer, err := yubikeyTufSigner(ref, pub)
+		if err != nil {
+			return fmt.Errorf("Invalid YubiKey key %s: %w", name, err)
+		}
+		tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+	}
+	return nil
+}
+
+// ykman runs a command of the YubiKey Manager CLI. It may ask for the PIV management key and PIN.
+func ykman(args ...string) ([]byte, error) {
+	cmd := exec.Command("ykman", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ykman %s failed: %w", strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// genYubikeyTufKeyPair generates a new key in a PIV slot of the YubiKey for a key rotation.
+// The key requires the PIN and a touch for each signature. Only the public key and a reference
+// to the slot are saved to the offline TUF keys.
+func genYubikeyTufKeyPair(cmd *cobra.Command) TufKeyPair {
+	slot, _ := cmd.Flags().GetString("yubikey-slot")
+	if _, ok := pivSlotKeyIds[strings.ToLower(slot)]; !ok {
+		subcommands.DieNotNil(subcommands.ValidationError("Unsupported PIV slot: " + slot))
+	}
+	algorithm := "RSA2048"
+	if keyType, _ := cmd.Flags().GetString("key-type"); cmd.Flags().Changed("key-type") {
+		t := ParseTufKeyType(keyType)
+		switch t.Name() {
+		case client.TufKeyTypeNameRSA:
+			// Only an explicit key size selects a bigger key, RSA3072 and RSA4096 require firmware 5.7 or later
+			if strings.Contains(keyType, "-") {
+				algorithm = fmt.Sprintf("RSA%d", t.(interface{ KeySize() int }).KeySize())
+			}
+		case client.TufKeyTypeNameEd25519:
+			// Requires a YubiKey with firmware 5.7 or later
+			algorithm = "ED25519"
+		case client.TufKeyTypeNameEcdsaP256:
+			algorithm = "ECCP256"
+		}
+	}
+
+	out, err := ykman("list", "--serials")
+	subcommands.DieNotNil(err)
+	serials := strings.Fields(string(out))
+	if len(serials) != 1 {
+		subcommands.DieNotNil(fmt.Errorf("Exactly one YubiKey must be connected, found %d", len(serials)))
+	}
+	serial := serials[0]
+
+	tmpDir, err := os.MkdirTemp("", "fioctl-yubikey-")
+	subcommands.DieNotNil(err)
+	defer os.RemoveAll(tmpDir)
+	pubFile := filepath.Join(tmpDir, "pub.pem")
+
+	fmt.Fprintf(tufProgress, "= Generating a %s key in the PIV slot %s of the YubiKey %s\n", algorithm, slot, serial)
+	_, err = ykman("--device", serial, "piv", "keys", "generate", "--algorithm", algorithm,
+		"--pin-policy", "ALWAYS", "--touch-policy", "ALWAYS", slot, pubFile)
+	subcommands.DieNotNil(err)
+	// The ykcs11 module only exposes the keys of the slots which have a certificate
+	fmt.Fprintln(tufProgress, "= Creating a self-signed certificate for the key; touch the YubiKey if it is blinking")
+	_, err = ykman("--device", serial, "piv", "certificates", "generate", "--subject", "CN=fioctl TUF key", slot, pubFile)
+	subcommands.DieNotNil(err)
+
+	pemBytes, err := os.ReadFile(pubFile)
+	subcommands.DieNotNil(err)
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		subcommands.DieNotNil(errors.New("Unable to parse the public key generated by the YubiKey"))
+	}
+	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	subcommands.DieNotNil(err)
+	pub := client.AtsKey{}
+	switch k := pubKey.(type) {
+	case *rsa.PublicKey:
+		pub.KeyType = client.TufKeyTypeNameRSA
+		pub.KeyValue.Public = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: block.Bytes}))
+	case *ecdsa.PublicKey:
+		pub.KeyType = client.TufKeyTypeNameEcdsaP256
+		pub.KeyValue.Public = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: block.Bytes}))
+	case ed25519.PublicKey:
+		pub.KeyType = client.TufKeyTypeNameEd25519
+		pub.KeyValue.Public = hex.EncodeToString(k)
+	default:
+		subcommands.DieNotNil(fmt.Errorf("Unsupported public key type: %T", pubKey))
+	}
+
+	ref := yubikeyRef{Slot: strings.ToLower(slot), Serial: serial}
+	signer, err := yubikeyTufSigner(ref, pub)
+	subcommands.DieNotNil(err)
+	atsPubBytes, err := json.Marshal(pub)
+	subcommands.DieNotNil(err)
+	refBytes, err := json.Marshal(ref)
+	subcommands.DieNotNil(err)
+	tufSignerOpts.ExternalSigners = append(tufSignerOpts.ExternalSigners, *signer)
+	return TufKeyPair{
+		signer:       *signer,
+		atsPub:       pub,
+		atsPubBytes:  atsPubBytes,
+		keyRefSuffix: yubikeyRefSuffix,
+		keyRefBytes:  refBytes,
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
-	"github.com/foundriesio/fioctl/client"
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
@@ -19,7 +18,24 @@ func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Access Foundries.io services with your client credentials",
-		Run:   doLogin,
+		Long: `Access Foundries.io services with your client credentials.
+
+Factories hosted on a different backend, e.g. an on-prem deployment, can use their own
+API and OAuth endpoints and CA certificates. These are set for each factory in the
+contexts section of the config file:
+
+  contexts:
+    <factory>:
+      api-url: https://api.example.com
+      oauth-url: https://app.example.com/oauth
+      cacert: /etc/ssl/certs/example-ca.pem
+      # Optional, an API token or a command printing it, used instead of the client credentials:
+      token-cmd: pass show example/fioctl-token
+
+The context is selected by the --factory flag, or by the factory set in the config file.
+Client credentials are shared by all contexts, so use API tokens to work with
+factories from several backends at the same time.`,
+		Run: doLogin,
 	}
 	cmd.Flags().BoolVarP(&refreshToken, "refresh-access-token", "", false, "Refresh your current oauth2 access token. This is used when a token's scopes have been updated in app.foundries.io")
 	return cmd
@@ -29,7 +45,7 @@ func doLogin(cmd *cobra.Command, args []string) {
 	logrus.Debug("Executing login command")
 
 	if refreshToken {
-		creds := client.NewClientCredentials(subcommands.Config.ClientCredentials)
+		creds := subcommands.NewClientCredentials()
 		// Change ExpiresIn to basically "now". This will cause fioctl to
 		// get a new token with fresh scopes
 		creds.Config.ExpiresIn = 1
@@ -37,7 +53,7 @@ func doLogin(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	creds := client.NewClientCredentials(subcommands.Config.ClientCredentials)
+	creds := subcommands.NewClientCredentials()
 	if creds.Config.ClientId == "" || creds.Config.ClientSecret == "" {
 		creds.Config.ClientId, creds.Config.ClientSecret = promptForCreds()
 	}
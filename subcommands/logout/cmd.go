@@ -4,7 +4,6 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
-	"github.com/foundriesio/fioctl/client"
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
@@ -19,7 +18,7 @@ func NewCommand() *cobra.Command {
 func doLogout(cmd *cobra.Command, args []string) {
 	logrus.Debug("Executing logout command")
 
-	creds := client.NewClientCredentials(subcommands.Config.ClientCredentials)
+	creds := subcommands.NewClientCredentials()
 	creds.Config.ClientId = ""
 	creds.Config.ClientSecret = ""
 	creds.Config.RefreshToken = ""
@@ -0,0 +1,71 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var api *client.Api
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply-plan <plan.json>",
+		Short: "Apply API changes recorded by a command run with --plan-out",
+		Long: `Apply API changes recorded by a command run with the --plan-out flag.
+
+Any fioctl command can be run with --plan-out. Instead of changing the factory,
+the command records the exact API requests it would make into a plan file.
+The plan can then be reviewed and applied by another person:
+
+  fioctl devices delete --plan-out plan.json device-1 device-2
+  fioctl apply-plan plan.json
+
+Requests are applied in the recorded order, to the recorded URLs and with the
+recorded headers, using the credentials of the person applying the plan. Commands which need the results of their own changes to
+continue, e.g. TUF key rotations, can not be planned.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			api = subcommands.Login(cmd)
+		},
+		Run:  doApplyPlan,
+		Args: cobra.ExactArgs(1),
+	}
+	cmd.Flags().BoolP("yes", "y", false, "Apply the plan without asking for a confirmation")
+	return cmd
+}
+
+func doApplyPlan(cmd *cobra.Command, args []string) {
+	yes, _ := cmd.Flags().GetBool("yes")
+	plan, err := client.LoadPlan(args[0])
+	subcommands.DieNotNil(err)
+
+	fmt.Printf("Plan created at %s for %s\n", plan.CreatedAt, plan.Server)
+	if len(plan.Requests) == 0 {
+		fmt.Println("The plan contains no changes")
+		return
+	}
+	for i, r := range plan.Requests {
+		fmt.Printf("\n%d. %s\n", i+1, r)
+		if len(r.Body) > 0 {
+			body, err := json.MarshalIndent(r.Body, "   ", "  ")
+			subcommands.DieNotNil(err)
+			fmt.Println("  ", string(body))
+		} else if len(r.BodyBase64) > 0 {
+			fmt.Printf("   <%s content, %d bytes base64>\n", r.Headers["Content-Type"], len(r.BodyBase64))
+		}
+	}
+	fmt.Println()
+
+	if !yes && !subcommands.PromptYesNo(fmt.Sprintf("Apply %d changes?", len(plan.Requests)), false) {
+		return
+	}
+	for i, r := range plan.Requests {
+		_, err := api.ApplyPlannedRequest(r)
+		subcommands.DieNotNil(err, fmt.Sprintf("Failed to apply %s (%d of %d):", r, i+1, len(plan.Requests)))
+		fmt.Printf("Applied %d of %d: %s\n", i+1, len(plan.Requests), r)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/cheynewallace/tabby"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -12,12 +11,16 @@ import (
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
+var listOutput subcommands.ListOutput
+
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List secret credentials configured in the factory",
 		Run:   doList,
-	})
+	}
+	listOutput.AddFlags(listCmd, "secrets")
+	cmd.AddCommand(listCmd)
 }
 
 func doList(cmd *cobra.Command, args []string) {
@@ -27,8 +30,7 @@ func doList(cmd *cobra.Command, args []string) {
 	triggers, err := api.FactoryTriggers(factory)
 	subcommands.DieNotNil(err)
 
-	t := tabby.New()
-	t.AddHeader("SECRETS")
+	t := listOutput.NewTable("SECRETS")
 	if len(triggers) == 1 {
 		for _, secret := range triggers[0].Secrets {
 			t.AddLine(secret.Name)
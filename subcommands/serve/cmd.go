@@ -0,0 +1,233 @@
+package serve
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+	"github.com/foundriesio/fioctl/subcommands/version"
+)
+
+const apiPrefix = "/api/v1"
+
+var (
+	api   *client.Api
+	apiMu sync.Mutex
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a local REST API over common fioctl operations",
+		Long: `Serve a local REST API over common fioctl operations using your fioctl credentials.
+This allows internal dashboards to query the factory without handling Foundries.io authentication.
+
+Every request must provide the serve token in the "Authorization: Bearer <token>" header.
+The token is taken from the FIOCTL_SERVE_TOKEN environment variable, or generated and printed on startup.
+
+Available endpoints (all read-only):
+  GET /api/v1/devices/?page=1&limit=100&group=&tag=&target=&name=
+  GET /api/v1/devices/<name>
+  GET /api/v1/targets/<name>
+  GET /api/v1/waves/?page=1&limit=100
+  GET /api/v1/waves/<name>
+  GET /api/v1/waves/<name>/status`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			api = subcommands.Login(cmd)
+		},
+		Run:  doServe,
+		Args: cobra.NoArgs,
+	}
+	subcommands.RequireFactory(cmd)
+	cmd.Flags().StringP("listen", "l", "127.0.0.1:8080", "Address to listen on")
+	return cmd
+}
+
+type server struct {
+	factory string
+	token   string
+}
+
+func doServe(cmd *cobra.Command, args []string) {
+	listen, _ := cmd.Flags().GetString("listen")
+	s := server{factory: viper.GetString("factory"), token: os.Getenv("FIOCTL_SERVE_TOKEN")}
+	if len(s.token) == 0 {
+		buf := make([]byte, 32)
+		_, err := rand.Read(buf)
+		subcommands.DieNotNil(err)
+		s.token = hex.EncodeToString(buf)
+		fmt.Fprintln(os.Stderr, "Serve token:", s.token)
+	}
+	if host, _, err := net.SplitHostPort(listen); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			logrus.Warnf("Listening on a non-loopback address %s exposes your factory to the network", listen)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix+"/devices/", s.handleDevices)
+	mux.HandleFunc(apiPrefix+"/targets/", s.handleTargets)
+	mux.HandleFunc(apiPrefix+"/waves/", s.handleWaves)
+
+	fmt.Fprintf(os.Stderr, "Serving factory %s on http://%s%s/\n", s.factory, listen, apiPrefix)
+	subcommands.DieNotNil(http.ListenAndServe(listen, s.authenticate(mux)))
+}
+
+func (s server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logrus.Debugf("%s %s", r.Method, r.URL)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "Invalid or missing serve token")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "Only GET requests are supported")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentApi returns the API client, refreshing its OAuth token once it expires,
+// as the server outlives the token fetched on startup.
+func currentApi() (*client.Api, error) {
+	apiMu.Lock()
+	defer apiMu.Unlock()
+	if len(subcommands.Config.Token) > 0 || len(subcommands.Config.ClientCredentials.AccessToken) == 0 {
+		return api, nil
+	}
+	creds := subcommands.NewClientCredentials()
+	if expired, err := creds.IsExpired(); err != nil || !expired {
+		return api, err
+	}
+	if !creds.HasRefreshToken() {
+		return nil, errors.New("OAuth token expired and there is no refresh token, please run: \"fioctl login\"")
+	}
+	if err := creds.Refresh(); err != nil {
+		return nil, fmt.Errorf("Unable to refresh the OAuth token: %w", err)
+	}
+	subcommands.SaveOauthConfig(creds.Config)
+	subcommands.Config.ClientCredentials = creds.Config
+	ctx := subcommands.CurrentContext()
+	api = client.NewApiClient(ctx.ApiUrl, subcommands.Config, ctx.CaCert, version.Commit)
+	return api, nil
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func writeResult(w http.ResponseWriter, val interface{}, err error) {
+	if err != nil {
+		status := http.StatusBadGateway
+		if herr := client.AsHttpError(err); herr != nil {
+			status = herr.Response.StatusCode
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(val)
+}
+
+func queryInt(r *http.Request, name string, def int) int {
+	if val, err := strconv.Atoi(r.URL.Query().Get(name)); err == nil && val > 0 {
+		return val
+	}
+	return def
+}
+
+// queryParam returns the query parameter escaped for the upstream API URL.
+func queryParam(r *http.Request, name string) string {
+	return url.QueryEscape(r.URL.Query().Get(name))
+}
+
+// Splits the path after the resource prefix into parts, e.g. /api/v1/waves/w1/status -> [w1, status]
+// Each part is escaped, as it goes into the upstream API URL.
+func pathParts(r *http.Request, resource string) []string {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix+"/"+resource), "/")
+	if len(path) == 0 {
+		return nil
+	}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return parts
+}
+
+func (s server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	api, err := currentApi()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	parts := pathParts(r, "devices")
+	switch len(parts) {
+	case 0:
+		dl, err := api.DeviceList(false, queryParam(r, "tag"), s.factory, queryParam(r, "group"), queryParam(r, "name"),
+			"", queryParam(r, "target"), queryInt(r, "page", 1), queryInt(r, "limit", 100))
+		writeResult(w, dl, err)
+	case 1:
+		device, err := api.DeviceGet(s.factory, parts[0])
+		writeResult(w, device, err)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s server) handleTargets(w http.ResponseWriter, r *http.Request) {
+	api, err := currentApi()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	parts := pathParts(r, "targets")
+	if len(parts) != 1 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	target, err := api.TargetGet(s.factory, parts[0])
+	writeResult(w, target, err)
+}
+
+func (s server) handleWaves(w http.ResponseWriter, r *http.Request) {
+	api, err := currentApi()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	parts := pathParts(r, "waves")
+	switch {
+	case len(parts) == 0:
+		waves, err := api.FactoryListWaves(s.factory, uint64(queryInt(r, "limit", 100)), queryInt(r, "page", 1))
+		writeResult(w, waves, err)
+	case len(parts) == 1:
+		wave, err := api.FactoryGetWave(s.factory, parts[0], false)
+		writeResult(w, wave, err)
+	case len(parts) == 2 && parts[1] == "status":
+		status, err := api.FactoryWaveStatus(s.factory, parts[0], queryInt(r, "offline-threshold", 4))
+		writeResult(w, status, err)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
@@ -0,0 +1,252 @@
+package status
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+const (
+	severityOk       = "ok"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+	// The check could not be run, e.g. the API request failed
+	severityUnknown = "unknown"
+)
+
+var severityOrder = map[string]int{severityOk: 0, severityUnknown: 1, severityWarning: 2, severityCritical: 3}
+
+// healthCheck is the result of checking one subsystem of a factory.
+type healthCheck struct {
+	Name     string      `json:"name"`
+	Severity string      `json:"severity"`
+	Summary  string      `json:"summary"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+type healthReport struct {
+	Factory   string                `json:"factory"`
+	CheckedAt time.Time             `json:"checked-at"`
+	Severity  string                `json:"severity"`
+	Checks    []healthCheck         `json:"checks"`
+	Status    *client.FactoryStatus `json:"status,omitempty"`
+}
+
+type expiryDetail struct {
+	Name    string    `json:"name"`
+	Expires time.Time `json:"expires"`
+	Days    int       `json:"days-left"`
+}
+
+// healthThresholds configure when a check turns into a warning.
+type healthThresholds struct {
+	expiryDays     int
+	offlinePercent int
+}
+
+func failedCheck(name string, err error) healthCheck {
+	return healthCheck{Name: name, Severity: severityUnknown, Summary: err.Error()}
+}
+
+func (t healthThresholds) expirySeverity(expires, now time.Time) string {
+	switch {
+	case !expires.After(now):
+		return severityCritical
+	case expires.Sub(now) < time.Duration(t.expiryDays)*24*time.Hour:
+		return severityWarning
+	}
+	return severityOk
+}
+
+// checkExpiries sets the severity and summary of a check from the soonest expiry.
+func (t healthThresholds) checkExpiries(name, what string, expiries []expiryDetail, now time.Time) healthCheck {
+	check := healthCheck{Name: name, Severity: severityOk, Details: expiries}
+	if len(expiries) == 0 {
+		check.Summary = "No " + what + " found"
+		return check
+	}
+	sort.Slice(expiries, func(i, j int) bool { return expiries[i].Expires.Before(expiries[j].Expires) })
+	first := expiries[0]
+	check.Severity = t.expirySeverity(first.Expires, now)
+	if check.Severity == severityCritical {
+		check.Summary = fmt.Sprintf("%s expired on %s", first.Name, subcommands.FormatTimestamp(first.Expires))
+	} else {
+		check.Summary = fmt.Sprintf("%s expires in %d days", first.Name, first.Days)
+	}
+	return check
+}
+
+func newExpiry(name string, expires, now time.Time) expiryDetail {
+	return expiryDetail{Name: name, Expires: expires, Days: int(expires.Sub(now).Hours() / 24)}
+}
+
+func checkTufRoot(factory string, t healthThresholds, now time.Time) healthCheck {
+	var expiries []expiryDetail
+	ciRoot, err := api.TufRootGet(factory)
+	if err != nil {
+		return failedCheck("tuf-root", err)
+	}
+	expiries = append(expiries, newExpiry(fmt.Sprintf("CI TUF root v%d", ciRoot.Signed.Version), ciRoot.Signed.Expires, now))
+	prodRoot, err := api.TufProdRootGet(factory)
+	if err != nil {
+		return failedCheck("tuf-root", err)
+	}
+	expiries = append(expiries, newExpiry(fmt.Sprintf("Production TUF root v%d", prodRoot.Signed.Version), prodRoot.Signed.Expires, now))
+	return t.checkExpiries("tuf-root", "TUF roots", expiries, now)
+}
+
+func checkTufUpdates(factory string) healthCheck {
+	updates, err := api.TufRootUpdatesGet(factory)
+	if err != nil {
+		return failedCheck("tuf-updates", err)
+	}
+	type detail struct {
+		Status   string   `json:"status"`
+		Errors   []string `json:"errors,omitempty"`
+		Warnings []string `json:"warnings,omitempty"`
+	}
+	d := detail{Status: updates.Status}
+	for _, e := range updates.Issues.Errors {
+		d.Errors = append(d.Errors, e.Message)
+	}
+	for _, w := range updates.Issues.Warnings {
+		d.Warnings = append(d.Warnings, w.Message)
+	}
+	check := healthCheck{Name: "tuf-updates", Severity: severityOk, Details: d}
+	switch {
+	case updates.Status == client.TufRootUpdatesStatusNone || len(updates.Status) == 0:
+		check.Summary = "No pending TUF root updates"
+	case len(d.Errors) > 0:
+		check.Severity = severityCritical
+		check.Summary = fmt.Sprintf("Pending TUF root updates (%s) have %d error(s)", updates.Status, len(d.Errors))
+	default:
+		check.Severity = severityWarning
+		check.Summary = fmt.Sprintf("Pending TUF root updates: %s", updates.Status)
+	}
+	return check
+}
+
+func checkCaCerts(factory string, t healthThresholds, now time.Time) healthCheck {
+	certs, err := api.FactoryGetCA(factory)
+	if subcommands.IsNotFound(err) {
+		return healthCheck{Name: "ca-certs", Severity: severityOk, Summary: "The factory PKI is not set up"}
+	} else if err != nil {
+		return failedCheck("ca-certs", err)
+	}
+	var expiries []expiryDetail
+	for _, bundle := range []struct{ name, pem string }{
+		{"Root CA", certs.RootCrt},
+		{"Device CA", certs.CaCrt},
+		{"Device gateway TLS", certs.TlsCrt},
+		{"EST server TLS", certs.EstCrt},
+	} {
+		rest := []byte(bundle.pem)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			expiries = append(expiries, newExpiry(bundle.name+" "+cert.Subject.CommonName, cert.NotAfter, now))
+		}
+	}
+	return t.checkExpiries("ca-certs", "CA certificates", expiries, now)
+}
+
+func checkWaves(factory string) healthCheck {
+	waves, err := api.FactoryListWaves(factory, 100, 1)
+	if err != nil {
+		return failedCheck("waves", err)
+	}
+	type detail struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Tag     string `json:"tag"`
+		Created string `json:"created-at"`
+	}
+	active := []detail{}
+	for _, w := range waves.Waves {
+		if w.Status == "active" {
+			active = append(active, detail{w.Name, w.Version, w.Tag, w.ChangeMeta.CreatedAt})
+		}
+	}
+	return healthCheck{
+		Name:     "waves",
+		Severity: severityOk,
+		Summary:  fmt.Sprintf("%d active wave(s)", len(active)),
+		Details:  active,
+	}
+}
+
+func checkBuilds(factory string, now time.Time) healthCheck {
+	builds, err := api.JobservBuilds(factory, 50, 1)
+	if err != nil {
+		return failedCheck("builds", err)
+	}
+	failed := []client.JobservBuild{}
+	for _, b := range builds.Builds {
+		created, ok := subcommands.ParseTime(b.Created)
+		if !ok || now.Sub(created) > 24*time.Hour {
+			continue
+		}
+		if b.Status == "FAILED" {
+			failed = append(failed, b)
+		}
+	}
+	check := healthCheck{Name: "builds", Severity: severityOk, Details: failed}
+	check.Summary = fmt.Sprintf("%d failed build(s) in the last 24 hours", len(failed))
+	if len(failed) > 0 {
+		check.Severity = severityWarning
+	}
+	return check
+}
+
+func checkDevices(status *client.FactoryStatus, t healthThresholds) healthCheck {
+	type detail struct {
+		Total   int `json:"total"`
+		Online  int `json:"online"`
+		Offline int `json:"offline"`
+	}
+	var d detail
+	// Wave devices are also counted in their production tags
+	for _, tags := range [][]client.TagStatus{status.Tags, status.ProdTags} {
+		for _, tag := range tags {
+			d.Total += tag.DevicesTotal
+			d.Online += tag.DevicesOnline
+		}
+	}
+	d.Offline = d.Total - d.Online
+	check := healthCheck{Name: "devices", Severity: severityOk, Details: d}
+	check.Summary = fmt.Sprintf("%d of %d device(s) offline", d.Offline, d.Total)
+	if d.Total > 0 && d.Offline*100 >= d.Total*t.offlinePercent {
+		check.Severity = severityWarning
+	}
+	return check
+}
+
+func runHealthChecks(factory string, status *client.FactoryStatus, t healthThresholds) healthReport {
+	now := time.Now()
+	report := healthReport{Factory: factory, CheckedAt: now.UTC().Round(time.Second), Severity: severityOk}
+	report.Checks = []healthCheck{
+		checkTufRoot(factory, t, now),
+		checkTufUpdates(factory),
+		checkCaCerts(factory, t, now),
+		checkWaves(factory),
+		checkBuilds(factory, now),
+		checkDevices(status, t),
+	}
+	for _, check := range report.Checks {
+		if severityOrder[check.Severity] > severityOrder[report.Severity] {
+			report.Severity = check.Severity
+		}
+	}
+	return report
+}
@@ -1,7 +1,9 @@
 package status
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,19 +15,43 @@ import (
 
 var api *client.Api
 
-var inactiveThreshold int
+var (
+	inactiveThreshold int
+	jsonOutput        bool
+	thresholds        healthThresholds
+)
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Get dashboard view of a factory and its devices",
-		Run:   showStatus,
+		Long: `Get dashboard view of a factory and its devices.
+
+The view ends with health checks of the factory subsystems, each with a severity of ok, warning,
+critical, or unknown (when the check could not be run):
+- tuf-root: expiry of the CI and production TUF roots.
+- tuf-updates: pending TUF root updates, and their errors.
+- ca-certs: expiry of the factory PKI certificates.
+- waves: active waves.
+- builds: failed builds in the last 24 hours.
+- devices: devices not seen within the offline threshold.
+
+Use --json for a machine readable report, e.g. for a nightly health check cron job.`,
+		Example: `
+  # Alert when any check of the factory is not ok:
+  fioctl status --json | jq -e '.severity == "ok"' || send-alert`,
+		Run: showStatus,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			api = subcommands.Login(cmd)
 		},
 	}
 	subcommands.RequireFactory(cmd)
 	cmd.Flags().IntVarP(&inactiveThreshold, "offline-threshold", "", 4, "Consider device 'OFFLINE' if not seen in the last X hours")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "", false, "Print the status and health checks as JSON")
+	cmd.Flags().IntVarP(&thresholds.expiryDays, "expiry-warning-days", "", 30,
+		"Warn about TUF roots and certificates expiring in fewer days")
+	cmd.Flags().IntVarP(&thresholds.offlinePercent, "offline-warning-percent", "", 10,
+		"Warn when at least this percentage of devices is offline")
 	return cmd
 }
 
@@ -35,6 +61,15 @@ func showStatus(cmd *cobra.Command, args []string) {
 
 	status, err := api.FactoryStatus(factory, inactiveThreshold)
 	subcommands.DieNotNil(err)
+	report := runHealthChecks(factory, status, thresholds)
+
+	if jsonOutput {
+		report.Status = status
+		buf, err := json.MarshalIndent(report, "", "  ")
+		subcommands.DieNotNil(err)
+		fmt.Println(string(buf))
+		return
+	}
 
 	fmt.Println("Total number of devices:", status.TotalDevices)
 
@@ -73,6 +108,13 @@ func showStatus(cmd *cobra.Command, args []string) {
 	printTargetStatus("Active Wave", status.ProdWaveTags)
 	printTargetStatus("Production", status.ProdTags)
 	printTargetStatus("CI", status.Tags)
+
+	fmt.Println("\nHealth checks:")
+	t = subcommands.Tabby(1, "CHECK", "SEVERITY", "SUMMARY")
+	for _, check := range report.Checks {
+		t.AddLine(check.Name, strings.ToUpper(check.Severity), check.Summary)
+	}
+	t.Print()
 }
 
 func printTargetStatus(tagPrefix string, tagStatus []client.TagStatus) {
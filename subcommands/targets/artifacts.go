@@ -2,25 +2,31 @@ package targets
 
 import (
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/foundriesio/fioctl/client"
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
+var (
+	artifactsOutDir   string
+	artifactsSha256   string
+	artifactsParallel int
+)
+
 func init() {
-	cmd.AddCommand(&cobra.Command{
-		Use:   "artifacts <target> [<artifact name>]",
+	artifactsCmd := &cobra.Command{
+		Use:   "artifacts <target> [<artifact name>...]",
 		Short: "Show artifacts created in CI for a Target",
 		Run:   doArtifacts,
-		Args:  cobra.RangeArgs(1, 2),
+		Args:  cobra.MinimumNArgs(1),
 		Example: `
   # List all artifacts for Target 12
   fioctl targets artifacts 12
@@ -32,8 +38,21 @@ func init() {
   # re-directed /tmp/tmp.gz
   fioctl-linux-amd64 targets artifacts 207 \
     raspberrypi3-64/lmp-factory-image-raspberrypi3-64.wic.gz >/tmp/tmp.gz
+
+  # Download several artifacts in parallel to /tmp/207/<run>/<artifact>.
+  # Interrupted downloads are resumed when the command is run again.
+  fioctl targets artifacts 207 \
+    raspberrypi3-64/lmp-factory-image-raspberrypi3-64.wic.gz \
+    raspberrypi3-64/other/raspberrypi3-64-ostree_repo.tar.bz2 --out-dir /tmp/207
 `,
-	})
+	}
+	cmd.AddCommand(artifactsCmd)
+	artifactsCmd.Flags().StringVarP(&artifactsOutDir, "out-dir", "", "",
+		"Download artifacts to this directory rather than STDOUT")
+	artifactsCmd.Flags().StringVarP(&artifactsSha256, "sha256", "", "",
+		"Verify a downloaded artifact has this SHA256 checksum")
+	artifactsCmd.Flags().IntVarP(&artifactsParallel, "parallel", "", 4,
+		"Number of artifacts to download in parallel")
 }
 
 func listArtifacts(factory string, target int) {
@@ -50,63 +69,54 @@ func listArtifacts(factory string, target int) {
 	}
 }
 
-type DlStatus struct {
-	Total   int64
-	Current int64
-	Width   int64
-	LastMsg time.Time
-}
-
-func (d *DlStatus) Write(p []byte) (int, error) {
-	n := len(p)
-	d.Current += int64(n)
-
-	now := time.Now()
-	elapsed := now.Sub(d.LastMsg)
-	if elapsed.Seconds() < 1 && d.Current != d.Total {
-		return n, nil
-	}
-	d.LastMsg = now
-	current := int64((float64(d.Current) / float64(d.Total)) * float64(d.Width))
-	fmt.Fprintf(
-		os.Stderr,
-		"[%s%s] %d of %d\r",
-		strings.Repeat("=", int(current)),
-		strings.Repeat(" ", int(d.Width-current)),
-		d.Current,
-		d.Total)
-	return n, nil
-}
-
-func downloadArtifact(factory string, target int, artifact string) {
+func parseArtifactPath(artifact string) (string, string) {
 	firstSlash := strings.Index(artifact, "/")
 	if firstSlash < 1 {
-		fmt.Println("ERROR: Invalid artifact path:", artifact)
-		os.Exit(1)
+		subcommands.DieNotNil(fmt.Errorf("Invalid artifact path: %s", artifact))
 	}
-	run := artifact[0:firstSlash]
-	artifact = artifact[firstSlash+1:]
+	return artifact[0:firstSlash], artifact[firstSlash+1:]
+}
 
+func downloadArtifact(factory string, target int, artifact string) {
+	run, artifact := parseArtifactPath(artifact)
 	if strings.HasSuffix(artifact, "console.log") {
 		api.JobservTailRun(factory, target, run, artifact)
 		return
 	}
 
-	resp, err := api.JobservRunArtifact(factory, target, run, artifact)
-	subcommands.DieNotNil(err)
+	item := client.DownloadItem{
+		Url:    api.JobservRunArtifactUrl(factory, target, run, artifact),
+		Writer: os.Stdout,
+		Sha256: artifactsSha256,
+	}
+	subcommands.DieNotNil(api.NewDownloader().Download(&item))
+}
 
-	status := DlStatus{resp.ContentLength, 0, 20, time.Now()}
-	written, err := io.Copy(os.Stdout, io.TeeReader(resp.Body, &status))
-	fmt.Fprintln(os.Stderr)
-	subcommands.DieNotNil(err)
-	if written != resp.ContentLength {
-		fmt.Fprintf(os.Stderr, "ERROR: read %d bytes, expected %d bytes\n", written, resp.ContentLength)
-		os.Exit(1)
+func downloadArtifacts(factory string, target int, artifacts []string, outDir string) {
+	items := make([]*client.DownloadItem, len(artifacts))
+	for idx, artifact := range artifacts {
+		run, name := parseArtifactPath(artifact)
+		path := filepath.Join(outDir, filepath.FromSlash(artifact))
+		subcommands.DieNotNil(os.MkdirAll(filepath.Dir(path), 0755))
+		items[idx] = &client.DownloadItem{
+			Url:  api.JobservRunArtifactUrl(factory, target, run, name),
+			Path: path,
+		}
 	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fmt.Fprintf(os.Stderr, "ERROR: HTTP response code %d\n", resp.StatusCode)
-		os.Exit(1)
+	if len(items) == 1 {
+		items[0].Sha256 = artifactsSha256
 	}
+	dl := api.NewDownloader()
+	dl.Concurrency = artifactsParallel
+	err := dl.Download(items...)
+	for _, item := range items {
+		if item.Err == nil {
+			fmt.Printf("%s\tsha256:%s\n", item.Path, item.Sha256)
+		} else {
+			fmt.Printf("%s\tERROR: %s\n", item.Path, item.Err)
+		}
+	}
+	subcommands.DieNotNil(err)
 }
 
 func doArtifacts(cmd *cobra.Command, args []string) {
@@ -125,9 +135,14 @@ func doArtifacts(cmd *cobra.Command, args []string) {
 	if len(args) == 1 {
 		logrus.Debugf("Showing target artifacts for %s %d", factory, target)
 		listArtifacts(factory, target)
-	} else {
+	} else if len(artifactsOutDir) > 0 {
+		logrus.Debugf("Downloading artifacts %s %d %v", factory, target, args[1:])
+		downloadArtifacts(factory, target, args[1:], artifactsOutDir)
+	} else if len(args) == 2 {
 		artifact := args[1]
 		logrus.Debugf("Downloading artifact %s %d %s", factory, target, artifact)
 		downloadArtifact(factory, target, artifact)
+	} else {
+		subcommands.DieNotNil(subcommands.ValidationError("The --out-dir flag is required to download several artifacts"))
 	}
 }
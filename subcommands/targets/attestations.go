@@ -0,0 +1,336 @@
+package targets
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	canonical "github.com/docker/go/canonical/json"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var attestationKeys []string
+
+// inTotoLink is the in-toto link metadata recorded by CI for a step of a build.
+type inTotoLink struct {
+	Signatures []struct {
+		KeyId string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+	Signed struct {
+		Type      string                       `json:"_type"`
+		Name      string                       `json:"name"`
+		Command   []string                     `json:"command"`
+		Materials map[string]map[string]string `json:"materials"`
+		Products  map[string]map[string]string `json:"products"`
+	} `json:"signed"`
+
+	artifact string
+	verified []string
+}
+
+func init() {
+	attestationsCmd := &cobra.Command{
+		Use:   "attestations <version>",
+		Short: "Verify in-toto attestations of how a target was built",
+		Long: `Download the in-toto link metadata recorded by CI for the build of a target version,
+and verify the chain of build steps from the source revisions to the published artifacts:
+
+ * A step uses the source revisions of the target as its materials.
+ * Each other step only uses materials produced by previous steps.
+ * The published artifacts of the targets, their OSTree commits and app bundles,
+   are products of the steps.
+
+CI records link metadata as *.link artifacts of its runs. The command fails, listing
+what is missing, when the chain is broken.
+
+The signatures of the links are verified when the public keys of the CI signers are
+given with --key.`,
+		Run:  doAttestations,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Verify how the target version 42 was built:
+  fioctl targets attestations 42
+
+  # Also verify the links are signed by the CI key:
+  fioctl targets attestations 42 --key ci-signer.pub`,
+	}
+	cmd.AddCommand(attestationsCmd)
+	attestationsCmd.Flags().StringArrayVarP(&attestationKeys, "key", "", nil,
+		"A PEM encoded public key of a CI signer. All links must be signed by one of these keys")
+}
+
+func inTotoKeyId(pub interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
+
+func loadAttestationKeys(files []string) (map[string]interface{}, error) {
+	keys := make(map[string]interface{})
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(buf)
+		if block == nil {
+			return nil, fmt.Errorf("No PEM encoded public key found in %s", file)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", file, err)
+		}
+		id, err := inTotoKeyId(pub)
+		if err != nil {
+			return nil, err
+		}
+		keys[id] = pub
+	}
+	return keys, nil
+}
+
+func verifyLinkSignature(pub interface{}, msg []byte, sig []byte) bool {
+	digest := sha256.Sum256(msg)
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, msg, sig)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPSS(key, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil
+	}
+	return false
+}
+
+// verifyLink finds which of the keys signed the link. The signatures are made over the canonical
+// JSON of the signed part, by any key, so the signatures are tried with all keys.
+func verifyLink(raw []byte, link *inTotoLink, keys map[string]interface{}) error {
+	var meta struct {
+		Signed json.RawMessage `json:"signed"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return err
+	}
+	dec := canonical.NewDecoder(bytes.NewReader(meta.Signed))
+	dec.UseNumber()
+	var signed interface{}
+	if err := dec.Decode(&signed); err != nil {
+		return err
+	}
+	msg, err := canonical.MarshalCanonical(signed)
+	if err != nil {
+		return err
+	}
+	for _, s := range link.Signatures {
+		sig, err := hex.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		for id, pub := range keys {
+			if verifyLinkSignature(pub, msg, sig) {
+				link.verified = append(link.verified, id)
+			}
+		}
+	}
+	return nil
+}
+
+func fetchLinks(factory string, build int) ([]*inTotoLink, error) {
+	runs, err := api.JobservRuns(factory, build)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]interface{}
+	if len(attestationKeys) > 0 {
+		if keys, err = loadAttestationKeys(attestationKeys); err != nil {
+			return nil, err
+		}
+	}
+	var links []*inTotoLink
+	for _, r := range runs {
+		run, err := api.JobservRun(r.Url)
+		if err != nil {
+			return nil, err
+		}
+		for _, artifact := range run.Artifacts {
+			if !strings.HasSuffix(artifact, ".link") {
+				continue
+			}
+			logrus.Debugf("Downloading in-toto link %s", artifact)
+			raw, err := api.Get(artifact)
+			if err != nil {
+				return nil, err
+			}
+			link := inTotoLink{artifact: run.Name + "/" + path.Base(artifact)}
+			if err := json.Unmarshal(*raw, &link); err != nil {
+				return nil, fmt.Errorf("Unable to parse %s: %w", link.artifact, err)
+			}
+			if link.Signed.Type != "link" {
+				logrus.Debugf("Skipping %s: not an in-toto link", link.artifact)
+				continue
+			}
+			if keys != nil {
+				if err := verifyLink(*raw, &link, keys); err != nil {
+					return nil, fmt.Errorf("Unable to verify %s: %w", link.artifact, err)
+				}
+			}
+			links = append(links, &link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].artifact < links[j].artifact })
+	return links, nil
+}
+
+// hasDigest checks whether any of the artifacts has the digest, of any algorithm.
+func hasDigest(artifacts map[string]map[string]string, digest string) bool {
+	for _, hashes := range artifacts {
+		for _, val := range hashes {
+			if strings.EqualFold(val, digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func doAttestations(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	version := args[0]
+	build, err := strconv.Atoi(version)
+	if err != nil {
+		subcommands.DieNotNil(subcommands.ValidationError("Invalid target version: %s", version))
+	}
+
+	_, hashes, targets := getTargets(factory, "", version)
+	links, err := fetchLinks(factory, build)
+	subcommands.DieNotNil(err)
+	if len(links) == 0 {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+			fmt.Errorf("No in-toto link metadata was recorded by CI for the build %d", build)))
+	}
+
+	fmt.Println("Steps:")
+	var problems []string
+	for _, link := range links {
+		fmt.Printf("\t%s (%s): %d materials, %d products\n",
+			link.Signed.Name, link.artifact, len(link.Signed.Materials), len(link.Signed.Products))
+		if len(attestationKeys) > 0 {
+			if len(link.verified) == 0 {
+				problems = append(problems, fmt.Sprintf("step %s is not signed by any of the given keys", link.Signed.Name))
+			} else {
+				fmt.Printf("\t\tsigned by: %s\n", strings.Join(link.verified, ", "))
+			}
+		}
+	}
+
+	// The source revisions the target was built from
+	var sources []string
+	// The artifacts published for the target
+	published := make(map[string]string)
+	for name, custom := range targets {
+		for _, sha := range []string{custom.ContainersSha, custom.LmpManifestSha, custom.OverridesSha} {
+			if len(sha) > 0 && !slices.Contains(sources, sha) {
+				sources = append(sources, sha)
+			}
+		}
+		// The hash of an OSTree target is its OSTree commit
+		if raw, err := base64.StdEncoding.DecodeString(hashes[name]); err == nil && len(raw) > 0 {
+			published[hex.EncodeToString(raw)] = name + " OSTree commit"
+		}
+		for app, uri := range custom.ComposeApps {
+			published[uri.Hash()] = "app " + app
+		}
+	}
+
+	fmt.Println("\nChain:")
+	sourceStep := false
+	for _, link := range links {
+		for _, sha := range sources {
+			if hasDigest(link.Signed.Materials, sha) {
+				fmt.Printf("\tsource revision %s -> %s\n", sha, link.Signed.Name)
+				sourceStep = true
+			}
+		}
+	}
+	if !sourceStep {
+		problems = append(problems, fmt.Sprintf("no step uses the source revisions of the target: %s", strings.Join(sources, ", ")))
+	}
+
+	for _, link := range links {
+		var unknown []string
+		for material, digests := range link.Signed.Materials {
+			known := false
+			for _, sha := range sources {
+				known = known || hasDigest(map[string]map[string]string{material: digests}, sha)
+			}
+			for _, other := range links {
+				if other == link {
+					continue
+				}
+				for _, d := range digests {
+					known = known || hasDigest(other.Signed.Products, d)
+				}
+			}
+			if !known {
+				unknown = append(unknown, material)
+			}
+		}
+		sort.Strings(unknown)
+		if len(unknown) > 0 {
+			problems = append(problems, fmt.Sprintf("step %s uses materials not produced by any step: %s",
+				link.Signed.Name, strings.Join(unknown, ", ")))
+		}
+	}
+
+	var digests []string
+	for digest := range published {
+		digests = append(digests, digest)
+	}
+	sort.Slice(digests, func(i, j int) bool { return published[digests[i]] < published[digests[j]] })
+	for _, digest := range digests {
+		var producers []string
+		for _, link := range links {
+			if hasDigest(link.Signed.Products, digest) {
+				producers = append(producers, link.Signed.Name)
+			}
+		}
+		if len(producers) == 0 {
+			problems = append(problems, fmt.Sprintf("no step produced the %s %s", published[digest], digest))
+			continue
+		}
+		fmt.Printf("\t%s -> %s\n", strings.Join(producers, ", "), published[digest])
+	}
+
+	if len(problems) > 0 {
+		fmt.Println("\nProblems:")
+		for _, p := range problems {
+			fmt.Println("\t", p)
+		}
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			errors.New("The attestations do not prove how the target was built")))
+	}
+	fmt.Println("\nThe attestations cover the build from the source revisions to the published artifacts")
+}
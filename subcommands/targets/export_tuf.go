@@ -0,0 +1,106 @@
+package targets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+var (
+	exportTufTag   string
+	exportTufOut   string
+	exportTufServe string
+)
+
+func init() {
+	exportTufCmd := &cobra.Command{
+		Use:   "export-tuf --tag <tag> --out <dir>",
+		Short: "Export production TUF metadata for an OTA mirror server",
+		Long: `Export the signed production TUF metadata of a tag in the layout an on-prem OTA mirror
+serves to devices from a static HTTP server:
+
+  <dir>/N.root.json     every version of the root metadata
+  <dir>/root.json       the latest root metadata
+  <dir>/timestamp.json
+  <dir>/snapshot.json
+  <dir>/targets.json    the production targets signed by the offline targets keys
+
+The timestamp and snapshot metadata are signed by online keys and expire in a short time,
+so the export must be repeated to keep the mirror usable by devices.
+
+The --serve option serves the exported directory after the export, so that a device
+can be tested against the mirror before it is deployed.`,
+		Run:  doExportTuf,
+		Args: cobra.NoArgs,
+		Example: `
+  # Export the metadata of the "prod" tag to a directory of a static HTTP server:
+  fioctl targets export-tuf --tag prod --out /srv/ota-mirror/repo
+
+  # Export, and serve the metadata to test a device against it:
+  fioctl targets export-tuf --tag prod --out /tmp/repo --serve 0.0.0.0:8080`,
+	}
+	cmd.AddCommand(exportTufCmd)
+	exportTufCmd.Flags().StringVarP(&exportTufTag, "tag", "", "", "The production tag to export")
+	exportTufCmd.Flags().StringVarP(&exportTufOut, "out", "", "", "The directory to write the metadata to")
+	exportTufCmd.Flags().StringVarP(&exportTufServe, "serve", "", "",
+		"Serve the exported metadata over HTTP on this address after the export, e.g. 127.0.0.1:8080")
+	_ = exportTufCmd.MarkFlagRequired("tag")
+	_ = exportTufCmd.MarkFlagRequired("out")
+}
+
+func doExportTuf(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	logrus.Debugf("Exporting TUF metadata of %s tag %s to %s", factory, exportTufTag, exportTufOut)
+
+	// Fail early with a clear message if there are no production targets for the tag
+	prodMeta, err := api.ProdTargetsGet(factory, exportTufTag, true)
+	subcommands.DieNotNil(err, "Failed to fetch production targets:")
+
+	subcommands.DieNotNil(downloadTufRoots(factory, exportTufTag, true, exportTufOut), "Failed to download TUF metadata:")
+	for _, name := range []string{"root.json", "timestamp.json", "snapshot.json", "targets.json"} {
+		subcommands.DieNotNil(downloadTufMetadata(factory, name, exportTufTag, true, exportTufOut),
+			"Failed to download TUF metadata:")
+	}
+
+	files, err := os.ReadDir(exportTufOut)
+	subcommands.DieNotNil(err)
+	fmt.Printf("Exported %d production targets of the tag %s to %s:\n", len(prodMeta.Signed.Targets), exportTufTag, exportTufOut)
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		var meta struct {
+			Signed struct {
+				Version int    `json:"version"`
+				Expires string `json:"expires"`
+			} `json:"signed"`
+		}
+		buf, err := os.ReadFile(path.Join(exportTufOut, f.Name()))
+		subcommands.DieNotNil(err)
+		subcommands.DieNotNil(json.Unmarshal(buf, &meta), "Failed to parse "+f.Name()+":")
+		fmt.Printf("\t%-16s version %d, expires %s\n", f.Name(), meta.Signed.Version, meta.Signed.Expires)
+	}
+
+	if len(exportTufServe) == 0 {
+		return
+	}
+	dir, err := filepath.Abs(exportTufOut)
+	subcommands.DieNotNil(err)
+	fmt.Printf("\nServing %s on http://%s/ (Ctrl-C to stop)\n", dir, exportTufServe)
+	fileServer := http.FileServer(http.Dir(dir))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println(r.RemoteAddr, r.Method, r.URL.Path)
+		fileServer.ServeHTTP(w, r)
+	})
+	subcommands.DieNotNil(http.ListenAndServe(exportTufServe, handler))
+}
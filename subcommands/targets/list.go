@@ -9,7 +9,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/cheynewallace/tabby"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,6 +22,7 @@ var (
 	listRaw     bool
 	listByTag   string
 	showColumns []string
+	listOutput  subcommands.ListOutput
 )
 
 // Represents the details we use for displaying a single OTA "build"
@@ -89,6 +89,7 @@ func init() {
 	listCmd.Flags().BoolVarP(&listProd, "production", "", false, "Show the production version targets.json")
 	listCmd.Flags().StringVarP(&listByTag, "by-tag", "", "", "Only list targets that match the given tag")
 	listCmd.Flags().StringSliceVarP(&showColumns, "columns", "", defCols, "Specify which columns to display")
+	listOutput.AddFlags(listCmd, "tags,version")
 }
 
 func doList(cmd *cobra.Command, args []string) {
@@ -114,92 +115,42 @@ func doList(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	var targets data.Files
+	var keys []string
+	listing := make(map[string]*targetListing)
 	if listProd {
 		meta, err := api.ProdTargetsGet(factory, listByTag, true)
 		subcommands.DieNotNil(err)
-		targets = meta.Signed.Targets
-	} else {
-		var err error
-		targets, err = api.TargetsList(factory)
-		subcommands.DieNotNil(err)
-	}
-
-	var keys []string
-	listing := make(map[string]*targetListing)
-	for _, target := range targets {
-		custom, err := api.TargetCustom(target)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			continue
-		}
-		if custom.TargetFormat != "OSTREE" {
-			logrus.Debugf("Skipping non-ostree target: %v", target)
-			continue
+		for _, target := range meta.Signed.Targets {
+			keys = addTargetListing(listing, keys, target)
 		}
-		if len(listByTag) > 0 {
-			found := false
-			for _, t := range custom.Tags {
-				if t == listByTag {
-					found = true
-					break
-				}
-			}
-			if !found {
-				logrus.Debugf("Skipping tag: %v", target)
-				continue
-			}
-		}
-		ver, err := strconv.Atoi(custom.Version)
-		if err != nil {
-			panic(fmt.Sprintf("Invalid version: %v. Error: %s", target, err))
-		}
-		key := fmt.Sprintf("%d-%s", ver, strings.Join(custom.Tags, ","))
-		build, ok := listing[key]
-		if ok {
-			build.hardwareIds = append(build.hardwareIds, custom.HardwareIds...)
-			//TODO assert list of docker-apps is the same
-		} else {
-			set := make(map[string]bool)
-			var apps []string
-			for app := range custom.ComposeApps {
-				if _, ok := set[app]; !ok {
-					apps = append(apps, app)
-				}
-			}
-			sort.Strings(apps)
-			keys = append(keys, key)
-			origin := ""
-			if len(custom.OrigUri) > 0 {
-				parts := strings.Split(custom.OrigUri, "/")
-				origin = parts[len(parts)-1]
-			}
-			listing[key] = &targetListing{
-				version:      ver,
-				hardwareIds:  custom.HardwareIds,
-				tags:         custom.Tags,
-				apps:         apps,
-				origin:       origin,
-				manifestSha:  custom.LmpManifestSha,
-				overridesSha: custom.OverridesSha,
-				containerSha: custom.ContainersSha,
-			}
+	} else {
+		// The targets are decoded one at a time, rather than all loaded before being listed
+		it := api.TargetIter(factory)
+		for it.Next() {
+			_, target := it.Value()
+			keys = addTargetListing(listing, keys, target)
 		}
+		subcommands.DieNotNil(it.Err())
 	}
 
-	t := tabby.New()
-	var cols = make([]interface{}, len(showColumns))
-	for idx, c := range showColumns {
+	for _, c := range showColumns {
 		if _, ok := Columns[c]; !ok {
 			fmt.Println("ERROR: Invalid column name:", c)
 			os.Exit(1)
 		}
-		cols[idx] = strings.ToUpper(c)
 	}
-	t.AddHeader(cols...)
+	t := listOutput.NewTable(showColumns...)
 	row := make([]interface{}, len(showColumns))
 
 	sort.Sort(byTargetKey(keys))
+	allCols := make([]string, 0, len(Columns))
+	for c := range Columns {
+		allCols = append(allCols, c)
+	}
+	sort.Strings(allCols)
+	listOutput.Sort(keys, allCols, func(idx int, column string) string {
+		return Columns[column].Formatter(listing[keys[idx]])
+	})
 	for _, key := range keys {
 		l := listing[key]
 		for idx, col := range showColumns {
@@ -210,3 +161,65 @@ func doList(cmd *cobra.Command, args []string) {
 	}
 	t.Print()
 }
+
+// addTargetListing adds a target to the listing of its build, and returns the keys of the listed builds.
+func addTargetListing(listing map[string]*targetListing, keys []string, target data.FileMeta) []string {
+	custom, err := api.TargetCustom(target)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		return keys
+	}
+	if custom.TargetFormat != "OSTREE" {
+		logrus.Debugf("Skipping non-ostree target: %v", target)
+		return keys
+	}
+	if len(listByTag) > 0 {
+		found := false
+		for _, t := range custom.Tags {
+			if t == listByTag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			logrus.Debugf("Skipping tag: %v", target)
+			return keys
+		}
+	}
+	ver, err := strconv.Atoi(custom.Version)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid version: %v. Error: %s", target, err))
+	}
+	key := fmt.Sprintf("%d-%s", ver, strings.Join(custom.Tags, ","))
+	build, ok := listing[key]
+	if ok {
+		build.hardwareIds = append(build.hardwareIds, custom.HardwareIds...)
+		//TODO assert list of docker-apps is the same
+	} else {
+		set := make(map[string]bool)
+		var apps []string
+		for app := range custom.ComposeApps {
+			if _, ok := set[app]; !ok {
+				apps = append(apps, app)
+			}
+		}
+		sort.Strings(apps)
+		keys = append(keys, key)
+		origin := ""
+		if len(custom.OrigUri) > 0 {
+			parts := strings.Split(custom.OrigUri, "/")
+			origin = parts[len(parts)-1]
+		}
+		listing[key] = &targetListing{
+			version:      ver,
+			hardwareIds:  custom.HardwareIds,
+			tags:         custom.Tags,
+			apps:         apps,
+			origin:       origin,
+			manifestSha:  custom.LmpManifestSha,
+			overridesSha: custom.OverridesSha,
+			containerSha: custom.ContainersSha,
+		}
+	}
+	return keys
+}
@@ -15,7 +15,6 @@ import (
 	"path"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type (
@@ -84,16 +83,29 @@ func doOfflineUpdate(cmd *cobra.Command, args []string) {
 
 	if !ouTufOnly {
 		fmt.Printf("Downloading an ostree repo from the Target's OE build %d...\n", ti.ostreeVersion)
-		subcommands.DieNotNil(downloadOstree(factory, ti.ostreeVersion, ti.hardwareID, dstDir), "Failed to download Target's ostree repo:")
+		ostree := ostreeDownloadItem(factory, ti.ostreeVersion, ti.hardwareID, dstDir)
+		items := []*client.DownloadItem{ostree}
+		var apps *client.DownloadItem
 		if !ouNoApps {
 			fmt.Printf("Downloading Apps fetched by the `assemble-system-image` run; build number:  %d, tag: %s...\n", ti.version, ti.buildTag)
-			err = downloadApps(factory, targetName, ti.version, ti.buildTag, path.Join(dstDir, "apps"))
-			if herr := client.AsHttpError(err); herr != nil && herr.Response.StatusCode == 404 {
+			apps = appsDownloadItem(factory, targetName, ti.version, ti.buildTag, dstDir)
+			items = append(items, apps)
+		}
+		// Errors are handled for each item, so that missing Apps are not fatal
+		_ = api.NewDownloader().Download(items...)
+
+		subcommands.DieNotNil(ostree.Err, "Failed to download Target's ostree repo:")
+		subcommands.DieNotNil(extractOstree(ostree.Path, dstDir), "Failed to extract Target's ostree repo:")
+		if apps != nil {
+			if herr := client.AsHttpError(apps.Err); herr != nil && herr.Response.StatusCode == 404 {
 				fmt.Println("WARNING: The Target Apps were not fetched by the `assemble` run, make sure that App preloading is enabled if needed. The update won't include any Apps!")
 			} else {
-				subcommands.DieNotNil(err, "Failed to download Target's Apps:")
+				subcommands.DieNotNil(apps.Err, "Failed to download Target's Apps:")
+				subcommands.DieNotNil(extractArchive(apps.Path, path.Join(dstDir, "apps"), untar), "Failed to extract Target's Apps:")
 			}
 		}
+		// Only removed if empty, i.e. all downloaded archives were extracted
+		_ = os.Remove(path.Join(dstDir, ouDownloadDir))
 		fmt.Println("Successfully downloaded offline update content")
 	}
 }
@@ -152,68 +164,89 @@ func getTargetInfo(factory string, targetName string) (*ouTargetInfo, error) {
 }
 
 func downloadTufRepo(factory string, target string, tag string, prod bool, expiresIn int, dstDir string) error {
-	// v1 - auto-generated by tuf_keyserver (default, on Factory creation);
-	// v2 - auto-generated by ota-lite to take keys online (default, on Factory creation);
-	ver := 3
-	downloadMetadataFile := func(metadataFileName string) error {
-		data, err := api.TufMetadataGet(factory, metadataFileName, tag, prod)
+	if err := downloadTufRoots(factory, tag, prod, dstDir); err != nil {
+		return err
+	}
+
+	meta, err := api.TufTargetMetadataRefresh(factory, target, tag, expiresIn, prod)
+	if err != nil {
+		return err
+	}
+	metadataNames := []string{
+		"timestamp", "snapshot", "targets",
+	}
+	for _, metaName := range metadataNames {
+		b, err := json.Marshal(meta[metaName])
 		if err != nil {
 			return err
 		}
-		f, err := os.Create(path.Join(dstDir, metadataFileName))
+		err = os.WriteFile(path.Join(dstDir, metaName+".json"), b, 0666)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		_, err = f.Write(*data)
-		return err
 	}
 
-	err := os.MkdirAll(dstDir, 0755)
-	if err != nil {
+	return nil
+}
+
+// downloadTufRoots downloads all versions of the TUF root metadata as N.root.json files.
+func downloadTufRoots(factory string, tag string, prod bool, dstDir string) error {
+	// v1 - auto-generated by tuf_keyserver (default, on Factory creation);
+	// v2 - auto-generated by ota-lite to take keys online (default, on Factory creation);
+	ver := 3
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return err
 	}
-
 	for {
 		metadataFileName := fmt.Sprintf("%d.root.json", ver)
-		err := downloadMetadataFile(metadataFileName)
+		err := downloadTufMetadata(factory, metadataFileName, tag, prod, dstDir)
 		if err != nil {
 			if httpErr := client.AsHttpError(err); httpErr != nil && httpErr.Response.StatusCode == 404 {
 				// if 404 received for N.root.json, then stop downloading root metadata versions
-				break
+				return nil
 			}
 			return err
 		}
 		ver += 1
 	}
+}
 
-	meta, err := api.TufTargetMetadataRefresh(factory, target, tag, expiresIn, prod)
+func downloadTufMetadata(factory string, metadataFileName string, tag string, prod bool, dstDir string) error {
+	data, err := api.TufMetadataGet(factory, metadataFileName, tag, prod)
 	if err != nil {
 		return err
 	}
-	metadataNames := []string{
-		"timestamp", "snapshot", "targets",
-	}
-	for _, metaName := range metadataNames {
-		b, err := json.Marshal(meta[metaName])
-		if err != nil {
-			return err
-		}
-		err = os.WriteFile(path.Join(dstDir, metaName+".json"), b, 0666)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return os.WriteFile(path.Join(dstDir, metadataFileName), *data, 0666)
 }
 
-func downloadOstree(factory string, targetVer int, hardwareID string, dstDir string) error {
+// Archives are downloaded to this directory inside the destination directory, so that
+// an interrupted download is resumed when the command is run again.
+const ouDownloadDir = ".download"
+
+func ostreeDownloadItem(factory string, targetVer int, hardwareID string, dstDir string) *client.DownloadItem {
 	runName := hardwareID
 	artifactName := hardwareID + "-ostree_repo.tar.bz2"
 	artifactPath := path.Join("other", artifactName)
+	return artifactDownloadItem(factory, targetVer, runName, artifactPath, dstDir)
+}
+
+func appsDownloadItem(factory string, targetName string, targetVer int, tag string, dstDir string) *client.DownloadItem {
+	runName := "assemble-system-image"
+	artifactPath := path.Join(tag, targetName+"-apps.tar")
+	return artifactDownloadItem(factory, targetVer, runName, artifactPath, dstDir)
+}
 
-	return downloadItem(factory, targetVer, runName, artifactPath, func(r io.Reader) error {
+func artifactDownloadItem(factory string, targetVer int, runName string, artifactPath string, dstDir string) *client.DownloadItem {
+	dlDir := path.Join(dstDir, ouDownloadDir)
+	subcommands.DieNotNil(os.MkdirAll(dlDir, 0755))
+	return &client.DownloadItem{
+		Url:  api.JobservRunArtifactUrl(factory, targetVer, runName, artifactPath),
+		Path: path.Join(dlDir, path.Base(artifactPath)),
+	}
+}
+
+func extractOstree(archive string, dstDir string) error {
+	return extractArchive(archive, dstDir, func(r io.Reader, dstDir string) error {
 		bzr := bzip2.NewReader(r)
 		if bzr == nil {
 			return fmt.Errorf("failed to create bzip2 reader")
@@ -222,13 +255,20 @@ func downloadOstree(factory string, targetVer int, hardwareID string, dstDir str
 	})
 }
 
-func downloadApps(factory string, targetName string, targetVer int, tag string, dstDir string) error {
-	runName := "assemble-system-image"
-	artifactPath := path.Join(tag, targetName+"-apps.tar")
-
-	return downloadItem(factory, targetVer, runName, artifactPath, func(r io.Reader) error {
-		return untar(r, dstDir)
-	})
+// extractArchive extracts a downloaded archive, and removes it once it is extracted.
+func extractArchive(archive string, dstDir string, extract func(r io.Reader, dstDir string) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+	if err := extract(f, dstDir); err != nil {
+		return err
+	}
+	return os.Remove(archive)
 }
 
 func getTargetCustomInfo(factory string, targetName string) (*client.TufCustom, error) {
@@ -240,22 +280,6 @@ func getTargetCustomInfo(factory string, targetName string) (*client.TufCustom,
 	return custom, err
 }
 
-func downloadItem(factory string, targetVer int, runName string, artifactPath string, storeHandler func(r io.Reader) error) error {
-	resp, err := api.JobservRunArtifact(factory, targetVer, runName, artifactPath)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return &client.HttpError{
-			Message:  fmt.Sprintf("failed to download a CI artifact; status code: %d, artifact: %s", resp.StatusCode, artifactPath),
-			Response: resp,
-		}
-	}
-
-	status := DlStatus{resp.ContentLength, 0, 20, time.Now()}
-	return storeHandler(io.TeeReader(resp.Body, &status))
-}
-
 func untar(r io.Reader, dstDir string) error {
 	tr := tar.NewReader(r)
 	storeItem := func(flag byte, name string, size int64) error {
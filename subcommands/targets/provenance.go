@@ -0,0 +1,246 @@
+package targets
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+	"github.com/foundriesio/fioctl/subcommands/keys"
+)
+
+const (
+	provenanceFormatSlsaV1 = "slsa-v1"
+	inTotoStatementType    = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType     = "https://slsa.dev/provenance/v1"
+	lmpBuildType           = "https://foundries.io/ci/lmp-build/v1"
+	dssePayloadType        = "application/vnd.in-toto+json"
+)
+
+var (
+	provenanceFormat string
+	provenanceOut    string
+	provenanceKeys   string
+)
+
+type slsaDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	Uri    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type slsaStatement struct {
+	Type          string           `json:"_type"`
+	Subject       []slsaDescriptor `json:"subject"`
+	PredicateType string           `json:"predicateType"`
+	Predicate     struct {
+		BuildDefinition struct {
+			BuildType            string            `json:"buildType"`
+			ExternalParameters   map[string]string `json:"externalParameters"`
+			ResolvedDependencies []slsaDescriptor  `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				Id string `json:"id"`
+			} `json:"builder"`
+			Metadata struct {
+				InvocationId string `json:"invocationId"`
+				StartedOn    string `json:"startedOn,omitempty"`
+				FinishedOn   string `json:"finishedOn,omitempty"`
+			} `json:"metadata"`
+			Byproducts []slsaDescriptor `json:"byproducts,omitempty"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// dsseEnvelope is the signed form of an in-toto statement.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		KeyId string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+func init() {
+	provenanceCmd := &cobra.Command{
+		Use:   "provenance <version> --out <file>",
+		Short: "Generate a SLSA provenance statement for a target version",
+		Long: `Assemble the build metadata of a target version into a SLSA provenance statement:
+the CI builder and build, the source revisions the targets were built from, and
+the digests of the published artifacts, their OSTree commits and app bundles.
+
+The statement can be signed with the offline targets keys, in which case it is written
+as a DSSE envelope, the format used by in-toto and Sigstore tools.`,
+		Run:  doProvenance,
+		Args: cobra.ExactArgs(1),
+		Example: `
+  # Generate the provenance of the target version 42:
+  fioctl targets provenance 42 --format slsa-v1 --out provenance.json
+
+  # Generate a signed provenance:
+  fioctl targets provenance 42 --out provenance.intoto.json --keys ~/path/to/keys/targets.only.key.tgz`,
+	}
+	cmd.AddCommand(provenanceCmd)
+	provenanceCmd.Flags().StringVarP(&provenanceFormat, "format", "", provenanceFormatSlsaV1, "The provenance format: slsa-v1")
+	provenanceCmd.Flags().StringVarP(&provenanceOut, "out", "", "", "Write the provenance to this file rather than STDOUT")
+	provenanceCmd.Flags().StringVarP(&provenanceKeys, "keys", "k", "",
+		"Path to <offline-creds.tgz> used to sign the provenance. Signed provenance is a DSSE envelope")
+}
+
+// dssePae is the pre-authentication encoding of a DSSE payload, which signatures are made over.
+func dssePae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func signProvenance(factory string, payload []byte, credsFile string) dsseEnvelope {
+	creds, err := keys.GetOfflineCreds(credsFile)
+	subcommands.DieNotNil(err, "Failed to open offline keys file")
+	root, err := api.TufProdRootGet(factory)
+	subcommands.DieNotNil(err, "Failed to fetch production root role")
+	onlinePub, err := api.TufTargetsOnlineKey(factory)
+	subcommands.DieNotNil(err, "Failed to fetch online targets public key")
+
+	var signers []keys.TufSigner
+	if role := root.Signed.Roles["targets"]; role != nil {
+		for _, kid := range role.KeyIDs {
+			pub := root.Signed.Keys[kid].KeyValue.Public
+			if pub == onlinePub.KeyValue.Public {
+				continue
+			}
+			if signer, err := keys.FindTufSigner(kid, pub, creds); err == nil {
+				signers = append(signers, *signer)
+			}
+		}
+	}
+	if len(signers) == 0 {
+		subcommands.DieNotNil(fmt.Errorf("None of the offline targets keys is found in %s", credsFile))
+	}
+	signatures, err := keys.SignTufMeta(dssePae(dssePayloadType, payload), signers...)
+	subcommands.DieNotNil(err, "Failed to sign the provenance")
+
+	env := dsseEnvelope{PayloadType: dssePayloadType, Payload: base64.StdEncoding.EncodeToString(payload)}
+	for _, sig := range signatures {
+		env.Signatures = append(env.Signatures, struct {
+			KeyId string `json:"keyid"`
+			Sig   string `json:"sig"`
+		}{sig.KeyID, base64.StdEncoding.EncodeToString(sig.Signature)})
+	}
+	return env
+}
+
+func doProvenance(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	version := args[0]
+	if provenanceFormat != provenanceFormatSlsaV1 {
+		subcommands.DieNotNil(subcommands.ValidationError("Unsupported provenance format: %s", provenanceFormat))
+	}
+	build, err := strconv.Atoi(version)
+	if err != nil {
+		subcommands.DieNotNil(subcommands.ValidationError("Invalid target version: %s", version))
+	}
+	logrus.Debugf("Generating provenance of %s %s", factory, version)
+
+	names, hashes, targets := getTargets(factory, "", version)
+	ciBuild, err := api.JobservBuild(factory, build)
+	subcommands.DieNotNil(err)
+	runs, err := api.JobservRuns(factory, build)
+	subcommands.DieNotNil(err)
+
+	var st slsaStatement
+	st.Type = inTotoStatementType
+	st.PredicateType = slsaProvenanceType
+	def := &st.Predicate.BuildDefinition
+	def.BuildType = lmpBuildType
+	def.ResolvedDependencies = []slsaDescriptor{}
+	def.ExternalParameters = map[string]string{"factory": factory, "version": version}
+	if len(ciBuild.TriggerName) > 0 {
+		def.ExternalParameters["trigger"] = ciBuild.TriggerName
+	}
+	if len(ciBuild.Reason) > 0 {
+		def.ExternalParameters["reason"] = ciBuild.Reason
+	}
+	run := &st.Predicate.RunDetails
+	run.Builder.Id = "https://api.foundries.io/projects/" + factory + "/lmp/"
+	run.Metadata.InvocationId = ciBuild.Url
+	run.Metadata.StartedOn = ciBuild.Created
+	run.Metadata.FinishedOn = ciBuild.Completed
+	for _, r := range runs {
+		run.Byproducts = append(run.Byproducts, slsaDescriptor{Name: r.Name, Uri: r.Url})
+	}
+
+	sources := make(map[string]string)
+	apps := make(map[string]string)
+	for _, name := range names {
+		custom := targets[name]
+		for repo, sha := range map[string]string{
+			"containers.git":                custom.ContainersSha,
+			"lmp-manifest.git":              custom.LmpManifestSha,
+			"meta-subscriber-overrides.git": custom.OverridesSha,
+		} {
+			if len(sha) > 0 {
+				sources[repo] = sha
+			}
+		}
+		if raw, err := base64.StdEncoding.DecodeString(hashes[name]); err == nil && len(raw) > 0 {
+			st.Subject = append(st.Subject, slsaDescriptor{Name: name, Digest: map[string]string{"sha256": hex.EncodeToString(raw)}})
+		}
+		for app, uri := range custom.ComposeApps {
+			apps[uri.Uri] = app
+		}
+	}
+	var repos []string
+	for repo := range sources {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		def.ResolvedDependencies = append(def.ResolvedDependencies, slsaDescriptor{
+			Uri:    "git+https://source.foundries.io/factories/" + factory + "/" + repo,
+			Digest: map[string]string{"gitCommit": sources[repo]},
+		})
+	}
+	var uris []string
+	for uri := range apps {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		st.Subject = append(st.Subject, slsaDescriptor{
+			Name:   uri,
+			Digest: map[string]string{"sha256": client.ComposeApp{Uri: uri}.Hash()},
+		})
+	}
+
+	out, err := json.MarshalIndent(st, "", "  ")
+	subcommands.DieNotNil(err)
+	if len(provenanceKeys) > 0 {
+		// The payload is signed as is, so it is kept compact rather than indented
+		payload, err := json.Marshal(st)
+		subcommands.DieNotNil(err)
+		out, err = json.MarshalIndent(signProvenance(factory, payload, provenanceKeys), "", "  ")
+		subcommands.DieNotNil(err)
+	}
+	out = append(out, '\n')
+
+	if len(provenanceOut) == 0 {
+		fmt.Print(string(out))
+		return
+	}
+	if _, err := os.Stat(provenanceOut); err == nil {
+		subcommands.DieNotNil(errors.New("Refusing to overwrite an existing file: " + provenanceOut))
+	}
+	subcommands.DieNotNil(os.WriteFile(provenanceOut, out, 0644))
+	fmt.Printf("Provenance of %d artifacts written to %s\n", len(st.Subject), provenanceOut)
+}
@@ -47,6 +47,7 @@ func init() {
 	pruneCmd.Flags().BoolVarP(&pruneByTag, "by-tag", "", false, "Prune all targets by tags instead of name")
 	pruneCmd.Flags().IntVarP(&pruneKeepLast, "keep-last", "", 0, "Keep the last X number of builds for a tag when pruning")
 	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dryrun", "", false, "Only show what would be pruned")
+	subcommands.AddConfirmFlag(pruneCmd)
 }
 
 func intersectionInSlices(list1, list2 []string) bool {
@@ -139,11 +140,19 @@ func doPrune(cmd *cobra.Command, args []string) {
 		target_names = args
 	}
 
-	fmt.Printf("Deleting targets:\n %s\n", strings.Join(target_names, "\n "))
+	sort.Strings(target_names)
+	preview := subcommands.NewPreview("Targets to delete:")
+	for _, name := range target_names {
+		preview.Remove(name)
+	}
 	if pruneDryRun {
+		preview.Print()
 		fmt.Println("Dry run, exiting")
 		return
 	}
+	if !preview.Confirm(cmd) {
+		return
+	}
 
 	jobservUrl, webUrl, err := api.TargetDeleteTargets(factory, target_names)
 	subcommands.DieNotNil(err)
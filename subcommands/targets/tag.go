@@ -3,6 +3,7 @@ package targets
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -15,6 +16,7 @@ import (
 var (
 	tagTags      string
 	tagAppend    bool
+	tagRemove    bool
 	tagNoTail    bool
 	tagByVersion bool
 )
@@ -28,16 +30,23 @@ func init() {
   fioctl targets tag --tags master,promoted --by-version 42
 
   # Tag a specific Target by name
-  fioctl targets tag --tags master,testing intel-corei7-64-lmp-42`,
+  fioctl targets tag --tags master,testing intel-corei7-64-lmp-42
+
+  # Remove the testing tag from Target #42, if it is still tagged so
+  fioctl targets tag --tags testing --remove --if-exists --by-version 42`,
 		Run:  doTag,
 		Args: cobra.MinimumNArgs(1),
 	}
 	cmd.AddCommand(tagCmd)
 	tagCmd.Flags().StringVarP(&tagTags, "tags", "T", "", "comma,separate,list")
 	tagCmd.Flags().BoolVarP(&tagAppend, "append", "", false, "Append the given tags rather than set them")
+	tagCmd.Flags().BoolVarP(&tagRemove, "remove", "", false, "Remove the given tags rather than set them")
+	tagCmd.MarkFlagsMutuallyExclusive("append", "remove")
+	subcommands.AddIfExistsFlags(tagCmd)
 	tagCmd.Flags().BoolVarP(&tagNoTail, "no-tail", "", false, "Don't tail output of CI Job")
 	tagCmd.Flags().BoolVarP(&tagByVersion, "by-version", "", false, "Apply tags to all targets matching the given version(s)")
 	tagCmd.Flags().BoolVarP(&dryRun, "dryrun", "", false, "Just show the changes that would be applied")
+	subcommands.AddConfirmFlag(tagCmd)
 }
 
 func Set(a, b []string) []string {
@@ -55,6 +64,43 @@ func Set(a, b []string) []string {
 	return unique
 }
 
+// newTags returns the tags of a target after applying the given tags. A tag to remove must be
+// one of the current tags, unless the --if-exists flag is set.
+func newTags(cmd *cobra.Command, name string, current, tags []string) []string {
+	if tagAppend {
+		return Set(current, tags)
+	} else if !tagRemove {
+		return tags
+	}
+	for _, tag := range tags {
+		if !intersectionInSlices([]string{tag}, current) && !subcommands.IfExists(cmd) {
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+				fmt.Errorf("Target %s is not tagged with %s. Use --if-exists to ignore it", name, tag)))
+		}
+	}
+	result := make([]string, 0, len(current))
+	for _, tag := range current {
+		if !intersectionInSlices([]string{tag}, tags) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// previewTagChange lists the tags removed from and added to a target.
+func previewTagChange(preview *subcommands.Preview, name string, before, after []string) {
+	for _, tag := range before {
+		if !intersectionInSlices([]string{tag}, after) {
+			preview.Remove("%s: %s", name, tag)
+		}
+	}
+	for _, tag := range after {
+		if !intersectionInSlices([]string{tag}, before) {
+			preview.Add("%s: %s", name, tag)
+		}
+	}
+}
+
 func doTag(cmd *cobra.Command, args []string) {
 	factory := viper.GetString("factory")
 	tags := strings.Split(tagTags, ",")
@@ -63,6 +109,7 @@ func doTag(cmd *cobra.Command, args []string) {
 	subcommands.DieNotNil(err)
 
 	updates := make(client.UpdateTargets)
+	currentTags := make(map[string][]string)
 
 	if tagByVersion {
 		for name, target := range targets {
@@ -71,14 +118,11 @@ func doTag(cmd *cobra.Command, args []string) {
 				fmt.Printf("ERROR: %s\n", err)
 			} else {
 				if intersectionInSlices([]string{custom.Version}, args) {
-					targetTags := tags
-					if tagAppend {
-						targetTags = Set(custom.Tags, tags)
-					}
+					targetTags := newTags(cmd, name, custom.Tags, tags)
 					updates[name] = client.UpdateTarget{
 						Custom: client.TufCustom{Tags: targetTags},
 					}
-					fmt.Printf("Changing tags of %s from %s -> %s\n", name, custom.Tags, targetTags)
+					currentTags[name] = custom.Tags
 				}
 			}
 		}
@@ -91,14 +135,11 @@ func doTag(cmd *cobra.Command, args []string) {
 			if target, ok := targets[name]; ok {
 				custom, err := api.TargetCustom(target)
 				subcommands.DieNotNil(err)
-				targetTags := tags
-				if tagAppend {
-					targetTags = Set(custom.Tags, tags)
-				}
+				targetTags := newTags(cmd, name, custom.Tags, tags)
 				updates[name] = client.UpdateTarget{
 					Custom: client.TufCustom{Tags: targetTags},
 				}
-				fmt.Printf("Changing tags of %s from %s -> %s\n", name, custom.Tags, targetTags)
+				currentTags[name] = custom.Tags
 			} else {
 				fmt.Printf("Target(%s) not found in targets.json\n", name)
 				os.Exit(1)
@@ -106,12 +147,26 @@ func doTag(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	preview := subcommands.NewPreview("Tags to change:")
+	names := make([]string, 0, len(updates))
+	for name := range updates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		previewTagChange(preview, name, currentTags[name], updates[name].Custom.Tags)
+	}
+
 	if dryRun {
+		preview.Print()
 		data, err := subcommands.MarshalIndent(updates, "  ", "  ")
 		subcommands.DieNotNil(err)
 		fmt.Println(string(data))
 		return
 	}
+	if !preview.Confirm(cmd) {
+		return
+	}
 
 	jobServUrl, webUrl, err := api.TargetUpdateTags(factory, updates)
 	subcommands.DieNotNil(err)
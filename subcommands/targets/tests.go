@@ -43,7 +43,7 @@ func timestamp(ts float32) string {
 	}
 	secs := int64(ts)
 	nsecs := int64((ts - float32(secs)) * 1e9)
-	return time.Unix(secs, nsecs).UTC().String()
+	return subcommands.FormatTimestamp(time.Unix(secs, nsecs).UTC())
 }
 
 func listAll(factory string) {
@@ -0,0 +1,279 @@
+package targets
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tuf "github.com/theupdateframework/notary/tuf/data"
+
+	"github.com/foundriesio/fioctl/client"
+	"github.com/foundriesio/fioctl/subcommands"
+)
+
+func init() {
+	verifyCmd := &cobra.Command{
+		Use:   "verify --tag=<tag> [--prod] [--target=<name>]",
+		Short: "Fetch and verify the TUF metadata of a tag the way a device does",
+		Long: `Fetch the TUF metadata served to the devices following a tag, and verify it with the same workflow
+as the TUF client of a device:
+
+1. root: update the root from the trusted root through each next version, each signed by the root keys
+   of the previous version and by its own root keys.
+2. timestamp: signed by the timestamp keys of the latest root.
+3. snapshot: matches the version and hashes listed in the timestamp, and signed by the snapshot keys.
+4. targets: matches the version listed in the snapshot, and signed by the targets keys.
+
+Each metadata must also be of the expected type and not expired. The workflow stops at the first failure,
+as a device would, and the result tells what a device would conclude about the metadata.
+
+By default, the trusted root is the first root version, as on a device provisioned with it.
+Use --trusted-root to start from the root.json of a given device instead.`,
+		Example: `
+  # Check the production metadata of the main tag:
+  fioctl targets verify --tag main --prod
+  # Check a device with the root version 3 would accept the Target lmp-42 of the devel tag:
+  fioctl targets verify --tag devel --trusted-root 3.root.json --target lmp-42`,
+		Run:  doVerify,
+		Args: cobra.NoArgs,
+	}
+	verifyCmd.Flags().StringP("tag", "", "", "The tag devices follow")
+	_ = verifyCmd.MarkFlagRequired("tag")
+	verifyCmd.Flags().BoolP("prod", "", false, "Verify the production metadata")
+	verifyCmd.Flags().StringP("trusted-root", "", "", "Path to the root.json a device trusts (default: the first root version)")
+	_ = verifyCmd.MarkFlagFilename("trusted-root")
+	verifyCmd.Flags().StringP("target", "", "", "Also check that this Target is listed in the targets metadata")
+	cmd.AddCommand(verifyCmd)
+}
+
+// tufMetaFile is an entry of the "meta" of a timestamp or snapshot metadata.
+// Hashes are hex strings, unlike those of the notary types which are base64.
+type tufMetaFile struct {
+	Version int               `json:"version"`
+	Length  int64             `json:"length"`
+	Hashes  map[string]string `json:"hashes"`
+}
+
+type tufMetaSigned struct {
+	Signed struct {
+		tuf.SignedCommon
+		Meta map[string]tufMetaFile `json:"meta"`
+	} `json:"signed"`
+}
+
+func doVerify(cmd *cobra.Command, args []string) {
+	factory := viper.GetString("factory")
+	tag, _ := cmd.Flags().GetString("tag")
+	prod, _ := cmd.Flags().GetBool("prod")
+	trustedFile, _ := cmd.Flags().GetString("trusted-root")
+	targetName, _ := cmd.Flags().GetString("target")
+	logrus.Debugf("Verifying the TUF metadata of %s for tag %s, production: %v", factory, tag, prod)
+
+	var trustedRaw []byte
+	if len(trustedFile) > 0 {
+		var err error
+		trustedRaw, err = os.ReadFile(trustedFile)
+		subcommands.DieNotNil(err)
+	}
+
+	kind := "CI"
+	if prod {
+		kind = "production"
+	}
+	fmt.Printf("Verifying the %s TUF metadata of the tag %s as a device would:\n", kind, tag)
+
+	var (
+		root              *client.AtsTufRoot
+		snapshot, targets tufMetaFile
+		targetsMeta       client.AtsTufTargets
+	)
+	steps := []struct {
+		name  string
+		check func() (string, error)
+	}{
+		{"root", func() (msg string, err error) {
+			root, msg, err = verifyTufRootUpdate(factory, tag, prod, trustedRaw)
+			return
+		}},
+		{"timestamp", func() (string, error) {
+			var timestamp tufMetaSigned
+			msg, err := verifyTufMetaFile(factory, tag, prod, root, tuf.CanonicalTimestampRole, nil, &timestamp)
+			snapshot = timestamp.Signed.Meta["snapshot.json"]
+			return msg, err
+		}},
+		{"snapshot", func() (string, error) {
+			var snapshotMeta tufMetaSigned
+			msg, err := verifyTufMetaFile(factory, tag, prod, root, tuf.CanonicalSnapshotRole, &snapshot, &snapshotMeta)
+			targets = snapshotMeta.Signed.Meta["targets.json"]
+			return msg, err
+		}},
+		{"targets", func() (string, error) {
+			return verifyTufMetaFile(factory, tag, prod, root, tuf.CanonicalTargetsRole, &targets, &targetsMeta)
+		}},
+	}
+	if len(targetName) > 0 {
+		steps = append(steps, struct {
+			name  string
+			check func() (string, error)
+		}{"target", func() (string, error) {
+			target, ok := targetsMeta.Signed.Targets[targetName]
+			if !ok {
+				return "", subcommands.WithErrorCode(subcommands.ErrorCodeNotFound,
+					fmt.Errorf("%s is not listed in the targets", targetName))
+			}
+			custom, err := api.TargetCustom(target)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s is listed, version %s, hardware IDs: %s",
+				targetName, custom.Version, strings.Join(custom.HardwareIds, ", ")), nil
+		}})
+	}
+
+	for idx, step := range steps {
+		msg, err := step.check()
+		if err != nil {
+			fmt.Printf("  %-10s FAILED: %s\n", step.name, err)
+			for _, skipped := range steps[idx+1:] {
+				fmt.Printf("  %-10s SKIPPED\n", skipped.name)
+			}
+			subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeOf(err), fmt.Errorf(
+				"A device would reject the %s TUF metadata of the tag %s: the %s check failed", kind, tag, step.name)))
+		}
+		fmt.Printf("  %-10s OK: %s\n", step.name, msg)
+	}
+	fmt.Printf("A device would accept the %s TUF metadata of the tag %s.\n", kind, tag)
+}
+
+// verifyTufRootUpdate updates the trusted root through each next root version, until there is none,
+// and returns the latest root.
+func verifyTufRootUpdate(factory, tag string, prod bool, trustedRaw []byte) (*client.AtsTufRoot, string, error) {
+	if trustedRaw == nil {
+		raw, err := api.TufMetadataGetRaw(factory, "1.root.json", tag, prod)
+		if err != nil {
+			return nil, "", fmt.Errorf("Unable to fetch the first root version: %w", err)
+		}
+		trustedRaw = *raw
+	}
+	root, err := client.VerifyTufRoot(nil, trustedRaw)
+	if err != nil {
+		return nil, "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf("Invalid trusted root: %w", err))
+	}
+	first := root.Signed.Version
+	for ver := first + 1; ; ver++ {
+		raw, err := api.TufMetadataGetRaw(factory, fmt.Sprintf("%d.root.json", ver), tag, prod)
+		if herr := client.AsHttpError(err); herr != nil && herr.Response.StatusCode == 404 {
+			break
+		} else if err != nil {
+			return nil, "", fmt.Errorf("Unable to fetch the root version %d: %w", ver, err)
+		}
+		if root, err = client.VerifyTufRoot(root, *raw); err != nil {
+			return nil, "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err)
+		}
+	}
+	if err := checkTufMetaCommon(root.Signed.SignedCommon, tuf.CanonicalRootRole); err != nil {
+		return nil, "", err
+	}
+	msg := fmt.Sprintf("version %d", root.Signed.Version)
+	if root.Signed.Version > first {
+		msg += fmt.Sprintf(", updated from version %d", first)
+	}
+	return root, msg + ", expires " + subcommands.FormatTimestamp(root.Signed.Expires), nil
+}
+
+// verifyTufMetaFile fetches the metadata of a role, verifies it against the root and the entry listing it in
+// the previous metadata, if any, and parses it into meta.
+func verifyTufMetaFile(
+	factory, tag string, prod bool, root *client.AtsTufRoot, role tuf.RoleName, expected *tufMetaFile, meta interface{},
+) (string, error) {
+	name := role.String() + ".json"
+	raw, err := api.TufMetadataGetRaw(factory, name, tag, prod)
+	if err != nil {
+		return "", fmt.Errorf("Unable to fetch %s: %w", name, err)
+	}
+	if expected != nil {
+		if expected.Version == 0 {
+			return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+				fmt.Errorf("%s is not listed in the previous metadata", name))
+		}
+		if expected.Length > 0 && int64(len(*raw)) != expected.Length {
+			return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+				fmt.Errorf("%s has %d bytes, expected %d", name, len(*raw), expected.Length))
+		}
+		if err := checkTufMetaHashes(*raw, expected.Hashes); err != nil {
+			return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if err := client.VerifyTufMetadata(root, role, *raw); err != nil {
+		return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, err)
+	}
+
+	var common struct {
+		Signed tuf.SignedCommon `json:"signed"`
+	}
+	if err := json.Unmarshal(*raw, &common); err != nil {
+		return "", fmt.Errorf("Unable to parse %s: %w", name, err)
+	}
+	if err := json.Unmarshal(*raw, meta); err != nil {
+		return "", fmt.Errorf("Unable to parse %s: %w", name, err)
+	}
+	if expected != nil && common.Signed.Version != expected.Version {
+		return "", subcommands.WithErrorCode(subcommands.ErrorCodeSigning, fmt.Errorf(
+			"%s has version %d, but version %d is listed in the previous metadata",
+			name, common.Signed.Version, expected.Version))
+	}
+	if err := checkTufMetaCommon(common.Signed, role); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("version %d, signed by the %s keys (threshold %d), expires %s",
+		common.Signed.Version, role, root.Signed.Roles[role].Threshold,
+		subcommands.FormatTimestamp(common.Signed.Expires)), nil
+}
+
+// checkTufMetaCommon checks the type and expiry of metadata, as a device does after verifying its signatures.
+func checkTufMetaCommon(signed tuf.SignedCommon, role tuf.RoleName) error {
+	if !strings.EqualFold(signed.Type, role.String()) {
+		return subcommands.WithErrorCode(subcommands.ErrorCodeSigning,
+			fmt.Errorf("Expected metadata of type %s, got %s", role, signed.Type))
+	}
+	if !signed.Expires.After(time.Now()) {
+		return subcommands.WithErrorCode(subcommands.ErrorCodeExpired, fmt.Errorf("Version %d expired on %s",
+			signed.Version, subcommands.FormatTimestamp(signed.Expires)))
+	}
+	return nil
+}
+
+// checkTufMetaHashes checks all hashes of supported algorithms match; there must be at least one if any is given.
+func checkTufMetaHashes(raw []byte, hashes map[string]string) error {
+	checked := 0
+	for alg, expected := range hashes {
+		var h hash.Hash
+		switch alg {
+		case "sha256":
+			h = sha256.New()
+		case "sha512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		h.Write(raw)
+		if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+			return fmt.Errorf("The %s hash %s does not match the expected %s", alg, actual, expected)
+		}
+		checked++
+	}
+	if len(hashes) > 0 && checked == 0 {
+		return errors.New("None of the hash algorithms is supported")
+	}
+	return nil
+}
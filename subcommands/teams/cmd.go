@@ -10,6 +10,8 @@ import (
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
+var listOutput subcommands.ListOutput
+
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "teams [<team_name>]",
@@ -18,6 +20,7 @@ func NewCommand() *cobra.Command {
 		Run:   doTeamsCommand,
 	}
 	subcommands.RequireFactory(cmd)
+	listOutput.AddFlags(cmd, "name")
 	return cmd
 }
 
@@ -36,8 +39,7 @@ func doList(api *client.Api, factory string) {
 	teams, err := api.TeamsList(factory)
 	subcommands.DieNotNil(err)
 
-	t := tabby.New()
-	t.AddHeader("NAME", "DESCRIPTION")
+	t := listOutput.NewTable("NAME", "DESCRIPTION")
 	for _, team := range teams {
 		t.AddLine(team.Name, team.Description)
 	}
@@ -10,6 +10,8 @@ import (
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
+var listOutput subcommands.ListOutput
+
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "users [<user_id>]",
@@ -18,6 +20,7 @@ func NewCommand() *cobra.Command {
 		Run:   doUserCommand,
 	}
 	subcommands.RequireFactory(cmd)
+	listOutput.AddFlags(cmd, "role,name")
 	return cmd
 }
 
@@ -36,8 +39,7 @@ func doList(api *client.Api, factory string) {
 	users, err := api.UsersList(factory)
 	subcommands.DieNotNil(err)
 
-	t := tabby.New()
-	t.AddHeader("ID", "NAME", "ROLE")
+	t := listOutput.NewTable("ID", "NAME", "ROLE")
 	for _, user := range users {
 		t.AddLine(user.PolisId, user.Name, user.Role)
 	}
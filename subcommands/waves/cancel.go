@@ -1,6 +1,8 @@
 package waves
 
 import (
+	"fmt"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -9,16 +11,20 @@ import (
 )
 
 func init() {
-	cmd.AddCommand(&cobra.Command{
+	cancelCmd := &cobra.Command{
 		Use:   "cancel <wave>",
 		Short: "Cancel a given wave by name",
 		Long: `Cancel a given wave by name.
 Once canceled a wave is no longer available as an update source for production devices.
 However, those devices that has already updated to a wave version
-will remain on that version until a new version is rolled out.`,
+will remain on that version until a new version is rolled out.
+With --if-exists, a wave which does not exist or is already canceled is left as is.`,
 		Run:  doCancelWave,
 		Args: cobra.ExactArgs(1),
-	})
+	}
+	cmd.AddCommand(cancelCmd)
+	subcommands.AddConfirmFlag(cancelCmd)
+	subcommands.AddIfExistsFlags(cancelCmd)
 }
 
 func doCancelWave(cmd *cobra.Command, args []string) {
@@ -26,5 +32,24 @@ func doCancelWave(cmd *cobra.Command, args []string) {
 	name := args[0]
 	logrus.Debugf("Canceling a wave %s for %s", name, factory)
 
-	subcommands.DieNotNil(api.FactoryCancelWave(factory, name))
+	if subcommands.IfExists(cmd) {
+		wave, err := api.FactoryGetWave(factory, name, false)
+		if !subcommands.IsNotFound(err) {
+			subcommands.DieNotNil(err)
+		}
+		if subcommands.SkipMissing(cmd, err == nil, "Wave "+name) {
+			return
+		}
+		if wave.Status == "canceled" {
+			fmt.Println("Wave", name, "is already canceled, skipping")
+			return
+		}
+	}
+
+	preview := subcommands.NewPreview("Waves to cancel:")
+	preview.Remove(name)
+	if !preview.Confirm(cmd) {
+		return
+	}
+	subcommands.DieNotNil(subcommands.IgnoreMissing(cmd, api.FactoryCancelWave(factory, name)))
 }
@@ -51,7 +51,23 @@ Example: 2020-01-01T00:00:00Z`)
 Example: 1,2,3`)
 	initCmd.Flags().StringP("keys", "k", "", "Path to <offline-creds.tgz> used to sign wave targets.")
 	initCmd.Flags().StringP("source-tag", "", "", "Match this tag when looking for target versions. Certain advanced tagging configurations may require this argument.")
-	_ = initCmd.MarkFlagRequired("keys")
+	keys.AddTufSignerFlags(initCmd)
+	subcommands.AddIfNotExistsFlag(initCmd)
+}
+
+// waveExists checks if a wave with the name exists. A wave for another version or tag
+// fails the check, as the wave to create is not the existing one.
+func waveExists(factory, name, version, tag string) bool {
+	wave, err := api.FactoryGetWave(factory, name, false)
+	if subcommands.IsNotFound(err) {
+		return false
+	}
+	subcommands.DieNotNil(err)
+	if wave.Version != version || wave.Tag != tag {
+		subcommands.DieNotNil(subcommands.WithErrorCode(subcommands.ErrorCodeConflict,
+			fmt.Errorf("Wave %s already exists for version %s and tag %s", name, wave.Version, wave.Tag)))
+	}
+	return true
 }
 
 func doInitWave(cmd *cobra.Command, args []string) {
@@ -63,6 +79,9 @@ func doInitWave(cmd *cobra.Command, args []string) {
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 	prune, _ := cmd.Flags().GetStringSlice("prune")
 	sourceTag, _ := cmd.Flags().GetString("source-tag")
+	if subcommands.IfNotExists(cmd) && subcommands.SkipExisting(cmd, waveExists(factory, name, version, tag), "Wave "+name) {
+		return
+	}
 	offlineKeys := readOfflineKeys(cmd)
 
 	logrus.Debugf("Creating a wave %s for factory %s targets version %s and new tag %s expires %s",
@@ -220,7 +239,7 @@ func readExpiration(cmd *cobra.Command) (expires time.Time) {
 
 func readOfflineKeys(cmd *cobra.Command) keys.OfflineCreds {
 	offlineKeysFile, _ := cmd.Flags().GetString("keys")
-	offlineKeys, err := keys.GetOfflineCreds(offlineKeysFile)
+	offlineKeys, err := keys.GetSigningCreds(offlineKeysFile)
 	subcommands.DieNotNil(err, "Failed to open offline keys file")
 	return offlineKeys
 }
@@ -1,7 +1,6 @@
 package waves
 
 import (
-	"github.com/cheynewallace/tabby"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -9,6 +8,8 @@ import (
 	"github.com/foundriesio/fioctl/subcommands"
 )
 
+var listOutput subcommands.ListOutput
+
 func init() {
 	listCmd := &cobra.Command{
 		Use:   "list",
@@ -18,6 +19,7 @@ func init() {
 	cmd.AddCommand(listCmd)
 	listCmd.Flags().Uint64P("limit", "n", 20, "Limit the number of results displayed.")
 	listCmd.Flags().IntP("page", "p", 1, "Page of waves to display when pagination is needed")
+	listOutput.AddFlags(listCmd, "created-at")
 }
 
 func doListWaves(cmd *cobra.Command, args []string) {
@@ -29,8 +31,7 @@ func doListWaves(cmd *cobra.Command, args []string) {
 	lst, err := api.FactoryListWaves(factory, limit, showPage)
 	subcommands.DieNotNil(err)
 
-	t := tabby.New()
-	t.AddHeader("NAME", "VERSION", "TAG", "STATUS", "CREATED AT", "FINISHED AT")
+	t := listOutput.NewTable("NAME", "VERSION", "TAG", "STATUS", "CREATED AT", "FINISHED AT")
 	for _, wave := range lst.Waves {
 		t.AddLine(
 			wave.Name,
@@ -42,5 +43,5 @@ func doListWaves(cmd *cobra.Command, args []string) {
 		)
 	}
 	t.Print()
-	subcommands.ShowPages(showPage, lst.Next)
+	listOutput.ShowPages(showPage, lst.Next)
 }
@@ -37,7 +37,7 @@ func doShowWave(cmd *cobra.Command, args []string) {
 	fmt.Printf("Tag: \t\t%s\n", wave.Tag)
 	fmt.Printf("Status: \t%s\n", wave.Status)
 
-	fmt.Printf("Created At: \t%s\n", wave.ChangeMeta.CreatedAt)
+	fmt.Printf("Created At: \t%s\n", subcommands.FormatTime(wave.ChangeMeta.CreatedAt))
 	if len(wave.ChangeMeta.CreatedBy) > 0 {
 		fmt.Printf("Created By: \t%s\n", wave.ChangeMeta.CreatedBy)
 	}
@@ -55,7 +55,7 @@ func doShowWave(cmd *cobra.Command, args []string) {
 				// A group has been deleted, only a reference still exists - we cannot track down a name
 				groupName = "<deleted group>"
 			}
-			line := fmt.Sprintf(formatLine, ref.CreatedAt, groupName)
+			line := fmt.Sprintf(formatLine, subcommands.FormatTime(ref.CreatedAt), groupName)
 			if len(ref.CreatedBy) > 0 {
 				line += " by " + ref.CreatedBy
 			}
@@ -63,7 +63,7 @@ func doShowWave(cmd *cobra.Command, args []string) {
 		}
 	}
 	if wave.ChangeMeta.UpdatedAt != "" {
-		fmt.Printf("Finished At: \t%s\n", wave.ChangeMeta.UpdatedAt)
+		fmt.Printf("Finished At: \t%s\n", subcommands.FormatTime(wave.ChangeMeta.UpdatedAt))
 	}
 	if wave.ChangeMeta.UpdatedBy != "" {
 		fmt.Printf("Finished By: \t%s\n", wave.ChangeMeta.UpdatedBy)
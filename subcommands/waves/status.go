@@ -76,9 +76,9 @@ func doShowWaveStatus(cmd *cobra.Command, args []string) {
 		fmt.Println("A device information is shown for a current time, not for a time when a wave was finished")
 		fmt.Println()
 	}
-	fmt.Printf("Created At: \t%s\n", status.CreatedAt)
+	fmt.Printf("Created At: \t%s\n", subcommands.FormatTime(status.CreatedAt))
 	if status.FinishedAt != "" {
-		fmt.Printf("Finished At: \t%s\n", status.FinishedAt)
+		fmt.Printf("Finished At: \t%s\n", subcommands.FormatTime(status.FinishedAt))
 	}
 
 	t := subcommands.Tabby(0)
@@ -104,7 +104,7 @@ func doShowWaveStatus(cmd *cobra.Command, args []string) {
 		for _, group := range status.RolloutGroups {
 			t.AddLine(
 				group.Name, group.DevicesTotal, group.DevicesOnWave+group.DevicesOnNewer,
-				group.DevicesOnOlder, group.DevicesOnline, group.RolloutAt)
+				group.DevicesOnOlder, group.DevicesOnline, subcommands.FormatTime(group.RolloutAt))
 		}
 		for _, group := range status.OtherGroups {
 			if group.Name == "" {